@@ -7,13 +7,11 @@ import (
 	"os/signal"
 	"syscall"
 
-	"gtask/internal/backend/googletasks"
 	"gtask/internal/cli"
 	"gtask/internal/commands"
-	"gtask/internal/config"
-	"gtask/internal/service"
 
-	// Import all command packages to register them via init()
+	// Import all backend and command packages to register them via init()
+	_ "gtask/internal/backend/all"
 	_ "gtask/internal/commands"
 )
 
@@ -30,13 +28,8 @@ func main() {
 		cancel()
 	}()
 
-	// Create service factory
-	factory := func(ctx context.Context, cfg *config.Config) (service.Service, error) {
-		return googletasks.New(ctx, cfg)
-	}
-
-	// Create dispatcher
-	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, factory)
+	// Create dispatcher; the backend comes from the backend registry
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, nil)
 
 	// Run and exit with code
 	code := dispatcher.Run(ctx, os.Args[1:], os.Stdout, os.Stderr)
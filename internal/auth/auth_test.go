@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"golang.org/x/oauth2"
+
+	"gtask/internal/config"
+)
+
+func TestFileStore_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "token.json")
+	store := NewFileStore(path)
+
+	if _, err := store.Load(); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("expected ErrNoToken, got %v", err)
+	}
+
+	want := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer"}
+	if err := store.Save(want); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got.AccessToken != want.AccessToken || got.RefreshToken != want.RefreshToken {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat failed: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+		}
+	}
+
+	if err := store.Delete(); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := store.Load(); !errors.Is(err, ErrNoToken) {
+		t.Errorf("expected ErrNoToken after delete, got %v", err)
+	}
+	if err := store.Delete(); err != nil {
+		t.Errorf("deleting a missing token should succeed, got %v", err)
+	}
+}
+
+func TestFileStore_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path).Load(); err == nil || errors.Is(err, ErrNoToken) {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
+
+// memStore is an in-memory TokenStore counting saves.
+type memStore struct {
+	token *oauth2.Token
+	saves int
+	err   error
+}
+
+func (s *memStore) Load() (*oauth2.Token, error) {
+	if s.token == nil {
+		return nil, ErrNoToken
+	}
+	return s.token, nil
+}
+
+func (s *memStore) Save(token *oauth2.Token) error {
+	s.saves++
+	if s.err != nil {
+		return s.err
+	}
+	s.token = token
+	return nil
+}
+
+func (s *memStore) Delete() error {
+	s.token = nil
+	return nil
+}
+
+// sequence returns its tokens in order, repeating the last one.
+type sequence []*oauth2.Token
+
+func (q *sequence) Token() (*oauth2.Token, error) {
+	t := (*q)[0]
+	if len(*q) > 1 {
+		*q = (*q)[1:]
+	}
+	return t, nil
+}
+
+func TestPersistingTokenSource_SavesOnlyRefreshedTokens(t *testing.T) {
+	current := &oauth2.Token{AccessToken: "old", RefreshToken: "refresh"}
+	refreshed := &oauth2.Token{AccessToken: "new", RefreshToken: "refresh"}
+	base := &sequence{current, refreshed}
+	store := &memStore{token: current}
+
+	ts := NewPersistingTokenSource(base, store, current)
+	for i := 0; i < 3; i++ {
+		if _, err := ts.Token(); err != nil {
+			t.Fatalf("token failed: %v", err)
+		}
+	}
+
+	if store.saves != 1 {
+		t.Errorf("expected 1 save, got %d", store.saves)
+	}
+	if store.token.AccessToken != "new" {
+		t.Errorf("expected refreshed token to be stored, got %q", store.token.AccessToken)
+	}
+}
+
+func TestPersistingTokenSource_SaveErrorDoesNotFailRequest(t *testing.T) {
+	base := &sequence{{AccessToken: "new"}}
+	store := &memStore{err: errors.New("disk full")}
+
+	ts := NewPersistingTokenSource(base, store, &oauth2.Token{AccessToken: "old"})
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatalf("token failed: %v", err)
+	}
+	if token.AccessToken != "new" || store.saves != 1 {
+		t.Errorf("expected one attempted save of the new token, got %q after %d saves", token.AccessToken, store.saves)
+	}
+}
+
+func TestReadOnly_UnreadableScopesFile(t *testing.T) {
+	cfg := &config.Config{Dir: t.TempDir()}
+	if ReadOnly(cfg) {
+		t.Error("a login without recorded scopes should have full access")
+	}
+
+	// A directory in place of the file cannot be read
+	if err := os.Mkdir(cfg.ScopesPath(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if !ReadOnly(cfg) {
+		t.Error("expected an unreadable scopes file to count as read-only")
+	}
+}
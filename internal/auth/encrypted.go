@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+
+	"gtask/internal/fsutil"
+)
+
+const (
+	// kdfPBKDF2 names the key derivation recorded in encrypted files.
+	kdfPBKDF2 = "pbkdf2-sha256"
+
+	// DefaultIterations is the PBKDF2 iteration count for new files.
+	DefaultIterations = 600000
+
+	saltSize = 16
+	keySize  = 32 // AES-256
+)
+
+// envelope is the on-disk format of an encrypted token. Byte slices are
+// base64 in JSON.
+type envelope struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// EncryptedStore keeps a token encrypted with AES-256-GCM under a key
+// derived from a passphrase with PBKDF2-SHA256. The plaintext token only
+// exists in memory. Like FileStore, writes are atomic and locked.
+type EncryptedStore struct {
+	path       string
+	passphrase PassphraseFunc
+
+	// Iterations for PBKDF2 when creating a file (default
+	// DefaultIterations). Existing files record their own count.
+	Iterations int
+
+	// The derived key is cached so that a load followed by a save (after
+	// a token refresh) derives it once.
+	mu         sync.Mutex
+	salt       []byte
+	iterations int
+	key        []byte
+}
+
+// NewEncryptedStore creates a store for the encrypted token file at path.
+// passphrase is only called when the token is loaded or saved.
+func NewEncryptedStore(path string, passphrase PassphraseFunc) *EncryptedStore {
+	return &EncryptedStore{path: path, passphrase: passphrase}
+}
+
+// Path returns the encrypted token file path.
+func (s *EncryptedStore) Path() string {
+	return s.path
+}
+
+// Unlock fetches the passphrase without touching the token file, so that
+// a missing passphrase is reported before an interactive login.
+func (s *EncryptedStore) Unlock() error {
+	if s.passphrase == nil {
+		return fmt.Errorf("no token passphrase configured")
+	}
+	_, err := s.passphrase()
+	return err
+}
+
+// Load implements TokenStore.
+func (s *EncryptedStore) Load() (*oauth2.Token, error) {
+	name := filepath.Base(s.path)
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if env.Version != 1 || env.KDF != kdfPBKDF2 || env.Iterations < 1 || len(env.Salt) == 0 {
+		return nil, fmt.Errorf("invalid %s: unsupported format", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, err := s.deriveKey(env.Salt, env.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid %s: bad nonce", name)
+	}
+	plain, err := aead.Open(nil, env.Nonce, env.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s (wrong passphrase?)", name)
+	}
+
+	var token oauth2.Token
+	if err := json.Unmarshal(plain, &token); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return &token, nil
+}
+
+// Save implements TokenStore.
+func (s *EncryptedStore) Save(token *oauth2.Token) error {
+	plain, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	salt, iterations := s.salt, s.iterations
+	if salt == nil {
+		salt = make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		iterations = s.Iterations
+		if iterations <= 0 {
+			iterations = DefaultIterations
+		}
+	}
+	key, err := s.deriveKey(salt, iterations)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(envelope{
+		Version:    1,
+		KDF:        kdfPBKDF2,
+		Iterations: iterations,
+		Salt:       salt,
+		Nonce:      nonce,
+		Data:       aead.Seal(nil, nonce, plain, nil),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	unlock, err := fsutil.Lock(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", filepath.Base(s.path), err)
+	}
+	defer unlock()
+	return fsutil.WriteFileAtomic(s.path, data, 0600)
+}
+
+// Delete implements TokenStore. It needs no passphrase.
+func (s *EncryptedStore) Delete() error {
+	return NewFileStore(s.path).Delete()
+}
+
+// deriveKey returns the key for salt and iterations, reusing the cached
+// key if they match. s.mu must be held.
+func (s *EncryptedStore) deriveKey(salt []byte, iterations int) ([]byte, error) {
+	if s.key != nil && string(s.salt) == string(salt) && s.iterations == iterations {
+		return s.key, nil
+	}
+	if s.passphrase == nil {
+		return nil, fmt.Errorf("no token passphrase configured")
+	}
+	pass, err := s.passphrase()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(s.path), err)
+	}
+	key, err := pbkdf2.Key(sha256.New, string(pass), salt, iterations, keySize)
+	if err != nil {
+		return nil, err
+	}
+	s.salt, s.iterations, s.key = salt, iterations, key
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+
+	"gtask/internal/config"
+)
+
+// fixed returns a passphrase source counting its calls.
+func fixed(pass string, calls *int) PassphraseFunc {
+	return func() ([]byte, error) {
+		*calls++
+		return []byte(pass), nil
+	}
+}
+
+func newTestStore(path, pass string, calls *int) *EncryptedStore {
+	s := NewEncryptedStore(path, fixed(pass, calls))
+	s.Iterations = 1000
+	return s
+}
+
+func TestEncryptedStore_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.enc")
+	calls := 0
+	store := newTestStore(path, "secret", &calls)
+
+	if _, err := store.Load(); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("expected ErrNoToken, got %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("passphrase should not be needed for a missing file, got %d calls", calls)
+	}
+
+	token := &oauth2.Token{AccessToken: "access-123", RefreshToken: "refresh-456"}
+	if err := store.Save(token); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("refresh-456")) || bytes.Contains(data, []byte("access-123")) {
+		t.Errorf("token stored in plaintext: %s", data)
+	}
+	if runtime.GOOS != "windows" {
+		info, _ := os.Stat(path)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+		}
+	}
+
+	// A fresh store (as in the next process) decrypts it
+	got, err := newTestStore(path, "secret", &calls).Load()
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got.RefreshToken != "refresh-456" || got.AccessToken != "access-123" {
+		t.Errorf("unexpected token: %+v", got)
+	}
+
+	// Saving again reuses the derived key
+	before := calls
+	if err := store.Save(&oauth2.Token{AccessToken: "access-789", RefreshToken: "refresh-456"}); err != nil {
+		t.Fatalf("second save failed: %v", err)
+	}
+	if calls != before {
+		t.Errorf("expected cached key, passphrase fetched %d more times", calls-before)
+	}
+}
+
+func TestEncryptedStore_WrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.enc")
+	calls := 0
+	if err := newTestStore(path, "secret", &calls).Save(&oauth2.Token{RefreshToken: "r"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := newTestStore(path, "wrong", &calls).Load()
+	if err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("expected wrong passphrase error, got %v", err)
+	}
+}
+
+func TestEncryptedStore_NoPassphrase(t *testing.T) {
+	store := NewEncryptedStore(filepath.Join(t.TempDir(), "token.enc"), nil)
+	if err := store.Save(&oauth2.Token{RefreshToken: "r"}); err == nil {
+		t.Error("expected error without a passphrase")
+	}
+	if err := store.Unlock(); err == nil {
+		t.Error("expected Unlock to fail without a passphrase")
+	}
+}
+
+func TestNewPassphrase_Sources(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pass")
+	if err := os.WriteFile(file, []byte("from-file\nignored\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		env      string
+		settings config.Settings
+		want     string
+		wantErr  string
+	}{
+		{name: "env", env: "from-env", settings: config.Settings{PassphraseFile: file}, want: "from-env"},
+		{name: "file", settings: config.Settings{PassphraseFile: file, PassphraseCommand: "echo cmd"}, want: "from-file"},
+		{name: "command", settings: config.Settings{PassphraseCommand: "echo from-command"}, want: "from-command"},
+		{name: "none", wantErr: "no token passphrase configured"},
+		{name: "missing file", settings: config.Settings{PassphraseFile: filepath.Join(dir, "nope")}, wantErr: "passphrase_file"},
+		{name: "empty command", settings: config.Settings{PassphraseCommand: "true"}, wantErr: "empty passphrase"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if runtime.GOOS == "windows" && tt.settings.PassphraseCommand != "" {
+				t.Skip("uses sh")
+			}
+			t.Setenv(PassphraseEnv, tt.env)
+			got, err := NewPassphrase(&tt.settings)()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	plain := NewFileStore(filepath.Join(dir, "token.json"))
+	calls := 0
+	enc := newTestStore(filepath.Join(dir, "token.enc"), "secret", &calls)
+
+	if err := Migrate(plain, enc); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("expected ErrNoToken, got %v", err)
+	}
+
+	if err := plain.Save(&oauth2.Token{AccessToken: "a", RefreshToken: "r"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(plain, enc); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if _, err := os.Stat(plain.Path()); !os.IsNotExist(err) {
+		t.Error("plaintext token should be deleted")
+	}
+	if got, err := enc.Load(); err != nil || got.RefreshToken != "r" {
+		t.Errorf("expected migrated token, got %+v, %v", got, err)
+	}
+
+	// And back
+	if err := Migrate(enc, plain); err != nil {
+		t.Fatalf("migrate back failed: %v", err)
+	}
+	if got, err := plain.Load(); err != nil || got.RefreshToken != "r" {
+		t.Errorf("expected decrypted token, got %+v, %v", got, err)
+	}
+	if _, err := os.Stat(enc.Path()); !os.IsNotExist(err) {
+		t.Error("encrypted token should be deleted")
+	}
+}
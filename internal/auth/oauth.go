@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"gtask/internal/config"
+)
+
+// OAuth client types, from the top-level key of oauth_client.json.
+const (
+	ClientDesktop = "desktop"
+	ClientWeb     = "web"
+)
+
+// OAuthConfig reads oauth_client.json for cfg and requests scopes.
+func OAuthConfig(cfg *config.Config, scopes ...string) (*oauth2.Config, error) {
+	data, err := readClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	oauthConfig, err := google.ConfigFromJSON(data, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid oauth_client.json: %w", err)
+	}
+	return oauthConfig, nil
+}
+
+// ClientType reports whether oauth_client.json holds a desktop app
+// ("installed") or a web application client. Only desktop clients accept
+// the localhost redirect used by login.
+func ClientType(cfg *config.Config) (string, error) {
+	data, err := readClient(cfg)
+	if err != nil {
+		return "", err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return "", fmt.Errorf("invalid oauth_client.json: %w", err)
+	}
+	if _, ok := keys["installed"]; ok {
+		return ClientDesktop, nil
+	}
+	if _, ok := keys["web"]; ok {
+		return ClientWeb, nil
+	}
+	return "", fmt.Errorf("invalid oauth_client.json: no installed or web client")
+}
+
+func readClient(cfg *config.Config) ([]byte, error) {
+	data, err := os.ReadFile(cfg.OAuthClientPath())
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("oauth_client.json not found in %s", cfg.Dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read oauth_client.json: %w", err)
+	}
+	return data, nil
+}
+
+// Preflight checks the files an OAuth backend needs before it is opened:
+// the OAuth client and a token in the configured store. Errors name the
+// command that fixes them.
+func Preflight(cfg *config.Config) error {
+	if !cfg.HasOAuthClient() {
+		return fmt.Errorf("oauth_client.json not found in %s", cfg.Dir)
+	}
+	if !cfg.HasToken() {
+		// A plaintext token is not used once encryption is enabled
+		if cfg.Settings.TokenStore == config.TokenStoreEncrypted && fileExists(cfg.TokenPath()) {
+			return fmt.Errorf("%s is not encrypted (run: %s)", config.TokenFile, cfg.ProfileCommand("auth migrate"))
+		}
+		return fmt.Errorf("not logged in (run: %s)", cfg.ProfileCommand("login"))
+	}
+	return nil
+}
+
+// Refresh loads the token of cfg and makes sure it is usable: it must have
+// a refresh token, and an expired access token (any access token if force
+// is set) is refreshed with the OAuth client and saved. It returns the
+// stored token and the current one.
+func Refresh(ctx context.Context, cfg *config.Config, force bool) (stored, current *oauth2.Token, err error) {
+	store := NewStore(cfg)
+	stored, err = store.Load()
+	if err == ErrNoToken {
+		return nil, nil, fmt.Errorf("not logged in (run: %s)", cfg.ProfileCommand("login"))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if stored.RefreshToken == "" {
+		return stored, nil, fmt.Errorf("token has no refresh token (run: %s)", cfg.ProfileCommand("login"))
+	}
+
+	oauthConfig, err := OAuthConfig(cfg, Scopes(cfg)...)
+	if err != nil {
+		return stored, nil, err
+	}
+
+	start := *stored
+	if force {
+		// An expired copy makes the token source refresh
+		start.Expiry = time.Now().Add(-time.Minute)
+	}
+	ts := NewPersistingTokenSource(oauthConfig.TokenSource(ctx, &start), store, stored)
+	current, err = ts.Token()
+	if err != nil {
+		return stored, nil, fmt.Errorf("token refresh failed: %w", err)
+	}
+	return stored, current, nil
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+
+	"gtask/internal/config"
+)
+
+// PassphraseEnv holds the passphrase of the encrypted token store. It takes
+// precedence over the passphrase_file and passphrase_command settings.
+const PassphraseEnv = "GTASK_TOKEN_PASSPHRASE"
+
+// PassphraseFunc returns the passphrase of the encrypted token store.
+type PassphraseFunc func() ([]byte, error)
+
+// NewPassphrase returns the passphrase source configured in s: the
+// GTASK_TOKEN_PASSPHRASE variable, else the first line of passphrase_file,
+// else the first line printed by passphrase_command (run by the shell, so
+// e.g. "pass show gtask" works). The result is cached, so a command runs
+// at most once per process.
+func NewPassphrase(s *config.Settings) PassphraseFunc {
+	var (
+		once sync.Once
+		pass []byte
+		err  error
+	)
+	return func() ([]byte, error) {
+		once.Do(func() {
+			pass, err = readPassphrase(s.PassphraseFile, s.PassphraseCommand)
+		})
+		return pass, err
+	}
+}
+
+func readPassphrase(file, command string) ([]byte, error) {
+	var (
+		out    []byte
+		err    error
+		source string
+	)
+	switch {
+	case os.Getenv(PassphraseEnv) != "":
+		return []byte(os.Getenv(PassphraseEnv)), nil
+	case file != "":
+		source = "passphrase_file"
+		out, err = os.ReadFile(file)
+	case command != "":
+		source = "passphrase_command"
+		out, err = shellCommand(command).Output()
+	default:
+		return nil, fmt.Errorf("no token passphrase configured (set %s, passphrase_file or passphrase_command)", PassphraseEnv)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	line, _, _ := bytes.Cut(out, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if len(line) == 0 {
+		return nil, fmt.Errorf("%s: empty passphrase", source)
+	}
+	return line, nil
+}
+
+// shellCommand runs command through the system shell. Stdin and stderr
+// stay attached so that tools like pass can prompt for a PIN.
+func shellCommand(command string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	return cmd
+}
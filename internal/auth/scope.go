@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"gtask/internal/config"
+)
+
+// OAuth scopes for Google Tasks.
+const (
+	// TasksScope allows reading and changing tasks.
+	TasksScope = "https://www.googleapis.com/auth/tasks"
+
+	// TasksReadOnlyScope only allows reading tasks (gtask login --readonly).
+	TasksReadOnlyScope = "https://www.googleapis.com/auth/tasks.readonly"
+)
+
+// LoginScopes returns the scopes login requests.
+func LoginScopes(readOnly bool) []string {
+	if readOnly {
+		return []string{TasksReadOnlyScope}
+	}
+	return []string{TasksScope}
+}
+
+// GrantedScopes returns the scopes the token endpoint reported for token,
+// or requested if it reported none. Users may grant fewer scopes than
+// requested.
+func GrantedScopes(token *oauth2.Token, requested []string) []string {
+	if s, ok := token.Extra("scope").(string); ok && strings.TrimSpace(s) != "" {
+		return strings.Fields(s)
+	}
+	return requested
+}
+
+// CanReadTasks reports whether scopes include access to Google Tasks.
+func CanReadTasks(scopes []string) bool {
+	return slices.Contains(scopes, TasksScope) || slices.Contains(scopes, TasksReadOnlyScope)
+}
+
+// Scopes returns the scopes recorded at login for cfg. Logins from before
+// scopes were recorded have full access. If the recorded scopes cannot be
+// read, the login is taken as read-only, so that changes are refused up
+// front rather than by the API.
+func Scopes(cfg *config.Config) []string {
+	scopes, err := cfg.SavedScopes()
+	if err != nil {
+		return []string{TasksReadOnlyScope}
+	}
+	if len(scopes) == 0 {
+		return []string{TasksScope}
+	}
+	return scopes
+}
+
+// ReadOnly reports whether the login of cfg cannot change tasks.
+func ReadOnly(cfg *config.Config) bool {
+	return !slices.Contains(Scopes(cfg), TasksScope)
+}
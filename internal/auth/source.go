@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// persistingSource writes every new token obtained from base to a store.
+type persistingSource struct {
+	base  oauth2.TokenSource
+	store TokenStore
+
+	mu   sync.Mutex
+	last string // access token last saved or loaded
+}
+
+// NewPersistingTokenSource wraps base, typically an auto-refreshing
+// oauth2.Config.TokenSource, and saves each refreshed token to store, so
+// the next process starts from a valid access token instead of
+// refreshing again. current is the token base started from.
+//
+// A failed save does not fail the request; the next process just
+// refreshes again.
+func NewPersistingTokenSource(base oauth2.TokenSource, store TokenStore, current *oauth2.Token) oauth2.TokenSource {
+	s := &persistingSource{base: base, store: store}
+	if current != nil {
+		s.last = current.AccessToken
+	}
+	return s
+}
+
+// Token implements oauth2.TokenSource.
+func (s *persistingSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.last {
+		s.last = token.AccessToken
+		_ = s.store.Save(token)
+	}
+	return token, nil
+}
@@ -0,0 +1,171 @@
+// Package auth stores OAuth tokens and keeps them current.
+//
+// Token storage goes through the TokenStore interface so that the Google
+// client, login and logout do not depend on where tokens live. NewStore
+// picks the store for a config directory.
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/oauth2"
+
+	"gtask/internal/config"
+	"gtask/internal/fsutil"
+)
+
+// ErrNoToken is returned by TokenStore.Load when no token is stored.
+var ErrNoToken = errors.New("no token")
+
+// TokenStore loads and saves the OAuth token of one account.
+type TokenStore interface {
+	// Load returns the stored token, or ErrNoToken.
+	Load() (*oauth2.Token, error)
+
+	// Save replaces the stored token.
+	Save(token *oauth2.Token) error
+
+	// Delete removes the stored token. Deleting a missing token is not
+	// an error.
+	Delete() error
+}
+
+// NewStore returns the token store selected by the token_store setting:
+// token.json in the config directory, or token.enc if "encrypted".
+func NewStore(cfg *config.Config) TokenStore {
+	if cfg.Settings.TokenStore == config.TokenStoreEncrypted {
+		return NewEncryptedStore(cfg.EncryptedTokenPath(), NewPassphrase(&cfg.Settings))
+	}
+	return NewFileStore(cfg.TokenPath())
+}
+
+// OtherStore returns the store that NewStore does not select, i.e. the
+// one tokens are migrated from.
+func OtherStore(cfg *config.Config) TokenStore {
+	if cfg.Settings.TokenStore == config.TokenStoreEncrypted {
+		return NewFileStore(cfg.TokenPath())
+	}
+	return NewEncryptedStore(cfg.EncryptedTokenPath(), NewPassphrase(&cfg.Settings))
+}
+
+// Migrate moves the token from one store to another. The source is only
+// deleted once the token reads back from the destination. It returns
+// ErrNoToken if from holds no token.
+func Migrate(from, to TokenStore) error {
+	token, err := from.Load()
+	if err != nil {
+		return err
+	}
+	if err := to.Save(token); err != nil {
+		return err
+	}
+	saved, err := to.Load()
+	if err != nil {
+		return err
+	}
+	if saved.AccessToken != token.AccessToken || saved.RefreshToken != token.RefreshToken {
+		return fmt.Errorf("migrated token does not match")
+	}
+	return from.Delete()
+}
+
+// DeleteAll removes the token from both stores, so that nothing is left
+// behind after token_store was changed, and the recorded scopes. It
+// reports whether any token existed.
+func DeleteAll(cfg *config.Config) (bool, error) {
+	if err := os.Remove(cfg.ScopesPath()); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	found := false
+	for _, path := range []string{cfg.TokenPath(), cfg.EncryptedTokenPath()} {
+		if !fileExists(path) {
+			continue
+		}
+		found = true
+		if err := NewFileStore(path).Delete(); err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+// FileStore keeps a token as JSON in a file with mode 0600. Writes are
+// atomic and serialized with a lock file, so concurrent gtask processes
+// refreshing the same token never leave a torn file behind.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore creates a store for the token file at path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Path returns the token file path.
+func (s *FileStore) Path() string {
+	return s.path
+}
+
+// Load implements TokenStore.
+func (s *FileStore) Load() (*oauth2.Token, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(s.path), err)
+	}
+
+	var token oauth2.Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filepath.Base(s.path), err)
+	}
+	return &token, nil
+}
+
+// Save implements TokenStore.
+func (s *FileStore) Save(token *oauth2.Token) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	unlock, err := fsutil.Lock(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", filepath.Base(s.path), err)
+	}
+	defer unlock()
+	return fsutil.WriteFileAtomic(s.path, data, 0600)
+}
+
+// Delete implements TokenStore.
+func (s *FileStore) Delete() error {
+	if !fileExists(s.path) {
+		return nil
+	}
+
+	unlock, err := fsutil.Lock(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", filepath.Base(s.path), err)
+	}
+	defer unlock()
+
+	err = os.Remove(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,11 @@
+// Package all imports every backend package so they register themselves
+// with backend.DefaultRegistry.
+package all
+
+import (
+	_ "gtask/internal/backend/caldav"
+	_ "gtask/internal/backend/googletasks"
+	_ "gtask/internal/backend/local"
+	_ "gtask/internal/backend/multi"
+	_ "gtask/internal/backend/todotxt"
+)
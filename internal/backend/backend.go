@@ -0,0 +1,151 @@
+// Package backend holds the registry of task storage backends.
+//
+// Each backend package registers itself in init(), like commands do, and
+// the dispatcher opens the backend selected by Config.Backend. Adding a
+// backend only requires a new package and an import in backend/all.
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gtask/internal/cache"
+	"gtask/internal/config"
+	"gtask/internal/outbox"
+	"gtask/internal/service"
+)
+
+// Backend describes a task storage backend.
+type Backend struct {
+	// Name selects the backend (--backend <name>).
+	Name string
+
+	// Synopsis is a one-line description for `gtask backend`.
+	Synopsis string
+
+	// NeedsOAuth reports whether the backend authenticates with
+	// `gtask login` (oauth_client.json and token.json).
+	NeedsOAuth bool
+
+	// ConfigFile is the backend's own JSON config file in the config
+	// directory, or "" if it has none. See ReadConfig.
+	ConfigFile string
+
+	// Remote backends are served through the cache and the offline outbox.
+	Remote bool
+
+	// New opens the backend.
+	New func(ctx context.Context, cfg *config.Config) (service.Service, error)
+}
+
+// Registry holds registered backends.
+type Registry struct {
+	mu       sync.RWMutex
+	backends map[string]Backend
+}
+
+// NewRegistry creates a new backend registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		backends: make(map[string]Backend),
+	}
+}
+
+// Register adds a backend to the registry.
+// Returns an error if the name is already registered.
+func (r *Registry) Register(b Backend) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.backends[b.Name]; exists {
+		return fmt.Errorf("backend already registered: %s", b.Name)
+	}
+	r.backends[b.Name] = b
+	return nil
+}
+
+// Find looks up a backend by name.
+func (r *Registry) Find(name string) (Backend, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	b, ok := r.backends[name]
+	return b, ok
+}
+
+// All returns all backends sorted by name.
+func (r *Registry) All() []Backend {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]Backend, 0, len(r.backends))
+	for _, b := range r.backends {
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Names returns the registered backend names, comma-separated.
+func (r *Registry) Names() string {
+	var names []string
+	for _, b := range r.All() {
+		names = append(names, b.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Open opens the backend selected by cfg.Backend. Remote backends are
+// wrapped in the cache, with the offline outbox on top, except while
+// recording or replaying a cassette: then every call must reach the API,
+// and the cache and outbox of the profile are left alone.
+// Open has the signature of cli.ServiceFactory.
+func (r *Registry) Open(ctx context.Context, cfg *config.Config) (service.Service, error) {
+	b, ok := r.Find(cfg.Backend)
+	if !ok {
+		return nil, fmt.Errorf("unknown backend: %s", cfg.Backend)
+	}
+	svc, err := b.New(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if b.Remote && cfg.Record == "" && cfg.Replay == "" {
+		svc = outbox.New(cache.New(svc, cfg), cfg)
+	}
+	return svc, nil
+}
+
+// DefaultRegistry is the global backend registry.
+var DefaultRegistry = NewRegistry()
+
+// Register adds a backend to the default registry.
+func Register(b Backend) {
+	if err := DefaultRegistry.Register(b); err != nil {
+		panic(err)
+	}
+}
+
+// ReadConfig decodes the JSON config file named file in the config
+// directory into v. Unknown keys are rejected so typos do not go unnoticed.
+func ReadConfig(cfg *config.Config, file string, v any) error {
+	data, err := os.ReadFile(filepath.Join(cfg.Dir, file))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s not found in %s", file, cfg.Dir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %w", file, err)
+	}
+	return nil
+}
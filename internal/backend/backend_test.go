@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gtask/internal/config"
+	"gtask/internal/outbox"
+	"gtask/internal/service"
+	"gtask/internal/testutil"
+)
+
+func fakeBackend(name string, remote bool) Backend {
+	return Backend{
+		Name:   name,
+		Remote: remote,
+		New: func(ctx context.Context, cfg *config.Config) (service.Service, error) {
+			return testutil.NewFakeService(), nil
+		},
+	}
+}
+
+func TestRegistry_RegisterAndFind(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(fakeBackend("b", false)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(fakeBackend("a", false)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(fakeBackend("a", true)); err == nil {
+		t.Error("expected error for duplicate name")
+	}
+
+	if _, ok := r.Find("a"); !ok {
+		t.Error("expected to find backend a")
+	}
+	if _, ok := r.Find("c"); ok {
+		t.Error("expected not to find backend c")
+	}
+	if got := r.Names(); got != "a, b" {
+		t.Errorf("expected sorted names, got %q", got)
+	}
+}
+
+func TestRegistry_Open(t *testing.T) {
+	r := NewRegistry()
+	r.Register(fakeBackend("file", false))
+	r.Register(fakeBackend("net", true))
+	ctx := context.Background()
+	cfg := &config.Config{Dir: t.TempDir(), CacheDir: t.TempDir()}
+
+	cfg.Backend = "file"
+	svc, err := r.Open(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := svc.(*testutil.FakeService); !ok {
+		t.Errorf("expected local backend to be unwrapped, got %T", svc)
+	}
+
+	cfg.Backend = "net"
+	svc, err = r.Open(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := svc.(*outbox.Service); !ok {
+		t.Errorf("expected remote backend behind the outbox, got %T", svc)
+	}
+
+	cfg.Replay = "session.json"
+	svc, err = r.Open(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := svc.(*testutil.FakeService); !ok {
+		t.Errorf("expected replayed backend to be unwrapped, got %T", svc)
+	}
+	cfg.Replay = ""
+
+	cfg.Backend = "missing"
+	if _, err := r.Open(ctx, cfg); err == nil || err.Error() != "unknown backend: missing" {
+		t.Errorf("expected unknown backend error, got %v", err)
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	cfg := &config.Config{Dir: t.TempDir()}
+	var v struct {
+		URL string `json:"url"`
+	}
+
+	if err := ReadConfig(cfg, "x.json", &v); err == nil || !strings.Contains(err.Error(), "x.json not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(cfg.Dir, "x.json"), []byte(`{"url": "https://example.com", "usr": "typo"}`), 0600)
+	if err := ReadConfig(cfg, "x.json", &v); err == nil || !strings.Contains(err.Error(), `unknown field "usr"`) {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(cfg.Dir, "x.json"), []byte(`{"url": "https://example.com"}`), 0600)
+	if err := ReadConfig(cfg, "x.json", &v); err != nil || v.URL != "https://example.com" {
+		t.Errorf("unexpected result %+v, %v", v, err)
+	}
+}
@@ -0,0 +1,499 @@
+// Package caldav implements the service.Service interface for CalDAV
+// servers (Nextcloud, Radicale, ...).
+//
+// Calendars that support VTODO are task lists; VTODO components are tasks.
+// Updates and deletions are conditional on the ETag of the version gtask
+// last read, so changes made elsewhere in the meantime are never
+// overwritten.
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gtask/internal/backend"
+	"gtask/internal/config"
+	"gtask/internal/service"
+	"gtask/internal/transport"
+)
+
+const (
+	// Name is the backend name.
+	Name = "caldav"
+
+	// ConfigFile is the CalDAV account filename in the config directory.
+	ConfigFile = "caldav.json"
+
+	// RequestTimeout is the default timeout for each HTTP request
+	// (setting: timeout).
+	RequestTimeout = 10 * time.Second
+)
+
+// Account is the content of caldav.json.
+type Account struct {
+	// URL is the calendar home collection, e.g.
+	// https://cloud.example.com/remote.php/dav/calendars/alice/
+	URL string `json:"url"`
+
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// DefaultList is the title of the default list. If empty, the first
+	// task calendar is the default.
+	DefaultList string `json:"default_list,omitempty"`
+}
+
+func init() {
+	backend.Register(backend.Backend{
+		Name:       Name,
+		Synopsis:   "CalDAV server (Nextcloud, Radicale, ...)",
+		ConfigFile: ConfigFile,
+		Remote:     true,
+		New: func(ctx context.Context, cfg *config.Config) (service.Service, error) {
+			return New(cfg)
+		},
+	})
+}
+
+// Client implements service.Service for a CalDAV calendar home.
+type Client struct {
+	home    *url.URL
+	account Account
+	http    *http.Client
+	now     func() time.Time
+	timeout time.Duration
+
+	// etags remembers the version of each task read by ListOpenTasks,
+	// keyed by task ID, for conditional updates.
+	etags map[string]string
+}
+
+// New creates a client from caldav.json in the config directory.
+func New(cfg *config.Config) (*Client, error) {
+	var account Account
+	if err := backend.ReadConfig(cfg, ConfigFile, &account); err != nil {
+		return nil, err
+	}
+	httpClient := http.DefaultClient
+	if cfg.Settings.Retries > 0 {
+		httpClient = &http.Client{Transport: transport.NewRetry(nil, cfg.Settings.Retries)}
+	}
+	c, err := NewWithHTTPClient(account, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Settings.Timeout > 0 {
+		c.timeout = cfg.Settings.Timeout
+	}
+	return c, nil
+}
+
+// NewWithHTTPClient creates a client for account using httpClient.
+// This is useful for testing with a stand-in server.
+func NewWithHTTPClient(account Account, httpClient *http.Client) (*Client, error) {
+	home, err := url.Parse(account.URL)
+	if err != nil || home.Scheme == "" || home.Host == "" {
+		return nil, fmt.Errorf("invalid CalDAV URL: %q", account.URL)
+	}
+	if !strings.HasSuffix(home.Path, "/") {
+		home.Path += "/"
+	}
+	return &Client{
+		home:    home,
+		account: account,
+		http:    httpClient,
+		now:     time.Now,
+		timeout: RequestTimeout,
+		etags:   make(map[string]string),
+	}, nil
+}
+
+// DefaultList implements service.Service.
+func (c *Client) DefaultList(ctx context.Context) (service.TaskList, error) {
+	lists, err := c.ListLists(ctx)
+	if err != nil {
+		return service.TaskList{}, err
+	}
+	for _, l := range lists {
+		if l.IsDefault {
+			return l, nil
+		}
+	}
+	return service.TaskList{}, errors.New("no task calendars found")
+}
+
+// ListLists implements service.Service.
+// Returns the calendars that support VTODO in server order.
+func (c *Client) ListLists(ctx context.Context) ([]service.TaskList, error) {
+	ms, err := c.multistatus(ctx, "PROPFIND", c.home.String(), "1", propfindCalendars)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []service.TaskList
+	for _, r := range ms.Responses {
+		p, ok := r.prop()
+		if !ok || p.ResourceType.Calendar == nil || !p.supportsTodo() {
+			continue
+		}
+		id, err := c.resolve(r.Href)
+		if err != nil {
+			return nil, err
+		}
+		title := p.DisplayName
+		if title == "" {
+			title = lastSegment(id)
+		}
+		result = append(result, service.TaskList{ID: id, Title: title})
+	}
+	c.markDefault(result)
+	return result, nil
+}
+
+// ResolveList implements service.Service.
+func (c *Client) ResolveList(ctx context.Context, name string) (service.TaskList, error) {
+	lists, err := c.ListLists(ctx)
+	if err != nil {
+		return service.TaskList{}, err
+	}
+	return service.MatchList(lists, name)
+}
+
+// CreateList implements service.Service with MKCALENDAR.
+func (c *Client) CreateList(ctx context.Context, name string) error {
+	id, err := newUID()
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf(mkcalendarBody, xmlEscape(name))
+	resp, err := c.do(ctx, "MKCALENDAR", c.home.String()+id+"/", nil, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return expectStatus(resp, http.StatusCreated)
+}
+
+// DeleteList implements service.Service.
+func (c *Client) DeleteList(ctx context.Context, listID string) error {
+	resp, err := c.do(ctx, http.MethodDelete, listID, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return expectStatus(resp, http.StatusNoContent, http.StatusOK)
+}
+
+// ListOpenTasks implements service.Service.
+// CalDAV has no manual order, so tasks are sorted by creation time.
+func (c *Client) ListOpenTasks(ctx context.Context, listID string, page int) ([]service.Task, error) {
+	open, err := c.openTasks(ctx, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.Page(open, page), nil
+}
+
+// HasOpenTasks implements service.Service.
+func (c *Client) HasOpenTasks(ctx context.Context, listID string) (bool, error) {
+	open, err := c.openTasks(ctx, listID)
+	if err != nil {
+		return false, err
+	}
+	return len(open) > 0, nil
+}
+
+// CreateTask implements service.Service.
+func (c *Client) CreateTask(ctx context.Context, listID, title string) error {
+	uid, err := newUID()
+	if err != nil {
+		return err
+	}
+	header := http.Header{
+		"Content-Type":  {"text/calendar; charset=utf-8"},
+		"If-None-Match": {"*"},
+	}
+	body := newTodo(uid, title, c.now())
+	resp, err := c.do(ctx, http.MethodPut, strings.TrimSuffix(listID, "/")+"/"+uid+".ics", header, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return expectStatus(resp, http.StatusCreated, http.StatusNoContent)
+}
+
+// CompleteTask implements service.Service. The task is fetched, marked
+// STATUS:COMPLETED and written back with If-Match.
+func (c *Client) CompleteTask(ctx context.Context, listID, taskID string) error {
+	data, etag, err := c.get(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if seen, ok := c.etags[taskID]; ok && seen != etag {
+		return errModified
+	}
+
+	updated, ok := completeTodo(data, c.now())
+	if !ok {
+		return errors.New("not a task")
+	}
+	header := http.Header{
+		"Content-Type": {"text/calendar; charset=utf-8"},
+		"If-Match":     {etag},
+	}
+	resp, err := c.do(ctx, http.MethodPut, taskID, header, strings.NewReader(updated))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return expectStatus(resp, http.StatusNoContent, http.StatusOK, http.StatusCreated)
+}
+
+// DeleteTask implements service.Service. Like CompleteTask, it fetches the
+// task's current ETag first and deletes with If-Match, so the guard holds
+// even when the listing came from the cache and not from this client.
+func (c *Client) DeleteTask(ctx context.Context, listID, taskID string) error {
+	_, etag, err := c.get(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if seen, ok := c.etags[taskID]; ok && seen != etag {
+		return errModified
+	}
+
+	header := http.Header{"If-Match": {etag}}
+	resp, err := c.do(ctx, http.MethodDelete, taskID, header, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return expectStatus(resp, http.StatusNoContent, http.StatusOK)
+}
+
+// errModified is returned when a task changed on the server since gtask
+// read it.
+var errModified = service.Conflict(errors.New("task was modified on the server (list again and retry)"))
+
+// openTasks fetches all open tasks of a calendar and remembers their ETags.
+func (c *Client) openTasks(ctx context.Context, listID string) ([]service.Task, error) {
+	ms, err := c.multistatus(ctx, "REPORT", listID, "1", reportTodos)
+	if err != nil {
+		return nil, err
+	}
+
+	type item struct {
+		task    service.Task
+		created time.Time
+	}
+	var items []item
+	for _, r := range ms.Responses {
+		p, ok := r.prop()
+		if !ok || p.CalendarData == "" {
+			continue
+		}
+		t, ok := parseTodo(p.CalendarData)
+		if !ok || !t.isOpen() {
+			continue
+		}
+		id, err := c.resolve(r.Href)
+		if err != nil {
+			return nil, err
+		}
+		c.etags[id] = p.ETag
+		items = append(items, item{
+			task: service.Task{
+				ID:     id,
+				Title:  t.Summary,
+				Status: "needsAction",
+				Due:    t.Due,
+			},
+			created: t.Created,
+		})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].created.Equal(items[j].created) {
+			return items[i].created.Before(items[j].created)
+		}
+		return items[i].task.ID < items[j].task.ID
+	})
+	result := make([]service.Task, len(items))
+	for i, it := range items {
+		it.task.Position = fmt.Sprintf("%020d", i)
+		result[i] = it.task
+	}
+	return result, nil
+}
+
+// get fetches a calendar object and its ETag.
+func (c *Client) get(ctx context.Context, href string) (string, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, href, nil, nil)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return "", "", err
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", service.Unavailable(err)
+	}
+	return string(data), resp.Header.Get("ETag"), nil
+}
+
+// multistatus sends a PROPFIND or REPORT request and decodes the response.
+func (c *Client) multistatus(ctx context.Context, method, href, depth, body string) (*multistatus, error) {
+	header := http.Header{
+		"Content-Type": {"application/xml; charset=utf-8"},
+		"Depth":        {depth},
+	}
+	resp, err := c.do(ctx, method, href, header, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := expectStatus(resp, http.StatusMultiStatus); err != nil {
+		return nil, err
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("invalid %s response: %w", method, err)
+	}
+	return &ms, nil
+}
+
+// do sends a request with credentials and a timeout. Network failures are
+// marked service.ErrUnavailable. The caller must close the response body.
+func (c *Client) do(ctx context.Context, method, href string, header http.Header, body io.Reader) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	req, err := http.NewRequestWithContext(ctx, method, href, body)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.account.Username != "" {
+		req.SetBasicAuth(c.account.Username, c.account.Password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		cancel()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, service.TimeoutError(ctx)
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) {
+			return nil, service.Unavailable(err)
+		}
+		return nil, err
+	}
+	// Release the timeout when the body is closed
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody cancels the request context when the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// expectStatus returns nil if resp has one of the wanted status codes and
+// an error describing the failure otherwise.
+func expectStatus(resp *http.Response, want ...int) error {
+	for _, code := range want {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return service.Conflict(errors.New("not found"))
+	case http.StatusPreconditionFailed:
+		return errModified
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("CalDAV authentication failed (check %s)", ConfigFile)
+	}
+	if resp.StatusCode >= 500 {
+		return service.Unavailable(fmt.Errorf("CalDAV server error: %s", resp.Status))
+	}
+	return fmt.Errorf("unexpected CalDAV response: %s", resp.Status)
+}
+
+// markDefault sets IsDefault on the configured default list, or on the
+// first list.
+func (c *Client) markDefault(lists []service.TaskList) {
+	if len(lists) == 0 {
+		return
+	}
+	if c.account.DefaultList != "" {
+		if match, err := service.MatchList(lists, c.account.DefaultList); err == nil {
+			for i := range lists {
+				lists[i].IsDefault = lists[i].ID == match.ID
+			}
+			return
+		}
+	}
+	lists[0].IsDefault = true
+}
+
+// resolve turns an href from a response into an absolute URL string.
+// Hrefs on another scheme or host are rejected: gtask sends the account
+// password with every request to a list or task URL.
+func (c *Client) resolve(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf("invalid CalDAV response: bad href %q", href)
+	}
+	abs := c.home.ResolveReference(u)
+	if abs.Scheme != c.home.Scheme || abs.Host != c.home.Host {
+		return "", fmt.Errorf("invalid CalDAV response: %s is not on %s://%s", abs.Redacted(), c.home.Scheme, c.home.Host)
+	}
+	return abs.String(), nil
+}
+
+// lastSegment returns the last path segment of a collection URL.
+func lastSegment(href string) string {
+	trimmed := strings.TrimSuffix(href, "/")
+	return trimmed[strings.LastIndex(trimmed, "/")+1:]
+}
+
+// newUID returns a random UID for new tasks and calendars.
+func newUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,328 @@
+package caldav
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gtask/internal/cache"
+	"gtask/internal/config"
+	"gtask/internal/service"
+	"gtask/internal/service/servicetest"
+)
+
+func vtodo(uid, summary, status, created string, extra ...string) string {
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//test//EN", "BEGIN:VTODO", "UID:" + uid, "SUMMARY:" + summary}
+	if status != "" {
+		lines = append(lines, "STATUS:"+status)
+	}
+	if created != "" {
+		lines = append(lines, "CREATED:"+created)
+	}
+	lines = append(lines, extra...)
+	lines = append(lines, "END:VTODO", "END:VCALENDAR")
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func newTestClient(t *testing.T, srv *fakeServer) *Client {
+	t.Helper()
+	c, err := NewWithHTTPClient(Account{
+		URL:      srv.URL + homePath,
+		Username: testUser,
+		Password: testPassword,
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.now = func() time.Time { return time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC) }
+	return c
+}
+
+func TestClient_ListListsOnlyTaskCalendars(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.addCalendar("events", "Events", "VEVENT")
+	srv.addCalendar("tasks", "Tasks", "VEVENT", "VTODO")
+	srv.addCalendar("shopping", "Shopping", "VTODO")
+	c := newTestClient(t, srv)
+
+	lists, err := c.ListLists(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 2 || lists[0].Title != "Tasks" || lists[1].Title != "Shopping" {
+		t.Fatalf("unexpected lists: %+v", lists)
+	}
+	if !lists[0].IsDefault || lists[1].IsDefault {
+		t.Errorf("expected first task calendar to be default: %+v", lists)
+	}
+	if lists[0].ID != srv.URL+homePath+"tasks/" {
+		t.Errorf("expected absolute list ID, got %q", lists[0].ID)
+	}
+
+	c.account.DefaultList = "shopping"
+	def, err := c.DefaultList(context.Background())
+	if err != nil || def.Title != "Shopping" {
+		t.Errorf("expected configured default list, got %+v (%v)", def, err)
+	}
+}
+
+func TestClient_ListOpenTasks(t *testing.T) {
+	srv := newFakeServer(t)
+	cal := srv.addCalendar("tasks", "Tasks", "VTODO")
+	srv.putObject(cal, "b.ics", vtodo("b", "Second", "NEEDS-ACTION", "20261002T080000Z", "DUE;VALUE=DATE:20261020"))
+	srv.putObject(cal, "a.ics", vtodo("a", "First\\, really", "", "20261001T080000Z"))
+	srv.putObject(cal, "c.ics", vtodo("c", "Done", "COMPLETED", "20260901T080000Z"))
+	srv.putObject(cal, "d.ics", vtodo("d", "Dropped", "CANCELLED", "20260901T080000Z"))
+	c := newTestClient(t, srv)
+
+	tasks, err := c.ListOpenTasks(context.Background(), srv.URL+cal, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 || tasks[0].Title != "First, really" || tasks[1].Title != "Second" {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+	if want := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC); !tasks[1].Due.Equal(want) {
+		t.Errorf("expected due %v, got %v", want, tasks[1].Due)
+	}
+	if page2, _ := c.ListOpenTasks(context.Background(), srv.URL+cal, 2); len(page2) != 0 {
+		t.Errorf("expected empty page 2, got %+v", page2)
+	}
+}
+
+func TestClient_CreateAndCompleteTask(t *testing.T) {
+	srv := newFakeServer(t)
+	cal := srv.addCalendar("tasks", "Tasks", "VTODO")
+	c := newTestClient(t, srv)
+	ctx := context.Background()
+	listID := srv.URL + cal
+
+	if err := c.CreateTask(ctx, listID, "Renew passport"); err != nil {
+		t.Fatal(err)
+	}
+	tasks, _ := c.ListOpenTasks(ctx, listID, 1)
+	if len(tasks) != 1 || tasks[0].Title != "Renew passport" {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+
+	if err := c.CompleteTask(ctx, listID, tasks[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	data := srv.object(tasks[0].ID)
+	for _, want := range []string{"STATUS:COMPLETED\r\n", "COMPLETED:20261018T093000Z\r\n", "PERCENT-COMPLETE:100\r\n", "SUMMARY:Renew passport\r\n"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("expected %q in completed task:\n%s", want, data)
+		}
+	}
+	if strings.Count(data, "STATUS:") != 1 {
+		t.Errorf("expected exactly one STATUS line:\n%s", data)
+	}
+	if tasks, _ := c.ListOpenTasks(ctx, listID, 1); len(tasks) != 0 {
+		t.Errorf("expected no open tasks, got %+v", tasks)
+	}
+}
+
+func TestClient_CompleteKeepsUnknownProperties(t *testing.T) {
+	srv := newFakeServer(t)
+	cal := srv.addCalendar("tasks", "Tasks", "VTODO")
+	long := "DESCRIPTION:" + strings.Repeat("ü", 60)
+	objURL := srv.putObject(cal, "x.ics", vtodo("x", "Water plants", "NEEDS-ACTION", "", "X-CUSTOM:keep me", long,
+		"BEGIN:VALARM", "ACTION:DISPLAY", "STATUS:ignored", "END:VALARM"))
+	c := newTestClient(t, srv)
+
+	if err := c.CompleteTask(context.Background(), srv.URL+cal, objURL); err != nil {
+		t.Fatal(err)
+	}
+	data := srv.object(objURL)
+	if !strings.Contains(data, "X-CUSTOM:keep me") || !strings.Contains(data, "STATUS:ignored") {
+		t.Errorf("expected unknown and nested properties to be kept:\n%s", data)
+	}
+	for _, line := range strings.Split(data, "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line not folded: %q", line)
+		}
+	}
+	if got := unfold(data); !contains(got, long) {
+		t.Errorf("expected folded description to unfold to the original")
+	}
+}
+
+func TestClient_ETagConflicts(t *testing.T) {
+	srv := newFakeServer(t)
+	cal := srv.addCalendar("tasks", "Tasks", "VTODO")
+	objURL := srv.putObject(cal, "x.ics", vtodo("x", "Original", "", ""))
+	c := newTestClient(t, srv)
+	ctx := context.Background()
+
+	if _, err := c.ListOpenTasks(ctx, srv.URL+cal, 1); err != nil {
+		t.Fatal(err)
+	}
+	// Someone edits the task after gtask listed it
+	srv.putObject(cal, "x.ics", vtodo("x", "Edited elsewhere", "", ""))
+
+	if err := c.CompleteTask(ctx, srv.URL+cal, objURL); !errors.Is(err, errModified) {
+		t.Errorf("expected modified error on complete, got %v", err)
+	}
+	if err := c.DeleteTask(ctx, srv.URL+cal, objURL); !errors.Is(err, errModified) || !errors.Is(err, service.ErrConflict) {
+		t.Errorf("expected modified error on delete, got %v", err)
+	}
+	if srv.object(objURL) == "" {
+		t.Fatal("expected task to survive conflicting delete")
+	}
+
+	// After listing again, the delete goes through
+	c.ListOpenTasks(ctx, srv.URL+cal, 1)
+	if err := c.DeleteTask(ctx, srv.URL+cal, objURL); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteTask(ctx, srv.URL+cal, objURL); err == nil || err.Error() != "not found" {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestClient_DeleteThroughCacheSendsETag(t *testing.T) {
+	srv := newFakeServer(t)
+	cal := srv.addCalendar("tasks", "Tasks", "VTODO")
+	objURL := srv.putObject(cal, "x.ics", vtodo("x", "Original", "", ""))
+	cfg := &config.Config{Dir: t.TempDir(), CacheDir: t.TempDir(), MaxAge: time.Hour}
+	ctx := context.Background()
+
+	if _, err := cache.New(newTestClient(t, srv), cfg).ListOpenTasks(ctx, srv.URL+cal, 1); err != nil {
+		t.Fatal(err)
+	}
+	// A later gtask run is served the listing from the cache, so its
+	// client has not seen any ETag
+	svc := cache.New(newTestClient(t, srv), cfg)
+	tasks, err := svc.ListOpenTasks(ctx, srv.URL+cal, 1)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("unexpected tasks %v, %v", tasks, err)
+	}
+	if err := svc.DeleteTask(ctx, srv.URL+cal, tasks[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.deletes) != 1 || srv.deletes[0] == "" {
+		t.Errorf("expected one DELETE with If-Match, got %q", srv.deletes)
+	}
+	if srv.object(objURL) != "" {
+		t.Error("expected task to be deleted")
+	}
+}
+
+func TestClient_RejectsHrefsOnOtherOrigins(t *testing.T) {
+	srv := newFakeServer(t)
+	cal := srv.addCalendar("tasks", "Tasks", "VTODO")
+	srv.putObject(cal, "x.ics", vtodo("x", "Task", "", ""))
+	c := newTestClient(t, srv)
+	ctx := context.Background()
+
+	for _, origin := range []string{"http://attacker.example", "https://" + strings.TrimPrefix(srv.URL, "http://"), "//attacker.example"} {
+		srv.mu.Lock()
+		srv.origin = origin
+		srv.mu.Unlock()
+		_, err := c.ListOpenTasks(ctx, srv.URL+cal, 1)
+		if err == nil || !strings.Contains(err.Error(), "invalid CalDAV response") {
+			t.Errorf("%s: expected invalid response error, got %v", origin, err)
+		}
+	}
+
+	// The same origin spelled out in full is fine
+	srv.mu.Lock()
+	srv.origin = srv.URL
+	srv.mu.Unlock()
+	if tasks, err := c.ListOpenTasks(ctx, srv.URL+cal, 1); err != nil || len(tasks) != 1 {
+		t.Errorf("unexpected tasks %v, %v", tasks, err)
+	}
+}
+
+func TestClient_CreateAndDeleteList(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.addCalendar("tasks", "Tasks", "VTODO")
+	c := newTestClient(t, srv)
+	ctx := context.Background()
+
+	if err := c.CreateList(ctx, "Home & Garden"); err != nil {
+		t.Fatal(err)
+	}
+	list, err := c.ResolveList(ctx, "home & garden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteList(ctx, list.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ResolveList(ctx, "Home & Garden"); err == nil {
+		t.Error("expected list to be gone")
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	srv := newFakeServer(t)
+	c := newTestClient(t, srv)
+	c.account.Password = "wrong"
+
+	_, err := c.ListLists(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("expected authentication error, got %v", err)
+	}
+
+	srv.Close()
+	_, err = c.ListLists(context.Background())
+	if !errors.Is(err, service.ErrUnavailable) {
+		t.Errorf("expected unavailable error, got %v", err)
+	}
+
+	if _, err := NewWithHTTPClient(Account{URL: "not a url"}, http.DefaultClient); err == nil {
+		t.Error("expected invalid URL error")
+	}
+}
+
+func TestClient_Timeouts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	c, err := NewWithHTTPClient(Account{URL: srv.URL + homePath}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The request timeout passes first
+	c.timeout = 20 * time.Millisecond
+	_, err = c.ListLists(context.Background())
+	if !errors.Is(err, service.ErrUnavailable) || err.Error() != "request timed out" {
+		t.Errorf("expected request timeout, got %v", err)
+	}
+
+	// The command deadline passes first
+	c.timeout = time.Minute
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 20*time.Millisecond, service.ErrDeadline)
+	defer cancel()
+	_, err = c.ListLists(ctx)
+	if !errors.Is(err, service.ErrDeadline) || errors.Is(err, service.ErrUnavailable) {
+		t.Errorf("expected command deadline error, got %v", err)
+	}
+}
+
+func contains(lines []string, want string) bool {
+	for _, line := range lines {
+		if line == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestClient_Conformance(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) service.Service {
+		srv := newFakeServer(t)
+		srv.addCalendar("tasks", "Tasks", "VTODO")
+		return newTestClient(t, srv)
+	})
+}
@@ -0,0 +1,226 @@
+package caldav
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// iCalendar (RFC 5545) handling is limited to what gtask needs: reading a
+// few VTODO properties and rewriting completion properties. Unknown
+// properties and components are passed through untouched.
+
+const (
+	// utcLayout is the iCalendar UTC date-time format.
+	utcLayout = "20060102T150405Z"
+
+	// maxLineOctets is the folding limit for content lines.
+	maxLineOctets = 75
+)
+
+// todo holds the VTODO properties gtask uses.
+type todo struct {
+	UID     string
+	Summary string
+	Status  string
+	Due     time.Time
+	Created time.Time
+}
+
+// isOpen reports whether the task still needs action.
+func (t todo) isOpen() bool {
+	return t.Status != "COMPLETED" && t.Status != "CANCELLED"
+}
+
+// unfold splits iCalendar data into logical content lines.
+func unfold(data string) []string {
+	var lines []string
+	for _, raw := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		if len(raw) > 0 && (raw[0] == ' ' || raw[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += raw[1:]
+			continue
+		}
+		if raw != "" {
+			lines = append(lines, raw)
+		}
+	}
+	return lines
+}
+
+// fold joins content lines with CRLF, folding lines longer than 75 octets
+// without splitting UTF-8 sequences.
+func fold(lines []string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		limit := maxLineOctets
+		for len(line) > limit {
+			cut := limit
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			b.WriteString(line[:cut])
+			b.WriteString("\r\n ")
+			line = line[cut:]
+			// Continuation lines start with a space
+			limit = maxLineOctets - 1
+		}
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// splitProp splits a content line into name (upper-cased, without
+// parameters), parameters and value.
+func splitProp(line string) (name, params, value string) {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return strings.ToUpper(line), "", ""
+	}
+	head := line[:colon]
+	value = line[colon+1:]
+	if semi := strings.IndexByte(head, ';'); semi >= 0 {
+		return strings.ToUpper(head[:semi]), head[semi+1:], value
+	}
+	return strings.ToUpper(head), "", value
+}
+
+// todoBounds returns the indexes of the BEGIN:VTODO and END:VTODO lines of
+// the first VTODO, or ok=false.
+func todoBounds(lines []string) (begin, end int, ok bool) {
+	begin = -1
+	for i, line := range lines {
+		switch strings.ToUpper(line) {
+		case "BEGIN:VTODO":
+			if begin < 0 {
+				begin = i
+			}
+		case "END:VTODO":
+			if begin >= 0 {
+				return begin, i, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// parseTodo reads the first VTODO in data.
+func parseTodo(data string) (todo, bool) {
+	lines := unfold(data)
+	begin, end, ok := todoBounds(lines)
+	if !ok {
+		return todo{}, false
+	}
+
+	var t todo
+	depth := 0
+	for _, line := range lines[begin+1 : end] {
+		name, _, value := splitProp(line)
+		// Skip properties of nested components such as VALARM
+		switch name {
+		case "BEGIN":
+			depth++
+			continue
+		case "END":
+			depth--
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+		switch name {
+		case "UID":
+			t.UID = value
+		case "SUMMARY":
+			t.Summary = unescapeText(value)
+		case "STATUS":
+			t.Status = strings.ToUpper(value)
+		case "DUE":
+			t.Due = parseDateTime(value)
+		case "CREATED":
+			t.Created = parseDateTime(value)
+		}
+	}
+	return t, true
+}
+
+// completeTodo marks the first VTODO in data completed at now, replacing
+// any existing completion properties.
+func completeTodo(data string, now time.Time) (string, bool) {
+	lines := unfold(data)
+	begin, end, ok := todoBounds(lines)
+	if !ok {
+		return "", false
+	}
+
+	replaced := map[string]bool{
+		"STATUS": true, "COMPLETED": true, "PERCENT-COMPLETE": true,
+		"LAST-MODIFIED": true, "DTSTAMP": true,
+	}
+	stamp := now.UTC().Format(utcLayout)
+
+	result := make([]string, 0, len(lines)+5)
+	result = append(result, lines[:begin+1]...)
+	depth := 0
+	for _, line := range lines[begin+1 : end] {
+		name, _, _ := splitProp(line)
+		switch name {
+		case "BEGIN":
+			depth++
+		case "END":
+			depth--
+		}
+		if depth == 0 && replaced[name] {
+			continue
+		}
+		result = append(result, line)
+	}
+	result = append(result,
+		"DTSTAMP:"+stamp,
+		"LAST-MODIFIED:"+stamp,
+		"STATUS:COMPLETED",
+		"COMPLETED:"+stamp,
+		"PERCENT-COMPLETE:100",
+	)
+	result = append(result, lines[end:]...)
+	return fold(result), true
+}
+
+// newTodo returns a calendar object with a single open VTODO.
+func newTodo(uid, summary string, now time.Time) string {
+	stamp := now.UTC().Format(utcLayout)
+	return fold([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//gtask//gtask//EN",
+		"BEGIN:VTODO",
+		"UID:" + uid,
+		"DTSTAMP:" + stamp,
+		"CREATED:" + stamp,
+		"LAST-MODIFIED:" + stamp,
+		"SUMMARY:" + escapeText(summary),
+		"STATUS:NEEDS-ACTION",
+		"END:VTODO",
+		"END:VCALENDAR",
+	})
+}
+
+// parseDateTime parses DATE and DATE-TIME values. Floating and TZID times
+// are read as UTC, which is close enough for ordering and due dates.
+// Returns the zero time for unknown formats.
+func parseDateTime(value string) time.Time {
+	for _, layout := range []string{utcLayout, "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+var (
+	textEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+func escapeText(s string) string   { return textEscaper.Replace(s) }
+func unescapeText(s string) string { return textUnescaper.Replace(s) }
@@ -0,0 +1,235 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer is an in-process CalDAV stand-in with one calendar home at
+// /dav/alice/. It implements just enough of WebDAV and CalDAV for the
+// client: PROPFIND, REPORT, MKCALENDAR, GET, PUT and DELETE with ETags.
+type fakeServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	calendars map[string]*fakeCalendar // path -> calendar
+	version   int
+	deletes   []string // If-Match header of each object DELETE
+	origin    string   // prepended to the hrefs in REPORT responses
+}
+
+type fakeCalendar struct {
+	name    string
+	comps   []string
+	order   int
+	objects map[string]*fakeObject // path -> object
+}
+
+type fakeObject struct {
+	data string
+	etag string
+}
+
+const (
+	homePath     = "/dav/alice/"
+	testUser     = "alice"
+	testPassword = "secret"
+)
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	s := &fakeServer{calendars: make(map[string]*fakeCalendar)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// addCalendar adds a calendar supporting comps and returns its path.
+func (s *fakeServer) addCalendar(slug, name string, comps ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := homePath + slug + "/"
+	s.calendars[path] = &fakeCalendar{name: name, comps: comps, order: len(s.calendars), objects: make(map[string]*fakeObject)}
+	return path
+}
+
+// putObject stores raw calendar data and returns the object URL.
+func (s *fakeServer) putObject(calPath, name, data string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calendars[calPath].objects[calPath+name] = &fakeObject{data: data, etag: s.nextETag()}
+	return s.URL + calPath + name
+}
+
+// object returns the stored data of an object, or "" if missing.
+func (s *fakeServer) object(objURL string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := strings.TrimPrefix(objURL, s.URL)
+	for _, cal := range s.calendars {
+		if obj, ok := cal.objects[path]; ok {
+			return obj.data
+		}
+	}
+	return ""
+}
+
+func (s *fakeServer) nextETag() string {
+	s.version++
+	return fmt.Sprintf(`"v%d"`, s.version)
+}
+
+func (s *fakeServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, pass, ok := r.BasicAuth(); !ok || user != testUser || pass != testPassword {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := r.URL.Path
+	switch r.Method {
+	case "PROPFIND":
+		if path != homePath || r.Header.Get("Depth") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.propfind(w)
+	case "REPORT":
+		cal, ok := s.calendars[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.report(w, cal)
+	case "MKCALENDAR":
+		if _, exists := s.calendars[path]; exists {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var body struct {
+			Name string `xml:"set>prop>displayname"`
+		}
+		xml.NewDecoder(r.Body).Decode(&body)
+		s.calendars[path] = &fakeCalendar{name: body.Name, comps: []string{"VTODO"}, order: len(s.calendars), objects: make(map[string]*fakeObject)}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		obj, _ := s.find(path)
+		if obj == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", obj.etag)
+		io.WriteString(w, obj.data)
+	case http.MethodPut:
+		s.put(w, r, path)
+	case http.MethodDelete:
+		if _, ok := s.calendars[path]; ok {
+			delete(s.calendars, path)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		obj, cal := s.find(path)
+		if obj == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.deletes = append(s.deletes, r.Header.Get("If-Match"))
+		if m := r.Header.Get("If-Match"); m != "" && m != obj.etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		delete(cal.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeServer) put(w http.ResponseWriter, r *http.Request, path string) {
+	calPath := path[:strings.LastIndex(path, "/")+1]
+	cal, ok := s.calendars[calPath]
+	if !ok {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	obj := cal.objects[path]
+	if r.Header.Get("If-None-Match") == "*" && obj != nil {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if m := r.Header.Get("If-Match"); m != "" && (obj == nil || m != obj.etag) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	data, _ := io.ReadAll(r.Body)
+	cal.objects[path] = &fakeObject{data: string(data), etag: s.nextETag()}
+	if obj == nil {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *fakeServer) find(path string) (*fakeObject, *fakeCalendar) {
+	for _, cal := range s.calendars {
+		if obj, ok := cal.objects[path]; ok {
+			return obj, cal
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeServer) propfind(w http.ResponseWriter) {
+	var paths []string
+	for path := range s.calendars {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return s.calendars[paths[i]].order < s.calendars[paths[j]].order })
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav">`)
+	fmt.Fprintf(&b, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, homePath)
+	for _, path := range paths {
+		cal := s.calendars[path]
+		var comps string
+		for _, c := range cal.comps {
+			comps += fmt.Sprintf(`<cal:comp name="%s"/>`, c)
+		}
+		fmt.Fprintf(&b, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:displayname>%s</d:displayname><d:resourcetype><d:collection/><cal:calendar/></d:resourcetype><cal:supported-calendar-component-set>%s</cal:supported-calendar-component-set></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, path, xmlEscape(cal.name), comps)
+	}
+	b.WriteString(`</d:multistatus>`)
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+func (s *fakeServer) report(w http.ResponseWriter, cal *fakeCalendar) {
+	var paths []string
+	for path := range cal.objects {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav">`)
+	for _, path := range paths {
+		obj := cal.objects[path]
+		if !strings.Contains(obj.data, "BEGIN:VTODO") {
+			continue
+		}
+		var data strings.Builder
+		xml.EscapeText(&data, []byte(obj.data))
+		fmt.Fprintf(&b, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getetag>%s</d:getetag><cal:calendar-data>%s</cal:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, s.origin+path, obj.etag, data.String())
+	}
+	b.WriteString(`</d:multistatus>`)
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
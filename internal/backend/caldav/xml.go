@@ -0,0 +1,99 @@
+package caldav
+
+import "strings"
+
+// WebDAV and CalDAV XML bodies and response types.
+
+// propfindCalendars asks for the calendars in the calendar home.
+const propfindCalendars = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop>
+    <d:displayname/>
+    <d:resourcetype/>
+    <c:supported-calendar-component-set/>
+  </d:prop>
+</d:propfind>`
+
+// reportTodos asks for all VTODOs in a calendar. Completed tasks are
+// filtered client-side: status filters are not supported by every server.
+const reportTodos = `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop>
+    <d:getetag/>
+    <c:calendar-data/>
+  </d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VTODO"/>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`
+
+// mkcalendarBody creates a task-only calendar; %s is the escaped title.
+const mkcalendarBody = `<?xml version="1.0" encoding="utf-8"?>
+<c:mkcalendar xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:set>
+    <d:prop>
+      <d:displayname>%s</d:displayname>
+      <c:supported-calendar-component-set>
+        <c:comp name="VTODO"/>
+      </c:supported-calendar-component-set>
+    </d:prop>
+  </d:set>
+</c:mkcalendar>`
+
+type multistatus struct {
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href      string     `xml:"DAV: href"`
+	Propstats []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"DAV: prop"`
+	Status string `xml:"DAV: status"`
+}
+
+type prop struct {
+	DisplayName  string        `xml:"DAV: displayname"`
+	ResourceType resourceType  `xml:"DAV: resourcetype"`
+	ETag         string        `xml:"DAV: getetag"`
+	CalendarData string        `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+	Components   *componentSet `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+}
+
+type resourceType struct {
+	Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+}
+
+type componentSet struct {
+	Comps []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+}
+
+// prop returns the successfully retrieved properties of a response.
+func (r response) prop() (prop, bool) {
+	for _, ps := range r.Propstats {
+		if ps.Status == "" || strings.Contains(ps.Status, " 200 ") {
+			return ps.Prop, true
+		}
+	}
+	return prop{}, false
+}
+
+// supportsTodo reports whether a calendar can hold VTODOs. Servers that do
+// not report the component set support everything.
+func (p prop) supportsTodo() bool {
+	if p.Components == nil || len(p.Components.Comps) == 0 {
+		return true
+	}
+	for _, comp := range p.Components.Comps {
+		if strings.EqualFold(comp.Name, "VTODO") {
+			return true
+		}
+	}
+	return false
+}
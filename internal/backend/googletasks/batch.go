@@ -0,0 +1,187 @@
+package googletasks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+
+	"gtask/internal/service"
+)
+
+// MaxBatchSize is the number of operations sent in one batch request.
+// The API accepts up to 1000, but large batches are slow to fail and are
+// charged against the quota all at once.
+const MaxBatchSize = 50
+
+// batchPath is the batch endpoint of the Tasks API, relative to the base
+// path of the service.
+const batchPath = "batch/tasks/v1"
+
+// errNoBatchResponse is reported for an operation the batch response did
+// not answer.
+var errNoBatchResponse = errors.New("no response in batch")
+
+// Batch implements service.Batcher. Ops are sent as multipart/mixed batch
+// requests of up to MaxBatchSize operations, each request with its own
+// timeout. If a batch request after the first fails as a whole, the
+// remaining ops get its error.
+func (c *Client) Batch(ctx context.Context, ops []service.Op) ([]error, error) {
+	if c.readOnly {
+		return nil, c.readOnlyError()
+	}
+	errs := make([]error, len(ops))
+	for start := 0; start < len(ops); start += MaxBatchSize {
+		end := min(start+MaxBatchSize, len(ops))
+		err := c.batch(ctx, ops[start:end], errs[start:end])
+		if err == nil {
+			continue
+		}
+		if start == 0 {
+			return nil, err
+		}
+		for i := start; i < len(ops); i++ {
+			errs[i] = err
+		}
+		break
+	}
+	return errs, nil
+}
+
+// batch sends ops in one batch request and stores the result of each op
+// in errs.
+func (c *Client) batch(ctx context.Context, ops []service.Op, errs []error) error {
+	ctx, cancel := context.WithTimeout(ctx, c.apiTimeout())
+	defer cancel()
+
+	base, err := url.Parse(c.svc.BasePath)
+	if err != nil {
+		return err
+	}
+	body, contentType, err := batchBody(base.Path, ops)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.svc.BasePath+batchPath, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return c.wrapError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return c.wrapError(ctx, err)
+	}
+
+	found, err := readBatchResponse(resp, errs)
+	if err != nil {
+		return c.wrapError(ctx, err)
+	}
+	for i := range errs {
+		if !found[i] {
+			errs[i] = errNoBatchResponse
+		} else if errs[i] != nil {
+			errs[i] = c.wrapError(ctx, errs[i])
+		}
+	}
+	return nil
+}
+
+// batchBody encodes ops as the parts of a batch request. Each part is an
+// HTTP request to a path below basePath, identified by its index in ops.
+func batchBody(basePath string, ops []service.Op) (io.Reader, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for i, op := range ops {
+		method, path, payload, err := batchRequest(basePath, op)
+		if err != nil {
+			return nil, "", err
+		}
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-Id":   {"<item-" + strconv.Itoa(i) + ">"},
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		fmt.Fprintf(part, "%s %s HTTP/1.1\r\n", method, path)
+		if payload != nil {
+			fmt.Fprintf(part, "Content-Type: application/json\r\nContent-Length: %d\r\n", len(payload))
+		}
+		fmt.Fprintf(part, "\r\n")
+		part.Write(payload)
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, "multipart/mixed; boundary=" + w.Boundary(), nil
+}
+
+// batchRequest returns the method, path and JSON body of the API request
+// for op.
+func batchRequest(basePath string, op service.Op) (string, string, []byte, error) {
+	path := strings.TrimSuffix(basePath, "/") + "/tasks/v1/lists/" + url.PathEscape(op.ListID) + "/tasks"
+	switch op.Kind {
+	case service.OpCreate:
+		payload, err := json.Marshal(map[string]string{"title": op.Title})
+		return http.MethodPost, path, payload, err
+	case service.OpComplete:
+		payload, err := json.Marshal(map[string]string{"status": "completed"})
+		return http.MethodPatch, path + "/" + url.PathEscape(op.TaskID), payload, err
+	case service.OpDelete:
+		return http.MethodDelete, path + "/" + url.PathEscape(op.TaskID), nil, nil
+	}
+	return "", "", nil, &service.UnknownOpError{Kind: op.Kind}
+}
+
+// readBatchResponse reads the parts of a batch response and stores the
+// error of each answered op in errs. Parts are matched to ops by their
+// Content-ID, as the API may answer in any order.
+func readBatchResponse(resp *http.Response, errs []error) ([]bool, error) {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("unexpected batch response type %q", resp.Header.Get("Content-Type"))
+	}
+
+	found := make([]bool, len(errs))
+	r := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return found, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading batch response: %w", err)
+		}
+
+		id := strings.Trim(part.Header.Get("Content-Id"), "<>")
+		i, err := strconv.Atoi(strings.TrimPrefix(id, "response-item-"))
+		if err != nil || i < 0 || i >= len(errs) {
+			return nil, fmt.Errorf("unexpected batch response part %q", id)
+		}
+
+		itemResp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			return nil, fmt.Errorf("reading batch response: %w", err)
+		}
+		errs[i] = googleapi.CheckResponse(itemResp)
+		itemResp.Body.Close()
+		found[i] = true
+	}
+}
@@ -0,0 +1,173 @@
+package googletasks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gtask/internal/config"
+	"gtask/internal/service"
+)
+
+// batchServer answers batch requests like the Tasks API: tasks named
+// "missing" are not found. Parts are answered in reverse order. It records
+// the inner requests of each batch.
+func batchServer(batches *[][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/batch/tasks/v1" {
+			http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusBadRequest)
+			return
+		}
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type item struct {
+			id     string
+			status int
+		}
+		var items []item
+		var requests []string
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req, err := http.ReadRequest(bufio.NewReader(part))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body, _ := io.ReadAll(req.Body)
+			requests = append(requests, strings.TrimSpace(req.Method+" "+req.URL.Path+" "+string(body)))
+
+			status := http.StatusOK
+			if strings.HasSuffix(req.URL.Path, "/missing") {
+				status = http.StatusNotFound
+			} else if req.Method == http.MethodDelete {
+				status = http.StatusNoContent
+			}
+			id := strings.Trim(part.Header.Get("Content-Id"), "<>")
+			items = append(items, item{"response-" + id, status})
+		}
+		*batches = append(*batches, requests)
+
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for i := len(items) - 1; i >= 0; i-- {
+			part, _ := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type": {"application/http"},
+				"Content-Id":   {"<" + items[i].id + ">"},
+			})
+			body := "{}"
+			if items[i].status == http.StatusNotFound {
+				body = `{"error":{"code":404,"message":"Task not found."}}`
+			}
+			fmt.Fprintf(part, "HTTP/1.1 %d %s\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s",
+				items[i].status, http.StatusText(items[i].status), len(body), body)
+		}
+		mw.Close()
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+		w.Write(buf.Bytes())
+	}))
+}
+
+func newBatchClient(t *testing.T, srv *httptest.Server) *Client {
+	t.Helper()
+	c, err := NewWithHTTPClient(context.Background(), srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.svc.BasePath = srv.URL + "/"
+	return c
+}
+
+func TestClient_Batch(t *testing.T) {
+	var batches [][]string
+	srv := batchServer(&batches)
+	defer srv.Close()
+	c := newBatchClient(t, srv)
+
+	errs, err := c.Batch(context.Background(), []service.Op{
+		{Kind: service.OpCreate, ListID: "L1", Title: "Buy milk"},
+		{Kind: service.OpComplete, ListID: "L1", TaskID: "t1"},
+		{Kind: service.OpComplete, ListID: "L1", TaskID: "missing"},
+		{Kind: service.OpDelete, ListID: "L 2", TaskID: "t2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batches) != 1 {
+		t.Fatalf("expected 1 batch request, got %d", len(batches))
+	}
+	want := []string{
+		`POST /tasks/v1/lists/L1/tasks {"title":"Buy milk"}`,
+		`PATCH /tasks/v1/lists/L1/tasks/t1 {"status":"completed"}`,
+		`PATCH /tasks/v1/lists/L1/tasks/missing {"status":"completed"}`,
+		`DELETE /tasks/v1/lists/L 2/tasks/t2`,
+	}
+	if fmt.Sprint(batches[0]) != fmt.Sprint(want) {
+		t.Errorf("unexpected requests:\n got %q\nwant %q", batches[0], want)
+	}
+
+	for i, err := range errs {
+		if i == 2 {
+			if err == nil || err.Error() != "not found" {
+				t.Errorf("op %d: expected not found, got %v", i, err)
+			}
+		} else if err != nil {
+			t.Errorf("op %d: unexpected error %v", i, err)
+		}
+	}
+}
+
+func TestClient_BatchSplitsLargeBatches(t *testing.T) {
+	var batches [][]string
+	srv := batchServer(&batches)
+	defer srv.Close()
+	c := newBatchClient(t, srv)
+
+	ops := make([]service.Op, 2*MaxBatchSize+1)
+	for i := range ops {
+		ops[i] = service.Op{Kind: service.OpDelete, ListID: "L1", TaskID: "t" + strconv.Itoa(i)}
+	}
+	errs, err := c.Batch(context.Background(), ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 || len(batches[2]) != 1 {
+		t.Errorf("expected 3 batch requests, the last with 1 op, got %d", len(batches))
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("op %d: unexpected error %v", i, err)
+		}
+	}
+}
+
+func TestClient_BatchReadOnly(t *testing.T) {
+	c := &Client{readOnly: true, cfg: &config.Config{Profile: "work"}}
+	_, err := c.Batch(context.Background(), []service.Op{{Kind: service.OpDelete, ListID: "L1", TaskID: "t1"}})
+	if !errors.Is(err, errReadOnly) || !strings.HasSuffix(err.Error(), "(run: gtask login --profile work)") {
+		t.Errorf("expected read-only error naming the profile, got %v", err)
+	}
+}
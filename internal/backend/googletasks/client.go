@@ -3,20 +3,24 @@ package googletasks
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
+	"net/url"
 	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	tasks "google.golang.org/api/tasks/v1"
 
+	"gtask/internal/auth"
+	"gtask/internal/backend"
 	"gtask/internal/config"
 	"gtask/internal/service"
+	"gtask/internal/transport"
 )
 
 const (
@@ -26,57 +30,98 @@ const (
 	// PageSize is the number of tasks per page.
 	PageSize = 100
 
-	// APITimeout is the timeout for API calls.
-	APITimeout = 5 * time.Second
+	// DefaultRateLimit is the default number of API requests per second
+	// (setting: rate_limit). Bursts of the same size are allowed.
+	DefaultRateLimit = 10
 
-	// OAuth scope for Google Tasks
-	tasksScope = "https://www.googleapis.com/auth/tasks"
+	// APITimeout is the default timeout for one API request (setting:
+	// timeout). Commands making several requests give each its own.
+	APITimeout = 5 * time.Second
 )
 
+func init() {
+	backend.Register(backend.Backend{
+		Name:       config.BackendGoogle,
+		Synopsis:   "Google Tasks (default)",
+		NeedsOAuth: true,
+		Remote:     true,
+		New: func(ctx context.Context, cfg *config.Config) (service.Service, error) {
+			return New(ctx, cfg)
+		},
+	})
+}
+
+// errReadOnly is wrapped by the errors of changes under a read-only login.
+var errReadOnly = errors.New("read-only login cannot change tasks")
+
 // Client implements service.Service using Google Tasks API.
 type Client struct {
-	svc       *tasks.Service
-	cfg       *config.Config
-	tokenPath string
+	svc *tasks.Service
+	cfg *config.Config
+
+	// http sends batch requests, which the generated service lacks.
+	http *http.Client
+
+	// readOnly is set for a login with the read-only scope.
+	readOnly bool
+
+	// timeout overrides APITimeout if non-zero.
+	timeout time.Duration
 }
 
 // New creates a new Google Tasks client.
-// Requires oauth_client.json and token.json to exist.
+// Requires oauth_client.json and a stored token (see auth.NewStore),
+// unless responses are replayed from a cassette (cfg.Replay).
 func New(ctx context.Context, cfg *config.Config) (*Client, error) {
-	// Load OAuth client config
-	clientJSON, err := os.ReadFile(cfg.OAuthClientPath())
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("oauth_client.json not found in %s", cfg.Dir)
-		}
-		return nil, fmt.Errorf("failed to read oauth_client.json: %w", err)
+	if cfg.Replay != "" {
+		return newReplay(ctx, cfg)
 	}
 
-	oauthConfig, err := google.ConfigFromJSON(clientJSON, tasksScope)
+	// Load OAuth client config
+	oauthConfig, err := auth.OAuthConfig(cfg, auth.Scopes(cfg)...)
 	if err != nil {
-		return nil, fmt.Errorf("invalid oauth_client.json: %w", err)
+		return nil, err
 	}
 
 	// Load token
-	tokenData, err := os.ReadFile(cfg.TokenPath())
+	store := auth.NewStore(cfg)
+	token, err := store.Load()
+	if errors.Is(err, auth.ErrNoToken) {
+		return nil, fmt.Errorf("not logged in (run: %s)", cfg.ProfileCommand("login"))
+	}
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("not logged in (run: gtask login)")
-		}
-		return nil, fmt.Errorf("failed to read token.json: %w", err)
+		return nil, err
 	}
 
-	var token oauth2.Token
-	if err := json.Unmarshal(tokenData, &token); err != nil {
-		return nil, fmt.Errorf("invalid token.json: %w", err)
+	// Pace requests (setting: rate_limit), retry failed reads (setting:
+	// retries) and log requests (--debug), including token refreshes.
+	// The rate limit is below the retries so that they are paced too.
+	rate := cfg.Settings.RateLimit
+	if rate == 0 {
+		rate = DefaultRateLimit
+	}
+	var base http.RoundTripper = transport.NewRateLimit(nil, float64(rate), rate)
+	if cfg.Settings.Retries > 0 {
+		base = transport.NewRetry(base, cfg.Settings.Retries)
 	}
+	if cfg.Debug {
+		base = transport.NewLog(base, cfg.Logger(), transport.StatsFrom(ctx))
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: base})
 
-	// Create token source that auto-refreshes
-	tokenSource := oauthConfig.TokenSource(ctx, &token)
+	// Create token source that auto-refreshes and saves refreshed tokens,
+	// so the next run does not have to refresh again
+	tokenSource := auth.NewPersistingTokenSource(oauthConfig.TokenSource(ctx, token), store, token)
 
 	// Create HTTP client with token source
 	httpClient := oauth2.NewClient(ctx, tokenSource)
 
+	// Record above the token source (--record), so that cassettes hold
+	// neither Authorization headers nor token refreshes
+	if cfg.Record != "" {
+		httpClient.Transport = transport.NewRecord(httpClient.Transport, cfg.Record)
+	}
+
 	// Create Tasks service
 	svc, err := tasks.NewService(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
@@ -84,29 +129,48 @@ func New(ctx context.Context, cfg *config.Config) (*Client, error) {
 	}
 
 	return &Client{
-		svc:       svc,
-		cfg:       cfg,
-		tokenPath: cfg.TokenPath(),
+		svc:      svc,
+		cfg:      cfg,
+		http:     httpClient,
+		readOnly: auth.ReadOnly(cfg),
+		timeout:  cfg.Settings.Timeout,
 	}, nil
 }
 
+// newReplay creates a client that answers from the cassette at
+// cfg.Replay (--replay) instead of the network. No login is needed.
+func newReplay(ctx context.Context, cfg *config.Config) (*Client, error) {
+	replay, err := transport.NewReplay(cfg.Replay)
+	if err != nil {
+		return nil, err
+	}
+	var base http.RoundTripper = replay
+	if cfg.Debug {
+		base = transport.NewLog(base, cfg.Logger(), transport.StatsFrom(ctx))
+	}
+	c, err := NewWithHTTPClient(ctx, &http.Client{Transport: base})
+	if err != nil {
+		return nil, err
+	}
+	c.cfg = cfg
+	c.timeout = cfg.Settings.Timeout
+	return c, nil
+}
+
 // NewWithHTTPClient creates a client with a custom HTTP client (for testing).
 func NewWithHTTPClient(ctx context.Context, httpClient *http.Client) (*Client, error) {
 	svc, err := tasks.NewService(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
 		return nil, err
 	}
-	return &Client{svc: svc}, nil
+	return &Client{svc: svc, http: httpClient}, nil
 }
 
 // DefaultList returns the user's default task list.
 func (c *Client) DefaultList(ctx context.Context) (service.TaskList, error) {
-	ctx, cancel := context.WithTimeout(ctx, APITimeout)
-	defer cancel()
-
-	list, err := c.svc.Tasklists.Get(DefaultListID).Context(ctx).Do()
+	list, err := c.defaultTaskList(ctx)
 	if err != nil {
-		return service.TaskList{}, wrapError(err)
+		return service.TaskList{}, err
 	}
 
 	return service.TaskList{
@@ -117,114 +181,168 @@ func (c *Client) DefaultList(ctx context.Context) (service.TaskList, error) {
 }
 
 // ListLists returns all task lists in API order.
+// Each request gets its own timeout.
 func (c *Client) ListLists(ctx context.Context) ([]service.TaskList, error) {
-	ctx, cancel := context.WithTimeout(ctx, APITimeout)
-	defer cancel()
-
 	// First, get the default list to know its real ID
-	defaultList, err := c.svc.Tasklists.Get(DefaultListID).Context(ctx).Do()
+	defaultList, err := c.defaultTaskList(ctx)
 	if err != nil {
-		return nil, wrapError(err)
+		return nil, err
 	}
-	defaultRealID := defaultList.Id
 
 	// List all task lists
-	var result []service.TaskList
-	err = c.svc.Tasklists.List().MaxResults(100).Pages(ctx, func(resp *tasks.TaskLists) error {
-		for _, list := range resp.Items {
-			isDefault := list.Id == defaultRealID
-			id := list.Id
-			if isDefault {
-				id = DefaultListID // Normalize to @default
-			}
-			result = append(result, service.TaskList{
-				ID:        id,
-				Title:     list.Title,
-				IsDefault: isDefault,
-			})
+	var items []*tasks.TaskList
+	var token string
+	for {
+		resp, err := c.listsPage(ctx, token, "")
+		if err != nil {
+			return nil, err
 		}
-		return nil
-	})
+		items = append(items, resp.Items...)
+		if token = resp.NextPageToken; token == "" {
+			break
+		}
+	}
+
+	return convertLists(items, defaultList.Id), nil
+}
+
+// ListListsIfNoneMatch implements service.Revalidator.
+// The etag is the one Google returns for the first page of tasklists.list.
+func (c *Client) ListListsIfNoneMatch(ctx context.Context, etag string) ([]service.TaskList, string, error) {
+	resp, err := c.listsPage(ctx, "", etag)
+	if errors.Is(err, service.ErrNotModified) {
+		return nil, etag, err
+	}
 	if err != nil {
-		return nil, wrapError(err)
+		return nil, "", err
 	}
 
-	return result, nil
+	// Remaining pages are fetched unconditionally
+	items := resp.Items
+	for token := resp.NextPageToken; token != ""; {
+		page, err := c.listsPage(ctx, token, "")
+		if err != nil {
+			return nil, "", err
+		}
+		items = append(items, page.Items...)
+		token = page.NextPageToken
+	}
+
+	// The lists changed, so look up the default list's real ID again
+	defaultList, err := c.defaultTaskList(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return convertLists(items, defaultList.Id), resp.Etag, nil
 }
 
-// ResolveList finds a list by name (case-insensitive, trimmed).
-func (c *Client) ResolveList(ctx context.Context, name string) (service.TaskList, error) {
-	name = strings.TrimSpace(name)
-	nameLower := strings.ToLower(name)
+// defaultTaskList fetches the default list.
+func (c *Client) defaultTaskList(ctx context.Context) (*tasks.TaskList, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.apiTimeout())
+	defer cancel()
 
-	lists, err := c.ListLists(ctx)
+	list, err := c.svc.Tasklists.Get(DefaultListID).Context(ctx).Do()
 	if err != nil {
-		return service.TaskList{}, err
+		return nil, c.wrapError(ctx, err)
+	}
+	return list, nil
+}
+
+// listsPage fetches the page of task lists starting at token ("" for the
+// first page). A non-empty etag makes the request conditional; an unchanged
+// first page returns service.ErrNotModified.
+func (c *Client) listsPage(ctx context.Context, token, etag string) (*tasks.TaskLists, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.apiTimeout())
+	defer cancel()
+
+	call := c.svc.Tasklists.List().MaxResults(100).Context(ctx)
+	if token != "" {
+		call.PageToken(token)
+	}
+	if etag != "" {
+		call.IfNoneMatch(etag)
+	}
+	resp, err := call.Do()
+	if googleapi.IsNotModified(err) {
+		return nil, service.ErrNotModified
+	}
+	if err != nil {
+		return nil, c.wrapError(ctx, err)
 	}
+	return resp, nil
+}
 
-	var matches []service.TaskList
-	for _, list := range lists {
-		if strings.ToLower(strings.TrimSpace(list.Title)) == nameLower {
-			matches = append(matches, list)
+// convertLists converts API task lists, marking the default list and
+// normalizing its ID to @default.
+func convertLists(items []*tasks.TaskList, defaultRealID string) []service.TaskList {
+	var result []service.TaskList
+	for _, list := range items {
+		isDefault := list.Id == defaultRealID
+		id := list.Id
+		if isDefault {
+			id = DefaultListID // Normalize to @default
 		}
+		result = append(result, service.TaskList{
+			ID:        id,
+			Title:     list.Title,
+			IsDefault: isDefault,
+		})
 	}
+	return result
+}
 
-	switch len(matches) {
-	case 0:
-		return service.TaskList{}, fmt.Errorf("list not found: %s", name)
-	case 1:
-		return matches[0], nil
-	default:
-		return service.TaskList{}, fmt.Errorf("ambiguous list name: %s", name)
+// ResolveList finds a list by name (case-insensitive, trimmed).
+func (c *Client) ResolveList(ctx context.Context, name string) (service.TaskList, error) {
+	lists, err := c.ListLists(ctx)
+	if err != nil {
+		return service.TaskList{}, err
 	}
+	return service.MatchList(lists, name)
 }
 
 // CreateList creates a new task list.
 func (c *Client) CreateList(ctx context.Context, name string) error {
-	ctx, cancel := context.WithTimeout(ctx, APITimeout)
+	if c.readOnly {
+		return c.readOnlyError()
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.apiTimeout())
 	defer cancel()
 
 	_, err := c.svc.Tasklists.Insert(&tasks.TaskList{Title: name}).Context(ctx).Do()
 	if err != nil {
-		return wrapError(err)
+		return c.wrapError(ctx, err)
 	}
 	return nil
 }
 
 // DeleteList deletes a task list by ID.
 func (c *Client) DeleteList(ctx context.Context, listID string) error {
-	ctx, cancel := context.WithTimeout(ctx, APITimeout)
+	if c.readOnly {
+		return c.readOnlyError()
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.apiTimeout())
 	defer cancel()
 
 	err := c.svc.Tasklists.Delete(listID).Context(ctx).Do()
 	if err != nil {
-		return wrapError(err)
+		return c.wrapError(ctx, err)
 	}
 	return nil
 }
 
 // ListOpenTasks returns open tasks for a list.
+// Each page fetch gets its own timeout.
 func (c *Client) ListOpenTasks(ctx context.Context, listID string, page int) ([]service.Task, error) {
-	ctx, cancel := context.WithTimeout(ctx, APITimeout)
-	defer cancel()
-
-	// Build request
-	call := c.svc.Tasks.List(listID).
-		MaxResults(PageSize).
-		ShowCompleted(false).
-		ShowDeleted(false).
-		ShowHidden(false).
-		Context(ctx)
-
 	// Handle pagination by fetching pages until we reach the requested one
 	// Google Tasks API uses page tokens, not page numbers
 	currentPage := 1
 	var pageToken string
 
 	for currentPage < page {
-		resp, err := call.PageToken(pageToken).Do()
+		resp, err := c.openTasksPage(ctx, listID, pageToken)
 		if err != nil {
-			return nil, wrapError(err)
+			return nil, err
 		}
 		if resp.NextPageToken == "" {
 			// No more pages, requested page is out of range
@@ -235,9 +353,9 @@ func (c *Client) ListOpenTasks(ctx context.Context, listID string, page int) ([]
 	}
 
 	// Fetch the requested page
-	resp, err := call.PageToken(pageToken).Do()
+	resp, err := c.openTasksPage(ctx, listID, pageToken)
 	if err != nil {
-		return nil, wrapError(err)
+		return nil, err
 	}
 
 	var result []service.Task
@@ -247,15 +365,35 @@ func (c *Client) ListOpenTasks(ctx context.Context, listID string, page int) ([]
 			Title:    task.Title,
 			Position: task.Position,
 			Status:   task.Status,
+			Due:      parseDue(task.Due),
 		})
 	}
 
 	return result, nil
 }
 
+// openTasksPage fetches the page of open tasks starting at pageToken.
+func (c *Client) openTasksPage(ctx context.Context, listID, pageToken string) (*tasks.Tasks, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.apiTimeout())
+	defer cancel()
+
+	resp, err := c.svc.Tasks.List(listID).
+		MaxResults(PageSize).
+		ShowCompleted(false).
+		ShowDeleted(false).
+		ShowHidden(false).
+		PageToken(pageToken).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, c.wrapError(ctx, err)
+	}
+	return resp, nil
+}
+
 // HasOpenTasks checks if a list has any open tasks.
 func (c *Client) HasOpenTasks(ctx context.Context, listID string) (bool, error) {
-	ctx, cancel := context.WithTimeout(ctx, APITimeout)
+	ctx, cancel := context.WithTimeout(ctx, c.apiTimeout())
 	defer cancel()
 
 	resp, err := c.svc.Tasks.List(listID).
@@ -266,7 +404,29 @@ func (c *Client) HasOpenTasks(ctx context.Context, listID string) (bool, error)
 		Context(ctx).
 		Do()
 	if err != nil {
-		return false, wrapError(err)
+		return false, c.wrapError(ctx, err)
+	}
+
+	return len(resp.Items) > 0, nil
+}
+
+// TasksModifiedSince implements service.Revalidator.
+// Completed, deleted and hidden tasks are included so that any change
+// to the list's open tasks is detected.
+func (c *Client) TasksModifiedSince(ctx context.Context, listID string, since time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.apiTimeout())
+	defer cancel()
+
+	resp, err := c.svc.Tasks.List(listID).
+		MaxResults(1).
+		ShowCompleted(true).
+		ShowDeleted(true).
+		ShowHidden(true).
+		UpdatedMin(since.UTC().Format(time.RFC3339)).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return false, c.wrapError(ctx, err)
 	}
 
 	return len(resp.Items) > 0, nil
@@ -274,64 +434,132 @@ func (c *Client) HasOpenTasks(ctx context.Context, listID string) (bool, error)
 
 // CreateTask creates a new task in the specified list.
 func (c *Client) CreateTask(ctx context.Context, listID, title string) error {
-	ctx, cancel := context.WithTimeout(ctx, APITimeout)
+	if c.readOnly {
+		return c.readOnlyError()
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.apiTimeout())
 	defer cancel()
 
 	_, err := c.svc.Tasks.Insert(listID, &tasks.Task{Title: title}).Context(ctx).Do()
 	if err != nil {
-		return wrapError(err)
+		return c.wrapError(ctx, err)
 	}
 	return nil
 }
 
 // CompleteTask marks a task as completed.
 func (c *Client) CompleteTask(ctx context.Context, listID, taskID string) error {
-	ctx, cancel := context.WithTimeout(ctx, APITimeout)
+	if c.readOnly {
+		return c.readOnlyError()
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.apiTimeout())
 	defer cancel()
 
 	_, err := c.svc.Tasks.Patch(listID, taskID, &tasks.Task{
 		Status: "completed",
 	}).Context(ctx).Do()
 	if err != nil {
-		return wrapError(err)
+		return c.wrapError(ctx, err)
 	}
 	return nil
 }
 
 // DeleteTask deletes a task.
 func (c *Client) DeleteTask(ctx context.Context, listID, taskID string) error {
-	ctx, cancel := context.WithTimeout(ctx, APITimeout)
+	if c.readOnly {
+		return c.readOnlyError()
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.apiTimeout())
 	defer cancel()
 
 	err := c.svc.Tasks.Delete(listID, taskID).Context(ctx).Do()
 	if err != nil {
-		return wrapError(err)
+		return c.wrapError(ctx, err)
 	}
 	return nil
 }
 
-// wrapError wraps API errors with user-friendly messages.
-func wrapError(err error) error {
+// apiTimeout returns the timeout for one API request.
+func (c *Client) apiTimeout() time.Duration {
+	if c.timeout > 0 {
+		return c.timeout
+	}
+	return APITimeout
+}
+
+// readOnlyError returns the error for a change under a read-only login.
+func (c *Client) readOnlyError() error {
+	return fmt.Errorf("%w (run: %s)", errReadOnly, c.loginCommand())
+}
+
+// loginCommand returns the command that logs in to the client's profile.
+func (c *Client) loginCommand() string {
+	if c.cfg == nil {
+		return "gtask login"
+	}
+	return c.cfg.ProfileCommand("login")
+}
+
+// wrapError wraps API errors with user-friendly messages. ctx is the
+// context of the failed request.
+func (c *Client) wrapError(ctx context.Context, err error) error {
 	if err == nil {
 		return nil
 	}
 
+	// A replayed session asked for more than was recorded (--replay)
+	if errors.Is(err, transport.ErrNotRecorded) {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+
 	errStr := err.Error()
 
-	// Check for timeout
-	if strings.Contains(errStr, "context deadline exceeded") {
-		return fmt.Errorf("request timed out")
+	// Check for timeout: of this request, or of the whole command
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || strings.Contains(errStr, "context deadline exceeded") {
+		return service.TimeoutError(ctx)
+	}
+
+	// Check for network failures (DNS, connection refused, no route)
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return service.Unavailable(err)
+	}
+
+	// Check for exhausted quota, which Google reports as 403 too
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		quota := apiErr.Code == http.StatusTooManyRequests
+		for _, item := range apiErr.Errors {
+			quota = quota || transport.IsQuotaReason(item.Reason)
+		}
+		if quota {
+			return errors.New("Google Tasks quota exceeded (try again later, or lower rate_limit)")
+		}
 	}
 
 	// Check for auth errors
 	if strings.Contains(errStr, "401") || strings.Contains(errStr, "403") {
-		return fmt.Errorf("token expired or revoked (run: gtask login)")
+		return fmt.Errorf("token expired or revoked (run: %s)", c.loginCommand())
 	}
 
 	// Check for not found
 	if strings.Contains(errStr, "404") {
-		return fmt.Errorf("not found")
+		return service.Conflict(errors.New("not found"))
 	}
 
 	return err
 }
+
+// parseDue parses the RFC 3339 due timestamp of a task. The API only keeps
+// the date part. Returns the zero time if due is empty or malformed.
+func parseDue(due string) time.Time {
+	t, err := time.Parse(time.RFC3339, due)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
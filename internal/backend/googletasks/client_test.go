@@ -0,0 +1,370 @@
+package googletasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gtask/internal/config"
+	"gtask/internal/outbox"
+	"gtask/internal/service"
+	"gtask/internal/service/servicetest"
+	"gtask/internal/testutil/tasksapi"
+	"gtask/internal/transport"
+)
+
+// newEmulated returns a client talking to a fresh Tasks API emulator.
+func newEmulated(t *testing.T) (*Client, *tasksapi.Server) {
+	t.Helper()
+	api := tasksapi.NewServer()
+	t.Cleanup(api.Close)
+	c, err := NewWithHTTPClient(context.Background(), api.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, api
+}
+
+func TestClient_ListListsNormalizesDefault(t *testing.T) {
+	c, api := newEmulated(t)
+	workID := api.AddList("Work")
+	ctx := context.Background()
+
+	lists, err := c.ListLists(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []service.TaskList{
+		{ID: DefaultListID, Title: tasksapi.DefaultListTitle, IsDefault: true},
+		{ID: workID, Title: "Work"},
+	}
+	if len(lists) != len(want) || lists[0] != want[0] || lists[1] != want[1] {
+		t.Errorf("ListLists() = %v, want %v", lists, want)
+	}
+
+	list, err := c.ResolveList(ctx, "  my TASKS ")
+	if err != nil || list.ID != DefaultListID {
+		t.Errorf("expected @default for the default list's title, got %v, %v", list, err)
+	}
+	list, err = c.DefaultList(ctx)
+	if err != nil || list.ID != DefaultListID || !list.IsDefault {
+		t.Errorf("DefaultList() = %v, %v", list, err)
+	}
+}
+
+func TestClient_ListOpenTasksPages(t *testing.T) {
+	c, api := newEmulated(t)
+	ctx := context.Background()
+	var ids []string
+	for i := range 2*PageSize + 50 {
+		ids = append(ids, api.AddTask(DefaultListID, "Task "+strconv.Itoa(i+1)))
+	}
+	if err := c.CompleteTask(ctx, DefaultListID, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	api.ResetRequests()
+	tasks, err := c.ListOpenTasks(ctx, DefaultListID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 49 || tasks[0].Title != "Task 202" || tasks[48].Title != "Task 250" {
+		t.Errorf("expected tasks 202-250 on page 3, got %d starting with %v", len(tasks), tasks[0])
+	}
+	if got := len(api.Requests()); got != 3 {
+		t.Errorf("expected 3 page requests, got %d: %v", got, api.Requests())
+	}
+
+	tasks, err = c.ListOpenTasks(ctx, DefaultListID, 4)
+	if err != nil || tasks != nil {
+		t.Errorf("expected no tasks past the last page, got %v, %v", tasks, err)
+	}
+}
+
+func TestClient_TaskMutations(t *testing.T) {
+	c, api := newEmulated(t)
+	ctx := context.Background()
+	listID := api.AddList("Errands")
+
+	for _, title := range []string{"Milk", "Bread"} {
+		if err := c.CreateTask(ctx, listID, title); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tasks, err := c.ListOpenTasks(ctx, listID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// New tasks go on top, as in Google Tasks
+	if len(tasks) != 2 || tasks[0].Title != "Bread" || tasks[1].Title != "Milk" {
+		t.Fatalf("unexpected tasks %v", tasks)
+	}
+
+	if err := c.CompleteTask(ctx, listID, tasks[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.Task(listID, tasks[0].ID); got.Status != "completed" || got.Completed == nil {
+		t.Errorf("expected task completed with a completion time, got %+v", got)
+	}
+	if err := c.DeleteTask(ctx, listID, tasks[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if open, err := c.HasOpenTasks(ctx, listID); err != nil || open {
+		t.Errorf("expected no open tasks, got %v, %v", open, err)
+	}
+
+	if err := c.CompleteTask(ctx, listID, tasks[1].ID); !errors.Is(err, service.ErrConflict) || err.Error() != "not found" {
+		t.Errorf("expected not found for a deleted task, got %v", err)
+	}
+	if err := c.CreateTask(ctx, "no-such-list", "Milk"); err == nil || err.Error() != "not found" {
+		t.Errorf("expected not found for a missing list, got %v", err)
+	}
+}
+
+func TestClient_Lists(t *testing.T) {
+	c, api := newEmulated(t)
+	ctx := context.Background()
+
+	if err := c.CreateList(ctx, "Work"); err != nil {
+		t.Fatal(err)
+	}
+	list, err := c.ResolveList(ctx, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteList(ctx, list.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ResolveList(ctx, "work"); err == nil || !strings.HasPrefix(err.Error(), "list not found") {
+		t.Errorf("expected list not found after delete, got %v", err)
+	}
+	if err := c.DeleteList(ctx, api.DefaultListID()); err == nil {
+		t.Error("expected the default list not to be deletable")
+	}
+}
+
+func TestClient_ListListsIfNoneMatch(t *testing.T) {
+	c, api := newEmulated(t)
+	ctx := context.Background()
+
+	lists, etag, err := c.ListListsIfNoneMatch(ctx, "")
+	if err != nil || len(lists) != 1 || etag == "" {
+		t.Fatalf("expected the default list and an etag, got %v, %q, %v", lists, etag, err)
+	}
+	if _, got, err := c.ListListsIfNoneMatch(ctx, etag); !errors.Is(err, service.ErrNotModified) || got != etag {
+		t.Errorf("expected not modified, got %q, %v", got, err)
+	}
+
+	api.AddList("Work")
+	lists, newTag, err := c.ListListsIfNoneMatch(ctx, etag)
+	if err != nil || len(lists) != 2 || newTag == etag {
+		t.Errorf("expected new lists and etag, got %v, %q, %v", lists, newTag, err)
+	}
+}
+
+func TestClient_TasksModifiedSince(t *testing.T) {
+	c, api := newEmulated(t)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	api.SetNow(func() time.Time { return now })
+	id := api.AddTask(DefaultListID, "Milk")
+
+	since := now.Add(time.Minute)
+	if changed, err := c.TasksModifiedSince(ctx, DefaultListID, since); err != nil || changed {
+		t.Errorf("expected no changes, got %v, %v", changed, err)
+	}
+
+	// Completing hides the task from open lists but counts as a change
+	now = now.Add(2 * time.Minute)
+	if err := c.CompleteTask(ctx, DefaultListID, id); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := c.TasksModifiedSince(ctx, DefaultListID, since); err != nil || !changed {
+		t.Errorf("expected a change, got %v, %v", changed, err)
+	}
+}
+
+func TestClient_WrapsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		fault   tasksapi.Fault
+		check   func(error) bool
+	}{
+		{"unauthorized", "", tasksapi.Fault{Status: http.StatusUnauthorized}, func(err error) bool {
+			return strings.Contains(err.Error(), "run: gtask login")
+		}},
+		{"forbidden", "work", tasksapi.Fault{Status: http.StatusForbidden}, func(err error) bool {
+			return strings.Contains(err.Error(), "run: gtask login --profile work")
+		}},
+		{"quota", "", tasksapi.Fault{Status: http.StatusForbidden, Reason: "rateLimitExceeded"}, func(err error) bool {
+			return strings.Contains(err.Error(), "quota exceeded") && !strings.Contains(err.Error(), "login")
+		}},
+		{"user quota", "", tasksapi.Fault{Status: http.StatusForbidden, Reason: "userRateLimitExceeded"}, func(err error) bool {
+			return strings.Contains(err.Error(), "quota exceeded") && !strings.Contains(err.Error(), "login")
+		}},
+		{"timeout", "", tasksapi.Fault{Delay: time.Second}, func(err error) bool {
+			return errors.Is(err, service.ErrUnavailable) && strings.Contains(err.Error(), "timed out")
+		}},
+		{"server error", "", tasksapi.Fault{Status: http.StatusInternalServerError}, func(err error) bool {
+			return strings.Contains(err.Error(), "500")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, api := newEmulated(t)
+			c.timeout = 50 * time.Millisecond
+			c.cfg = &config.Config{Profile: tt.profile}
+			tt.fault.Path = "lists/"
+			api.Inject(tt.fault)
+
+			_, err := c.HasOpenTasks(context.Background(), DefaultListID)
+			if err == nil || !tt.check(err) {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_BatchAgainstEmulator(t *testing.T) {
+	c, api := newEmulated(t)
+	ctx := context.Background()
+	var ops []service.Op
+	for i := range 120 {
+		id := api.AddTask(DefaultListID, "Task "+strconv.Itoa(i+1))
+		ops = append(ops, service.Op{Kind: service.OpComplete, ListID: DefaultListID, TaskID: id})
+	}
+	// Fail one item inside the second batch
+	api.Inject(tasksapi.Fault{Method: http.MethodPatch, Path: "lists/@default/tasks/" + ops[70].TaskID, Status: http.StatusNotFound})
+
+	api.ResetRequests()
+	errs, err := c.Batch(ctx, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(api.Requests()); got != 3 {
+		t.Errorf("expected 3 batch requests for 120 ops, got %d", got)
+	}
+	for i, err := range errs {
+		if i == 70 {
+			if err == nil || err.Error() != "not found" {
+				t.Errorf("op %d: expected not found, got %v", i, err)
+			}
+		} else if err != nil {
+			t.Errorf("op %d: unexpected error %v", i, err)
+		}
+	}
+	if open, err := c.HasOpenTasks(ctx, DefaultListID); err != nil || !open {
+		t.Errorf("expected the failed task to stay open, got %v, %v", open, err)
+	}
+}
+
+func TestClient_SyncSendsIndependentChangesInOneBatch(t *testing.T) {
+	c, api := newEmulated(t)
+	ctx := context.Background()
+	box := outbox.Open(filepath.Join(t.TempDir(), "outbox.json"))
+	for i := range 5 {
+		id := api.AddTask(DefaultListID, "Task "+strconv.Itoa(i+1))
+		kind := outbox.CompleteTask
+		if i%2 == 1 {
+			kind = outbox.DeleteTask
+		}
+		box.Append(outbox.Op{Kind: kind, ListID: DefaultListID, TaskID: id, Title: "Task " + strconv.Itoa(i+1)})
+	}
+	// A create keeps its place: it goes alone, after the batch
+	box.Append(outbox.Op{Kind: outbox.CreateTask, ListID: DefaultListID, Title: "New"})
+
+	api.ResetRequests()
+	results, err := outbox.Replay(ctx, box, c)
+	if err != nil || len(results) != 6 {
+		t.Fatalf("unexpected replay results %+v, %v", results, err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: unexpected error %v", r.Op.Describe(), r.Err)
+		}
+	}
+	// The create lists the tasks first, to tell its task apart if the
+	// insert is not answered
+	if got := api.Requests(); len(got) != 3 {
+		t.Errorf("expected one batch request, one listing and one insert, got %q", got)
+	}
+	tasks, err := c.ListOpenTasks(ctx, DefaultListID, 1)
+	if err != nil || len(tasks) != 1 || tasks[0].Title != "New" {
+		t.Errorf("expected only the new task open, got %+v, %v", tasks, err)
+	}
+	if ops, _ := box.Ops(); len(ops) != 0 {
+		t.Errorf("expected the outbox drained, got %+v", ops)
+	}
+}
+
+func TestClient_RecordAndReplay(t *testing.T) {
+	api := tasksapi.NewServer()
+	t.Cleanup(api.Close)
+	api.AddTask(DefaultListID, "Milk")
+	ctx := context.Background()
+
+	session := func(c *Client) (string, error) {
+		if err := c.CreateTask(ctx, DefaultListID, "Bread"); err != nil {
+			return "", err
+		}
+		lists, err := c.ListLists(ctx)
+		if err != nil {
+			return "", err
+		}
+		tasks, err := c.ListOpenTasks(ctx, DefaultListID, 1)
+		if err != nil {
+			return "", err
+		}
+		errs, err := c.Batch(ctx, []service.Op{
+			{Kind: service.OpComplete, ListID: DefaultListID, TaskID: tasks[0].ID},
+			{Kind: service.OpDelete, ListID: DefaultListID, TaskID: "missing"},
+		})
+		return fmt.Sprint(lists, tasks, errs), err
+	}
+
+	path := filepath.Join(t.TempDir(), "session.json")
+	httpClient := api.Client()
+	httpClient.Transport = transport.NewRecord(httpClient.Transport, path)
+	recorded, err := NewWithHTTPClient(ctx, httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := session(recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaying needs no login and sends no requests
+	requests := len(api.Requests())
+	replayed, err := New(ctx, &config.Config{Dir: t.TempDir(), Replay: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := session(replayed)
+	if err != nil || got != want {
+		t.Errorf("replayed session = %q, %v, want %q", got, err, want)
+	}
+	if n := len(api.Requests()); n != requests {
+		t.Errorf("expected no requests while replaying, got %d", n-requests)
+	}
+
+	// Past the end of the recording
+	_, err = replayed.DefaultList(ctx)
+	if !errors.Is(err, transport.ErrNotRecorded) || !strings.HasPrefix(err.Error(), "replay: no recorded response for GET https://tasks.googleapis.com/tasks/v1/users/@me/lists/%40default") {
+		t.Errorf("expected not recorded error, got %v", err)
+	}
+}
+
+func TestClient_Conformance(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) service.Service {
+		c, _ := newEmulated(t)
+		return c
+	})
+}
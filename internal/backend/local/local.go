@@ -0,0 +1,343 @@
+// Package local implements the service.Service interface on top of a JSON
+// file in the config directory. It needs no account and no network.
+package local
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gtask/internal/backend"
+	"gtask/internal/config"
+	"gtask/internal/fsutil"
+	"gtask/internal/service"
+)
+
+const (
+	// Name is the backend name.
+	Name = "local"
+
+	// DataFile is the task store filename in the config directory.
+	DataFile = "tasks.json"
+
+	// DefaultListID is the ID of the default list.
+	DefaultListID = "@default"
+
+	// DefaultListTitle is the title of the default list in a new store.
+	DefaultListTitle = "My Tasks"
+
+	// formatVersion is the current on-disk format version.
+	formatVersion = 1
+)
+
+func init() {
+	backend.Register(backend.Backend{
+		Name:     Name,
+		Synopsis: "JSON file in the config directory (tasks.json)",
+		New: func(ctx context.Context, cfg *config.Config) (service.Service, error) {
+			return New(cfg), nil
+		},
+	})
+}
+
+// errNotFound is returned when a list or task does not exist.
+var errNotFound = service.Conflict(errors.New("not found"))
+
+// store is the on-disk layout.
+type store struct {
+	Version int         `json:"version"`
+	Lists   []storeList `json:"lists"`
+}
+
+type storeList struct {
+	ID        string      `json:"id"`
+	Title     string      `json:"title"`
+	IsDefault bool        `json:"default,omitempty"`
+	Tasks     []storeTask `json:"tasks"`
+}
+
+type storeTask struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	Status    string     `json:"status"`
+	Updated   time.Time  `json:"updated"`
+	Completed *time.Time `json:"completed,omitempty"`
+}
+
+// Store implements service.Service using a JSON file.
+// Every mutation is a locked read-modify-write with an atomic rename,
+// so concurrent gtask processes never corrupt or lose data.
+type Store struct {
+	path string
+}
+
+// New creates a store backed by tasks.json in the config directory.
+// The file is created on the first mutation.
+func New(cfg *config.Config) *Store {
+	return NewWithPath(filepath.Join(cfg.Dir, DataFile))
+}
+
+// NewWithPath creates a store backed by the file at path.
+func NewWithPath(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path returns the data file path.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// DefaultList implements service.Service.
+func (s *Store) DefaultList(ctx context.Context) (service.TaskList, error) {
+	st, err := s.read()
+	if err != nil {
+		return service.TaskList{}, err
+	}
+	for _, l := range st.Lists {
+		if l.IsDefault {
+			return toTaskList(l), nil
+		}
+	}
+	return service.TaskList{}, errors.New("no default list")
+}
+
+// ListLists implements service.Service.
+func (s *Store) ListLists(ctx context.Context) ([]service.TaskList, error) {
+	st, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]service.TaskList, 0, len(st.Lists))
+	for _, l := range st.Lists {
+		result = append(result, toTaskList(l))
+	}
+	return result, nil
+}
+
+// ResolveList implements service.Service.
+func (s *Store) ResolveList(ctx context.Context, name string) (service.TaskList, error) {
+	lists, err := s.ListLists(ctx)
+	if err != nil {
+		return service.TaskList{}, err
+	}
+	return service.MatchList(lists, name)
+}
+
+// CreateList implements service.Service.
+func (s *Store) CreateList(ctx context.Context, name string) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	return s.modify(func(st *store) error {
+		st.Lists = append(st.Lists, storeList{ID: id, Title: name})
+		return nil
+	})
+}
+
+// DeleteList implements service.Service.
+func (s *Store) DeleteList(ctx context.Context, listID string) error {
+	return s.modify(func(st *store) error {
+		for i, l := range st.Lists {
+			if l.ID == listID {
+				if l.IsDefault {
+					return errors.New("cannot delete default list")
+				}
+				st.Lists = append(st.Lists[:i], st.Lists[i+1:]...)
+				return nil
+			}
+		}
+		return errNotFound
+	})
+}
+
+// ListOpenTasks implements service.Service.
+func (s *Store) ListOpenTasks(ctx context.Context, listID string, page int) ([]service.Task, error) {
+	open, err := s.openTasks(listID)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.Page(open, page), nil
+}
+
+// HasOpenTasks implements service.Service.
+func (s *Store) HasOpenTasks(ctx context.Context, listID string) (bool, error) {
+	open, err := s.openTasks(listID)
+	if err != nil {
+		return false, err
+	}
+	return len(open) > 0, nil
+}
+
+// CreateTask implements service.Service.
+func (s *Store) CreateTask(ctx context.Context, listID, title string) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	return s.modify(func(st *store) error {
+		l := st.list(listID)
+		if l == nil {
+			return errNotFound
+		}
+		l.Tasks = append(l.Tasks, storeTask{
+			ID:      id,
+			Title:   title,
+			Status:  "needsAction",
+			Updated: time.Now().UTC(),
+		})
+		return nil
+	})
+}
+
+// CompleteTask implements service.Service.
+func (s *Store) CompleteTask(ctx context.Context, listID, taskID string) error {
+	return s.modify(func(st *store) error {
+		t := st.task(listID, taskID)
+		if t == nil {
+			return errNotFound
+		}
+		now := time.Now().UTC()
+		t.Status = "completed"
+		t.Completed = &now
+		t.Updated = now
+		return nil
+	})
+}
+
+// DeleteTask implements service.Service.
+func (s *Store) DeleteTask(ctx context.Context, listID, taskID string) error {
+	return s.modify(func(st *store) error {
+		l := st.list(listID)
+		if l == nil {
+			return errNotFound
+		}
+		for i, t := range l.Tasks {
+			if t.ID == taskID {
+				l.Tasks = append(l.Tasks[:i], l.Tasks[i+1:]...)
+				return nil
+			}
+		}
+		return errNotFound
+	})
+}
+
+// openTasks returns the open tasks of a list in stored order.
+func (s *Store) openTasks(listID string) ([]service.Task, error) {
+	st, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	l := st.list(listID)
+	if l == nil {
+		return nil, errNotFound
+	}
+
+	var open []service.Task
+	for i, t := range l.Tasks {
+		if t.Status != "completed" {
+			open = append(open, service.Task{
+				ID:       t.ID,
+				Title:    t.Title,
+				Position: fmt.Sprintf("%020d", i),
+				Status:   t.Status,
+			})
+		}
+	}
+	return open, nil
+}
+
+// read loads the store. A missing file yields a new store with only the
+// default list.
+func (s *Store) read() (*store, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return &store{
+			Version: formatVersion,
+			Lists:   []storeList{{ID: DefaultListID, Title: DefaultListTitle, IsDefault: true}},
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+
+	var st store
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", s.path, err)
+	}
+	if st.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported %s version: %d", s.path, st.Version)
+	}
+	return &st, nil
+}
+
+// modify applies fn to the store under an exclusive lock and writes the
+// result atomically. Nothing is written if fn returns an error.
+func (s *Store) modify(fn func(*store) error) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	unlock, err := fsutil.Lock(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", s.path, err)
+	}
+	defer unlock()
+
+	st, err := s.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(st); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(s.path, data, 0600)
+}
+
+// list returns the list with the given ID, or nil.
+func (st *store) list(listID string) *storeList {
+	for i := range st.Lists {
+		if st.Lists[i].ID == listID {
+			return &st.Lists[i]
+		}
+	}
+	return nil
+}
+
+// task returns the task with the given ID in a list, or nil.
+func (st *store) task(listID, taskID string) *storeTask {
+	l := st.list(listID)
+	if l == nil {
+		return nil
+	}
+	for i := range l.Tasks {
+		if l.Tasks[i].ID == taskID {
+			return &l.Tasks[i]
+		}
+	}
+	return nil
+}
+
+func toTaskList(l storeList) service.TaskList {
+	return service.TaskList{ID: l.ID, Title: l.Title, IsDefault: l.IsDefault}
+}
+
+// newID returns a random 16-character hex ID.
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,151 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"gtask/internal/service"
+	"gtask/internal/service/servicetest"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	return NewWithPath(filepath.Join(t.TempDir(), DataFile))
+}
+
+func TestStore_NewStoreHasDefaultList(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	list, err := s.DefaultList(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.ID != DefaultListID || list.Title != DefaultListTitle || !list.IsDefault {
+		t.Errorf("unexpected default list: %+v", list)
+	}
+	if has, _ := s.HasOpenTasks(ctx, DefaultListID); has {
+		t.Error("expected no tasks in a new store")
+	}
+}
+
+func TestStore_TaskLifecycle(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	for _, title := range []string{"First", "Second", "Third"} {
+		if err := s.CreateTask(ctx, DefaultListID, title); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tasks, err := s.ListOpenTasks(ctx, DefaultListID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 3 || tasks[0].Title != "First" || tasks[2].Title != "Third" {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+
+	if err := s.CompleteTask(ctx, DefaultListID, tasks[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteTask(ctx, DefaultListID, tasks[2].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second store on the same file sees the changes
+	tasks, err = NewWithPath(s.Path()).ListOpenTasks(ctx, DefaultListID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Title != "Second" {
+		t.Errorf("expected only 'Second' to remain, got %+v", tasks)
+	}
+
+	if err := s.CompleteTask(ctx, DefaultListID, "missing"); err == nil || err.Error() != "not found" {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestStore_Lists(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	if err := s.CreateList(ctx, "Work"); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.ResolveList(ctx, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Title != "Work" || list.IsDefault {
+		t.Errorf("unexpected list: %+v", list)
+	}
+	if _, err := s.ResolveList(ctx, "Home"); err == nil {
+		t.Error("expected error for unknown list")
+	}
+
+	if err := s.DeleteList(ctx, DefaultListID); err == nil {
+		t.Error("expected error deleting the default list")
+	}
+	if err := s.DeleteList(ctx, list.ID); err != nil {
+		t.Fatal(err)
+	}
+	lists, _ := s.ListLists(ctx)
+	if len(lists) != 1 {
+		t.Errorf("expected only the default list, got %+v", lists)
+	}
+}
+
+func TestStore_Paging(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	for i := 0; i < 150; i++ {
+		s.CreateTask(ctx, DefaultListID, fmt.Sprintf("Task %d", i+1))
+	}
+	page1, _ := s.ListOpenTasks(ctx, DefaultListID, 1)
+	page2, _ := s.ListOpenTasks(ctx, DefaultListID, 2)
+	page3, _ := s.ListOpenTasks(ctx, DefaultListID, 3)
+	if len(page1) != 100 || len(page2) != 50 || len(page3) != 0 {
+		t.Errorf("unexpected page sizes: %d, %d, %d", len(page1), len(page2), len(page3))
+	}
+	if page2[0].Title != "Task 101" {
+		t.Errorf("expected page 2 to start at Task 101, got %q", page2[0].Title)
+	}
+}
+
+func TestStore_ConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DataFile)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Separate stores, like separate gtask processes
+			if err := NewWithPath(path).CreateTask(ctx, DefaultListID, fmt.Sprintf("Task %d", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	tasks, err := NewWithPath(path).ListOpenTasks(ctx, DefaultListID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 20 {
+		t.Errorf("expected 20 tasks, got %d", len(tasks))
+	}
+}
+
+func TestStore_Conformance(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) service.Service {
+		return newTestStore(t)
+	})
+}
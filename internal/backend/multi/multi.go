@@ -0,0 +1,145 @@
+// Package multi implements the "multi" backend, which shows the lists of
+// several backends (for example two Google accounts and a local file) in
+// one gtask invocation.
+//
+// The mounts are configured in mounts.json in the config directory. Each
+// mount is a backend with its own config directory, so it keeps its own
+// token, cache and offline outbox.
+package multi
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gtask/internal/backend"
+	"gtask/internal/config"
+	"gtask/internal/service"
+)
+
+const (
+	// Name is the backend name.
+	Name = "multi"
+
+	// ConfigFile lists the mounted backends.
+	ConfigFile = "mounts.json"
+
+	// mountsDir holds the default config directories of mounts.
+	mountsDir = "mounts"
+)
+
+func init() {
+	backend.Register(backend.Backend{
+		Name:       Name,
+		Synopsis:   "Several backends at once, configured in mounts.json",
+		ConfigFile: ConfigFile,
+		New: func(ctx context.Context, cfg *config.Config) (service.Service, error) {
+			return New(ctx, cfg, backend.DefaultRegistry)
+		},
+	})
+}
+
+// MountConfig is one entry of mounts.json.
+type MountConfig struct {
+	// Name prefixes the mount's lists, e.g. "work" in "work/Groceries".
+	Name string `json:"name"`
+
+	// Backend is the backend name (default "google").
+	Backend string `json:"backend,omitempty"`
+
+	// Config is the mount's config directory. "~/" is expanded. Defaults
+	// to mounts/<name> in the main config directory.
+	Config string `json:"config,omitempty"`
+}
+
+// Config is the content of mounts.json.
+type Config struct {
+	Mounts []MountConfig `json:"mounts"`
+}
+
+// New opens every mount listed in mounts.json using backends from r.
+func New(ctx context.Context, cfg *config.Config, r *backend.Registry) (*Mux, error) {
+	var mc Config
+	if err := backend.ReadConfig(cfg, ConfigFile, &mc); err != nil {
+		return nil, err
+	}
+	if len(mc.Mounts) == 0 {
+		return nil, fmt.Errorf("no mounts in %s", ConfigFile)
+	}
+
+	seen := make(map[string]bool)
+	var mounts []Mount
+	for _, m := range mc.Mounts {
+		if m.Name == "" || strings.Contains(m.Name, Separator) {
+			return nil, fmt.Errorf("invalid mount name in %s: %q", ConfigFile, m.Name)
+		}
+		if seen[strings.ToLower(m.Name)] {
+			return nil, fmt.Errorf("duplicate mount name in %s: %s", ConfigFile, m.Name)
+		}
+		seen[strings.ToLower(m.Name)] = true
+
+		mountCfg, err := mountConfig(cfg, m)
+		if err != nil {
+			return nil, fmt.Errorf("mount %s: %w", m.Name, err)
+		}
+		b, ok := r.Find(mountCfg.Backend)
+		if !ok || b.Name == Name {
+			return nil, fmt.Errorf("mount %s: unknown backend: %s", m.Name, mountCfg.Backend)
+		}
+		if b.NeedsOAuth && !mountCfg.HasToken() {
+			return nil, fmt.Errorf("mount %s: no token (run: gtask login --config %s)", m.Name, mountCfg.Dir)
+		}
+
+		svc, err := r.Open(ctx, mountCfg)
+		if err != nil {
+			return nil, fmt.Errorf("mount %s: %w", m.Name, err)
+		}
+		mounts = append(mounts, Mount{Name: m.Name, Service: svc})
+	}
+	return NewMux(mounts), nil
+}
+
+// mountConfig derives the config of a mount from the main config: same
+// flags, but the mount's own directory and backend, and the settings of
+// the mount's config.toml, as `gtask login --config <dir>` uses them. Only
+// the display settings and the command deadline come from the main config.
+// The mount has no profile, so hints name its directory.
+func mountConfig(cfg *config.Config, m MountConfig) (*config.Config, error) {
+	mountCfg := *cfg
+	mountCfg.Profile = ""
+	mountCfg.Backend = m.Backend
+	if mountCfg.Backend == "" {
+		mountCfg.Backend = config.BackendGoogle
+	}
+	mountCfg.Dir = expandHome(m.Config)
+	if mountCfg.Dir == "" {
+		mountCfg.Dir = filepath.Join(cfg.Dir, mountsDir, m.Name)
+	}
+	mountCfg.BaseDir = mountCfg.Dir
+
+	if err := mountCfg.LoadSettings(); err != nil {
+		return nil, err
+	}
+	own, main := &mountCfg.Settings, &cfg.Settings
+	own.DefaultList, own.Format, own.PageSize = main.DefaultList, main.Format, main.PageSize
+	own.HiddenLists, own.Color, own.Flags = main.HiddenLists, main.Color, main.Flags
+	own.Deadline = main.Deadline
+	if cfg.TimeoutFlag != 0 {
+		own.Timeout = cfg.TimeoutFlag
+	}
+	return &mountCfg, nil
+}
+
+// expandHome replaces a leading "~/" with the home directory.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
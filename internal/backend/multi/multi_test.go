@@ -0,0 +1,316 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gtask/internal/backend"
+	"gtask/internal/backend/todotxt"
+	"gtask/internal/config"
+	"gtask/internal/service"
+	"gtask/internal/service/servicetest"
+	"gtask/internal/testutil"
+)
+
+func newTestMux() (*Mux, *testutil.FakeService, *testutil.FakeService) {
+	personal := testutil.NewFakeService()
+	personal.AddList("p1", "Groceries")
+	personal.AddTask("@default", "t1", "Call mom")
+	work := testutil.NewFakeService()
+	work.AddList("w1", "Groceries")
+	work.AddList("w2", "Reports")
+	work.AddTask("w2", "t2", "Q3 report")
+	return NewMux([]Mount{{Name: "personal", Service: personal}, {Name: "work", Service: work}}), personal, work
+}
+
+func TestMux_ListListsNamespacesAndKeepsOneDefault(t *testing.T) {
+	mux, _, _ := newTestMux()
+
+	lists, err := mux.ListLists(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	defaults := 0
+	for _, l := range lists {
+		got = append(got, l.ID+"="+l.Title)
+		if l.IsDefault {
+			defaults++
+		}
+	}
+	want := "personal/@default=personal/My Tasks personal/p1=personal/Groceries work/@default=work/My Tasks work/w1=work/Groceries work/w2=work/Reports"
+	if strings.Join(got, " ") != want {
+		t.Errorf("unexpected lists:\n got %s\nwant %s", strings.Join(got, " "), want)
+	}
+	if defaults != 1 || !lists[0].IsDefault {
+		t.Errorf("expected only the first mount's default list to be default, got %+v", lists)
+	}
+}
+
+func TestMux_ResolveList(t *testing.T) {
+	mux, _, _ := newTestMux()
+	ctx := context.Background()
+
+	l, err := mux.ResolveList(ctx, "reports")
+	if err != nil || l.ID != "work/w2" {
+		t.Errorf("expected bare name in one mount to resolve, got %+v, %v", l, err)
+	}
+
+	if _, err := mux.ResolveList(ctx, "groceries"); err == nil || err.Error() != "ambiguous list name: groceries" {
+		t.Errorf("expected ambiguous error, got %v", err)
+	}
+
+	l, err = mux.ResolveList(ctx, "Work/groceries")
+	if err != nil || l.ID != "work/w1" || l.Title != "work/Groceries" {
+		t.Errorf("expected namespaced name to resolve, got %+v, %v", l, err)
+	}
+
+	if _, err := mux.ResolveList(ctx, "holidays"); err == nil || err.Error() != "list not found: holidays" {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestMux_ResolveListTitlesWithSeparator(t *testing.T) {
+	mux, personal, _ := newTestMux()
+	personal.AddList("p2", "Work/Q3")
+	personal.AddList("p3", "Home/Garden")
+	ctx := context.Background()
+
+	// The prefix names a mount that has no such list
+	l, err := mux.ResolveList(ctx, "work/q3")
+	if err != nil || l.ID != "personal/p2" {
+		t.Errorf("expected whole title to resolve in another mount, got %+v, %v", l, err)
+	}
+
+	// The prefix names no mount
+	l, err = mux.ResolveList(ctx, "Home/Garden")
+	if err != nil || l.ID != "personal/p3" {
+		t.Errorf("expected whole title to resolve, got %+v, %v", l, err)
+	}
+
+	// A list in the named mount still wins
+	l, err = mux.ResolveList(ctx, "work/reports")
+	if err != nil || l.ID != "work/w2" {
+		t.Errorf("expected namespaced name to resolve, got %+v, %v", l, err)
+	}
+
+	if _, err := mux.ResolveList(ctx, "work/holidays"); err == nil || err.Error() != "list not found: work/holidays" {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestMux_ResolveListKeepsBackendErrors(t *testing.T) {
+	mux, personal, _ := newTestMux()
+	// A backend failure mentioning "not found" is not a missing list
+	personal.ResolveListErr = errors.New("config file not found")
+
+	if _, err := mux.ResolveList(context.Background(), "reports"); err == nil || err.Error() != "personal: config file not found" {
+		t.Errorf("expected the backend error, got %v", err)
+	}
+	if _, err := mux.ResolveList(context.Background(), "personal/groceries"); err == nil || err.Error() != "personal: config file not found" {
+		t.Errorf("expected the backend error with its mount, got %v", err)
+	}
+}
+
+func TestMux_RoutesByListID(t *testing.T) {
+	mux, personal, work := newTestMux()
+	ctx := context.Background()
+
+	if err := mux.CreateTask(ctx, "work/w1", "Milk"); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, _ := work.ListOpenTasks(ctx, "w1", 1); len(tasks) != 1 || tasks[0].Title != "Milk" {
+		t.Errorf("expected task in the work backend, got %+v", tasks)
+	}
+	if tasks, _ := personal.ListOpenTasks(ctx, "p1", 1); len(tasks) != 0 {
+		t.Errorf("expected personal backend untouched, got %+v", tasks)
+	}
+
+	if err := mux.CompleteTask(ctx, "personal/@default", "t1"); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := mux.HasOpenTasks(ctx, "personal/@default"); has {
+		t.Error("expected personal default list to be empty")
+	}
+
+	if err := mux.CreateList(ctx, "work/Travel"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := work.ResolveList(ctx, "Travel"); err != nil {
+		t.Errorf("expected list created in the work backend: %v", err)
+	}
+
+	if err := mux.CreateTask(ctx, "nowhere/x", "Lost"); !errors.Is(err, service.ErrListNotFound) {
+		t.Errorf("expected list not found for unknown mount, got %v", err)
+	}
+}
+
+func TestMux_MountErrorsKeepTheirKind(t *testing.T) {
+	mux, _, work := newTestMux()
+	work.ListListsErr = service.Unavailable(errors.New("network is unreachable"))
+
+	_, err := mux.ListLists(context.Background())
+	if !errors.Is(err, service.ErrUnavailable) || !strings.HasPrefix(err.Error(), "work: ") {
+		t.Errorf("expected prefixed unavailable error, got %v", err)
+	}
+}
+
+func TestNew_OpensMounts(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{Dir: dir, CacheDir: t.TempDir()}
+
+	r := backend.NewRegistry()
+	opened := make(map[string]string)
+	r.Register(backend.Backend{
+		Name: "fake",
+		New: func(ctx context.Context, mc *config.Config) (service.Service, error) {
+			opened[mc.Dir] = mc.Backend
+			return testutil.NewFakeService(), nil
+		},
+	})
+	r.Register(backend.Backend{Name: "oauth", NeedsOAuth: true})
+
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, ConfigFile), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"mounts": [{"name": "home", "backend": "fake"}, {"name": "work", "backend": "fake", "config": "/elsewhere"}]}`)
+	mux, err := New(context.Background(), cfg, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mux.mounts) != 2 || opened[filepath.Join(dir, "mounts", "home")] != "fake" || opened["/elsewhere"] != "fake" {
+		t.Errorf("unexpected mounts opened: %v", opened)
+	}
+
+	write(`{"mounts": [{"name": "a", "backend": "fake"}, {"name": "A", "backend": "fake"}]}`)
+	if _, err := New(context.Background(), cfg, r); err == nil || !strings.Contains(err.Error(), "duplicate mount name") {
+		t.Errorf("expected duplicate name error, got %v", err)
+	}
+
+	write(`{"mounts": [{"name": "work", "backend": "oauth"}]}`)
+	if _, err := New(context.Background(), cfg, r); err == nil || !strings.Contains(err.Error(), "run: gtask login --config") {
+		t.Errorf("expected login hint, got %v", err)
+	}
+
+	write(`{"mounts": [{"name": "loop", "backend": "multi"}]}`)
+	if _, err := New(context.Background(), cfg, r); err == nil || !strings.Contains(err.Error(), "unknown backend: multi") {
+		t.Errorf("expected nested multi to be rejected, got %v", err)
+	}
+}
+
+func TestNew_MountsUseTheirOwnSettings(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{Dir: dir, BaseDir: dir, Profile: "work", CacheDir: t.TempDir()}
+	cfg.Settings = config.Settings{TokenStore: config.TokenStoreFile, Timeout: 2 * time.Second, Format: config.FormatJSON}
+
+	mountDir := filepath.Join(dir, "mounts", "home")
+	if err := os.MkdirAll(mountDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	toml := "token_store = \"encrypted\"\ntimeout = \"7s\"\nformat = \"text\"\n"
+	if err := os.WriteFile(filepath.Join(mountDir, config.SettingsFile), []byte(toml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ConfigFile), []byte(`{"mounts": [{"name": "home", "backend": "fake"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := backend.NewRegistry()
+	var got *config.Config
+	r.Register(backend.Backend{
+		Name: "fake",
+		New: func(ctx context.Context, mc *config.Config) (service.Service, error) {
+			got = mc
+			return testutil.NewFakeService(), nil
+		},
+	})
+	if _, err := New(context.Background(), cfg, r); err != nil {
+		t.Fatal(err)
+	}
+	if got.Settings.TokenStore != config.TokenStoreEncrypted || got.Settings.Timeout != 7*time.Second {
+		t.Errorf("expected the mount's token store and timeout, got %+v", got.Settings)
+	}
+	if got.Settings.Format != config.FormatJSON {
+		t.Errorf("expected the main config's format, got %q", got.Settings.Format)
+	}
+	if hint := got.ProfileCommand("login"); hint != "gtask login --config "+mountDir {
+		t.Errorf("expected a hint naming the mount directory, got %q", hint)
+	}
+
+	// --timeout applies to every mount
+	cfg.TimeoutFlag = time.Second
+	if _, err := New(context.Background(), cfg, r); err != nil {
+		t.Fatal(err)
+	}
+	if got.Settings.Timeout != time.Second {
+		t.Errorf("expected the --timeout flag, got %s", got.Settings.Timeout)
+	}
+}
+
+func TestMountConfig_TodoFileStaysWithTheDefaultProfile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(todotxt.FileEnv, filepath.Join(t.TempDir(), "todo.txt"))
+	t.Setenv(config.ProfileEnv, "")
+	cfg, err := config.New(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mountCfg, err := mountConfig(cfg, MountConfig{Name: "home", Backend: todotxt.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "mounts", "home", todotxt.DataFile)
+	if got := todotxt.New(mountCfg).Path(); got != want {
+		t.Errorf("expected the mount's own file %s, got %s", want, got)
+	}
+}
+
+func TestMux_BatchRoutesOpsToMounts(t *testing.T) {
+	mux, personal, work := newTestMux()
+	ctx := context.Background()
+
+	errs, err := mux.Batch(ctx, []service.Op{
+		{Kind: service.OpCreate, ListID: "work/w1", Title: "Milk"},
+		{Kind: service.OpComplete, ListID: "personal/@default", TaskID: "t1"},
+		{Kind: service.OpDelete, ListID: "work/w2", TaskID: "nope"},
+		{Kind: service.OpCreate, ListID: "home/h1", Title: "Lost"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("expected first ops to succeed, got %v", errs)
+	}
+	if errs[2] == nil || !strings.HasPrefix(errs[2].Error(), "work: ") {
+		t.Errorf("expected error prefixed with the mount, got %v", errs[2])
+	}
+	if errs[3] == nil {
+		t.Error("expected error for unknown mount")
+	}
+
+	if tasks, _ := work.ListOpenTasks(ctx, "w1", 1); len(tasks) != 1 || tasks[0].Title != "Milk" {
+		t.Errorf("expected task created in work, got %v", tasks)
+	}
+	if open, _ := personal.HasOpenTasks(ctx, "@default"); open {
+		t.Error("expected personal task completed")
+	}
+}
+
+func TestMux_Conformance(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) service.Service {
+		return NewMux([]Mount{
+			{Name: "personal", Service: testutil.NewFakeService()},
+			{Name: "work", Service: testutil.NewFakeService()},
+		})
+	})
+}
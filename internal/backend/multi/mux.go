@@ -0,0 +1,297 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gtask/internal/outbox"
+	"gtask/internal/service"
+)
+
+// Separator joins a mount name and a list ID or title.
+const Separator = "/"
+
+// Mount is a named backend in a Mux.
+type Mount struct {
+	Name    string
+	Service service.Service
+}
+
+// Mux is a service.Service that presents the lists of several backends as
+// one account. List IDs and titles are prefixed with the mount name
+// ("work/Groceries"); every call is routed to the owning backend by that
+// prefix. Task IDs are passed through unchanged.
+//
+// The default list of the first mount is the default list.
+type Mux struct {
+	mounts []Mount
+}
+
+// NewMux creates a multiplexer over mounts, in display order.
+func NewMux(mounts []Mount) *Mux {
+	return &Mux{mounts: mounts}
+}
+
+// DefaultList implements service.Service.
+func (m *Mux) DefaultList(ctx context.Context) (service.TaskList, error) {
+	if len(m.mounts) == 0 {
+		return service.TaskList{}, errors.New("no backends mounted")
+	}
+	first := m.mounts[0]
+	l, err := first.Service.DefaultList(ctx)
+	if err != nil {
+		return service.TaskList{}, mountError(first, err)
+	}
+	return wrap(first, l, true), nil
+}
+
+// ListLists implements service.Service. Lists are grouped by mount, so
+// list letters are assigned across all backends.
+func (m *Mux) ListLists(ctx context.Context) ([]service.TaskList, error) {
+	var result []service.TaskList
+	for i, mount := range m.mounts {
+		lists, err := mount.Service.ListLists(ctx)
+		if err != nil {
+			return nil, mountError(mount, err)
+		}
+		for _, l := range lists {
+			result = append(result, wrap(mount, l, i == 0))
+		}
+	}
+	return result, nil
+}
+
+// ResolveList implements service.Service. "work/groceries" looks in the
+// work mount first; a bare name, or a prefixed one the mount lacks (a
+// title like "Work/Q3"), must match in exactly one mount.
+func (m *Mux) ResolveList(ctx context.Context, name string) (service.TaskList, error) {
+	name = strings.TrimSpace(name)
+	if mount, rest, ok := m.splitName(name); ok {
+		l, err := mount.Service.ResolveList(ctx, rest)
+		if err == nil {
+			return wrap(mount, l, m.isFirst(mount)), nil
+		}
+		if errors.Is(err, service.ErrAmbiguousList) {
+			return service.TaskList{}, err
+		}
+		if !errors.Is(err, service.ErrListNotFound) {
+			return service.TaskList{}, mountError(mount, err)
+		}
+	}
+
+	var found []service.TaskList
+	for i, mount := range m.mounts {
+		l, err := mount.Service.ResolveList(ctx, name)
+		if err != nil {
+			if errors.Is(err, service.ErrListNotFound) {
+				continue
+			}
+			if errors.Is(err, service.ErrAmbiguousList) {
+				return service.TaskList{}, err
+			}
+			return service.TaskList{}, mountError(mount, err)
+		}
+		found = append(found, wrap(mount, l, i == 0))
+	}
+	switch len(found) {
+	case 0:
+		return service.TaskList{}, fmt.Errorf("%w: %s", service.ErrListNotFound, name)
+	case 1:
+		return found[0], nil
+	}
+	return service.TaskList{}, fmt.Errorf("%w: %s", service.ErrAmbiguousList, name)
+}
+
+// CreateList implements service.Service. "work/Groceries" creates the list
+// in the work mount; a bare name creates it in the first mount.
+func (m *Mux) CreateList(ctx context.Context, name string) error {
+	if len(m.mounts) == 0 {
+		return errors.New("no backends mounted")
+	}
+	if mount, rest, ok := m.splitName(strings.TrimSpace(name)); ok {
+		return mount.Service.CreateList(ctx, rest)
+	}
+	return m.mounts[0].Service.CreateList(ctx, name)
+}
+
+// DeleteList implements service.Service.
+func (m *Mux) DeleteList(ctx context.Context, listID string) error {
+	mount, id, err := m.route(listID)
+	if err != nil {
+		return err
+	}
+	return mount.Service.DeleteList(ctx, id)
+}
+
+// ListOpenTasks implements service.Service.
+func (m *Mux) ListOpenTasks(ctx context.Context, listID string, page int) ([]service.Task, error) {
+	mount, id, err := m.route(listID)
+	if err != nil {
+		return nil, err
+	}
+	return mount.Service.ListOpenTasks(ctx, id, page)
+}
+
+// HasOpenTasks implements service.Service.
+func (m *Mux) HasOpenTasks(ctx context.Context, listID string) (bool, error) {
+	mount, id, err := m.route(listID)
+	if err != nil {
+		return false, err
+	}
+	return mount.Service.HasOpenTasks(ctx, id)
+}
+
+// CreateTask implements service.Service.
+func (m *Mux) CreateTask(ctx context.Context, listID, title string) error {
+	mount, id, err := m.route(listID)
+	if err != nil {
+		return err
+	}
+	return mount.Service.CreateTask(ctx, id, title)
+}
+
+// CompleteTask implements service.Service.
+func (m *Mux) CompleteTask(ctx context.Context, listID, taskID string) error {
+	mount, id, err := m.route(listID)
+	if err != nil {
+		return err
+	}
+	return mount.Service.CompleteTask(ctx, id, taskID)
+}
+
+// DeleteTask implements service.Service.
+func (m *Mux) DeleteTask(ctx context.Context, listID, taskID string) error {
+	mount, id, err := m.route(listID)
+	if err != nil {
+		return err
+	}
+	return mount.Service.DeleteTask(ctx, id, taskID)
+}
+
+// Batch implements service.Batcher. Ops are grouped by mount, and each
+// group is batched by its backend if it supports it. A mount that cannot
+// be reached fails only its own ops.
+func (m *Mux) Batch(ctx context.Context, ops []service.Op) ([]error, error) {
+	errs := make([]error, len(ops))
+	var groups []*batchGroup
+	byMount := make(map[string]*batchGroup)
+	for i, op := range ops {
+		mount, id, err := m.route(op.ListID)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		g := byMount[mount.Name]
+		if g == nil {
+			g = &batchGroup{mount: mount}
+			byMount[mount.Name] = g
+			groups = append(groups, g)
+		}
+		op.ListID = id
+		g.ops = append(g.ops, op)
+		g.index = append(g.index, i)
+	}
+
+	for _, g := range groups {
+		groupErrs, err := service.ApplyBatch(ctx, g.mount.Service, g.ops)
+		for j, i := range g.index {
+			switch {
+			case err != nil:
+				errs[i] = mountError(g.mount, err)
+			case groupErrs[j] != nil:
+				errs[i] = mountError(g.mount, groupErrs[j])
+			}
+		}
+	}
+	return errs, nil
+}
+
+// batchGroup holds the ops of a batch routed to one mount, with their
+// indexes in the batch.
+type batchGroup struct {
+	mount Mount
+	ops   []service.Op
+	index []int
+}
+
+// Queued returns the number of changes queued offline by all mounts.
+func (m *Mux) Queued() int {
+	total := 0
+	for _, mount := range m.mounts {
+		if q, ok := mount.Service.(interface{ Queued() int }); ok {
+			total += q.Queued()
+		}
+	}
+	return total
+}
+
+// Sync replays the offline outbox of every mount that has one. All mounts
+// are tried; the first error is returned.
+func (m *Mux) Sync(ctx context.Context) ([]outbox.Result, error) {
+	var results []outbox.Result
+	var firstErr error
+	for _, mount := range m.mounts {
+		s, ok := mount.Service.(interface {
+			Sync(ctx context.Context) ([]outbox.Result, error)
+		})
+		if !ok {
+			continue
+		}
+		r, err := s.Sync(ctx)
+		results = append(results, r...)
+		if err != nil && firstErr == nil {
+			firstErr = mountError(mount, err)
+		}
+	}
+	return results, firstErr
+}
+
+// route finds the mount owning listID and returns the backend's list ID,
+// or service.ErrListNotFound.
+func (m *Mux) route(listID string) (Mount, string, error) {
+	name, id, ok := strings.Cut(listID, Separator)
+	if ok {
+		for _, mount := range m.mounts {
+			if mount.Name == name {
+				return mount, id, nil
+			}
+		}
+	}
+	return Mount{}, "", service.ErrListNotFound
+}
+
+// splitName splits "mount/list" if the prefix names a mount
+// (case-insensitively).
+func (m *Mux) splitName(name string) (Mount, string, bool) {
+	prefix, rest, ok := strings.Cut(name, Separator)
+	if !ok {
+		return Mount{}, "", false
+	}
+	for _, mount := range m.mounts {
+		if strings.EqualFold(mount.Name, strings.TrimSpace(prefix)) {
+			return mount, strings.TrimSpace(rest), true
+		}
+	}
+	return Mount{}, "", false
+}
+
+func (m *Mux) isFirst(mount Mount) bool {
+	return len(m.mounts) > 0 && m.mounts[0].Name == mount.Name
+}
+
+// wrap namespaces a backend list. Only the first mount keeps its default.
+func wrap(mount Mount, l service.TaskList, first bool) service.TaskList {
+	return service.TaskList{
+		ID:        mount.Name + Separator + l.ID,
+		Title:     mount.Name + Separator + l.Title,
+		IsDefault: l.IsDefault && first,
+	}
+}
+
+// mountError prefixes err with the mount name, keeping it inspectable
+// with errors.Is.
+func mountError(mount Mount, err error) error {
+	return fmt.Errorf("%s: %w", mount.Name, err)
+}
@@ -0,0 +1,223 @@
+package todotxt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dateLayout is the todo.txt date format.
+const dateLayout = "2006-01-02"
+
+// listMarker prefixes comment lines that declare a project with no tasks,
+// so lists created with `gtask createlist` survive until they get tasks.
+const listMarker = "# gtask:list "
+
+var (
+	priorityRe = regexp.MustCompile(`^\([A-Z]\) `)
+	dateRe     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} `)
+)
+
+// file is a parsed todo.txt file. Lines are kept verbatim; only the lines
+// gtask changes are rewritten, so comments, blank lines, unknown tags and
+// ordering survive a round trip.
+type file struct {
+	lines []string
+
+	// eol is the line ending used by the file ("\n" or "\r\n").
+	eol string
+
+	// finalEOL records whether the last line ended with eol.
+	finalEOL bool
+}
+
+// entry is a task line.
+type entry struct {
+	// index is the line number (0-based) in file.lines.
+	index int
+
+	// id identifies the line: a hash of its content plus the occurrence
+	// count among identical lines.
+	id string
+
+	done        bool
+	description string
+	project     string // first +project without the "+", or ""
+	due         time.Time
+}
+
+// parse splits data into lines. It never fails: anything that is not a
+// task is kept as an opaque line.
+func parse(data []byte) *file {
+	f := &file{eol: "\n"}
+	if len(data) == 0 {
+		return f
+	}
+	text := string(data)
+	if strings.Contains(text, "\r\n") {
+		f.eol = "\r\n"
+	}
+	if strings.HasSuffix(text, f.eol) {
+		f.finalEOL = true
+		text = strings.TrimSuffix(text, f.eol)
+	}
+	f.lines = strings.Split(text, f.eol)
+	return f
+}
+
+// bytes serializes the file with its original line endings.
+func (f *file) bytes() []byte {
+	if len(f.lines) == 0 {
+		return nil
+	}
+	text := strings.Join(f.lines, f.eol)
+	if f.finalEOL {
+		text += f.eol
+	}
+	return []byte(text)
+}
+
+// entries returns the task lines in file order.
+func (f *file) entries() []entry {
+	var result []entry
+	seen := make(map[string]int)
+	for i, line := range f.lines {
+		e, ok := parseEntry(line)
+		if !ok {
+			continue
+		}
+		sum := sha256.Sum256([]byte(line))
+		hash := hex.EncodeToString(sum[:6])
+		seen[hash]++
+		e.index = i
+		e.id = fmt.Sprintf("%s-%d", hash, seen[hash])
+		result = append(result, e)
+	}
+	return result
+}
+
+// remove deletes the lines at the given indexes.
+func (f *file) remove(indexes map[int]bool) {
+	kept := f.lines[:0]
+	for i, line := range f.lines {
+		if !indexes[i] {
+			kept = append(kept, line)
+		}
+	}
+	f.lines = kept
+}
+
+// appendLine adds a line at the end of the file.
+func (f *file) appendLine(line string) {
+	f.lines = append(f.lines, line)
+	f.finalEOL = true
+}
+
+// parseEntry parses a task line. Blank lines and comments are not tasks.
+func parseEntry(line string) (entry, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return entry{}, false
+	}
+
+	var e entry
+	rest := line
+	if strings.HasPrefix(rest, "x ") {
+		e.done = true
+		rest = rest[2:]
+		// Completion date, then optional creation date
+		if dateRe.MatchString(rest) {
+			rest = rest[len(dateLayout)+1:]
+			if dateRe.MatchString(rest) {
+				rest = rest[len(dateLayout)+1:]
+			}
+		}
+	} else {
+		if priorityRe.MatchString(rest) {
+			rest = rest[4:]
+		}
+		if dateRe.MatchString(rest) {
+			rest = rest[len(dateLayout)+1:]
+		}
+	}
+	e.description = strings.TrimSpace(rest)
+
+	for _, word := range strings.Fields(e.description) {
+		switch {
+		case e.project == "" && len(word) > 1 && word[0] == '+':
+			e.project = word[1:]
+		case e.due.IsZero() && strings.HasPrefix(word, "due:"):
+			if due, err := time.Parse(dateLayout, word[len("due:"):]); err == nil {
+				e.due = due
+			}
+		}
+	}
+	return e, true
+}
+
+// title returns the task title shown by gtask: the description without the
+// project tag that already names its list. Everything else, including
+// contexts and key:value tags, is kept.
+func (e entry) title() string {
+	if e.project == "" {
+		return e.description
+	}
+	words := strings.Fields(e.description)
+	kept := words[:0]
+	dropped := false
+	for _, word := range words {
+		if !dropped && word == "+"+e.project {
+			dropped = true
+			continue
+		}
+		kept = append(kept, word)
+	}
+	return strings.Join(kept, " ")
+}
+
+// completeLine returns line marked done on day. The creation date is kept
+// and the priority moves to a pri: tag, as the todo.txt format recommends.
+func completeLine(line string, day time.Time) string {
+	rest := line
+	var pri string
+	if priorityRe.MatchString(rest) {
+		pri = rest[1:2]
+		rest = rest[4:]
+	}
+	result := "x " + day.Format(dateLayout) + " " + rest
+	if pri != "" {
+		result += " pri:" + pri
+	}
+	return result
+}
+
+// newLine returns the line for a new task created on day in project
+// (empty for the default list). A task belongs to its first project, so the
+// list's tag goes at the end unless the title has a project of its own; then
+// it goes in front ("+home buy +groceries").
+func newLine(title, project string, day time.Time) string {
+	title = strings.TrimSpace(title)
+	line := day.Format(dateLayout) + " "
+	switch first := firstProject(title); {
+	case project == "" || first == project:
+		line += title
+	case first == "":
+		line += title + " +" + project
+	default:
+		line += "+" + project + " " + title
+	}
+	return line
+}
+
+// firstProject returns the first +project of s without the "+", or "".
+func firstProject(s string) string {
+	for _, word := range strings.Fields(s) {
+		if len(word) > 1 && word[0] == '+' {
+			return word[1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,337 @@
+// Package todotxt implements the service.Service interface on top of a
+// todo.txt file (http://todotxt.org).
+//
+// Projects (+proj) are lists; tasks without a project are in the default
+// list. "x " marks completed tasks and due:YYYY-MM-DD sets the due date.
+// gtask only rewrites the lines it changes, so comments, unknown tags and
+// line order are preserved.
+package todotxt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gtask/internal/backend"
+	"gtask/internal/config"
+	"gtask/internal/fsutil"
+	"gtask/internal/service"
+)
+
+const (
+	// Name is the backend name.
+	Name = "todotxt"
+
+	// DataFile is the default todo.txt filename in the config directory.
+	DataFile = "todo.txt"
+
+	// FileEnv names the environment variable that overrides the file path
+	// of the default profile. It is the variable todo.sh uses.
+	FileEnv = "TODO_FILE"
+
+	// DefaultListID is the ID of the list of tasks without a project.
+	DefaultListID = "@default"
+
+	// DefaultListTitle is the title of the default list.
+	DefaultListTitle = "Inbox"
+
+	// projectPrefix prefixes list IDs of project lists.
+	projectPrefix = "+"
+)
+
+func init() {
+	backend.Register(backend.Backend{
+		Name:     Name,
+		Synopsis: "todo.txt file (todo.txt in the config directory, or $TODO_FILE)",
+		New: func(ctx context.Context, cfg *config.Config) (service.Service, error) {
+			return New(cfg), nil
+		},
+	})
+}
+
+// errNotFound is returned when a list or task does not exist.
+var errNotFound = service.Conflict(errors.New("not found"))
+
+// Store implements service.Service using a todo.txt file.
+// Mutations are locked read-modify-writes with an atomic rename.
+type Store struct {
+	path string
+	now  func() time.Time
+}
+
+// New creates a store for todo.txt in the config directory. $TODO_FILE
+// overrides it for the default profile only: named profiles and multi
+// mounts have config directories of their own and keep their own file.
+// The file is created on the first mutation.
+func New(cfg *config.Config) *Store {
+	if path := os.Getenv(FileEnv); path != "" && cfg.Profile == config.DefaultProfile {
+		return NewWithPath(path)
+	}
+	return NewWithPath(filepath.Join(cfg.Dir, DataFile))
+}
+
+// NewWithPath creates a store for the todo.txt file at path.
+func NewWithPath(path string) *Store {
+	return &Store{path: path, now: time.Now}
+}
+
+// Path returns the todo.txt file path.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// DefaultList implements service.Service.
+func (s *Store) DefaultList(ctx context.Context) (service.TaskList, error) {
+	return defaultList(), nil
+}
+
+// ListLists implements service.Service.
+// The default list comes first, then projects in order of first appearance.
+func (s *Store) ListLists(ctx context.Context) ([]service.TaskList, error) {
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return lists(f), nil
+}
+
+// ResolveList implements service.Service. A leading "+" is ignored, so
+// both "work" and "+work" find the work project.
+func (s *Store) ResolveList(ctx context.Context, name string) (service.TaskList, error) {
+	all, err := s.ListLists(ctx)
+	if err != nil {
+		return service.TaskList{}, err
+	}
+	return service.MatchList(all, strings.TrimPrefix(strings.TrimSpace(name), projectPrefix))
+}
+
+// CreateList implements service.Service. The project is declared with a
+// marker comment until it has tasks.
+func (s *Store) CreateList(ctx context.Context, name string) error {
+	project := strings.TrimPrefix(strings.TrimSpace(name), projectPrefix)
+	if project == "" || strings.ContainsAny(project, " \t") {
+		return fmt.Errorf("invalid project name: %s", name)
+	}
+	return s.modify(func(f *file) error {
+		for _, l := range lists(f) {
+			if l.ID == projectPrefix+project {
+				return fmt.Errorf("list already exists: %s", project)
+			}
+		}
+		f.appendLine(listMarker + projectPrefix + project)
+		return nil
+	})
+}
+
+// DeleteList implements service.Service. All tasks of the project, open or
+// completed, are removed together with its marker comment.
+func (s *Store) DeleteList(ctx context.Context, listID string) error {
+	if listID == DefaultListID {
+		return errors.New("cannot delete default list")
+	}
+	project := strings.TrimPrefix(listID, projectPrefix)
+	return s.modify(func(f *file) error {
+		drop := make(map[int]bool)
+		for _, e := range f.entries() {
+			if e.project == project {
+				drop[e.index] = true
+			}
+		}
+		for i, line := range f.lines {
+			if line == listMarker+listID {
+				drop[i] = true
+			}
+		}
+		if len(drop) == 0 {
+			return errNotFound
+		}
+		f.remove(drop)
+		return nil
+	})
+}
+
+// ListOpenTasks implements service.Service. Tasks are in file order.
+func (s *Store) ListOpenTasks(ctx context.Context, listID string, page int) ([]service.Task, error) {
+	open, err := s.openTasks(listID)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.Page(open, page), nil
+}
+
+// HasOpenTasks implements service.Service.
+func (s *Store) HasOpenTasks(ctx context.Context, listID string) (bool, error) {
+	open, err := s.openTasks(listID)
+	if err != nil {
+		return false, err
+	}
+	return len(open) > 0, nil
+}
+
+// CreateTask implements service.Service. The task is appended with today's
+// creation date and the list's project tag.
+func (s *Store) CreateTask(ctx context.Context, listID, title string) error {
+	return s.modify(func(f *file) error {
+		if !hasList(f, listID) {
+			return errNotFound
+		}
+		project := strings.TrimPrefix(listID, projectPrefix)
+		if listID == DefaultListID {
+			project = ""
+		}
+		f.appendLine(newLine(title, project, s.now()))
+		return nil
+	})
+}
+
+// CompleteTask implements service.Service.
+func (s *Store) CompleteTask(ctx context.Context, listID, taskID string) error {
+	return s.modify(func(f *file) error {
+		e, ok := findEntry(f, listID, taskID)
+		if !ok {
+			return errNotFound
+		}
+		f.lines[e.index] = completeLine(f.lines[e.index], s.now())
+		return nil
+	})
+}
+
+// DeleteTask implements service.Service.
+func (s *Store) DeleteTask(ctx context.Context, listID, taskID string) error {
+	return s.modify(func(f *file) error {
+		e, ok := findEntry(f, listID, taskID)
+		if !ok {
+			return errNotFound
+		}
+		f.remove(map[int]bool{e.index: true})
+		return nil
+	})
+}
+
+// openTasks returns the open tasks of a list.
+func (s *Store) openTasks(listID string) ([]service.Task, error) {
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if !hasList(f, listID) {
+		return nil, errNotFound
+	}
+
+	var open []service.Task
+	for _, e := range f.entries() {
+		if e.done || listIDOf(e) != listID {
+			continue
+		}
+		open = append(open, service.Task{
+			ID:       e.id,
+			Title:    e.title(),
+			Position: fmt.Sprintf("%020d", e.index),
+			Status:   "needsAction",
+			Due:      e.due,
+		})
+	}
+	return open, nil
+}
+
+// read loads the file. A missing file is an empty todo list.
+func (s *Store) read() (*file, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return parse(nil), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+	return parse(data), nil
+}
+
+// modify applies fn to the file under an exclusive lock and writes the
+// result atomically, keeping the file mode. A symlinked todo.txt (common
+// in dotfile repos) is updated at its target.
+func (s *Store) modify(fn func(*file) error) error {
+	path := s.path
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	unlock, err := fsutil.Lock(path)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	defer unlock()
+
+	perm := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(path, f.bytes(), perm)
+}
+
+// lists returns the default list followed by the projects in order of
+// first appearance in tasks or marker comments.
+func lists(f *file) []service.TaskList {
+	result := []service.TaskList{defaultList()}
+	seen := make(map[string]bool)
+	for _, line := range f.lines {
+		var project string
+		if strings.HasPrefix(line, listMarker) {
+			project = strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(line, listMarker)), projectPrefix)
+		} else if e, ok := parseEntry(line); ok {
+			project = e.project
+		}
+		if project != "" && !seen[project] {
+			seen[project] = true
+			result = append(result, service.TaskList{ID: projectPrefix + project, Title: project})
+		}
+	}
+	return result
+}
+
+// hasList reports whether listID exists in f.
+func hasList(f *file, listID string) bool {
+	for _, l := range lists(f) {
+		if l.ID == listID {
+			return true
+		}
+	}
+	return false
+}
+
+// findEntry finds an open task by list and ID.
+func findEntry(f *file, listID, taskID string) (entry, bool) {
+	for _, e := range f.entries() {
+		if e.id == taskID && !e.done && listIDOf(e) == listID {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// listIDOf returns the ID of the list a task belongs to: its first project,
+// or the default list.
+func listIDOf(e entry) string {
+	if e.project == "" {
+		return DefaultListID
+	}
+	return projectPrefix + e.project
+}
+
+func defaultList() service.TaskList {
+	return service.TaskList{ID: DefaultListID, Title: DefaultListTitle, IsDefault: true}
+}
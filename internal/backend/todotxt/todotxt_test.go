@@ -0,0 +1,246 @@
+package todotxt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gtask/internal/config"
+	"gtask/internal/service"
+	"gtask/internal/service/servicetest"
+)
+
+const sample = `# groceries live in the fridge list
+(A) 2026-10-01 Call Bob +work @phone due:2026-10-20
+Buy milk @store
+x 2026-10-02 2026-10-01 Old report +work
+
+Water plants rec:1w
+2026-10-03 Fix bike +home +garage
+`
+
+func newTestStore(t *testing.T, content string) *Store {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DataFile)
+	if content != "" {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewWithPath(path)
+	s.now = func() time.Time { return time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC) }
+	return s
+}
+
+func readFile(t *testing.T, s *Store) string {
+	t.Helper()
+	data, err := os.ReadFile(s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestStore_MapsProjectsToLists(t *testing.T) {
+	s := newTestStore(t, sample)
+	ctx := context.Background()
+
+	lists, err := s.ListLists(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, l := range lists {
+		titles = append(titles, l.Title)
+	}
+	want := []string{DefaultListTitle, "work", "home"}
+	if len(titles) != len(want) {
+		t.Fatalf("expected lists %v, got %v", want, titles)
+	}
+	for i := range want {
+		if titles[i] != want[i] {
+			t.Errorf("expected lists %v, got %v", want, titles)
+		}
+	}
+
+	inbox, _ := s.ListOpenTasks(ctx, DefaultListID, 1)
+	if len(inbox) != 2 || inbox[0].Title != "Buy milk @store" || inbox[1].Title != "Water plants rec:1w" {
+		t.Errorf("unexpected default list tasks: %+v", inbox)
+	}
+
+	work, err := s.ResolveList(ctx, "+work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, _ := s.ListOpenTasks(ctx, work.ID, 1)
+	if len(tasks) != 1 || tasks[0].Title != "Call Bob @phone due:2026-10-20" {
+		t.Fatalf("unexpected work tasks: %+v", tasks)
+	}
+	if want := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC); !tasks[0].Due.Equal(want) {
+		t.Errorf("expected due %v, got %v", want, tasks[0].Due)
+	}
+
+	// A task belongs to its first project only
+	home, _ := s.ListOpenTasks(ctx, "+home", 1)
+	if len(home) != 1 || home[0].Title != "Fix bike +garage" {
+		t.Errorf("unexpected home tasks: %+v", home)
+	}
+}
+
+func TestStore_RoundTripKeepsUntouchedLines(t *testing.T) {
+	s := newTestStore(t, sample)
+	ctx := context.Background()
+
+	tasks, _ := s.ListOpenTasks(ctx, "+work", 1)
+	if err := s.CompleteTask(ctx, "+work", tasks[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	inbox, _ := s.ListOpenTasks(ctx, DefaultListID, 1)
+	if err := s.DeleteTask(ctx, DefaultListID, inbox[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateTask(ctx, "+home", "Paint fence"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# groceries live in the fridge list
+x 2026-10-18 2026-10-01 Call Bob +work @phone due:2026-10-20 pri:A
+x 2026-10-02 2026-10-01 Old report +work
+
+Water plants rec:1w
+2026-10-03 Fix bike +home +garage
+2026-10-18 Paint fence +home
+`
+	if got := readFile(t, s); got != want {
+		t.Errorf("unexpected file:\n%s\nwant:\n%s", got, want)
+	}
+
+	info, _ := os.Stat(s.Path())
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("expected file mode to be kept, got %v", info.Mode().Perm())
+	}
+}
+
+func TestStore_PreservesLineEndings(t *testing.T) {
+	s := newTestStore(t, "First\r\nSecond")
+	ctx := context.Background()
+
+	if err := s.CreateTask(ctx, DefaultListID, "Third"); err != nil {
+		t.Fatal(err)
+	}
+	want := "First\r\nSecond\r\n2026-10-18 Third\r\n"
+	if got := readFile(t, s); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestStore_DuplicateLinesHaveDistinctIDs(t *testing.T) {
+	s := newTestStore(t, "Stretch\nStretch\n")
+	ctx := context.Background()
+
+	tasks, _ := s.ListOpenTasks(ctx, DefaultListID, 1)
+	if len(tasks) != 2 || tasks[0].ID == tasks[1].ID {
+		t.Fatalf("expected two tasks with distinct IDs, got %+v", tasks)
+	}
+	if err := s.CompleteTask(ctx, DefaultListID, tasks[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, s); got != "Stretch\nx 2026-10-18 Stretch\n" {
+		t.Errorf("expected second line completed, got %q", got)
+	}
+}
+
+func TestStore_CreateAndDeleteList(t *testing.T) {
+	s := newTestStore(t, "")
+	ctx := context.Background()
+
+	if err := s.CreateList(ctx, "errands"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateList(ctx, "Errands"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateList(ctx, "errands"); err == nil {
+		t.Error("expected error for existing project")
+	}
+	if err := s.CreateList(ctx, "two words"); err == nil {
+		t.Error("expected error for project with spaces")
+	}
+
+	list, err := s.ResolveList(ctx, "errands")
+	if err == nil {
+		t.Errorf("expected ambiguous match, got %+v", list)
+	}
+	if err := s.CreateTask(ctx, "+errands", "Post office"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteList(ctx, "+errands"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, s); got != "# gtask:list +Errands\n" {
+		t.Errorf("unexpected file after delete: %q", got)
+	}
+}
+
+func TestStore_Conformance(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) service.Service {
+		return newTestStore(t, "")
+	})
+}
+
+func TestStore_CreateKeepsListWithOtherProjectInTitle(t *testing.T) {
+	s := newTestStore(t, "")
+	ctx := context.Background()
+	for _, name := range []string{"home", "groceries"} {
+		if err := s.CreateList(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, title := range []string{"buy +groceries", "fix sink +home", "sweep"} {
+		if err := s.CreateTask(ctx, "+home", title); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tasks, _ := s.ListOpenTasks(ctx, "+home", 1)
+	var got []string
+	for _, task := range tasks {
+		got = append(got, task.Title)
+	}
+	if len(got) != 3 || got[0] != "buy +groceries" || got[1] != "fix sink" || got[2] != "sweep" {
+		t.Errorf("expected all tasks in home, got %q", got)
+	}
+	if open, _ := s.HasOpenTasks(ctx, "+groceries"); open {
+		t.Error("expected no tasks in groceries")
+	}
+	if file := readFile(t, s); !strings.Contains(file, "2026-10-18 +home buy +groceries\n") {
+		t.Errorf("expected the list's project first, got:\n%s", file)
+	}
+}
+
+func TestNew_TodoFileOnlyForDefaultProfile(t *testing.T) {
+	dir := t.TempDir()
+	todoFile := filepath.Join(t.TempDir(), "todo.txt")
+	t.Setenv(FileEnv, todoFile)
+	t.Setenv(config.ProfileEnv, "")
+
+	def, err := config.New(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := New(def).Path(); got != todoFile {
+		t.Errorf("expected $%s for the default profile, got %s", FileEnv, got)
+	}
+
+	work, err := config.New(dir, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := New(work).Path(), filepath.Join(work.Dir, DataFile); got != want {
+		t.Errorf("expected the work profile's own file %s, got %s", want, got)
+	}
+
+}
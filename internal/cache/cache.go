@@ -0,0 +1,415 @@
+// Package cache implements a persistent caching decorator for service.Service.
+//
+// Cached lists and open tasks are stored in a JSON file under the cache
+// directory ($XDG_CACHE_HOME/gtask). Entries younger than Config.MaxAge are
+// served without touching the backend. Older entries are revalidated through
+// service.Revalidator when the backend supports it (ETags for lists,
+// updatedMin for tasks) and refetched otherwise. Every mutation invalidates
+// the entries it affects.
+//
+// When the backend is unreachable (service.ErrUnavailable), stale entries are
+// served instead of failing. In offline mode the backend is never asked.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gtask/internal/config"
+	"gtask/internal/fsutil"
+	"gtask/internal/service"
+)
+
+const (
+	// formatVersion is bumped whenever the on-disk layout changes.
+	// Files with a different version are ignored.
+	formatVersion = 1
+
+	// skewMargin is subtracted from fetch times when asking the backend
+	// for changes, to tolerate clock differences with the server.
+	skewMargin = time.Minute
+)
+
+// errNotCached is returned in offline mode for data that was never cached.
+var errNotCached = service.Unavailable(errors.New("no cached data available offline"))
+
+// snapshot is the on-disk cache content for one account.
+type snapshot struct {
+	Version int                    `json:"version"`
+	Lists   *listsEntry            `json:"lists,omitempty"`
+	Tasks   map[string]*tasksEntry `json:"tasks,omitempty"` // listID -> open tasks
+}
+
+// listsEntry caches the result of ListLists.
+type listsEntry struct {
+	Lists     []service.TaskList `json:"lists"`
+	ETag      string             `json:"etag,omitempty"`
+	FetchedAt time.Time          `json:"fetched_at"`
+}
+
+// tasksEntry caches all open tasks of one list, across all pages.
+type tasksEntry struct {
+	Tasks     []service.Task `json:"tasks"`
+	FetchedAt time.Time      `json:"fetched_at"`
+}
+
+// Service is a caching service.Service decorator.
+type Service struct {
+	backend service.Service
+	path    string
+	maxAge  time.Duration
+	refresh bool
+	offline bool
+	now     func() time.Time
+
+	mu   sync.Mutex
+	snap *snapshot // loaded lazily
+}
+
+// New wraps backend with a cache stored under cfg.CacheDir.
+// cfg.MaxAge controls how long entries are served without revalidation;
+// cfg.NoCache bypasses cached reads but still stores fresh results.
+func New(backend service.Service, cfg *config.Config) *Service {
+	return &Service{
+		backend: backend,
+		path:    filepath.Join(cfg.CacheDir, Key(cfg)+".json"),
+		maxAge:  cfg.MaxAge,
+		refresh: cfg.NoCache,
+		offline: cfg.Offline,
+		now:     time.Now,
+	}
+}
+
+// Key returns the cache key for the account described by cfg.
+// Different config directories and backends never share cached data.
+func Key(cfg *config.Config) string {
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		dir = cfg.Dir
+	}
+	if cfg.Backend != "" && cfg.Backend != config.BackendGoogle {
+		dir += "\x00" + cfg.Backend
+	}
+	sum := sha256.Sum256([]byte(dir))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Remove deletes the cached data for the account described by cfg.
+// A missing cache file is not an error.
+func Remove(cfg *config.Config) error {
+	err := os.Remove(filepath.Join(cfg.CacheDir, Key(cfg)+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Path returns the cache file path.
+func (s *Service) Path() string {
+	return s.path
+}
+
+// DefaultList implements service.Service.
+// Served from the cached lists when possible.
+func (s *Service) DefaultList(ctx context.Context) (service.TaskList, error) {
+	lists, err := s.ListLists(ctx)
+	if err != nil {
+		return service.TaskList{}, err
+	}
+	for _, list := range lists {
+		if list.IsDefault {
+			return list, nil
+		}
+	}
+	return s.backend.DefaultList(ctx)
+}
+
+// ListLists implements service.Service.
+func (s *Service) ListLists(ctx context.Context) ([]service.TaskList, error) {
+	cached := s.load().Lists
+	if cached != nil && (s.offline || !s.refresh && s.fresh(cached.FetchedAt)) {
+		return copyLists(cached.Lists), nil
+	}
+	if s.offline {
+		return nil, errNotCached
+	}
+
+	entry, err := s.fetchLists(ctx, cached)
+	if err != nil {
+		// Unreachable backend: stale data beats no data
+		if cached != nil && errors.Is(err, service.ErrUnavailable) {
+			return copyLists(cached.Lists), nil
+		}
+		return nil, err
+	}
+	s.update(func(snap *snapshot) {
+		snap.Lists = entry
+	})
+	return copyLists(entry.Lists), nil
+}
+
+// fetchLists fetches lists from the backend, revalidating cached when the
+// backend supports it.
+func (s *Service) fetchLists(ctx context.Context, cached *listsEntry) (*listsEntry, error) {
+	now := s.now()
+
+	rv, ok := s.backend.(service.Revalidator)
+	if !ok {
+		lists, err := s.backend.ListLists(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &listsEntry{Lists: lists, FetchedAt: now}, nil
+	}
+
+	etag := ""
+	if cached != nil && !s.refresh {
+		etag = cached.ETag
+	}
+	lists, newETag, err := rv.ListListsIfNoneMatch(ctx, etag)
+	if errors.Is(err, service.ErrNotModified) && cached != nil {
+		return &listsEntry{Lists: cached.Lists, ETag: cached.ETag, FetchedAt: now}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &listsEntry{Lists: lists, ETag: newETag, FetchedAt: now}, nil
+}
+
+// ResolveList implements service.Service.
+func (s *Service) ResolveList(ctx context.Context, name string) (service.TaskList, error) {
+	lists, err := s.ListLists(ctx)
+	if err != nil {
+		return service.TaskList{}, err
+	}
+	return service.MatchList(lists, name)
+}
+
+// CreateList implements service.Service.
+func (s *Service) CreateList(ctx context.Context, name string) error {
+	err := s.backend.CreateList(ctx, name)
+	s.invalidateLists(err)
+	return err
+}
+
+// DeleteList implements service.Service.
+func (s *Service) DeleteList(ctx context.Context, listID string) error {
+	err := s.backend.DeleteList(ctx, listID)
+	s.invalidateLists(err)
+	s.invalidateTasks(listID, err)
+	return err
+}
+
+// ListOpenTasks implements service.Service.
+// The first call for a list fetches and caches all of its pages.
+func (s *Service) ListOpenTasks(ctx context.Context, listID string, page int) ([]service.Task, error) {
+	tasks, err := s.openTasks(ctx, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.Page(tasks, page), nil
+}
+
+// HasOpenTasks implements service.Service.
+func (s *Service) HasOpenTasks(ctx context.Context, listID string) (bool, error) {
+	tasks, err := s.openTasks(ctx, listID)
+	if err != nil {
+		return false, err
+	}
+	return len(tasks) > 0, nil
+}
+
+// openTasks returns all open tasks of a list, from cache when possible.
+func (s *Service) openTasks(ctx context.Context, listID string) ([]service.Task, error) {
+	cached := s.load().Tasks[listID]
+	if cached != nil && s.offline {
+		return cached.Tasks, nil
+	}
+	if s.offline {
+		return nil, errNotCached
+	}
+
+	if cached != nil && !s.refresh {
+		if s.fresh(cached.FetchedAt) {
+			return cached.Tasks, nil
+		}
+		if rv, ok := s.backend.(service.Revalidator); ok {
+			now := s.now()
+			modified, err := rv.TasksModifiedSince(ctx, listID, cached.FetchedAt.Add(-skewMargin))
+			if errors.Is(err, service.ErrUnavailable) {
+				return cached.Tasks, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !modified {
+				entry := &tasksEntry{Tasks: cached.Tasks, FetchedAt: now}
+				s.update(func(snap *snapshot) {
+					snap.Tasks[listID] = entry
+				})
+				return entry.Tasks, nil
+			}
+		}
+	}
+
+	now := s.now()
+	tasks, err := service.AllOpenTasks(ctx, s.backend, listID)
+	if err != nil {
+		if cached != nil && errors.Is(err, service.ErrUnavailable) {
+			return cached.Tasks, nil
+		}
+		return nil, err
+	}
+
+	entry := &tasksEntry{Tasks: tasks, FetchedAt: now}
+	s.update(func(snap *snapshot) {
+		snap.Tasks[listID] = entry
+	})
+	return tasks, nil
+}
+
+// CreateTask implements service.Service.
+func (s *Service) CreateTask(ctx context.Context, listID, title string) error {
+	err := s.backend.CreateTask(ctx, listID, title)
+	s.invalidateTasks(listID, err)
+	return err
+}
+
+// CompleteTask implements service.Service.
+func (s *Service) CompleteTask(ctx context.Context, listID, taskID string) error {
+	err := s.backend.CompleteTask(ctx, listID, taskID)
+	s.invalidateTasks(listID, err)
+	return err
+}
+
+// DeleteTask implements service.Service.
+func (s *Service) DeleteTask(ctx context.Context, listID, taskID string) error {
+	err := s.backend.DeleteTask(ctx, listID, taskID)
+	s.invalidateTasks(listID, err)
+	return err
+}
+
+// Batch implements service.Batcher, batching with the backend if it
+// supports it. Lists with a mutation are invalidated as by the single
+// mutations.
+func (s *Service) Batch(ctx context.Context, ops []service.Op) ([]error, error) {
+	errs, err := service.ApplyBatch(ctx, s.backend, ops)
+	for i, op := range ops {
+		if err == nil {
+			s.invalidateTasks(op.ListID, errs[i])
+		} else {
+			s.invalidateTasks(op.ListID, err)
+		}
+	}
+	return errs, err
+}
+
+// Unwrap implements service.Wrapper: batches are passed on to the backend.
+func (s *Service) Unwrap() service.Service {
+	return s.backend
+}
+
+// invalidateLists drops the cached lists after a list mutation.
+// See invalidateTasks for how errors are treated.
+func (s *Service) invalidateLists(err error) {
+	s.update(func(snap *snapshot) {
+		if snap.Lists != nil && errors.Is(err, service.ErrUnavailable) {
+			snap.Lists.FetchedAt = time.Time{}
+			return
+		}
+		snap.Lists = nil
+	})
+}
+
+// invalidateTasks drops the cached tasks of a list after a task mutation.
+// Failed mutations invalidate too, since the server may still have applied
+// them. If the backend was unreachable the entry is only marked stale, so it
+// keeps serving offline reads but is revalidated once back online.
+func (s *Service) invalidateTasks(listID string, err error) {
+	s.update(func(snap *snapshot) {
+		if entry := snap.Tasks[listID]; entry != nil && errors.Is(err, service.ErrUnavailable) {
+			entry.FetchedAt = time.Time{}
+			return
+		}
+		delete(snap.Tasks, listID)
+	})
+}
+
+// fresh reports whether data fetched at t may be served without revalidation.
+func (s *Service) fresh(t time.Time) bool {
+	return s.now().Sub(t) < s.maxAge
+}
+
+// load returns the in-memory snapshot, reading it from disk on first use.
+func (s *Service) load() *snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snap == nil {
+		s.snap = readSnapshot(s.path)
+	}
+	return s.snap
+}
+
+// update applies fn to both the in-memory snapshot and the file on disk.
+// The file is re-read under an exclusive lock so concurrent gtask processes
+// do not lose each other's updates. The cache is best-effort: write errors
+// are ignored and only cost a refetch later.
+func (s *Service) update(fn func(*snapshot)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snap == nil {
+		s.snap = readSnapshot(s.path)
+	}
+	fn(s.snap)
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return
+	}
+	unlock, err := fsutil.Lock(s.path)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	onDisk := readSnapshot(s.path)
+	fn(onDisk)
+	data, err := json.Marshal(onDisk)
+	if err != nil {
+		return
+	}
+	fsutil.WriteFileAtomic(s.path, data, 0600)
+}
+
+// readSnapshot reads a snapshot from disk. Missing, corrupt or outdated
+// files yield an empty snapshot.
+func readSnapshot(path string) *snapshot {
+	empty := &snapshot{Version: formatVersion, Tasks: make(map[string]*tasksEntry)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return empty
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil || snap.Version != formatVersion {
+		return empty
+	}
+	if snap.Tasks == nil {
+		snap.Tasks = make(map[string]*tasksEntry)
+	}
+	return &snap
+}
+
+// copyLists returns a copy so callers cannot modify cached data.
+func copyLists(lists []service.TaskList) []service.TaskList {
+	result := make([]service.TaskList, len(lists))
+	copy(result, lists)
+	return result
+}
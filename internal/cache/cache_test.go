@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gtask/internal/config"
+	"gtask/internal/service"
+	"gtask/internal/service/servicetest"
+	"gtask/internal/testutil"
+)
+
+// countingService counts backend calls made through the cache.
+type countingService struct {
+	*testutil.FakeService
+	listLists int
+	listTasks int
+}
+
+func (c *countingService) ListLists(ctx context.Context) ([]service.TaskList, error) {
+	c.listLists++
+	return c.FakeService.ListLists(ctx)
+}
+
+func (c *countingService) ListOpenTasks(ctx context.Context, listID string, page int) ([]service.Task, error) {
+	c.listTasks++
+	return c.FakeService.ListOpenTasks(ctx, listID, page)
+}
+
+// revalidatingService adds service.Revalidator with a controllable answer.
+type revalidatingService struct {
+	*countingService
+	etag        string
+	modified    bool
+	revalidated int
+}
+
+func (r *revalidatingService) ListListsIfNoneMatch(ctx context.Context, etag string) ([]service.TaskList, string, error) {
+	r.revalidated++
+	if etag != "" && etag == r.etag {
+		return nil, etag, service.ErrNotModified
+	}
+	lists, err := r.ListLists(ctx)
+	return lists, r.etag, err
+}
+
+func (r *revalidatingService) TasksModifiedSince(ctx context.Context, listID string, since time.Time) (bool, error) {
+	r.revalidated++
+	return r.modified, nil
+}
+
+func newTestConfig(t *testing.T, maxAge time.Duration) *config.Config {
+	t.Helper()
+	return &config.Config{Dir: t.TempDir(), CacheDir: t.TempDir(), MaxAge: maxAge}
+}
+
+func TestCache_ServesFreshEntriesAcrossInstances(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.AddList("work", "Work")
+	fake.AddTask("work", "t1", "Report")
+	backend := &countingService{FakeService: fake}
+	cfg := newTestConfig(t, time.Hour)
+	ctx := context.Background()
+
+	first := New(backend, cfg)
+	if _, err := first.ListLists(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.ListOpenTasks(ctx, "work", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second process reads the same cache file
+	second := New(backend, cfg)
+	lists, err := second.ListLists(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := second.ListOpenTasks(ctx, "work", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasOpen, err := second.HasOpenTasks(ctx, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lists) != 2 || len(tasks) != 1 || !hasOpen {
+		t.Errorf("unexpected cached data: lists=%v tasks=%v hasOpen=%v", lists, tasks, hasOpen)
+	}
+	if backend.listLists != 1 || backend.listTasks != 1 {
+		t.Errorf("expected one backend call each, got lists=%d tasks=%d", backend.listLists, backend.listTasks)
+	}
+}
+
+func TestCache_MutationInvalidates(t *testing.T) {
+	fake := testutil.NewFakeService()
+	backend := &countingService{FakeService: fake}
+	svc := New(backend, newTestConfig(t, time.Hour))
+	ctx := context.Background()
+
+	if _, err := svc.ListOpenTasks(ctx, "@default", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreateTask(ctx, "@default", "Buy milk"); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := svc.ListOpenTasks(ctx, "@default", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Title != "Buy milk" {
+		t.Errorf("expected new task after invalidation, got %v", tasks)
+	}
+	if backend.listTasks != 2 {
+		t.Errorf("expected refetch after mutation, got %d fetches", backend.listTasks)
+	}
+}
+
+func TestCache_RevalidatesStaleEntries(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.AddTask("@default", "t1", "Buy milk")
+	backend := &revalidatingService{countingService: &countingService{FakeService: fake}, etag: `"v1"`}
+	svc := New(backend, newTestConfig(t, 0))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.ListLists(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.ListOpenTasks(ctx, "@default", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the first round fetches; later rounds are cheap revalidations
+	if backend.listLists != 1 || backend.listTasks != 1 {
+		t.Errorf("expected single full fetch, got lists=%d tasks=%d", backend.listLists, backend.listTasks)
+	}
+
+	// A reported change triggers a refetch
+	backend.modified = true
+	if _, err := svc.ListOpenTasks(ctx, "@default", 1); err != nil {
+		t.Fatal(err)
+	}
+	if backend.listTasks != 2 {
+		t.Errorf("expected refetch after change, got %d fetches", backend.listTasks)
+	}
+}
+
+func TestCache_NoCacheBypassesReads(t *testing.T) {
+	fake := testutil.NewFakeService()
+	backend := &countingService{FakeService: fake}
+	cfg := newTestConfig(t, time.Hour)
+	ctx := context.Background()
+
+	New(backend, cfg).ListLists(ctx)
+
+	cfg.NoCache = true
+	New(backend, cfg).ListLists(ctx)
+
+	if backend.listLists != 2 {
+		t.Errorf("expected --no-cache to hit the backend, got %d calls", backend.listLists)
+	}
+}
+
+func TestCache_PagesFromCachedTasks(t *testing.T) {
+	fake := testutil.NewFakeService()
+	for i := 0; i < 150; i++ {
+		fake.AddTask("@default", "t", "Task")
+	}
+	svc := New(&countingService{FakeService: fake}, newTestConfig(t, time.Hour))
+	ctx := context.Background()
+
+	page2, err := svc.ListOpenTasks(ctx, "@default", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page3, err := svc.ListOpenTasks(ctx, "@default", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page2) != 50 || len(page3) != 0 {
+		t.Errorf("expected 50 and 0 tasks, got %d and %d", len(page2), len(page3))
+	}
+}
+
+func TestService_Conformance(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) service.Service {
+		return New(testutil.NewFakeService(), newTestConfig(t, time.Hour))
+	})
+}
@@ -5,12 +5,18 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
+	"os"
 	"strings"
+	"time"
 
+	"gtask/internal/auth"
+	"gtask/internal/backend"
 	"gtask/internal/commands"
 	"gtask/internal/config"
 	"gtask/internal/exitcode"
 	"gtask/internal/service"
+	"gtask/internal/transport"
 )
 
 // ServiceFactory creates a Service from config.
@@ -20,13 +26,17 @@ type ServiceFactory func(ctx context.Context, cfg *config.Config) (service.Servi
 // Dispatcher handles command-line parsing and dispatch.
 type Dispatcher struct {
 	registry *commands.Registry
+	backends *backend.Registry
 	factory  ServiceFactory
 }
 
 // NewDispatcher creates a new dispatcher with the given registry and service factory.
+// A nil factory opens the backend selected by the config or --backend flag
+// from backend.DefaultRegistry.
 func NewDispatcher(registry *commands.Registry, factory ServiceFactory) *Dispatcher {
 	return &Dispatcher{
 		registry: registry,
+		backends: backend.DefaultRegistry,
 		factory:  factory,
 	}
 }
@@ -68,24 +78,57 @@ func (d *Dispatcher) dispatch(ctx context.Context, cmdName string, args []string
 	return d.dispatchCommand(ctx, cmd, args, out, errOut)
 }
 
-func (d *Dispatcher) dispatchCommand(ctx context.Context, cmd commands.Command, args []string, out, errOut io.Writer) int {
+// commonFlags holds the flags available on every command.
+type commonFlags struct {
+	configDir   string
+	quiet       bool
+	debug       bool
+	noCache     bool
+	maxAge      time.Duration
+	offline     bool
+	backendName string
+	profile     string
+	format      string
+	timeout     time.Duration
+	deadline    time.Duration
+	record      string
+	replay      string
+}
+
+// newFlagSet creates the flag set for cmd with the common flags.
+func newFlagSet(cmd commands.Command) (*flag.FlagSet, *commonFlags) {
 	// Create flag set with custom error handling
 	fs := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
 	fs.SetOutput(io.Discard) // We handle errors ourselves
-
-	// Common flags
-	var configDir string
-	var quiet bool
-	var debug bool
-
-	fs.StringVar(&configDir, "config", "", "")
-	fs.BoolVar(&quiet, "quiet", false, "")
-	fs.BoolVar(&debug, "debug", false, "")
+	cf := registerCommonFlags(fs)
 
 	// Register command-specific flags
 	cmd.RegisterFlags(fs)
+	return fs, cf
+}
 
-	// Parse flags
+// registerCommonFlags adds the common flags to fs.
+func registerCommonFlags(fs *flag.FlagSet) *commonFlags {
+	cf := &commonFlags{}
+	fs.StringVar(&cf.configDir, "config", "", "")
+	fs.BoolVar(&cf.quiet, "quiet", false, "")
+	fs.BoolVar(&cf.debug, "debug", false, "")
+	fs.BoolVar(&cf.noCache, "no-cache", false, "")
+	fs.DurationVar(&cf.maxAge, "max-age", 0, "")
+	fs.BoolVar(&cf.offline, "offline", false, "")
+	fs.StringVar(&cf.backendName, "backend", "", "")
+	fs.StringVar(&cf.profile, "profile", "", "")
+	fs.StringVar(&cf.format, "format", "", "")
+	fs.DurationVar(&cf.timeout, "timeout", 0, "")
+	fs.DurationVar(&cf.deadline, "deadline", 0, "")
+	fs.StringVar(&cf.record, "record", "", "")
+	fs.StringVar(&cf.replay, "replay", "", "")
+	return cf
+}
+
+// parseFlags parses args into fs and returns the positional arguments.
+// On failure it prints the error and returns false.
+func parseFlags(fs *flag.FlagSet, args []string, errOut io.Writer) ([]string, bool) {
 	if err := fs.Parse(args); err != nil {
 		// Handle specific error types
 		errStr := err.Error()
@@ -98,7 +141,7 @@ func (d *Dispatcher) dispatchCommand(ctx context.Context, cmd commands.Command,
 				flagPart := strings.TrimSpace(parts[0])
 				flagPart = strings.TrimPrefix(flagPart, "flag ")
 				fmt.Fprintf(errOut, "error: flag needs an argument: %s\n", flagPart)
-				return exitcode.UserError
+				return nil, false
 			}
 		}
 
@@ -106,66 +149,236 @@ func (d *Dispatcher) dispatchCommand(ctx context.Context, cmd commands.Command,
 		if strings.HasPrefix(errStr, "flag provided but not defined:") {
 			flagName := strings.TrimPrefix(errStr, "flag provided but not defined: ")
 			fmt.Fprintf(errOut, "error: unknown flag: %s\n", flagName)
-			return exitcode.UserError
+			return nil, false
 		}
 
 		// Generic error handling for bad flag values
 		if strings.Contains(errStr, "invalid value") {
 			fmt.Fprintf(errOut, "error: %s\n", errStr)
-			return exitcode.UserError
+			return nil, false
 		}
 
 		fmt.Fprintf(errOut, "error: %s\n", errStr)
-		return exitcode.UserError
+		return nil, false
 	}
 
 	// Check if first positional arg starts with - (should have been parsed as flag)
 	positionalArgs := fs.Args()
 	if len(positionalArgs) > 0 && strings.HasPrefix(positionalArgs[0], "-") {
 		fmt.Fprintf(errOut, "error: unknown flag: %s\n", positionalArgs[0])
+		return nil, false
+	}
+	return positionalArgs, true
+}
+
+func (d *Dispatcher) dispatchCommand(ctx context.Context, cmd commands.Command, args []string, out, errOut io.Writer) int {
+	// Parse flags
+	fs, flags := newFlagSet(cmd)
+	positionalArgs, ok := parseFlags(fs, args, errOut)
+	if !ok {
 		return exitcode.UserError
 	}
 
 	// Create config
-	cfg, err := config.New(configDir)
+	cfg, err := config.New(flags.configDir, flags.profile)
 	if err != nil {
 		fmt.Fprintf(errOut, "error: %s\n", err)
 		return exitcode.UserError
 	}
-	cfg.Quiet = quiet
-	cfg.Debug = debug
+	if err := cfg.LoadSettings(); err != nil {
+		fmt.Fprintf(errOut, "error: %s\n", err)
+		return exitcode.AuthError
+	}
+
+	// Common flags from the environment, checked here so that a bad value
+	// is reported with its variable
+	envArgs, err := envFlags()
+	if err != nil {
+		fmt.Fprintf(errOut, "error: %s\n", err)
+		return exitcode.UserError
+	}
+
+	// Default flags from config.toml and the environment go first, so the
+	// command line wins. Parsing again resets every flag before applying all.
+	defaults := cfg.Settings.CommandFlags(cmd.Name())
+	if len(defaults)+len(envArgs) > 0 {
+		fs, flags = newFlagSet(cmd)
+		var errBuf strings.Builder
+		withDefaults, ok := parseFlags(fs, append(append(defaults, envArgs...), args...), &errBuf)
+		if !ok || len(withDefaults) != len(positionalArgs) {
+			reason := strings.TrimPrefix(strings.TrimSpace(errBuf.String()), "error: ")
+			if reason == "" {
+				reason = "only flags are allowed"
+			}
+			fmt.Fprintf(errOut, "error: invalid default flags for %s in %s: %s\n", cmd.Name(), cfg.Settings.FlagsOrigin(cmd.Name()), reason)
+			return exitcode.AuthError
+		}
+	}
+
+	cfg.Quiet = flags.quiet
+	cfg.Debug = flags.debug
+	cfg.NoCache = flags.noCache
+	cfg.MaxAge = flags.maxAge
+	cfg.Offline = flags.offline
+	if flags.backendName != "" {
+		cfg.Backend = flags.backendName
+	}
+	if flags.format != "" {
+		if flags.format != config.FormatText && flags.format != config.FormatJSON {
+			fmt.Fprintf(errOut, "error: invalid format: %s\n", flags.format)
+			return exitcode.UserError
+		}
+		cfg.Settings.Format = flags.format
+	}
+	if flags.timeout != 0 {
+		if flags.timeout < 0 {
+			fmt.Fprintf(errOut, "error: invalid timeout: %s\n", flags.timeout)
+			return exitcode.UserError
+		}
+		cfg.Settings.Timeout = flags.timeout
+		cfg.TimeoutFlag = flags.timeout
+	}
+	if flags.deadline != 0 {
+		if flags.deadline < 0 {
+			fmt.Fprintf(errOut, "error: invalid deadline: %s\n", flags.deadline)
+			return exitcode.UserError
+		}
+		cfg.Settings.Deadline = flags.deadline
+	}
+	if flags.record != "" && flags.replay != "" {
+		fmt.Fprintln(errOut, "error: --record and --replay cannot be combined")
+		return exitcode.UserError
+	}
+	if (flags.record != "" || flags.replay != "") && cfg.Backend != config.BackendGoogle {
+		fmt.Fprintf(errOut, "error: --record and --replay need the %s backend, not %s\n", config.BackendGoogle, cfg.Backend)
+		return exitcode.UserError
+	}
+	cfg.Record = flags.record
+	cfg.Replay = flags.replay
+	if cfg.Debug {
+		cfg.Log = newDebugLogger(errOut)
+		stats := &transport.Stats{}
+		ctx = transport.WithStats(ctx, stats)
+		start := time.Now()
+		cfg.Log.Debug("dispatch", "command", cmd.Name(), "args", positionalArgs,
+			"profile", cfg.Profile, "dir", cfg.Dir, "backend", cfg.Backend)
+		defer func() {
+			cfg.Log.Debug("api summary", append(stats.Attrs(), "total", time.Since(start).Round(time.Millisecond))...)
+		}()
+	}
+
+	// The deadline covers everything from here on; requests cut short by it
+	// fail with service.ErrDeadline instead of "request timed out"
+	if cfg.Settings.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, cfg.Settings.Deadline, service.ErrDeadline)
+		defer cancel()
+	}
 
 	// Check auth requirements
 	var svc service.Service
 	if cmd.NeedsAuth() {
-		if d.factory != nil {
-			// Custom factory provided (e.g., tests with FakeService) - skip file checks,
-			// let the factory handle auth
-			svc, err = d.factory(ctx, cfg)
-			if err != nil {
-				// Check if it's an auth error
-				if strings.Contains(err.Error(), "token") || strings.Contains(err.Error(), "auth") {
-					fmt.Fprintf(errOut, "error: auth error: %s\n", err)
+		b, ok := d.backends.Find(cfg.Backend)
+		if !ok {
+			fmt.Fprintf(errOut, "error: unknown backend: %s\n", cfg.Backend)
+			return exitcode.UserError
+		}
+
+		// A read-only login cannot change tasks; say so before any request.
+		// A replayed session does not use the login. This does not cover
+		// multi, whose mounts have their own logins: a read-only mount's
+		// client refuses changes routed to it, and other mounts still work.
+		if b.NeedsOAuth && cfg.Replay == "" && cmd.Mutates() && auth.ReadOnly(cfg) {
+			fmt.Fprintf(errOut, "error: auth error: read-only login cannot run %s (run: %s)\n", cmd.Name(), cfg.ProfileCommand("login"))
+			return exitcode.AuthError
+		}
+
+		factory := d.factory
+		if factory == nil {
+			// Report missing OAuth files before the backend tries to use them
+			if b.NeedsOAuth && cfg.Replay == "" {
+				if err := auth.Preflight(cfg); err != nil {
+					fmt.Fprintf(errOut, "error: %s\n", err)
 					return exitcode.AuthError
 				}
-				fmt.Fprintf(errOut, "error: backend error: %s\n", err)
-				return exitcode.BackendError
 			}
-		} else {
-			// No factory - check for required auth files and report user-friendly errors
-			if !cfg.HasOAuthClient() {
-				fmt.Fprintf(errOut, "error: oauth_client.json not found in %s\n", cfg.Dir)
+			factory = d.backends.Open
+		}
+
+		svc, err = factory(ctx, cfg)
+		if err != nil {
+			// Check if it's an auth error
+			if strings.Contains(err.Error(), "token") || strings.Contains(err.Error(), "auth") {
+				fmt.Fprintf(errOut, "error: auth error: %s\n", err)
 				return exitcode.AuthError
 			}
-			if !cfg.HasToken() {
-				fmt.Fprintf(errOut, "error: not logged in (run: gtask login)\n")
+			// Missing or invalid backend config file
+			if b.ConfigFile != "" && strings.Contains(err.Error(), b.ConfigFile) {
+				fmt.Fprintf(errOut, "error: %s\n", err)
 				return exitcode.AuthError
 			}
-			// No factory and no service creation - svc remains nil
-			// Commands must handle nil service (this path is for pre-flight checks only)
+			fmt.Fprintf(errOut, "error: backend error: %s\n", err)
+			return exitcode.BackendError
 		}
 	}
 
 	// Run command
-	return cmd.Run(ctx, cfg, svc, positionalArgs, out, errOut)
+	code := cmd.Run(ctx, cfg, svc, positionalArgs, out, errOut)
+	cfg.Logger().Debug("command finished", "command", cmd.Name(), "code", code)
+
+	// Let the user know when changes only reached the offline outbox
+	if q, ok := svc.(queuer); ok && q.Queued() > 0 && !cfg.Quiet {
+		fmt.Fprintf(errOut, "queued %d change(s) while offline (run: %s)\n", q.Queued(), cfg.ProfileCommand("sync"))
+	}
+	return code
+}
+
+// commonEnv maps environment variables to the common flags they set.
+// GTASK_CONFIG_DIR and GTASK_PROFILE are read by config.New, and settings
+// such as GTASK_FORMAT by config.Settings.ApplyEnv.
+var commonEnv = []struct{ env, flag string }{
+	{"GTASK_QUIET", "quiet"},
+	{"GTASK_DEBUG", "debug"},
+	{"GTASK_NO_CACHE", "no-cache"},
+	{"GTASK_MAX_AGE", "max-age"},
+	{"GTASK_OFFLINE", "offline"},
+	{"GTASK_BACKEND", "backend"},
+}
+
+// envFlags returns the common flags set in the environment as arguments.
+// Values are validated against the flag types.
+func envFlags() ([]string, error) {
+	var args []string
+	scratch := flag.NewFlagSet("env", flag.ContinueOnError)
+	registerCommonFlags(scratch)
+	for _, e := range commonEnv {
+		v := os.Getenv(e.env)
+		if v == "" {
+			continue
+		}
+		if err := scratch.Set(e.flag, v); err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", e.env, v)
+		}
+		args = append(args, "--"+e.flag+"="+v)
+	}
+	return args, nil
+}
+
+// newDebugLogger returns the --debug logger writing to w. Times are left
+// out; requests log their own latency.
+func newDebugLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey && a.Value.Kind() == slog.KindTime {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+// queuer is implemented by services that queue changes while offline.
+type queuer interface {
+	Queued() int
 }
@@ -3,14 +3,22 @@ package cli_test
 import (
 	"bytes"
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"gtask/internal/auth"
+	"gtask/internal/cache"
 	"gtask/internal/cli"
 	"gtask/internal/commands"
 	"gtask/internal/config"
 	"gtask/internal/exitcode"
+	"gtask/internal/outbox"
 	"gtask/internal/service"
 	"gtask/internal/testutil"
+
+	_ "gtask/internal/backend/all"
 )
 
 // testFactory creates a service factory that returns the given FakeService.
@@ -20,6 +28,47 @@ func testFactory(svc *testutil.FakeService) cli.ServiceFactory {
 	}
 }
 
+// slowService answers ListLists only when the request context ends.
+type slowService struct {
+	*testutil.FakeService
+}
+
+func (s slowService) ListLists(ctx context.Context) ([]service.TaskList, error) {
+	<-ctx.Done()
+	return nil, service.TimeoutError(ctx)
+}
+
+func TestDispatcher_Deadline(t *testing.T) {
+	t.Setenv("GTASK_DEADLINE", "")
+	factory := func(ctx context.Context, cfg *config.Config) (service.Service, error) {
+		return slowService{testutil.NewFakeService()}, nil
+	}
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, factory)
+
+	var stdout, stderr bytes.Buffer
+	code := dispatcher.Run(context.Background(), []string{"lists", "--config", t.TempDir(), "--deadline", "20ms"}, &stdout, &stderr)
+	if code != exitcode.BackendError {
+		t.Errorf("expected exit code %d, got %d", exitcode.BackendError, code)
+	}
+	if stderr.String() != "error: backend error: command deadline exceeded\n" {
+		t.Errorf("unexpected stderr: %q", stderr.String())
+	}
+
+	// From the environment
+	t.Setenv("GTASK_DEADLINE", "20ms")
+	stderr.Reset()
+	code = dispatcher.Run(context.Background(), []string{"lists", "--config", t.TempDir()}, &stdout, &stderr)
+	if code != exitcode.BackendError || !strings.Contains(stderr.String(), "command deadline exceeded") {
+		t.Errorf("expected deadline from GTASK_DEADLINE, got %d %q", code, stderr.String())
+	}
+
+	stderr.Reset()
+	code = dispatcher.Run(context.Background(), []string{"lists", "--config", t.TempDir(), "--timeout", "-1s"}, &stdout, &stderr)
+	if code != exitcode.UserError || stderr.String() != "error: invalid timeout: -1s\n" {
+		t.Errorf("expected invalid timeout, got %d %q", code, stderr.String())
+	}
+}
+
 func TestDispatcher_UnknownCommand(t *testing.T) {
 	svc := testutil.NewFakeService()
 	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, testFactory(svc))
@@ -179,3 +228,533 @@ func TestDispatcher_RmWithShortListFlag(t *testing.T) {
 		t.Errorf("expected 0 tasks, got %d", len(tasks))
 	}
 }
+
+func TestDispatcher_UnknownBackend(t *testing.T) {
+	svc := testutil.NewFakeService()
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, testFactory(svc))
+
+	var stdout, stderr bytes.Buffer
+	code := dispatcher.Run(context.Background(), []string{"lists", "--backend", "paper"}, &stdout, &stderr)
+
+	if code != exitcode.UserError {
+		t.Errorf("expected exit code %d, got %d", exitcode.UserError, code)
+	}
+	expected := "error: unknown backend: paper\n"
+	if stderr.String() != expected {
+		t.Errorf("expected %q, got %q", expected, stderr.String())
+	}
+}
+
+func TestDispatcher_SavedBackend(t *testing.T) {
+	dir := t.TempDir()
+	var gotBackend string
+	factory := func(ctx context.Context, cfg *config.Config) (service.Service, error) {
+		gotBackend = cfg.Backend
+		return testutil.NewFakeService(), nil
+	}
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, factory)
+
+	var stdout, stderr bytes.Buffer
+	if code := dispatcher.Run(context.Background(), []string{"backend", "--config", dir, "local"}, &stdout, &stderr); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, stderr.String())
+	}
+
+	dispatcher.Run(context.Background(), []string{"lists", "--config", dir}, &stdout, &stderr)
+	if gotBackend != "local" {
+		t.Errorf("expected saved backend 'local', got %q", gotBackend)
+	}
+
+	// The flag overrides the saved selection
+	dispatcher.Run(context.Background(), []string{"lists", "--config", dir, "--backend", "todotxt"}, &stdout, &stderr)
+	if gotBackend != "todotxt" {
+		t.Errorf("expected flag backend 'todotxt', got %q", gotBackend)
+	}
+}
+
+func TestDispatcher_Profiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(config.ProfileEnv, "")
+	var gotDir, gotProfile string
+	factory := func(ctx context.Context, cfg *config.Config) (service.Service, error) {
+		gotDir, gotProfile = cfg.Dir, cfg.Profile
+		return testutil.NewFakeService(), nil
+	}
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, factory)
+	workDir := filepath.Join(dir, config.ProfilesDir, "work")
+
+	var stdout, stderr bytes.Buffer
+	dispatcher.Run(context.Background(), []string{"lists", "--config", dir}, &stdout, &stderr)
+	if gotDir != dir || gotProfile != config.DefaultProfile {
+		t.Errorf("expected default profile in %s, got %q in %s", dir, gotProfile, gotDir)
+	}
+
+	dispatcher.Run(context.Background(), []string{"lists", "--config", dir, "--profile", "work"}, &stdout, &stderr)
+	if gotDir != workDir || gotProfile != "work" {
+		t.Errorf("expected work profile in %s, got %q in %s", workDir, gotProfile, gotDir)
+	}
+
+	// The environment selects a profile when the flag is absent
+	t.Setenv(config.ProfileEnv, "home")
+	dispatcher.Run(context.Background(), []string{"lists", "--config", dir}, &stdout, &stderr)
+	if gotProfile != "home" {
+		t.Errorf("expected profile from %s, got %q", config.ProfileEnv, gotProfile)
+	}
+	t.Setenv(config.ProfileEnv, "")
+
+	// A saved default profile applies last
+	if code := dispatcher.Run(context.Background(), []string{"profiles", "--config", dir, "add", "work"}, &stdout, &stderr); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, stderr.String())
+	}
+	if code := dispatcher.Run(context.Background(), []string{"profiles", "--config", dir, "default", "work"}, &stdout, &stderr); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, stderr.String())
+	}
+	dispatcher.Run(context.Background(), []string{"lists", "--config", dir}, &stdout, &stderr)
+	if gotProfile != "work" {
+		t.Errorf("expected saved default profile 'work', got %q", gotProfile)
+	}
+}
+
+func TestDispatcher_ProfilesRmRemovesEveryCache(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv(config.ProfileEnv, "")
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, nil)
+
+	var stdout, stderr bytes.Buffer
+	if code := dispatcher.Run(context.Background(), []string{"profiles", "--config", dir, "add", "work"}, &stdout, &stderr); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, stderr.String())
+	}
+
+	// Caches of the profile with two backends, and of a mount inside it
+	workDir := filepath.Join(dir, config.ProfilesDir, "work")
+	mountDir := filepath.Join(workDir, "mounts", "home")
+	if err := os.MkdirAll(mountDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	cacheDir := config.DefaultCacheDir()
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, account := range []config.Config{
+		{Dir: workDir, Backend: config.BackendGoogle},
+		{Dir: workDir, Backend: "caldav"},
+		{Dir: mountDir, Backend: config.BackendGoogle},
+	} {
+		path := filepath.Join(cacheDir, cache.Key(&account)+".json")
+		if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	if code := dispatcher.Run(context.Background(), []string{"profiles", "--config", dir, "rm", "work"}, &stdout, &stderr); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, stderr.String())
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s removed, got %v", path, err)
+		}
+	}
+}
+
+func TestDispatcher_ProfilesRmRefusesQueuedChanges(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv(config.ProfileEnv, "")
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, nil)
+
+	var stdout, stderr bytes.Buffer
+	if code := dispatcher.Run(context.Background(), []string{"profiles", "--config", dir, "add", "work"}, &stdout, &stderr); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, stderr.String())
+	}
+
+	// A change queued by a mount of the profile
+	workDir := filepath.Join(dir, config.ProfilesDir, "work")
+	mount := config.Config{Dir: filepath.Join(workDir, "mounts", "home"), Backend: config.BackendGoogle}
+	if err := os.MkdirAll(mount.Dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := outbox.Open(mount.OutboxPath()).Append(outbox.Op{Kind: outbox.CreateTask, ListID: "@default", Title: "Milk"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stderr.Reset()
+	code := dispatcher.Run(context.Background(), []string{"profiles", "--config", dir, "rm", "work"}, &stdout, &stderr)
+	if code != exitcode.UserError {
+		t.Errorf("expected exit code %d, got %d", exitcode.UserError, code)
+	}
+	want := "error: 1 offline change(s) not synced yet (run: gtask sync --profile work, or remove " + mount.OutboxPath() + " to discard them)\n"
+	if stderr.String() != want {
+		t.Errorf("expected %q, got %q", want, stderr.String())
+	}
+	if _, err := os.Stat(mount.OutboxPath()); err != nil {
+		t.Errorf("expected the outbox kept, got %v", err)
+	}
+}
+
+func TestDispatcher_ProfileDebugAndLoginHint(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(config.ProfileEnv, "")
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, nil)
+	workDir := filepath.Join(dir, config.ProfilesDir, "work")
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	// Profiles share the OAuth client in the base directory
+	if err := os.WriteFile(filepath.Join(dir, config.OAuthClientFile), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := dispatcher.Run(context.Background(), []string{"lists", "--config", dir, "--profile", "work", "--debug"}, &stdout, &stderr)
+
+	if code != exitcode.AuthError {
+		t.Errorf("expected exit code %d, got %d", exitcode.AuthError, code)
+	}
+	expected := "level=DEBUG msg=dispatch command=lists args=[] profile=work dir=" + workDir + " backend=google\n" +
+		"error: not logged in (run: gtask login --profile work)\n" +
+		"level=DEBUG msg=\"api summary\" calls=0 failed=0 retries=0 throttled=0 waited=0s time=0s total="
+	if !strings.HasPrefix(stderr.String(), expected) {
+		t.Errorf("expected stderr to start with %q, got %q", expected, stderr.String())
+	}
+}
+
+func TestDispatcher_QueuedChangesHintNamesProfile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(config.ProfileEnv, "")
+	if err := os.MkdirAll(filepath.Join(dir, config.ProfilesDir, "work"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	fake := testutil.NewFakeService()
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, func(ctx context.Context, cfg *config.Config) (service.Service, error) {
+		return outbox.New(fake, cfg), nil
+	})
+
+	var stdout, stderr bytes.Buffer
+	code := dispatcher.Run(context.Background(), []string{"add", "--config", dir, "--profile", "work", "--offline", "Milk"}, &stdout, &stderr)
+
+	if code != exitcode.Success {
+		t.Errorf("expected exit code %d, got %d: %s", exitcode.Success, code, stderr.String())
+	}
+	if stderr.String() != "queued 1 change(s) while offline (run: gtask sync --profile work)\n" {
+		t.Errorf("unexpected stderr: %q", stderr.String())
+	}
+}
+
+func TestDispatcher_UnencryptedTokenHint(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(config.ProfileEnv, "")
+	t.Setenv("GTASK_TOKEN_STORE", "")
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, nil)
+	for _, name := range []string{config.OAuthClientFile, config.TokenFile} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSettingsFile(t, dir, "token_store = \"encrypted\"\n")
+
+	var stdout, stderr bytes.Buffer
+	code := dispatcher.Run(context.Background(), []string{"lists", "--config", dir}, &stdout, &stderr)
+
+	if code != exitcode.AuthError {
+		t.Errorf("expected exit code %d, got %d", exitcode.AuthError, code)
+	}
+	if stderr.String() != "error: token.json is not encrypted (run: gtask auth migrate)\n" {
+		t.Errorf("unexpected stderr: %q", stderr.String())
+	}
+}
+
+func TestDispatcher_ReadOnlyLogin(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(config.ProfileEnv, "")
+	t.Setenv("GTASK_BACKEND", "")
+	if err := os.WriteFile(filepath.Join(dir, config.ScopesFile), []byte(auth.TasksReadOnlyScope+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	svc := testutil.NewFakeService()
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, testFactory(svc))
+
+	var stdout, stderr bytes.Buffer
+	code := dispatcher.Run(context.Background(), []string{"add", "--config", dir, "Buy", "milk"}, &stdout, &stderr)
+	if code != exitcode.AuthError {
+		t.Errorf("expected exit code %d, got %d", exitcode.AuthError, code)
+	}
+	if stderr.String() != "error: auth error: read-only login cannot run add (run: gtask login)\n" {
+		t.Errorf("unexpected stderr: %q", stderr.String())
+	}
+	if tasks, _ := svc.ListOpenTasks(context.Background(), "@default", 1); len(tasks) != 0 {
+		t.Errorf("expected no task to be created, got %d", len(tasks))
+	}
+
+	// Reading is still allowed
+	stdout.Reset()
+	stderr.Reset()
+	code = dispatcher.Run(context.Background(), []string{"lists", "--config", dir}, &stdout, &stderr)
+	if code != exitcode.Success {
+		t.Errorf("expected exit code %d, got %d (stderr: %s)", exitcode.Success, code, stderr.String())
+	}
+}
+
+func TestDispatcher_InvalidProfile(t *testing.T) {
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, nil)
+
+	var stdout, stderr bytes.Buffer
+	code := dispatcher.Run(context.Background(), []string{"lists", "--config", t.TempDir(), "--profile", "../work"}, &stdout, &stderr)
+
+	if code != exitcode.UserError {
+		t.Errorf("expected exit code %d, got %d", exitcode.UserError, code)
+	}
+	if stderr.String() != "error: invalid profile name: ../work\n" {
+		t.Errorf("unexpected stderr: %q", stderr.String())
+	}
+}
+
+func TestDispatcher_UnreadableSavedBackend(t *testing.T) {
+	dir := t.TempDir()
+	// A directory where the backend file should be cannot be read
+	if err := os.Mkdir(filepath.Join(dir, config.BackendFile), 0700); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, nil)
+
+	var stdout, stderr bytes.Buffer
+	code := dispatcher.Run(context.Background(), []string{"lists", "--config", dir}, &stdout, &stderr)
+
+	if code != exitcode.UserError {
+		t.Errorf("expected exit code %d, got %d", exitcode.UserError, code)
+	}
+	if !strings.HasPrefix(stderr.String(), "error: ") || !strings.Contains(stderr.String(), config.BackendFile) {
+		t.Errorf("unexpected stderr: %q", stderr.String())
+	}
+}
+
+// writeSettingsFile writes config.toml to dir.
+func writeSettingsFile(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, config.SettingsFile), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatcher_SettingsPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		args     []string
+		wantList string
+	}{
+		{"built-in default", "", nil, "@default"},
+		{"file default_list", `default_list = "Work"`, nil, "work"},
+		{"flags entry over default_list", "default_list = \"Work\"\n[flags]\nadd = [\"-l\", \"Home\"]\n", nil, "home"},
+		{"command line over file", "default_list = \"Work\"\n[flags]\nadd = [\"-l\", \"Home\"]\n", []string{"--list", "Shopping"}, "shopping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeSettingsFile(t, dir, tt.settings)
+			svc := testutil.NewFakeService()
+			svc.AddList("work", "Work")
+			svc.AddList("home", "Home")
+			svc.AddList("shopping", "Shopping")
+			dispatcher := cli.NewDispatcher(commands.DefaultRegistry, testFactory(svc))
+
+			args := append([]string{"add", "--config", dir}, tt.args...)
+			var stdout, stderr bytes.Buffer
+			if code := dispatcher.Run(context.Background(), append(args, "Milk"), &stdout, &stderr); code != exitcode.Success {
+				t.Fatalf("expected success, got %d: %s", code, stderr.String())
+			}
+			tasks, _ := svc.ListOpenTasks(context.Background(), tt.wantList, 1)
+			if len(tasks) != 1 || tasks[0].Title != "Milk" {
+				t.Errorf("expected the task in %s, got %+v", tt.wantList, tasks)
+			}
+		})
+	}
+}
+
+func TestDispatcher_SettingsPageSizeAndFormat(t *testing.T) {
+	dir := t.TempDir()
+	writeSettingsFile(t, dir, "page_size = 2\nformat = \"json\"\n")
+	svc := testutil.NewFakeService()
+	for _, id := range []string{"t1", "t2", "t3"} {
+		svc.AddTask("@default", id, "Task "+id)
+	}
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, testFactory(svc))
+
+	// page_size from the file, format overridden by the flag
+	var stdout, stderr bytes.Buffer
+	dispatcher.Run(context.Background(), []string{"list", "--config", dir, "--format", "text"}, &stdout, &stderr)
+	if stdout.String() != "   1  Task t1\n   2  Task t2\n" {
+		t.Errorf("expected two text lines, got %q (stderr %q)", stdout.String(), stderr.String())
+	}
+
+	// --page-size on the command line wins over the file
+	stdout.Reset()
+	dispatcher.Run(context.Background(), []string{"list", "--config", dir, "--page-size", "1"}, &stdout, &stderr)
+	if !strings.HasPrefix(stdout.String(), "[") || strings.Count(stdout.String(), `"ref"`) != 1 {
+		t.Errorf("expected JSON with one task, got %q", stdout.String())
+	}
+}
+
+func TestDispatcher_InvalidSettings(t *testing.T) {
+	tests := []struct {
+		settings string
+		want     string
+	}{
+		{"page_size = \"ten\"\n", "config.toml:1: page_size: expected an integer\n"},
+		{"[flags]\nlist = [\"--colour\"]\n", "error: invalid default flags for list in config.toml: unknown flag: -colour\n"},
+		{"[flags]\nlist = [\"Work\"]\n", "error: invalid default flags for list in config.toml: only flags are allowed\n"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeSettingsFile(t, dir, tt.settings)
+		dispatcher := cli.NewDispatcher(commands.DefaultRegistry, testFactory(testutil.NewFakeService()))
+
+		var stdout, stderr bytes.Buffer
+		code := dispatcher.Run(context.Background(), []string{"list", "--config", dir}, &stdout, &stderr)
+
+		if code != exitcode.AuthError {
+			t.Errorf("%q: expected exit code %d, got %d", tt.settings, exitcode.AuthError, code)
+		}
+		if !strings.HasSuffix(stderr.String(), tt.want) {
+			t.Errorf("%q: expected stderr ending in %q, got %q", tt.settings, tt.want, stderr.String())
+		}
+	}
+}
+
+func TestDispatcher_Environment(t *testing.T) {
+	dir := t.TempDir()
+	writeSettingsFile(t, dir, "default_list = \"Work\"\n")
+	t.Setenv(config.ConfigDirEnv, dir)
+	t.Setenv(config.ProfileEnv, "")
+	t.Setenv("GTASK_LIST", "Home")
+	t.Setenv("GTASK_QUIET", "true")
+
+	var gotDir string
+	svc := testutil.NewFakeService()
+	svc.AddList("work", "Work")
+	svc.AddList("home", "Home")
+	svc.AddList("shopping", "Shopping")
+	factory := func(ctx context.Context, cfg *config.Config) (service.Service, error) {
+		gotDir = cfg.Dir
+		return svc, nil
+	}
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, factory)
+
+	// GTASK_LIST beats config.toml, GTASK_QUIET silences "ok"
+	var stdout, stderr bytes.Buffer
+	if code := dispatcher.Run(context.Background(), []string{"add", "Milk"}, &stdout, &stderr); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, stderr.String())
+	}
+	if gotDir != dir {
+		t.Errorf("expected config dir from %s, got %s", config.ConfigDirEnv, gotDir)
+	}
+	if stdout.String() != "" {
+		t.Errorf("expected quiet output, got %q", stdout.String())
+	}
+	if tasks, _ := svc.ListOpenTasks(context.Background(), "home", 1); len(tasks) != 1 {
+		t.Errorf("expected the task in Home, got %+v", tasks)
+	}
+
+	// Flags beat the environment
+	stdout.Reset()
+	dispatcher.Run(context.Background(), []string{"add", "--quiet=false", "-l", "Shopping", "Eggs"}, &stdout, &stderr)
+	if stdout.String() != "ok\n" {
+		t.Errorf("expected --quiet=false to win, got %q", stdout.String())
+	}
+	if tasks, _ := svc.ListOpenTasks(context.Background(), "shopping", 1); len(tasks) != 1 {
+		t.Errorf("expected the task in Shopping, got %+v", tasks)
+	}
+	otherDir := t.TempDir()
+	dispatcher.Run(context.Background(), []string{"lists", "--config", otherDir}, &stdout, &stderr)
+	if gotDir != otherDir {
+		t.Errorf("expected --config to win, got %s", gotDir)
+	}
+}
+
+func TestDispatcher_InvalidEnvironment(t *testing.T) {
+	tests := []struct {
+		env, value string
+		code       int
+		want       string
+	}{
+		{"GTASK_QUIET", "sometimes", exitcode.UserError, "error: invalid GTASK_QUIET: sometimes\n"},
+		{"GTASK_MAX_AGE", "1 minute", exitcode.UserError, "error: invalid GTASK_MAX_AGE: 1 minute\n"},
+		{"GTASK_FORMAT", "yaml", exitcode.AuthError, "error: GTASK_FORMAT: invalid format: yaml (want text or json)\n"},
+		{"GTASK_FLAGS_LIST", "--colour", exitcode.AuthError, "error: invalid default flags for list in GTASK_FLAGS_LIST: unknown flag: -colour\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+			dispatcher := cli.NewDispatcher(commands.DefaultRegistry, testFactory(testutil.NewFakeService()))
+
+			var stdout, stderr bytes.Buffer
+			code := dispatcher.Run(context.Background(), []string{"list", "--config", t.TempDir()}, &stdout, &stderr)
+
+			if code != tt.code {
+				t.Errorf("expected exit code %d, got %d", tt.code, code)
+			}
+			if stderr.String() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, stderr.String())
+			}
+		})
+	}
+}
+
+func TestDispatcher_Replay(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(config.ProfileEnv, "")
+	t.Setenv("GTASK_BACKEND", "")
+	cassette := filepath.Join(dir, "session.json")
+	if err := os.WriteFile(cassette, []byte(`{"version": 1, "interactions": [
+  {"request": {"method": "GET", "url": "https://tasks.googleapis.com/tasks/v1/users/@me/lists/%40default?alt=json&prettyPrint=false"},
+   "response": {"status": 200, "header": {"Content-Type": ["application/json"]}, "body": "{\"id\": \"L1\", \"title\": \"My Tasks\"}"}},
+  {"request": {"method": "GET", "url": "https://tasks.googleapis.com/tasks/v1/users/@me/lists?alt=json&maxResults=100&prettyPrint=false"},
+   "response": {"status": 200, "header": {"Content-Type": ["application/json"]}, "body": "{\"items\": [{\"id\": \"L1\", \"title\": \"My Tasks\"}, {\"id\": \"L2\", \"title\": \"Work\"}]}"}}
+]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// No login: replaying needs no OAuth files or token
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, nil)
+
+	var stdout, stderr bytes.Buffer
+	code := dispatcher.Run(context.Background(), []string{"lists", "--config", dir, "--replay", cassette}, &stdout, &stderr)
+	if code != exitcode.Success {
+		t.Fatalf("expected exit code %d, got %d (stderr: %s)", exitcode.Success, code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "My Tasks") || !strings.Contains(stdout.String(), "Work") {
+		t.Errorf("expected replayed lists, got %q", stdout.String())
+	}
+
+	// Each run replays the cassette from the start
+	stdout.Reset()
+	code = dispatcher.Run(context.Background(), []string{"lists", "--config", dir, "--replay", cassette}, &stdout, &stderr)
+	if code != exitcode.Success || !strings.Contains(stdout.String(), "Work") {
+		t.Errorf("expected the replay to repeat, got %d %q", code, stdout.String())
+	}
+
+	stderr.Reset()
+	code = dispatcher.Run(context.Background(), []string{"add", "--config", dir, "--replay", cassette, "Milk"}, &stdout, &stderr)
+	if code != exitcode.BackendError || !strings.Contains(stderr.String(), "replay: no recorded response for POST") {
+		t.Errorf("expected a replay miss, got %d %q", code, stderr.String())
+	}
+}
+
+func TestDispatcher_RecordReplayErrors(t *testing.T) {
+	t.Setenv("GTASK_BACKEND", "")
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, nil)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--record", "a.json", "--replay", "b.json"}, "error: --record and --replay cannot be combined\n"},
+		{[]string{"--backend", "local", "--record", "a.json"}, "error: --record and --replay need the google backend, not local\n"},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := dispatcher.Run(context.Background(), append([]string{"lists", "--config", t.TempDir()}, tt.args...), &stdout, &stderr)
+		if code != exitcode.UserError || stderr.String() != tt.want {
+			t.Errorf("%v: got %d %q, want %q", tt.args, code, stderr.String(), tt.want)
+		}
+	}
+}
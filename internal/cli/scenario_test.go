@@ -0,0 +1,259 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gtask/internal/cli"
+	"gtask/internal/commands"
+	"gtask/internal/config"
+	"gtask/internal/testutil"
+)
+
+// Scenario tests run the CLI from script files in testdata/scenarios. Each
+// file seeds a FakeService, runs gtask commands one after another against
+// it and lists what each printed:
+//
+//	# Comments and blank lines are kept.
+//	list work Work
+//	task work Write report
+//
+//	$ gtask done -l work 1
+//	> ok
+//	$ gtask done 9
+//	! error: ...
+//	[exit 1]
+//
+// Lines before the first command seed the fake (see seedScenario). After a
+// command, "> " lines are its stdout, "! " lines its stderr and "[exit N]"
+// its exit code if not 0. The files are golden files: the test renders the
+// script with the actual output and compares it with the file, and
+// GOLDEN_UPDATE=1 writes the actual output in. To add a scenario, write the
+// state and commands, run the test with GOLDEN_UPDATE=1 and review the
+// output it filled in.
+//
+// Commands share one config directory, so settings persist from one to the
+// next. Its path shows as $WORK in the output.
+
+// scenarioStep is a line of a scenario: a command with its output, or any
+// other line, which is kept as is.
+type scenarioStep struct {
+	line string
+	args []string // nil unless line is a command
+}
+
+func TestScenarios(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "scenarios", "*.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no scenarios in testdata/scenarios")
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".golden")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			state, steps, err := parseScenario(string(data))
+			if err != nil {
+				t.Fatalf("%s:%v", file, err)
+			}
+			testutil.GoldenString(t, filepath.Join("scenarios", name), runScenario(t, state, steps))
+		})
+	}
+}
+
+// parseScenario splits a scenario into the state lines before the first
+// command and the steps from there on. Expected output is dropped; it is
+// compared as part of the rendered scenario.
+func parseScenario(text string) (state []string, steps []scenarioStep, err error) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	inCommand := false
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "$ "):
+			fields, err := splitArgs(strings.TrimPrefix(line, "$ "))
+			if err != nil {
+				return nil, nil, fmt.Errorf("%d: %w", i+1, err)
+			}
+			if len(fields) == 0 || fields[0] != "gtask" {
+				return nil, nil, fmt.Errorf("%d: commands must start with gtask: %s", i+1, line)
+			}
+			steps = append(steps, scenarioStep{line: line, args: fields[1:]})
+			inCommand = true
+		case line == "" || strings.HasPrefix(line, "#"):
+			if steps == nil {
+				state = append(state, line)
+			} else {
+				steps = append(steps, scenarioStep{line: line})
+			}
+			inCommand = false
+		case steps == nil:
+			state = append(state, line)
+		case inCommand && (line == ">" || line == "!" || strings.HasPrefix(line, "> ") || strings.HasPrefix(line, "! ") || strings.HasPrefix(line, "[exit ")):
+			// Expected output
+		default:
+			return nil, nil, fmt.Errorf("%d: expected a command, output, comment or blank line: %s", i+1, line)
+		}
+	}
+	return state, steps, nil
+}
+
+// splitArgs splits a command line at spaces. Single or double quotes group
+// words and may be empty; there are no escapes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// seedScenario applies the state lines of a scenario to svc:
+//
+//	list <id> <title>             add a list (@default, "My Tasks", exists)
+//	task <list-id> <title>        add an open task
+//	completed <list-id> <title>   add a completed task
+//	fail <method> <message>       fail every call of a service method
+//
+// Task IDs are made from the title as FakeService.CreateTask does.
+func seedScenario(svc *testutil.FakeService, state []string) error {
+	failures := map[string]*error{
+		"DefaultList":  &svc.DefaultListErr,
+		"ListLists":    &svc.ListListsErr,
+		"ResolveList":  &svc.ResolveListErr,
+		"CreateList":   &svc.CreateListErr,
+		"DeleteList":   &svc.DeleteListErr,
+		"HasOpenTasks": &svc.HasOpenTasksErr,
+		"CreateTask":   &svc.CreateTaskErr,
+		"CompleteTask": &svc.CompleteTaskErr,
+		"DeleteTask":   &svc.DeleteTaskErr,
+	}
+	for i, line := range state {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		directive, rest, _ := strings.Cut(line, " ")
+		arg, value, ok := strings.Cut(strings.TrimSpace(rest), " ")
+		if !ok || strings.TrimSpace(value) == "" {
+			return fmt.Errorf("%d: expected %s <arg> <value>: %s", i+1, directive, line)
+		}
+		value = strings.TrimSpace(value)
+		switch directive {
+		case "list":
+			svc.AddList(arg, value)
+		case "task", "completed":
+			id := strings.ToLower(strings.ReplaceAll(value, " ", "-"))
+			svc.AddTask(arg, id, value)
+			if directive == "completed" {
+				if err := svc.CompleteTask(context.Background(), arg, id); err != nil {
+					return fmt.Errorf("%d: %w", i+1, err)
+				}
+			}
+		case "fail":
+			target, ok := failures[arg]
+			if !ok {
+				return fmt.Errorf("%d: unknown service method: %s", i+1, arg)
+			}
+			*target = errors.New(value)
+		default:
+			return fmt.Errorf("%d: unknown state directive: %s", i+1, directive)
+		}
+	}
+	return nil
+}
+
+// runScenario runs the steps against a fake seeded with state and returns
+// the scenario rendered with the output.
+func runScenario(t *testing.T, state []string, steps []scenarioStep) string {
+	t.Helper()
+	svc := testutil.NewFakeService()
+	if err := seedScenario(svc, state); err != nil {
+		t.Fatalf("state:%v", err)
+	}
+
+	// Only the scenario decides the config, not the environment
+	work := t.TempDir()
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "GTASK_") {
+			t.Setenv(name, "")
+		}
+	}
+	t.Setenv(config.ConfigDirEnv, filepath.Join(work, "config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(work, "cache"))
+	t.Setenv("NO_COLOR", "1")
+	dispatcher := cli.NewDispatcher(commands.DefaultRegistry, testFactory(svc))
+
+	var b strings.Builder
+	for _, line := range state {
+		b.WriteString(line + "\n")
+	}
+	for _, step := range steps {
+		b.WriteString(step.line + "\n")
+		if step.args == nil {
+			continue
+		}
+		var stdout, stderr bytes.Buffer
+		code := dispatcher.Run(context.Background(), step.args, &stdout, &stderr)
+		writeOutput(&b, ">", strings.ReplaceAll(stdout.String(), work, "$WORK"))
+		writeOutput(&b, "!", strings.ReplaceAll(stderr.String(), work, "$WORK"))
+		if code != 0 {
+			b.WriteString("[exit " + strconv.Itoa(code) + "]\n")
+		}
+	}
+	return b.String()
+}
+
+// writeOutput writes each line of out with prefix. A missing final newline
+// is not shown.
+func writeOutput(b *strings.Builder, prefix, out string) {
+	if out == "" {
+		return
+	}
+	for line := range strings.Lines(out) {
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			b.WriteString(prefix + "\n")
+		} else {
+			b.WriteString(prefix + " " + line + "\n")
+		}
+	}
+}
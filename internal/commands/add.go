@@ -32,6 +32,7 @@ func (c *AddCmd) Aliases() []string { return nil }
 func (c *AddCmd) Synopsis() string  { return "Create a task" }
 func (c *AddCmd) Usage() string     { return "gtask add [--list <list-name>] <title...>" }
 func (c *AddCmd) NeedsAuth() bool   { return true }
+func (c *AddCmd) Mutates() bool     { return true }
 
 func (c *AddCmd) RegisterFlags(fs *flag.FlagSet) {
 	fs.StringVar(&c.listName, "list", "", "")
@@ -52,6 +53,7 @@ func (c *CreateCmd) Aliases() []string { return nil }
 func (c *CreateCmd) Synopsis() string  { return "Create a task (alias for add)" }
 func (c *CreateCmd) Usage() string     { return "gtask create [--list <list-name>] <title...>" }
 func (c *CreateCmd) NeedsAuth() bool   { return true }
+func (c *CreateCmd) Mutates() bool     { return true }
 
 func (c *CreateCmd) RegisterFlags(fs *flag.FlagSet) {
 	fs.StringVar(&c.listName, "list", "", "")
@@ -81,7 +83,7 @@ func runAdd(ctx context.Context, cfg *config.Config, svc service.Service, listNa
 	var list service.TaskList
 	var err error
 	if listName != "" {
-		list, err = svc.ResolveList(ctx, listName)
+		list, err = resolveList(ctx, cfg, svc, listName)
 		if err != nil {
 			if strings.Contains(err.Error(), "not found") {
 				fmt.Fprintf(errOut, "error: list not found: %s\n", listName)
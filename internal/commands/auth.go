@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gtask/internal/auth"
+	"gtask/internal/backend"
+	"gtask/internal/config"
+	"gtask/internal/exitcode"
+	"gtask/internal/service"
+)
+
+func init() {
+	Register(&AuthCmd{})
+}
+
+// AuthCmd implements the auth command, which manages the stored OAuth
+// token.
+type AuthCmd struct{}
+
+func (c *AuthCmd) Name() string      { return "auth" }
+func (c *AuthCmd) Aliases() []string { return nil }
+func (c *AuthCmd) Synopsis() string  { return "Manage the stored OAuth token" }
+func (c *AuthCmd) Usage() string     { return "gtask auth [common flags] status | migrate" }
+func (c *AuthCmd) NeedsAuth() bool   { return false }
+func (c *AuthCmd) Mutates() bool     { return false }
+
+func (c *AuthCmd) RegisterFlags(fs *flag.FlagSet) {}
+
+func (c *AuthCmd) Run(ctx context.Context, cfg *config.Config, svc service.Service, args []string, out, errOut io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintf(errOut, "error: usage: %s\n", c.Usage())
+		return exitcode.UserError
+	}
+	switch args[0] {
+	case "status":
+		return c.status(ctx, cfg, out, errOut)
+	case "migrate":
+		return c.migrate(cfg, out, errOut)
+	}
+	fmt.Fprintf(errOut, "error: unknown auth command: %s\n", args[0])
+	return exitcode.UserError
+}
+
+// migrate moves the token into the store selected by token_store:
+// token.json is encrypted into token.enc, or token.enc decrypted back.
+func (c *AuthCmd) migrate(cfg *config.Config, out, errOut io.Writer) int {
+	if b, ok := backend.DefaultRegistry.Find(cfg.Backend); ok && !b.NeedsOAuth {
+		if !cfg.Quiet {
+			fmt.Fprintln(out, noLoginMessage(b))
+		}
+		return exitcode.Success
+	}
+
+	err := auth.Migrate(auth.OtherStore(cfg), auth.NewStore(cfg))
+	if errors.Is(err, auth.ErrNoToken) {
+		if !cfg.Quiet {
+			fmt.Fprintln(out, "nothing to migrate")
+		}
+		return exitcode.Success
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "error: failed to migrate token: %v\n", err)
+		return exitcode.AuthError
+	}
+	if !cfg.Quiet {
+		fmt.Fprintln(out, "ok")
+	}
+	return exitcode.Success
+}
+
+// status reports the login of the active profile: granted scopes, token
+// expiry and whether a refresh token is stored. It refreshes the token to
+// prove it still works. Token values are never printed.
+func (c *AuthCmd) status(ctx context.Context, cfg *config.Config, out, errOut io.Writer) int {
+	if b, ok := backend.DefaultRegistry.Find(cfg.Backend); ok && !b.NeedsOAuth {
+		fmt.Fprintln(out, noLoginMessage(b))
+		return exitcode.Success
+	}
+
+	fmt.Fprintf(out, "profile: %s (%s)\n", cfg.Profile, cfg.Dir)
+	storeName, storePath := config.TokenStoreFile, cfg.TokenPath()
+	if cfg.Settings.TokenStore == config.TokenStoreEncrypted {
+		storeName, storePath = config.TokenStoreEncrypted, cfg.EncryptedTokenPath()
+	}
+	fmt.Fprintf(out, "token store: %s (%s)\n", storeName, storePath)
+
+	if err := auth.Preflight(cfg); err != nil {
+		fmt.Fprintf(errOut, "error: %v\n", err)
+		return exitcode.AuthError
+	}
+
+	scopes := auth.Scopes(cfg)
+	label := ""
+	if auth.ReadOnly(cfg) {
+		label = " (read-only)"
+	}
+	fmt.Fprintf(out, "scopes: %s%s\n", strings.Join(scopes, " "), label)
+
+	refreshCtx, cancel := context.WithTimeout(ctx, authTimeout(cfg, tokenValidationTimeout))
+	defer cancel()
+	stored, current, err := auth.Refresh(refreshCtx, cfg, true)
+	if stored != nil {
+		if stored.RefreshToken != "" {
+			fmt.Fprintln(out, "refresh token: present")
+		} else {
+			fmt.Fprintln(out, "refresh token: missing")
+		}
+		fmt.Fprintf(out, "access token: %s\n", describeExpiry(stored.Expiry))
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "error: %v\n", err)
+		return exitcode.AuthError
+	}
+	fmt.Fprintf(out, "refresh: ok (new access token %s)\n", describeExpiry(current.Expiry))
+	return exitcode.Success
+}
+
+// describeExpiry formats a token expiry for auth status.
+func describeExpiry(expiry time.Time) string {
+	switch {
+	case expiry.IsZero():
+		return "no expiry"
+	case time.Now().After(expiry):
+		return "expired " + expiry.Local().Format(time.RFC3339)
+	}
+	return "expires " + expiry.Local().Format(time.RFC3339)
+}
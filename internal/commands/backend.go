@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"gtask/internal/backend"
+	"gtask/internal/config"
+	"gtask/internal/exitcode"
+	"gtask/internal/service"
+)
+
+func init() {
+	Register(&BackendCmd{})
+}
+
+// BackendCmd implements the backend command.
+type BackendCmd struct{}
+
+func (c *BackendCmd) Name() string      { return "backend" }
+func (c *BackendCmd) Aliases() []string { return nil }
+func (c *BackendCmd) Synopsis() string  { return "Show or select the task backend" }
+func (c *BackendCmd) Usage() string     { return "gtask backend [common flags] [<name>]" }
+func (c *BackendCmd) NeedsAuth() bool   { return false }
+func (c *BackendCmd) Mutates() bool     { return false }
+
+func (c *BackendCmd) RegisterFlags(fs *flag.FlagSet) {}
+
+func (c *BackendCmd) Run(ctx context.Context, cfg *config.Config, svc service.Service, args []string, out, errOut io.Writer) int {
+	if len(args) > 1 {
+		fmt.Fprintln(errOut, "error: too many arguments")
+		return exitcode.UserError
+	}
+
+	// No argument: list backends, marking the selected one
+	if len(args) == 0 {
+		for _, b := range backend.DefaultRegistry.All() {
+			marker := " "
+			if b.Name == cfg.Backend {
+				marker = "*"
+			}
+			line := fmt.Sprintf("%s %-8s %s", marker, b.Name, b.Synopsis)
+			if b.ConfigFile != "" {
+				line += fmt.Sprintf(" [%s]", b.ConfigFile)
+			}
+			fmt.Fprintln(out, line)
+		}
+		return exitcode.Success
+	}
+
+	name := args[0]
+	if _, ok := backend.DefaultRegistry.Find(name); !ok {
+		fmt.Fprintf(errOut, "error: unknown backend: %s\n", name)
+		return exitcode.UserError
+	}
+	if err := cfg.SaveBackend(name); err != nil {
+		fmt.Fprintf(errOut, "error: failed to save backend: %v\n", err)
+		return exitcode.UserError
+	}
+
+	if !cfg.Quiet {
+		fmt.Fprintln(out, "ok")
+	}
+	return exitcode.Success
+}
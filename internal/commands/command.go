@@ -28,6 +28,10 @@ type Command interface {
 	// Commands like help, version, login, logout return false.
 	NeedsAuth() bool
 
+	// Mutates returns true if the command changes tasks or lists.
+	// The dispatcher refuses such commands for a read-only login.
+	Mutates() bool
+
 	// RegisterFlags registers command-specific flags.
 	RegisterFlags(fs *flag.FlagSet)
 
@@ -3,13 +3,21 @@ package commands_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"gtask/internal/commands"
 	"gtask/internal/config"
 	"gtask/internal/exitcode"
+	"gtask/internal/outbox"
 	"gtask/internal/testutil"
+
+	_ "gtask/internal/backend/all"
 )
 
 // runCommand is a helper to run a command with FakeService.
@@ -261,6 +269,22 @@ func TestAddCommand_Quiet(t *testing.T) {
 	}
 }
 
+func TestAddCommand_LogsListResolution(t *testing.T) {
+	svc := testutil.NewFakeService()
+	svc.AddList("shopping", "Shopping")
+
+	var logBuf, outBuf, errBuf bytes.Buffer
+	cfg := &config.Config{Log: slog.New(slog.NewTextHandler(&logBuf, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+	cmd := &commands.AddCmd{}
+	cmd.SetListName("shopping")
+	if code := cmd.Run(context.Background(), cfg, svc, []string{"Bread"}, &outBuf, &errBuf); code != exitcode.Success {
+		t.Fatalf("expected exit code %d, got %d (stderr: %s)", exitcode.Success, code, errBuf.String())
+	}
+	if !strings.Contains(logBuf.String(), `msg="resolve list" name=shopping id=shopping title=Shopping`) {
+		t.Errorf("expected list resolution in debug log, got %q", logBuf.String())
+	}
+}
+
 func TestAddCommand_NoTitle(t *testing.T) {
 	svc := testutil.NewFakeService()
 
@@ -863,3 +887,501 @@ func TestListCommand_TooManyLists(t *testing.T) {
 		t.Errorf("expected too many lists error, got %q", stderr)
 	}
 }
+
+// Tests for --all and --page-size
+
+func TestListCommand_AllShowsEveryTask(t *testing.T) {
+	svc := testutil.NewFakeService()
+	svc.AddList("work", "Work")
+	for i := 1; i <= 150; i++ {
+		svc.AddTask("work", fmt.Sprintf("task%d", i), fmt.Sprintf("Task %d", i))
+	}
+
+	cmd := &commands.ListCmd{}
+	cmd.SetPage(1)
+	cmd.SetAll(true)
+	stdout, stderr, code := runCommand(t, cmd, svc, []string{"Work"}, false)
+
+	if code != exitcode.Success {
+		t.Errorf("expected exit code %d, got %d", exitcode.Success, code)
+	}
+	if stderr != "" {
+		t.Errorf("expected no stderr, got %q", stderr)
+	}
+	if !strings.Contains(stdout, "     101  Task 101\n") {
+		t.Errorf("expected numbering to continue past page 1, got %q", stdout)
+	}
+	if !strings.HasSuffix(stdout, "     150  Task 150\n") {
+		t.Errorf("expected last task to be 150, got %q", stdout)
+	}
+}
+
+func TestListCommand_AllListsViewWithAll(t *testing.T) {
+	svc := testutil.NewFakeService()
+	for i := 1; i <= 102; i++ {
+		svc.AddTask("@default", fmt.Sprintf("task%d", i), fmt.Sprintf("Task %d", i))
+	}
+
+	cmd := &commands.ListCmd{}
+	cmd.SetPage(1)
+	cmd.SetAll(true)
+	stdout, _, code := runCommand(t, cmd, svc, nil, false)
+
+	if code != exitcode.Success {
+		t.Errorf("expected exit code %d, got %d", exitcode.Success, code)
+	}
+	if !strings.HasSuffix(stdout, " 102  Task 102\n") {
+		t.Errorf("expected all default list tasks, got %q", stdout)
+	}
+}
+
+func TestListCommand_PageSize(t *testing.T) {
+	svc := testutil.NewFakeService()
+	svc.AddList("work", "Work")
+	for i := 1; i <= 5; i++ {
+		svc.AddTask("work", fmt.Sprintf("task%d", i), fmt.Sprintf("Task %d", i))
+	}
+
+	cmd := &commands.ListCmd{}
+	cmd.SetPage(2)
+	cmd.SetPageSize(2)
+	stdout, stderr, code := runCommand(t, cmd, svc, []string{"Work"}, false)
+
+	if code != exitcode.Success {
+		t.Errorf("expected exit code %d, got %d", exitcode.Success, code)
+	}
+	if stderr != "" {
+		t.Errorf("expected no stderr, got %q", stderr)
+	}
+	expected := "------------\nWork\n------------\n       3  Task 3\n       4  Task 4\n"
+	if stdout != expected {
+		t.Errorf("expected %q, got %q", expected, stdout)
+	}
+}
+
+func TestListCommand_PageSizeFetchesOnlyCoveringPages(t *testing.T) {
+	svc := testutil.NewFakeService()
+	svc.AddList("work", "Work")
+	for i := 1; i <= 350; i++ {
+		svc.AddTask("work", fmt.Sprintf("task%d", i), fmt.Sprintf("Task %d", i))
+	}
+
+	cmd := &commands.ListCmd{}
+	cmd.SetPage(2)
+	cmd.SetPageSize(150)
+	stdout, _, code := runCommand(t, cmd, svc, []string{"Work"}, false)
+
+	if code != exitcode.Success {
+		t.Errorf("expected exit code %d, got %d", exitcode.Success, code)
+	}
+	if !strings.Contains(stdout, "     151  Task 151\n") || !strings.HasSuffix(stdout, "     300  Task 300\n") {
+		t.Errorf("expected tasks 151 to 300, got %q", stdout)
+	}
+	if got := fmt.Sprint(svc.PagesFetched); got != "[2 3]" {
+		t.Errorf("expected only pages 2 and 3 fetched, got %s", got)
+	}
+}
+
+func TestListCommand_InvalidPageSize(t *testing.T) {
+	svc := testutil.NewFakeService()
+
+	cmd := &commands.ListCmd{}
+	cmd.SetPage(1)
+	cmd.SetPageSize(-5)
+	_, stderr, code := runCommand(t, cmd, svc, nil, false)
+
+	if code != exitcode.UserError {
+		t.Errorf("expected exit code %d, got %d", exitcode.UserError, code)
+	}
+	if stderr != "error: invalid page size: -5\n" {
+		t.Errorf("expected invalid page size error, got %q", stderr)
+	}
+}
+
+func TestListCommand_PageAndAllConflict(t *testing.T) {
+	svc := testutil.NewFakeService()
+
+	cmd := &commands.ListCmd{}
+	cmd.SetPage(2)
+	cmd.SetAll(true)
+	_, stderr, code := runCommand(t, cmd, svc, nil, false)
+
+	if code != exitcode.UserError {
+		t.Errorf("expected exit code %d, got %d", exitcode.UserError, code)
+	}
+	if stderr != "error: cannot use both --page and --all\n" {
+		t.Errorf("expected conflict error, got %q", stderr)
+	}
+}
+
+func TestDoneCommand_BeyondFirstPage(t *testing.T) {
+	svc := testutil.NewFakeService()
+	for i := 1; i <= 120; i++ {
+		svc.AddTask("@default", fmt.Sprintf("task%d", i), fmt.Sprintf("Task %d", i))
+	}
+
+	cmd := &commands.DoneCmd{}
+	_, stderr, code := runCommand(t, cmd, svc, []string{"110"}, false)
+
+	if code != exitcode.Success {
+		t.Fatalf("expected exit code %d, got %d (%s)", exitcode.Success, code, stderr)
+	}
+
+	tasks, _ := svc.ListOpenTasks(context.Background(), "@default", 2)
+	for _, task := range tasks {
+		if task.Title == "Task 110" {
+			t.Error("expected Task 110 to be completed")
+		}
+	}
+}
+
+// Tests for sync command
+
+func TestSyncCommand_NothingToSync(t *testing.T) {
+	svc := testutil.NewFakeService()
+
+	cmd := &commands.SyncCmd{}
+	stdout, stderr, code := runCommand(t, cmd, svc, nil, false)
+
+	if code != exitcode.Success {
+		t.Errorf("expected exit code %d, got %d", exitcode.Success, code)
+	}
+	if stderr != "" {
+		t.Errorf("expected no stderr, got %q", stderr)
+	}
+	if stdout != "nothing to sync\n" {
+		t.Errorf("expected 'nothing to sync', got %q", stdout)
+	}
+}
+
+func TestSyncCommand_ReportsConflicts(t *testing.T) {
+	svc := testutil.NewFakeService()
+	cfg := &config.Config{Dir: t.TempDir()}
+
+	box := outbox.Open(cfg.OutboxPath())
+	box.Append(outbox.Op{Kind: outbox.CreateTask, ListID: "@default", Title: "Buy milk"})
+	box.Append(outbox.Op{Kind: outbox.CompleteTask, ListID: "@default", TaskID: "gone", Title: "Old task"})
+
+	var outBuf, errBuf bytes.Buffer
+	code := (&commands.SyncCmd{}).Run(context.Background(), cfg, svc, nil, &outBuf, &errBuf)
+
+	if code != exitcode.UserError {
+		t.Errorf("expected exit code %d, got %d", exitcode.UserError, code)
+	}
+	expected := "error: conflict: done \"Old task\": not found\n"
+	if errBuf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, errBuf.String())
+	}
+	tasks, _ := svc.ListOpenTasks(context.Background(), "@default", 1)
+	if len(tasks) != 1 || tasks[0].Title != "Buy milk" {
+		t.Errorf("expected queued task to be created, got %v", tasks)
+	}
+}
+
+func TestSyncCommand_KeepsFailedChanges(t *testing.T) {
+	svc := testutil.NewFakeService()
+	svc.CreateTaskErr = errors.New("400 Bad Request")
+	svc.AddTask("@default", "t1", "Call mom")
+	cfg := &config.Config{Dir: t.TempDir()}
+
+	box := outbox.Open(cfg.OutboxPath())
+	box.Append(outbox.Op{Kind: outbox.CreateTask, ListID: "@default", Title: "Buy milk"})
+	box.Append(outbox.Op{Kind: outbox.CompleteTask, ListID: "@default", TaskID: "t1", Title: "Call mom"})
+
+	var outBuf, errBuf bytes.Buffer
+	code := (&commands.SyncCmd{}).Run(context.Background(), cfg, svc, nil, &outBuf, &errBuf)
+
+	if code != exitcode.BackendError {
+		t.Errorf("expected exit code %d, got %d", exitcode.BackendError, code)
+	}
+	expected := "error: backend error: add \"Buy milk\": 400 Bad Request (kept for the next sync)\n"
+	if errBuf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, errBuf.String())
+	}
+	if open, _ := svc.HasOpenTasks(context.Background(), "@default"); open {
+		t.Error("expected the change after the failed one to be applied")
+	}
+	if ops, _ := box.Ops(); len(ops) != 1 || ops[0].Title != "Buy milk" {
+		t.Errorf("expected the failed change to stay queued, got %+v", ops)
+	}
+}
+
+// Tests for backend command
+func TestBackendCommand_ListsBackends(t *testing.T) {
+	cmd := &commands.BackendCmd{}
+	var out, errOut bytes.Buffer
+	cfg := &config.Config{Dir: t.TempDir(), Backend: config.BackendGoogle}
+
+	code := cmd.Run(context.Background(), cfg, nil, nil, &out, &errOut)
+
+	if code != exitcode.Success {
+		t.Fatalf("expected exit code %d, got %d", exitcode.Success, code)
+	}
+	if !strings.Contains(out.String(), "* google   Google Tasks (default)\n") {
+		t.Errorf("expected google to be marked as selected, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "  caldav   CalDAV server (Nextcloud, Radicale, ...) [caldav.json]\n") {
+		t.Errorf("expected caldav with its config file, got:\n%s", out.String())
+	}
+}
+
+func TestBackendCommand_SavesSelection(t *testing.T) {
+	cmd := &commands.BackendCmd{}
+	var out, errOut bytes.Buffer
+	cfg := &config.Config{Dir: t.TempDir()}
+
+	if code := cmd.Run(context.Background(), cfg, nil, []string{"local"}, &out, &errOut); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, errOut.String())
+	}
+	if name, _ := cfg.SavedBackend(); name != "local" {
+		t.Errorf("expected saved backend 'local', got %q", name)
+	}
+
+	errOut.Reset()
+	if code := cmd.Run(context.Background(), cfg, nil, []string{"paper"}, &out, &errOut); code != exitcode.UserError {
+		t.Errorf("expected user error, got %d", code)
+	}
+	if errOut.String() != "error: unknown backend: paper\n" {
+		t.Errorf("unexpected stderr: %q", errOut.String())
+	}
+}
+
+func TestLoginCommand_NonOAuthBackend(t *testing.T) {
+	cmd := &commands.LoginCmd{}
+	var out, errOut bytes.Buffer
+	cfg := &config.Config{Dir: t.TempDir(), Backend: "caldav"}
+
+	code := cmd.Run(context.Background(), cfg, nil, nil, &out, &errOut)
+
+	if code != exitcode.Success {
+		t.Errorf("expected exit code %d, got %d", exitcode.Success, code)
+	}
+	expected := "backend caldav does not use login (credentials are read from caldav.json)\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+// Tests for profiles command
+func TestProfilesCommand_Manage(t *testing.T) {
+	cmd := &commands.ProfilesCmd{}
+	dir := t.TempDir()
+	cfg, err := config.New(dir, config.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.CacheDir = t.TempDir()
+	run := func(args ...string) (string, string, int) {
+		var out, errOut bytes.Buffer
+		code := cmd.Run(context.Background(), cfg, nil, args, &out, &errOut)
+		return out.String(), errOut.String(), code
+	}
+
+	if _, stderr, code := run("add", "work"); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, stderr)
+	}
+	if _, stderr, code := run("add", "work"); code != exitcode.UserError || stderr != "error: profile already exists: work\n" {
+		t.Errorf("expected duplicate error, got %d: %q", code, stderr)
+	}
+	if err := os.WriteFile(filepath.Join(dir, config.ProfilesDir, "work", config.TokenFile), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, _ := run()
+	expected := "* default    google, not logged in\n  work       google, logged in\n"
+	if stdout != expected {
+		t.Errorf("expected %q, got %q", expected, stdout)
+	}
+
+	if _, stderr, code := run("default", "work"); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, stderr)
+	}
+	if saved, _ := cfg.SavedDefaultProfile(); saved != "work" {
+		t.Errorf("expected saved default 'work', got %q", saved)
+	}
+
+	if _, stderr, code := run("rm", "work"); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, config.ProfilesDir, "work")); !os.IsNotExist(err) {
+		t.Errorf("expected profile directory removed, got %v", err)
+	}
+	if saved, _ := cfg.SavedDefaultProfile(); saved != "" {
+		t.Errorf("expected saved default reset, got %q", saved)
+	}
+
+	if _, stderr, code := run("rm", "default"); code != exitcode.UserError || stderr != "error: cannot remove default profile\n" {
+		t.Errorf("expected refusal, got %d: %q", code, stderr)
+	}
+	if _, stderr, code := run("default", "home"); code != exitcode.UserError || stderr != "error: profile not found: home\n" {
+		t.Errorf("expected not found, got %d: %q", code, stderr)
+	}
+}
+
+// Tests for config.toml settings
+func runWithSettings(t *testing.T, cmd commands.Command, svc *testutil.FakeService, settings config.Settings, args []string) (string, string, int) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	cfg := &config.Config{Dir: t.TempDir(), Settings: settings}
+	code := cmd.Run(context.Background(), cfg, svc, args, &out, &errOut)
+	return out.String(), errOut.String(), code
+}
+
+func newListCmd() *commands.ListCmd {
+	cmd := &commands.ListCmd{}
+	cmd.SetPage(1)
+	return cmd
+}
+
+func TestListCommand_HiddenLists(t *testing.T) {
+	svc := testutil.NewFakeService()
+	svc.AddList("archive", "Archive")
+	svc.AddList("work", "Work")
+	svc.AddTask("archive", "t1", "Old stuff")
+	svc.AddTask("work", "t2", "Report")
+	settings := config.Settings{HiddenLists: []string{"archive"}}
+
+	stdout, _, _ := runWithSettings(t, newListCmd(), svc, settings, nil)
+	expected := "------------\nWork\n------------\n      a1  Report\n"
+	if stdout != expected {
+		t.Errorf("expected %q, got %q", expected, stdout)
+	}
+
+	// Letters skip hidden lists, so a1 is still Work
+	if _, stderr, code := runWithSettings(t, &commands.DoneCmd{}, svc, settings, []string{"a1"}); code != exitcode.Success {
+		t.Fatalf("expected success, got %d: %s", code, stderr)
+	}
+	if has, _ := svc.HasOpenTasks(context.Background(), "work"); has {
+		t.Error("expected the Work task to be done")
+	}
+
+	// Hidden lists can still be shown by name and are marked in lists
+	if stdout, _, _ := runWithSettings(t, newListCmd(), svc, settings, []string{"Archive"}); !strings.Contains(stdout, "Old stuff") {
+		t.Errorf("expected the hidden list by name, got %q", stdout)
+	}
+	stdout, _, _ = runWithSettings(t, &commands.ListsCmd{}, svc, settings, nil)
+	if stdout != "My Tasks [default]\nArchive [hidden]\nWork\n" {
+		t.Errorf("unexpected lists output: %q", stdout)
+	}
+}
+
+func TestListCommand_JSON(t *testing.T) {
+	svc := testutil.NewFakeService()
+	svc.AddList("work", "Work")
+	svc.AddTask("work", "t1", "Report")
+	svc.AddTask("work", "t2", "Slides")
+
+	cmd := &commands.ListCmd{}
+	cmd.SetPage(2)
+	cmd.SetPageSize(1)
+	stdout, _, code := runWithSettings(t, cmd, svc, config.Settings{Format: config.FormatJSON}, []string{"work"})
+
+	if code != exitcode.Success {
+		t.Fatalf("expected success, got %d", code)
+	}
+	expected := `{
+  "id": "work",
+  "title": "Work",
+  "tasks": [
+    {
+      "ref": "2",
+      "id": "t2",
+      "title": "Slides"
+    }
+  ]
+}
+`
+	if stdout != expected {
+		t.Errorf("expected %s, got %s", expected, stdout)
+	}
+}
+
+func TestListCommand_EmptyJSON(t *testing.T) {
+	stdout, _, _ := runWithSettings(t, newListCmd(), testutil.NewFakeService(), config.Settings{Format: config.FormatJSON}, nil)
+
+	if !strings.Contains(stdout, `"tasks": []`) || strings.Contains(stdout, "no tasks found") {
+		t.Errorf("expected an empty default list in JSON, got %q", stdout)
+	}
+}
+
+func TestListCommand_Color(t *testing.T) {
+	svc := testutil.NewFakeService()
+	svc.AddList("work", "Work")
+	svc.AddTask("work", "t1", "Report")
+
+	stdout, _, _ := runWithSettings(t, newListCmd(), svc, config.Settings{Color: config.ColorAlways}, nil)
+	expected := "------------\n\033[1mWork\033[0m\n------------\n    \033[36m  a1\033[0m  Report\n"
+	if stdout != expected {
+		t.Errorf("expected %q, got %q", expected, stdout)
+	}
+}
+
+func TestListCommand_ColorTaskNumbers(t *testing.T) {
+	svc := testutil.NewFakeService()
+	svc.AddList("work", "Work")
+	svc.AddTask("work", "t1", "Report")
+	svc.AddTask(testutil.DefaultListID, "t2", "Milk")
+	settings := config.Settings{Color: config.ColorAlways}
+
+	stdout, _, _ := runWithSettings(t, newListCmd(), svc, settings, []string{"work"})
+	expected := "------------\n\033[1mWork\033[0m\n------------\n    \033[36m   1\033[0m  Report\n"
+	if stdout != expected {
+		t.Errorf("expected %q, got %q", expected, stdout)
+	}
+
+	// The default list comes first, without a header
+	stdout, _, _ = runWithSettings(t, newListCmd(), svc, settings, nil)
+	if !strings.HasPrefix(stdout, "\033[36m   1\033[0m  Milk\n") {
+		t.Errorf("expected a colored default list, got %q", stdout)
+	}
+}
+
+func TestConfigCommand(t *testing.T) {
+	cmd := &commands.ConfigCmd{}
+	cfg := &config.Config{Dir: t.TempDir()}
+	run := func(args ...string) (string, string, int) {
+		var out, errOut bytes.Buffer
+		code := cmd.Run(context.Background(), cfg, nil, args, &out, &errOut)
+		return out.String(), errOut.String(), code
+	}
+
+	for _, args := range [][]string{
+		{"set", "default_list", "Work"},
+		{"set", "hidden_lists", "Archive,Someday"},
+		{"set", "flags.list", "--all --page-size 5"},
+	} {
+		if _, stderr, code := run(args...); code != exitcode.Success {
+			t.Fatalf("%v: expected success, got %d: %s", args, code, stderr)
+		}
+	}
+
+	if stdout, _, _ := run("get", "hidden_lists"); stdout != "Archive,Someday\n" {
+		t.Errorf("unexpected get output: %q", stdout)
+	}
+	if stdout, _, code := run("get", "color"); code != exitcode.UserError || stdout != "" {
+		t.Errorf("expected unset key to fail silently, got %d: %q", code, stdout)
+	}
+
+	stdout, _, _ := run("list")
+	expected := "default_list = Work\nhidden_lists = Archive,Someday\nflags.list = --all --page-size 5\n"
+	if stdout != expected {
+		t.Errorf("expected %q, got %q", expected, stdout)
+	}
+
+	if _, stderr, _ := run("set", "flags.lst", "--all"); stderr != "error: unknown command: lst\n" {
+		t.Errorf("unexpected stderr: %q", stderr)
+	}
+	if _, stderr, _ := run("set", "format", "yaml"); stderr != "error: invalid format: yaml (want text or json)\n" {
+		t.Errorf("unexpected stderr: %q", stderr)
+	}
+	if _, stderr, _ := run("get"); stderr != "error: usage: "+cmd.Usage()+"\n" {
+		t.Errorf("unexpected stderr: %q", stderr)
+	}
+
+	if _, _, code := run("unset", "default_list"); code != exitcode.Success {
+		t.Errorf("expected unset to succeed, got %d", code)
+	}
+	if _, _, code := run("get", "default_list"); code != exitcode.UserError {
+		t.Errorf("expected default_list to be unset, got %d", code)
+	}
+}
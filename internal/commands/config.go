@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"gtask/internal/config"
+	"gtask/internal/exitcode"
+	"gtask/internal/service"
+)
+
+func init() {
+	Register(&ConfigCmd{})
+}
+
+// ConfigCmd implements the config command, which reads and edits
+// config.toml in the config directory of the active profile.
+type ConfigCmd struct{}
+
+func (c *ConfigCmd) Name() string      { return "config" }
+func (c *ConfigCmd) Aliases() []string { return nil }
+func (c *ConfigCmd) Synopsis() string  { return "Show or change settings in config.toml" }
+func (c *ConfigCmd) Usage() string {
+	return "gtask config [common flags] [list | get <key> | set <key> <value> | unset <key>]"
+}
+func (c *ConfigCmd) NeedsAuth() bool { return false }
+func (c *ConfigCmd) Mutates() bool   { return false }
+
+func (c *ConfigCmd) RegisterFlags(fs *flag.FlagSet) {}
+
+func (c *ConfigCmd) Run(ctx context.Context, cfg *config.Config, svc service.Service, args []string, out, errOut io.Writer) int {
+	sub := "list"
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+
+	want := map[string]int{"list": 0, "get": 1, "set": 2, "unset": 1}
+	n, ok := want[sub]
+	if !ok {
+		fmt.Fprintf(errOut, "error: unknown config command: %s\n", sub)
+		return exitcode.UserError
+	}
+	if len(args) != n {
+		fmt.Fprintf(errOut, "error: usage: %s\n", c.Usage())
+		return exitcode.UserError
+	}
+
+	// Default flags are keyed by the command's canonical name
+	if len(args) > 0 && sub != "unset" {
+		if name, ok := strings.CutPrefix(args[0], "flags."); ok {
+			if cmd, found := DefaultRegistry.Find(name); !found || cmd.Name() != name {
+				fmt.Fprintf(errOut, "error: unknown command: %s\n", name)
+				return exitcode.UserError
+			}
+		}
+	}
+
+	path := cfg.SettingsPath()
+	switch sub {
+	case "set":
+		if err := config.SetSetting(path, args[0], args[1]); err != nil {
+			fmt.Fprintf(errOut, "error: %s\n", err)
+			return exitcode.UserError
+		}
+		if !cfg.Quiet {
+			fmt.Fprintln(out, "ok")
+		}
+		return exitcode.Success
+	case "unset":
+		if err := config.UnsetSetting(path, args[0]); err != nil {
+			fmt.Fprintf(errOut, "error: %s\n", err)
+			return exitcode.UserError
+		}
+		if !cfg.Quiet {
+			fmt.Fprintln(out, "ok")
+		}
+		return exitcode.Success
+	}
+
+	settings, err := config.ReadSettings(path)
+	if err != nil {
+		fmt.Fprintf(errOut, "error: %s\n", err)
+		return exitcode.AuthError
+	}
+
+	// get prints the bare value; an unset key prints nothing and fails
+	if sub == "get" {
+		v, set, err := config.GetSetting(settings, args[0])
+		if err != nil {
+			fmt.Fprintf(errOut, "error: %s\n", err)
+			return exitcode.UserError
+		}
+		if !set {
+			return exitcode.UserError
+		}
+		fmt.Fprintln(out, v)
+		return exitcode.Success
+	}
+
+	for _, key := range config.SettingKeys(settings) {
+		v, _, _ := config.GetSetting(settings, key)
+		fmt.Fprintf(out, "%s = %s\n", key, v)
+	}
+	return exitcode.Success
+}
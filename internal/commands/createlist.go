@@ -25,6 +25,7 @@ func (c *CreateListCmd) Aliases() []string { return nil }
 func (c *CreateListCmd) Synopsis() string  { return "Create a new list" }
 func (c *CreateListCmd) Usage() string     { return "gtask createlist [common flags] <list-name>" }
 func (c *CreateListCmd) NeedsAuth() bool   { return true }
+func (c *CreateListCmd) Mutates() bool     { return true }
 
 func (c *CreateListCmd) RegisterFlags(fs *flag.FlagSet) {}
 
@@ -40,6 +41,7 @@ func (c *AddListCmd) Aliases() []string { return nil }
 func (c *AddListCmd) Synopsis() string  { return "Create a new list (alias for createlist)" }
 func (c *AddListCmd) Usage() string     { return "gtask addlist [common flags] <list-name>" }
 func (c *AddListCmd) NeedsAuth() bool   { return true }
+func (c *AddListCmd) Mutates() bool     { return true }
 
 func (c *AddListCmd) RegisterFlags(fs *flag.FlagSet) {}
 
@@ -64,7 +66,7 @@ func runCreateList(ctx context.Context, cfg *config.Config, svc service.Service,
 	}
 
 	// Check if list already exists
-	_, err := svc.ResolveList(ctx, name)
+	_, err := resolveList(ctx, cfg, svc, name)
 	if err == nil {
 		// List found - already exists
 		fmt.Fprintf(errOut, "error: list already exists: %s\n", name)
@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"gtask/internal/auth"
+	"gtask/internal/backend"
+	"gtask/internal/config"
+	"gtask/internal/exitcode"
+	"gtask/internal/service"
+)
+
+func init() {
+	Register(&DoctorCmd{})
+}
+
+const (
+	// defaultAPIURL is probed by doctor to check that the Tasks API is
+	// reachable.
+	defaultAPIURL = "https://tasks.googleapis.com/"
+
+	// defaultProbeTimeout limits the API probe when no timeout is set.
+	defaultProbeTimeout = 5 * time.Second
+
+	// maxClockSkew is the largest clock difference doctor accepts; OAuth
+	// tokens are rejected when the local clock is too far off.
+	maxClockSkew = time.Minute
+)
+
+// DoctorCmd implements the doctor command, which checks the setup of the
+// active profile and prints a checklist.
+type DoctorCmd struct {
+	apiURL string
+}
+
+// SetAPIURL sets the URL probed for reachability and clock skew (for
+// testing).
+func (c *DoctorCmd) SetAPIURL(url string) {
+	c.apiURL = url
+}
+
+func (c *DoctorCmd) Name() string      { return "doctor" }
+func (c *DoctorCmd) Aliases() []string { return nil }
+func (c *DoctorCmd) Synopsis() string  { return "Check the configuration and login" }
+func (c *DoctorCmd) Usage() string     { return "gtask doctor [common flags]" }
+func (c *DoctorCmd) NeedsAuth() bool   { return false }
+func (c *DoctorCmd) Mutates() bool     { return false }
+
+func (c *DoctorCmd) RegisterFlags(fs *flag.FlagSet) {}
+
+// checklist prints doctor results and counts failures.
+type checklist struct {
+	out      io.Writer
+	failures int
+}
+
+func (l *checklist) pass(name, format string, a ...any) {
+	fmt.Fprintf(l.out, "ok    %s: %s\n", name, fmt.Sprintf(format, a...))
+}
+
+func (l *checklist) fail(name, format string, a ...any) {
+	l.failures++
+	fmt.Fprintf(l.out, "FAIL  %s: %s\n", name, fmt.Sprintf(format, a...))
+}
+
+func (l *checklist) skip(name, format string, a ...any) {
+	fmt.Fprintf(l.out, "skip  %s: %s\n", name, fmt.Sprintf(format, a...))
+}
+
+func (c *DoctorCmd) Run(ctx context.Context, cfg *config.Config, svc service.Service, args []string, out, errOut io.Writer) int {
+	if len(args) != 0 {
+		fmt.Fprintf(errOut, "error: usage: %s\n", c.Usage())
+		return exitcode.UserError
+	}
+
+	l := &checklist{out: out}
+	checkConfigDir(l, cfg)
+
+	b, ok := backend.DefaultRegistry.Find(cfg.Backend)
+	if !ok {
+		l.fail("backend", "unknown backend %s", cfg.Backend)
+	} else {
+		l.pass("backend", "%s", b.Name)
+	}
+
+	if ok && b.NeedsOAuth {
+		c.checkOAuth(ctx, l, cfg)
+	} else {
+		l.skip("login", "backend %s does not use login", cfg.Backend)
+	}
+
+	if l.failures > 0 {
+		fmt.Fprintf(out, "%d problem(s) found\n", l.failures)
+		return exitcode.UserError
+	}
+	fmt.Fprintln(out, "all checks passed")
+	return exitcode.Success
+}
+
+// checkConfigDir checks that the config directory exists and is private.
+func checkConfigDir(l *checklist, cfg *config.Config) {
+	info, err := os.Stat(cfg.Dir)
+	if err != nil {
+		l.fail("config dir", "%v", err)
+		return
+	}
+	if !info.IsDir() {
+		l.fail("config dir", "%s is not a directory", cfg.Dir)
+		return
+	}
+	// Windows does not report Unix permission bits
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		l.fail("config dir", "%s has mode %04o, want 0700 (run: chmod 700 %s)", cfg.Dir, info.Mode().Perm(), cfg.Dir)
+		return
+	}
+	l.pass("config dir", "%s", cfg.Dir)
+}
+
+// checkOAuth checks the OAuth client, the stored token, and the Tasks API.
+func (c *DoctorCmd) checkOAuth(ctx context.Context, l *checklist, cfg *config.Config) {
+	clientType, err := auth.ClientType(cfg)
+	switch {
+	case err != nil:
+		l.fail("oauth client", "%v", err)
+	case clientType != auth.ClientDesktop:
+		l.fail("oauth client", "%s is a %s client, login needs a Desktop app client", cfg.OAuthClientPath(), clientType)
+	default:
+		l.pass("oauth client", "%s (%s)", cfg.OAuthClientPath(), clientType)
+	}
+
+	// Same checks as the dispatcher and login use
+	tokenOK := false
+	if err := auth.Preflight(cfg); err != nil {
+		l.fail("token", "%v", err)
+	} else {
+		refreshCtx, cancel := context.WithTimeout(ctx, authTimeout(cfg, tokenValidationTimeout))
+		_, _, err := auth.Refresh(refreshCtx, cfg, false)
+		cancel()
+		if err != nil {
+			l.fail("token", "%v", err)
+		} else {
+			tokenOK = true
+			checkTokenFile(l, cfg)
+		}
+	}
+
+	if tokenOK {
+		if _, err := cfg.SavedScopes(); err != nil {
+			l.fail("scopes", "%v", err)
+		} else if !auth.CanReadTasks(auth.Scopes(cfg)) {
+			l.fail("scopes", "access to Google Tasks was not granted (run: %s)", cfg.ProfileCommand("login"))
+		} else if auth.ReadOnly(cfg) {
+			l.pass("scopes", "read-only")
+		} else {
+			l.pass("scopes", "read and write")
+		}
+	}
+
+	c.checkAPI(ctx, l, cfg)
+}
+
+// checkTokenFile checks that the token file is readable by the owner only.
+func checkTokenFile(l *checklist, cfg *config.Config) {
+	path := cfg.TokenPath()
+	if cfg.Settings.TokenStore == config.TokenStoreEncrypted {
+		path = cfg.EncryptedTokenPath()
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		l.fail("token", "%v", err)
+		return
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		l.fail("token", "%s has mode %04o, want 0600 (run: chmod 600 %s)", path, info.Mode().Perm(), path)
+		return
+	}
+	l.pass("token", "valid (%s)", path)
+}
+
+// checkAPI probes the Tasks API for reachability and compares the server
+// clock with the local one.
+func (c *DoctorCmd) checkAPI(ctx context.Context, l *checklist, cfg *config.Config) {
+	url := c.apiURL
+	if url == "" {
+		url = defaultAPIURL
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, authTimeout(cfg, defaultProbeTimeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(probeCtx, http.MethodHead, url, nil)
+	if err != nil {
+		l.fail("api", "%v", err)
+		l.skip("clock", "api not reachable")
+		return
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		l.fail("api", "%s not reachable: %v", url, err)
+		l.skip("clock", "api not reachable")
+		return
+	}
+	resp.Body.Close()
+	elapsed := time.Since(start)
+	// Any HTTP response proves the API is reachable; unauthenticated
+	// requests are expected to be refused.
+	l.pass("api", "%s reachable (%s)", url, elapsed.Round(time.Millisecond))
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		l.skip("clock", "no Date header in response")
+		return
+	}
+	// The Date header has one second resolution and was set while the
+	// request was in flight.
+	skew := start.Add(elapsed / 2).Sub(date)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxClockSkew {
+		l.fail("clock", "local clock is off by %s", skew.Round(time.Second))
+		return
+	}
+	l.pass("clock", "in sync (off by %s)", skew.Round(time.Second))
+}
@@ -31,6 +31,7 @@ func (c *DoneCmd) Aliases() []string { return nil }
 func (c *DoneCmd) Synopsis() string  { return "Mark a task completed" }
 func (c *DoneCmd) Usage() string     { return "gtask done [--list <list-name>] <ref>" }
 func (c *DoneCmd) NeedsAuth() bool   { return true }
+func (c *DoneCmd) Mutates() bool     { return true }
 
 func (c *DoneCmd) RegisterFlags(fs *flag.FlagSet) {
 	fs.StringVar(&c.listName, "list", "", "")
@@ -65,7 +66,7 @@ func (c *DoneCmd) Run(ctx context.Context, cfg *config.Config, svc service.Servi
 	var list service.TaskList
 	if c.listName != "" {
 		// --list flag provided
-		list, err = svc.ResolveList(ctx, c.listName)
+		list, err = resolveList(ctx, cfg, svc, c.listName)
 		if err != nil {
 			if strings.Contains(err.Error(), "not found") {
 				fmt.Fprintf(errOut, "error: list not found: %s\n", c.listName)
@@ -80,7 +81,7 @@ func (c *DoneCmd) Run(ctx context.Context, cfg *config.Config, svc service.Servi
 		}
 	} else if ref.HasLetter {
 		// List letter provided (e.g., a1, b 3)
-		list, err = ResolveListByLetter(ctx, svc, ref.Letter)
+		list, err = resolveListByLetter(ctx, cfg, svc, ref.Letter)
 		if err != nil {
 			if strings.Contains(err.Error(), "list letter not found") {
 				fmt.Fprintf(errOut, "error: list letter not found: %c\n", ref.Letter)
@@ -124,10 +125,8 @@ func (c *DoneCmd) Run(ctx context.Context, cfg *config.Config, svc service.Servi
 // findTaskByNumber finds a task by its 1-based number in the list.
 // Fetches pages as needed until the task is found.
 func findTaskByNumber(ctx context.Context, svc service.Service, listID string, num int) (service.Task, error) {
-	const pageSize = 100
-
-	page := (num-1)/pageSize + 1
-	indexInPage := (num - 1) % pageSize
+	page := (num-1)/service.PageSize + 1
+	indexInPage := (num - 1) % service.PageSize
 
 	tasks, err := svc.ListOpenTasks(ctx, listID, page)
 	if err != nil {
@@ -23,6 +23,7 @@ func (c *HelpCmd) Aliases() []string { return nil }
 func (c *HelpCmd) Synopsis() string  { return "Print usage" }
 func (c *HelpCmd) Usage() string     { return "gtask help" }
 func (c *HelpCmd) NeedsAuth() bool   { return false }
+func (c *HelpCmd) Mutates() bool     { return false }
 
 func (c *HelpCmd) RegisterFlags(fs *flag.FlagSet) {}
 
@@ -34,6 +35,8 @@ func (c *HelpCmd) Run(ctx context.Context, cfg *config.Config, svc service.Servi
 const helpText = `Usage:
   gtask                                              List all open tasks (with list letters)
   gtask list [common flags] [--page <n>] <list-name> List tasks in a specific list
+  gtask list [common flags] [--page-size <n>] [--all] [<list-name>]
+                                                     Show more tasks per list, or every task
   gtask add [common flags] [-l|--list <list-name>] <title...>
   gtask create [common flags] [-l|--list <list-name>] <title...>
   gtask done [common flags] [-l|--list <list-name>] <ref>
@@ -48,15 +51,43 @@ const helpText = `Usage:
   gtask createlist [common flags] <list-name>
   gtask addlist [common flags] <list-name>
   gtask rmlist [common flags] [--force] <list-name>
-  gtask login [common flags]
+  gtask sync [common flags]                          Apply changes queued while offline
+  gtask backend [common flags] [<name>]              Show backends, or select one for this config directory
+  gtask config [common flags] [list|get <key>|set <key> <value>|unset <key>]
+                                                     Show or change settings in config.toml
+  gtask profiles [common flags] [add|rm|default <name>]
+                                                     Show profiles, or manage them
+  gtask login [common flags] [--readonly] [--manual] [--no-browser] [--port <n>] [--listen <host[:port]>]
+                                                     --readonly: view-only access; --manual: paste the redirect URL
   gtask logout [common flags]
+  gtask auth [common flags] status                   Show the login: scopes, token expiry, refresh
+  gtask auth [common flags] migrate                  Move the token into the store set by token_store
+  gtask doctor [common flags]                        Check config, OAuth client, token, API and clock
   gtask help
   gtask version
 
 Common flags:
   --config <dir>   Override config directory
+  --format <fmt>   Output of list and lists: text or json
+  --profile <name> Use a named profile (default: $GTASK_PROFILE, else 'gtask profiles default')
   --quiet          Suppress informational output
   --debug          Print debug logs to stderr
+  --no-cache       Ignore cached data and fetch fresh results
+  --max-age <dur>  Serve cached data younger than this without asking the server (e.g. 30s)
+  --offline        Use cached data and queue add/done/rm for 'gtask sync'
+  --backend <name> Task storage for this run: google, local, todotxt, caldav or multi
+  --timeout <dur>  Limit each API request (default 5s, CalDAV 10s)
+  --deadline <dur> Limit the whole command, e.g. 30s in cron (default: none)
+  --record <file>  Record Google API exchanges to a sanitized cassette for bug reports
+  --replay <file>  Answer Google API requests from a recorded cassette
+
+Environment:
+  GTASK_CONFIG_DIR, GTASK_PROFILE, GTASK_BACKEND, GTASK_QUIET, GTASK_DEBUG, GTASK_OFFLINE,
+  GTASK_NO_CACHE and GTASK_MAX_AGE act like the flags above; GTASK_LIST, GTASK_FORMAT,
+  GTASK_PAGE_SIZE, GTASK_TIMEOUT, GTASK_DEADLINE, GTASK_RETRIES, GTASK_RATE_LIMIT,
+  GTASK_HIDDEN_LISTS, GTASK_COLOR, GTASK_TOKEN_STORE, GTASK_PASSPHRASE_FILE,
+  GTASK_PASSPHRASE_COMMAND and GTASK_FLAGS_<COMMAND> override config.toml. Flags win over the environment.
+  GTASK_TOKEN_PASSPHRASE unlocks the encrypted token store.
 
 List letters (a-z) are shown in 'gtask' output and can be used with 'done' and 'rm'.
 `
@@ -18,10 +18,15 @@ func init() {
 	Register(&ListCmd{})
 }
 
+// DefaultPageSize is the number of tasks shown per list when --page-size is not given.
+const DefaultPageSize = service.PageSize
+
 // ListCmd implements the list command.
 // Handles both `gtask` (no args) and `gtask list <list-name>`.
 type ListCmd struct {
-	page int
+	page     int
+	pageSize int
+	all      bool
 }
 
 // SetPage sets the page number (for testing).
@@ -29,14 +34,27 @@ func (c *ListCmd) SetPage(page int) {
 	c.page = page
 }
 
+// SetPageSize sets the page size (for testing).
+func (c *ListCmd) SetPageSize(size int) {
+	c.pageSize = size
+}
+
+// SetAll sets the all flag (for testing).
+func (c *ListCmd) SetAll(all bool) {
+	c.all = all
+}
+
 func (c *ListCmd) Name() string      { return "list" }
 func (c *ListCmd) Aliases() []string { return nil }
 func (c *ListCmd) Synopsis() string  { return "List tasks" }
-func (c *ListCmd) Usage() string     { return "gtask list [--page <n>] <list-name>" }
+func (c *ListCmd) Usage() string     { return "gtask list [--all] [--page <n>] [--page-size <n>] [<list>]" }
 func (c *ListCmd) NeedsAuth() bool   { return true }
+func (c *ListCmd) Mutates() bool     { return false }
 
 func (c *ListCmd) RegisterFlags(fs *flag.FlagSet) {
 	fs.IntVar(&c.page, "page", 1, "")
+	fs.IntVar(&c.pageSize, "page-size", DefaultPageSize, "")
+	fs.BoolVar(&c.all, "all", false, "")
 }
 
 func (c *ListCmd) Run(ctx context.Context, cfg *config.Config, svc service.Service, args []string, out, errOut io.Writer) int {
@@ -46,6 +64,21 @@ func (c *ListCmd) Run(ctx context.Context, cfg *config.Config, svc service.Servi
 		return exitcode.UserError
 	}
 
+	// Zero means the flag was never registered (direct Run in tests)
+	if c.pageSize == 0 {
+		c.pageSize = DefaultPageSize
+	}
+	if c.pageSize < 1 {
+		fmt.Fprintf(errOut, "error: invalid page size: %d\n", c.pageSize)
+		return exitcode.UserError
+	}
+
+	// --all shows every task, so a page selection makes no sense
+	if c.all && c.page != 1 {
+		fmt.Fprintln(errOut, "error: cannot use both --page and --all")
+		return exitcode.UserError
+	}
+
 	// If no args, list all tasks (default + named lists)
 	if len(args) == 0 {
 		return c.listAll(ctx, cfg, svc, out, errOut)
@@ -56,26 +89,38 @@ func (c *ListCmd) Run(ctx context.Context, cfg *config.Config, svc service.Servi
 	return c.listOne(ctx, cfg, svc, listName, out, errOut)
 }
 
-// listAll lists tasks from all lists (gtask with no args).
+// listAll lists tasks from all lists (gtask with no args, or gtask list --all).
+// Hidden lists are skipped and get no letter.
 func (c *ListCmd) listAll(ctx context.Context, cfg *config.Config, svc service.Service, out, errOut io.Writer) int {
 	hasAnyTasks := false
+	jsonOut := cfg.Settings.Format == config.FormatJSON
+	color := !jsonOut && output.UseColor(out, cfg.Settings.Color)
+	var sections []output.ListTasks
 
-	// Get default list tasks (page 1 only for gtask with no args)
+	// Get default list tasks (first page only unless --all)
 	defaultList, err := svc.DefaultList(ctx)
 	if err != nil {
 		fmt.Fprintf(errOut, "error: backend error: %v\n", err)
 		return exitcode.BackendError
 	}
 
-	defaultTasks, err := svc.ListOpenTasks(ctx, defaultList.ID, 1)
+	defaultTasks, err := fetchTaskRange(ctx, svc, defaultList.ID, 1, c.limit())
 	if err != nil {
 		fmt.Fprintf(errOut, "error: backend error: %v\n", err)
 		return exitcode.BackendError
 	}
 
 	// Print default list tasks (no header)
+	if jsonOut {
+		sections = append(sections, output.ListTasks{
+			List:  output.List{ID: defaultList.ID, Title: defaultList.Title, Default: true},
+			Tasks: output.Tasks(defaultTasks, 0, 1),
+		})
+	}
 	for i, task := range defaultTasks {
-		output.FormatTask(out, i+1, task)
+		if !jsonOut {
+			output.FormatTask(out, i+1, task, color)
+		}
 		hasAnyTasks = true
 	}
 
@@ -92,8 +137,11 @@ func (c *ListCmd) listAll(ctx context.Context, cfg *config.Config, svc service.S
 		if list.IsDefault {
 			continue // Already printed
 		}
+		if cfg.Settings.IsHidden(list.Title) {
+			continue
+		}
 
-		tasks, err := svc.ListOpenTasks(ctx, list.ID, 1)
+		tasks, err := fetchTaskRange(ctx, svc, list.ID, 1, c.limit())
 		if err != nil {
 			// Partial failure: print what we have so far, then error
 			fmt.Fprintf(errOut, "error: failed to fetch list: %s: %v\n", list.Title, err)
@@ -111,14 +159,25 @@ func (c *ListCmd) listAll(ctx context.Context, cfg *config.Config, svc service.S
 		}
 
 		// Print list section with current letter
-		output.FormatListHeader(out, list.Title, false)
-		for i, task := range tasks {
-			output.FormatTaskWithLetter(out, letter, i+1, task)
+		if jsonOut {
+			sections = append(sections, output.ListTasks{
+				List:  output.List{ID: list.ID, Title: list.Title, Letter: string(letter)},
+				Tasks: output.Tasks(tasks, letter, 1),
+			})
+		} else {
+			output.FormatListHeader(out, list.Title, false, color)
+			for i, task := range tasks {
+				output.FormatTaskWithLetter(out, letter, i+1, task, color)
+			}
 		}
 		letter++
 		hasAnyTasks = true
 	}
 
+	if jsonOut {
+		return writeJSON(sections, out, errOut)
+	}
+
 	// If no tasks found anywhere
 	if !hasAnyTasks && !cfg.Quiet {
 		fmt.Fprintln(out, "no tasks found")
@@ -137,7 +196,7 @@ func (c *ListCmd) listOne(ctx context.Context, cfg *config.Config, svc service.S
 	}
 
 	// Resolve list
-	list, err := svc.ResolveList(ctx, listName)
+	list, err := resolveList(ctx, cfg, svc, listName)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			fmt.Fprintf(errOut, "error: list not found: %s\n", listName)
@@ -151,23 +210,86 @@ func (c *ListCmd) listOne(ctx context.Context, cfg *config.Config, svc service.S
 		return exitcode.BackendError
 	}
 
+	// Calculate starting number based on page (absolute within the list)
+	startNum := (c.page-1)*c.pageSize + 1
+
 	// Get tasks for the page
-	tasks, err := svc.ListOpenTasks(ctx, list.ID, c.page)
+	tasks, err := fetchTaskRange(ctx, svc, list.ID, startNum, c.limit())
 	if err != nil {
 		fmt.Fprintf(errOut, "error: backend error: %v\n", err)
 		return exitcode.BackendError
 	}
 
-	// Print list section (even if empty)
-	output.FormatListHeader(out, list.Title, list.IsDefault)
+	if cfg.Settings.Format == config.FormatJSON {
+		return writeJSON(output.ListTasks{
+			List: output.List{
+				ID:      list.ID,
+				Title:   list.Title,
+				Default: list.IsDefault,
+				Hidden:  cfg.Settings.IsHidden(list.Title),
+			},
+			Tasks: output.Tasks(tasks, 0, startNum),
+		}, out, errOut)
+	}
 
-	// Calculate starting number based on page
-	startNum := (c.page-1)*100 + 1
+	// Print list section (even if empty)
+	color := output.UseColor(out, cfg.Settings.Color)
+	output.FormatListHeader(out, list.Title, list.IsDefault, color)
 
 	for i, task := range tasks {
-		output.FormatTaskIndented(out, startNum+i, task)
+		output.FormatTaskIndented(out, startNum+i, task, color)
+	}
+
+	return exitcode.Success
+}
+
+// limit returns the maximum number of tasks to show per list (0 = no limit).
+func (c *ListCmd) limit() int {
+	if c.all {
+		return 0
+	}
+	return c.pageSize
+}
+
+// fetchTaskRange returns up to count open tasks starting at the 1-based
+// position start, fetching only the backend pages that cover them. A count
+// of 0 returns all remaining tasks. Positions are absolute within the list,
+// so numbering matches the references accepted by done and rm.
+func fetchTaskRange(ctx context.Context, svc service.Service, listID string, start, count int) ([]service.Task, error) {
+	if count == 0 && start == 1 {
+		return service.AllOpenTasks(ctx, svc, listID)
+	}
+	page := (start-1)/service.PageSize + 1
+	skip := (start - 1) % service.PageSize
+
+	var result []service.Task
+	for {
+		tasks, err := svc.ListOpenTasks(ctx, listID, page)
+		if err != nil {
+			return nil, err
+		}
+		if skip < len(tasks) {
+			result = append(result, tasks[skip:]...)
+		}
+		skip = 0
+
+		if count > 0 && len(result) >= count {
+			return result[:count], nil
+		}
+		// A short page means there is nothing more to fetch
+		if len(tasks) < service.PageSize {
+			return result, nil
+		}
+		page++
 	}
+}
 
+// writeJSON prints v for --format json.
+func writeJSON(v any, out, errOut io.Writer) int {
+	if err := output.WriteJSON(out, v); err != nil {
+		fmt.Fprintf(errOut, "error: %v\n", err)
+		return exitcode.UserError
+	}
 	return exitcode.Success
 }
 
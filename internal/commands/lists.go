@@ -24,6 +24,7 @@ func (c *ListsCmd) Aliases() []string { return nil }
 func (c *ListsCmd) Synopsis() string  { return "Print all lists" }
 func (c *ListsCmd) Usage() string     { return "gtask lists [common flags]" }
 func (c *ListsCmd) NeedsAuth() bool   { return true }
+func (c *ListsCmd) Mutates() bool     { return false }
 
 func (c *ListsCmd) RegisterFlags(fs *flag.FlagSet) {}
 
@@ -34,8 +35,21 @@ func (c *ListsCmd) Run(ctx context.Context, cfg *config.Config, svc service.Serv
 		return exitcode.BackendError
 	}
 
+	if cfg.Settings.Format == config.FormatJSON {
+		result := make([]output.List, 0, len(lists))
+		for _, list := range lists {
+			result = append(result, output.List{
+				ID:      list.ID,
+				Title:   list.Title,
+				Default: list.IsDefault,
+				Hidden:  cfg.Settings.IsHidden(list.Title),
+			})
+		}
+		return writeJSON(result, out, errOut)
+	}
+
 	for _, list := range lists {
-		output.FormatListName(out, list)
+		output.FormatListName(out, list, !list.IsDefault && cfg.Settings.IsHidden(list.Title))
 	}
 
 	return exitcode.Success
@@ -1,34 +1,46 @@
 package commands
 
 import (
+	"bufio"
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"flag"
 	"fmt"
+	"html"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 
+	"gtask/internal/auth"
+	"gtask/internal/backend"
 	"gtask/internal/config"
 	"gtask/internal/exitcode"
 	"gtask/internal/service"
 )
 
 const (
-	// OAuth scope for Google Tasks
-	tasksScope = "https://www.googleapis.com/auth/tasks"
-
 	// OAuth callback timeout
 	oauthCallbackTimeout = 5 * time.Minute
 
-	// Token exchange timeout
+	// Token exchange timeout, unless the timeout setting is given
 	tokenExchangeTimeout = 30 * time.Second
 
+	// Timeout for checking a stored token (one refresh request), unless
+	// the timeout setting is given
+	tokenValidationTimeout = 10 * time.Second
+
 	// Starting port for OAuth callback server
 	oauthStartPort = 8085
 
@@ -41,17 +53,72 @@ func init() {
 }
 
 // LoginCmd implements the login command.
-type LoginCmd struct{}
+type LoginCmd struct {
+	manual    bool
+	port      int
+	listen    string
+	noBrowser bool
+	readOnly  bool
+
+	// in is read for the redirect URL in manual mode (default os.Stdin).
+	in io.Reader
+
+	// openBrowser opens the auth URL (default openBrowser).
+	openBrowser func(url string) error
+}
+
+// SetManual sets the manual flag (for testing).
+func (c *LoginCmd) SetManual(manual bool) {
+	c.manual = manual
+}
+
+// SetReadOnly sets the readonly flag (for testing).
+func (c *LoginCmd) SetReadOnly(readOnly bool) {
+	c.readOnly = readOnly
+}
+
+// SetInput sets the reader used in manual mode (for testing).
+func (c *LoginCmd) SetInput(in io.Reader) {
+	c.in = in
+}
+
+// SetOpenBrowser replaces the browser launcher (for testing).
+func (c *LoginCmd) SetOpenBrowser(open func(url string) error) {
+	c.openBrowser = open
+}
 
 func (c *LoginCmd) Name() string      { return "login" }
 func (c *LoginCmd) Aliases() []string { return nil }
 func (c *LoginCmd) Synopsis() string  { return "Authenticate with Google" }
-func (c *LoginCmd) Usage() string     { return "gtask login [common flags]" }
-func (c *LoginCmd) NeedsAuth() bool   { return false }
-
-func (c *LoginCmd) RegisterFlags(fs *flag.FlagSet) {}
+func (c *LoginCmd) Usage() string {
+	return "gtask login [common flags] [--readonly] [--manual] [--no-browser] [--port <n>] [--listen <host[:port]>]"
+}
+func (c *LoginCmd) NeedsAuth() bool { return false }
+func (c *LoginCmd) Mutates() bool   { return false }
+
+func (c *LoginCmd) RegisterFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.manual, "manual", false, "")
+	fs.IntVar(&c.port, "port", 0, "")
+	fs.StringVar(&c.listen, "listen", "", "")
+	fs.BoolVar(&c.noBrowser, "no-browser", false, "")
+	fs.BoolVar(&c.readOnly, "readonly", false, "")
+}
 
 func (c *LoginCmd) Run(ctx context.Context, cfg *config.Config, svc service.Service, args []string, out, errOut io.Writer) int {
+	// Only OAuth backends use login
+	if b, ok := backend.DefaultRegistry.Find(cfg.Backend); ok && !b.NeedsOAuth {
+		if !cfg.Quiet {
+			fmt.Fprintln(out, noLoginMessage(b))
+		}
+		return exitcode.Success
+	}
+
+	host, port, err := c.callbackAddress()
+	if err != nil {
+		fmt.Fprintf(errOut, "error: %v\n", err)
+		return exitcode.UserError
+	}
+
 	// Check if oauth_client.json exists
 	if !cfg.HasOAuthClient() {
 		fmt.Fprintf(errOut, "error: oauth_client.json not found in %s\n\n", cfg.Dir)
@@ -72,8 +139,19 @@ func (c *LoginCmd) Run(ctx context.Context, cfg *config.Config, svc service.Serv
 		return exitcode.AuthError
 	}
 
-	// Check if already logged in (token exists and is valid)
-	if cfg.HasToken() {
+	// An encrypted token store needs its passphrase before the browser flow
+	store := auth.NewStore(cfg)
+	if es, ok := store.(*auth.EncryptedStore); ok {
+		if err := es.Unlock(); err != nil {
+			fmt.Fprintf(errOut, "error: %v\n", err)
+			return exitcode.AuthError
+		}
+	}
+
+	// Check if already logged in (token exists and is valid) with the
+	// requested access; switching between read-only and full access needs
+	// a new login
+	if cfg.HasToken() && auth.ReadOnly(cfg) == c.readOnly {
 		if isTokenValid(ctx, cfg) {
 			if !cfg.Quiet {
 				fmt.Fprintln(out, "already logged in")
@@ -83,94 +161,69 @@ func (c *LoginCmd) Run(ctx context.Context, cfg *config.Config, svc service.Serv
 	}
 
 	// Load OAuth client config
-	clientJSON, err := os.ReadFile(cfg.OAuthClientPath())
-	if err != nil {
-		fmt.Fprintf(errOut, "error: failed to read oauth_client.json: %v\n", err)
-		return exitcode.AuthError
-	}
-
-	oauthConfig, err := google.ConfigFromJSON(clientJSON, tasksScope)
+	requested := auth.LoginScopes(c.readOnly)
+	oauthConfig, err := auth.OAuthConfig(cfg, requested...)
 	if err != nil {
-		fmt.Fprintf(errOut, "error: invalid oauth_client.json: %v\n", err)
+		fmt.Fprintf(errOut, "error: %v\n", err)
 		return exitcode.AuthError
 	}
 
-	// Find available port
-	port, listener, err := findAvailablePort()
-	if err != nil {
-		fmt.Fprintf(errOut, "error: could not bind to local port for OAuth callback\n")
-		return exitcode.AuthError
+	// Listen for the OAuth callback, unless the user pastes the redirect
+	var listener net.Listener
+	if c.manual {
+		if port == 0 {
+			port = oauthStartPort
+		}
+	} else {
+		port, listener, err = listenCallback(host, port)
+		if err != nil {
+			fmt.Fprintf(errOut, "error: could not bind to local port for OAuth callback: %v\n", err)
+			return exitcode.AuthError
+		}
+		defer listener.Close()
 	}
-	defer listener.Close()
 
-	// Set redirect URL
-	redirectURL := fmt.Sprintf("http://localhost:%d/callback", port)
-	oauthConfig.RedirectURL = redirectURL
+	// Set redirect URL. Google only accepts loopback redirects for desktop
+	// clients, so it names localhost even when listening elsewhere.
+	oauthConfig.RedirectURL = fmt.Sprintf("http://localhost:%d/callback", port)
 
 	// Generate PKCE verifier
 	verifier := oauth2.GenerateVerifier()
 
+	// Generate a random state, checked on the redirect so that a request
+	// from another page cannot inject its own code
+	state, err := newState()
+	if err != nil {
+		fmt.Fprintf(errOut, "error: %v\n", err)
+		return exitcode.AuthError
+	}
+
 	// Generate auth URL
-	authURL := oauthConfig.AuthCodeURL("state",
+	authURL := oauthConfig.AuthCodeURL(state,
 		oauth2.AccessTypeOffline,
 		oauth2.S256ChallengeOption(verifier),
 	)
 
-	// Print URL to stderr
-	fmt.Fprintln(errOut, "Open this URL in your browser:")
-	fmt.Fprintln(errOut, authURL)
-
-	// Start callback server
-	codeCh := make(chan string, 1)
-	errCh := make(chan error, 1)
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
-		code := r.URL.Query().Get("code")
-		if code == "" {
-			http.Error(w, "No code in callback", http.StatusBadRequest)
-			errCh <- fmt.Errorf("no code in callback")
-			return
-		}
-		w.Header().Set("Content-Type", "text/html")
-		fmt.Fprint(w, "<html><body><h1>Authentication successful</h1><p>You may close this window.</p></body></html>")
-		codeCh <- code
-	})
-
-	server := &http.Server{Handler: mux}
-	go func() {
-		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
-			errCh <- err
-		}
-	}()
-
-	// Wait for callback or timeout
 	var code string
-	select {
-	case code = <-codeCh:
-		// Got code
-	case err := <-errCh:
+	if c.manual {
+		code, err = c.readCode(ctx, authURL, state, errOut)
+	} else {
+		code, err = c.waitForCallback(ctx, listener, authURL, state, errOut)
+	}
+	if err != nil {
 		fmt.Fprintf(errOut, "error: %v\n", err)
 		return exitcode.AuthError
-	case <-time.After(oauthCallbackTimeout):
-		fmt.Fprintln(errOut, "error: oauth callback timed out")
-		return exitcode.AuthError
-	case <-ctx.Done():
-		fmt.Fprintln(errOut, "error: cancelled")
-		return exitcode.AuthError
 	}
 
-	// Shutdown server
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	server.Shutdown(shutdownCtx)
-
 	// Exchange code for token
-	exchangeCtx, cancelExchange := context.WithTimeout(ctx, tokenExchangeTimeout)
+	exchangeCtx, cancelExchange := context.WithTimeout(ctx, authTimeout(cfg, tokenExchangeTimeout))
 	defer cancelExchange()
 
 	token, err := oauthConfig.Exchange(exchangeCtx, code, oauth2.VerifierOption(verifier))
 	if err != nil {
+		if exchangeCtx.Err() != nil {
+			err = service.TimeoutError(exchangeCtx)
+		}
 		fmt.Fprintf(errOut, "error: failed to exchange code for token: %v\n", err)
 		return exitcode.AuthError
 	}
@@ -181,11 +234,30 @@ func (c *LoginCmd) Run(ctx context.Context, cfg *config.Config, svc service.Serv
 		return exitcode.AuthError
 	}
 
-	// Save token
-	if err := saveToken(cfg.TokenPath(), token); err != nil {
+	// The user may have unticked the tasks permission on the consent page
+	scopes := auth.GrantedScopes(token, requested)
+	if !auth.CanReadTasks(scopes) {
+		fmt.Fprintln(errOut, "error: access to Google Tasks was not granted")
+		return exitcode.AuthError
+	}
+
+	// Save token and the scopes granted with it
+	if err := store.Save(token); err != nil {
 		fmt.Fprintf(errOut, "error: failed to save token: %v\n", err)
 		return exitcode.AuthError
 	}
+	if err := cfg.SaveScopes(scopes); err != nil {
+		fmt.Fprintf(errOut, "error: failed to save scopes: %v\n", err)
+		return exitcode.AuthError
+	}
+
+	// Drop a plaintext token left from before encryption was enabled
+	if cfg.Settings.TokenStore == config.TokenStoreEncrypted {
+		if err := auth.NewFileStore(cfg.TokenPath()).Delete(); err != nil {
+			fmt.Fprintf(errOut, "error: failed to remove %s: %v\n", config.TokenFile, err)
+			return exitcode.AuthError
+		}
+	}
 
 	if !cfg.Quiet {
 		fmt.Fprintln(out, "ok")
@@ -193,12 +265,48 @@ func (c *LoginCmd) Run(ctx context.Context, cfg *config.Config, svc service.Serv
 	return exitcode.Success
 }
 
-// findAvailablePort tries to find an available port starting from oauthStartPort.
-func findAvailablePort() (int, net.Listener, error) {
+// callbackAddress returns the host and port for the OAuth callback from
+// --listen and --port. Port 0 means the first free port from
+// oauthStartPort.
+func (c *LoginCmd) callbackAddress() (string, int, error) {
+	host, port := "localhost", c.port
+	if c.port < 0 || c.port > 65535 {
+		return "", 0, fmt.Errorf("invalid port: %d", c.port)
+	}
+	if c.listen == "" {
+		return host, port, nil
+	}
+	if c.manual {
+		return "", 0, fmt.Errorf("--listen cannot be used with --manual")
+	}
+
+	host = c.listen
+	if h, p, err := net.SplitHostPort(c.listen); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 65535 {
+			return "", 0, fmt.Errorf("invalid listen address: %s", c.listen)
+		}
+		if c.port != 0 && c.port != n {
+			return "", 0, fmt.Errorf("--port %d conflicts with --listen %s", c.port, c.listen)
+		}
+		host, port = h, n
+	}
+	return host, port, nil
+}
+
+// listenCallback listens on host:port, or on the first free port from
+// oauthStartPort if port is 0.
+func listenCallback(host string, port int) (int, net.Listener, error) {
+	if port != 0 {
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			return 0, nil, err
+		}
+		return port, listener, nil
+	}
 	for i := 0; i < oauthMaxPortAttempts; i++ {
 		port := oauthStartPort + i
-		addr := fmt.Sprintf("localhost:%d", port)
-		listener, err := net.Listen("tcp", addr)
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 		if err == nil {
 			return port, listener, nil
 		}
@@ -206,50 +314,244 @@ func findAvailablePort() (int, net.Listener, error) {
 	return 0, nil, fmt.Errorf("no available port found")
 }
 
-// isTokenValid checks if a token file contains a valid token.
-// Valid means: parseable, contains a non-empty refresh token, and can be
-// refreshed via OAuth2.
-func isTokenValid(ctx context.Context, cfg *config.Config) bool {
-	// Read token
-	data, err := os.ReadFile(cfg.TokenPath())
-	if err != nil {
-		return false
+// waitForCallback prints the auth URL, opens it in a browser unless
+// --no-browser is given, and serves the OAuth redirect on listener until
+// it delivers a code or an error.
+func (c *LoginCmd) waitForCallback(ctx context.Context, listener net.Listener, authURL, state string, errOut io.Writer) (string, error) {
+	// Print URL to stderr
+	fmt.Fprintln(errOut, "Open this URL in your browser:")
+	fmt.Fprintln(errOut, authURL)
+	if !c.noBrowser {
+		open := c.openBrowser
+		if open == nil {
+			open = openBrowser
+		}
+		// The URL is printed anyway, so a failed launch is not an error
+		_ = open(authURL)
 	}
-	var token oauth2.Token
-	if err := json.Unmarshal(data, &token); err != nil {
-		return false
+
+	// Start callback server. The first redirect with the right state
+	// decides the result; later requests must never block the handler.
+	type result struct {
+		code string
+		err  error
 	}
-	if token.RefreshToken == "" {
-		return false
+	resultCh := make(chan result, 1)
+	var once sync.Once
+	deliver := func(r result) bool {
+		delivered := false
+		once.Do(func() {
+			resultCh <- r
+			delivered = true
+		})
+		return delivered
 	}
 
-	// Read OAuth config to check token validity
-	clientJSON, err := os.ReadFile(cfg.OAuthClientPath())
-	if err != nil {
-		return false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("state") != state {
+			// A stray or forged request; keep waiting for the real one
+			writeCallbackPage(w, http.StatusBadRequest, "Authentication failed", "Invalid state parameter. Start again with gtask login.")
+			return
+		}
+
+		code, err := redirectCode(query)
+		if !deliver(result{code: code, err: err}) {
+			writeCallbackPage(w, http.StatusConflict, "Already completed", "This login has already been handled. Return to the terminal.")
+			return
+		}
+		if err != nil {
+			writeCallbackPage(w, http.StatusBadRequest, "Authentication failed", err.Error()+". Return to the terminal.")
+			return
+		}
+		writeCallbackPage(w, http.StatusOK, "Authentication successful", "You may close this window.")
+	})
+
+	server := &http.Server{Handler: mux}
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	// Wait for callback or timeout
+	select {
+	case r := <-resultCh:
+		return r.code, r.err
+	case err := <-serveErr:
+		return "", err
+	case <-time.After(oauthCallbackTimeout):
+		return "", fmt.Errorf("oauth callback timed out")
+	case <-ctx.Done():
+		return "", cancelled(ctx)
 	}
-	oauthConfig, err := google.ConfigFromJSON(clientJSON, tasksScope)
+}
+
+// writeCallbackPage answers a callback request with a small HTML page.
+func writeCallbackPage(w http.ResponseWriter, status int, title, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<html><body><h1>%s</h1><p>%s</p></body></html>", html.EscapeString(title), html.EscapeString(message))
+}
+
+// redirectCode returns the code of an OAuth redirect, or the error Google
+// reported (e.g. access_denied when the user declines).
+func redirectCode(query url.Values) (string, error) {
+	if e := query.Get("error"); e != "" {
+		if desc := query.Get("error_description"); desc != "" {
+			return "", fmt.Errorf("authorization failed: %s (%s)", e, desc)
+		}
+		return "", fmt.Errorf("authorization failed: %s", e)
+	}
+	code := query.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("no code in callback")
+	}
+	return code, nil
+}
+
+// newState returns a random OAuth state value.
+func newState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// openBrowser opens url in the default browser without waiting for it.
+// On Linux and BSD it needs a graphical session.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return fmt.Errorf("no graphical session")
+		}
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// readCode prints the auth URL and reads the redirect URL, or just the
+// code, pasted by the user. The browser may run on any machine; the
+// localhost page it is sent to fails to load, but its URL carries the code.
+func (c *LoginCmd) readCode(ctx context.Context, authURL, state string, errOut io.Writer) (string, error) {
+	fmt.Fprintln(errOut, "Open this URL in a browser on any machine:")
+	fmt.Fprintln(errOut, authURL)
+	fmt.Fprintln(errOut)
+	fmt.Fprintln(errOut, "After you approve access, the browser opens a localhost page that does not load.")
+	fmt.Fprint(errOut, "Paste the full URL of that page (or just the code) here: ")
+
+	in := c.in
+	if in == nil {
+		in = os.Stdin
+	}
+	lineCh := make(chan string, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			errCh <- fmt.Errorf("no code entered")
+			return
+		}
+		lineCh <- line
+	}()
+
+	select {
+	case line := <-lineCh:
+		return parseRedirect(line, state)
+	case err := <-errCh:
+		return "", err
+	case <-time.After(oauthCallbackTimeout):
+		return "", fmt.Errorf("oauth callback timed out")
+	case <-ctx.Done():
+		return "", cancelled(ctx)
+	}
+}
+
+// parseRedirect extracts the authorization code from a pasted redirect URL
+// (whose state must match) or returns a pasted bare code.
+func parseRedirect(input, state string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("no code entered")
+	}
+	// A bare code has no query parameters (but may contain slashes)
+	if !strings.Contains(input, "=") {
+		if strings.ContainsAny(input, " \t") {
+			return "", fmt.Errorf("invalid code")
+		}
+		return input, nil
+	}
+
+	if _, rawQuery, ok := strings.Cut(input, "?"); ok {
+		input = rawQuery
+	}
+	input, _, _ = strings.Cut(input, "#")
+	query, err := url.ParseQuery(input)
 	if err != nil {
-		return false
+		return "", fmt.Errorf("invalid redirect URL: %v", err)
+	}
+	if query.Get("state") != state {
+		return "", fmt.Errorf("invalid state in redirect URL")
+	}
+	code, err := redirectCode(query)
+	if err != nil && query.Get("error") == "" {
+		return "", fmt.Errorf("no code in redirect URL")
 	}
+	return code, err
+}
 
-	// Create a context with timeout for validation, derived from parent context
-	validationCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+// isTokenValid checks if the token store holds a valid token.
+// Valid means: parseable, contains a non-empty refresh token, and can be
+// refreshed via OAuth2 (see auth.Refresh). A refreshed token is saved back
+// to the store.
+func isTokenValid(ctx context.Context, cfg *config.Config) bool {
+	validationCtx, cancel := context.WithTimeout(ctx, authTimeout(cfg, tokenValidationTimeout))
 	defer cancel()
 
-	// Create token source that auto-refreshes
-	tokenSource := oauthConfig.TokenSource(validationCtx, &token)
-
-	// Try to get a valid token - this will refresh if needed
-	_, err = tokenSource.Token()
+	_, _, err := auth.Refresh(validationCtx, cfg, false)
 	return err == nil
 }
 
-// saveToken saves an OAuth token to a file with mode 0600.
-func saveToken(path string, token *oauth2.Token) error {
-	data, err := json.MarshalIndent(token, "", "  ")
-	if err != nil {
-		return err
+// authTimeout returns the timeout for one OAuth request: the timeout
+// setting if given, else def.
+func authTimeout(cfg *config.Config, def time.Duration) time.Duration {
+	if cfg.Settings.Timeout > 0 {
+		return cfg.Settings.Timeout
+	}
+	return def
+}
+
+// cancelled returns the error for a login wait ended by ctx: the command
+// deadline, or an interrupt.
+func cancelled(ctx context.Context) error {
+	if errors.Is(context.Cause(ctx), service.ErrDeadline) {
+		return service.ErrDeadline
+	}
+	return fmt.Errorf("cancelled")
+}
+
+// noLoginMessage explains why a backend needs no login.
+func noLoginMessage(b backend.Backend) string {
+	if b.ConfigFile != "" {
+		return fmt.Sprintf("backend %s does not use login (credentials are read from %s)", b.Name, b.ConfigFile)
 	}
-	return os.WriteFile(path, data, 0600)
+	return fmt.Sprintf("backend %s does not use login", b.Name)
 }
@@ -3,13 +3,26 @@ package commands_test
 import (
 	"bytes"
 	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"gtask/internal/auth"
 	"gtask/internal/commands"
 	"gtask/internal/config"
 	"gtask/internal/exitcode"
+	"gtask/internal/outbox"
 )
 
 // TestLoginCommand_NoOAuthClient verifies login fails without oauth_client.json
@@ -39,6 +52,7 @@ func TestLoginCommand_NoOAuthClient(t *testing.T) {
 // TestLoginCommand_InvalidToken verifies login proceeds when token is invalid/corrupt
 func TestLoginCommand_InvalidToken(t *testing.T) {
 	cmd := &commands.LoginCmd{}
+	cmd.SetOpenBrowser(func(string) error { return nil })
 
 	tmpDir := t.TempDir()
 
@@ -78,6 +92,7 @@ func TestLoginCommand_InvalidToken(t *testing.T) {
 // TestLoginCommand_NoRefreshToken verifies login proceeds when token has no refresh token
 func TestLoginCommand_NoRefreshToken(t *testing.T) {
 	cmd := &commands.LoginCmd{}
+	cmd.SetOpenBrowser(func(string) error { return nil })
 
 	tmpDir := t.TempDir()
 
@@ -166,6 +181,39 @@ func TestLogoutCommand_OnlyRemovesToken(t *testing.T) {
 }
 
 // TestLogoutCommand_NotLoggedIn verifies logout handles not being logged in
+func TestLogoutCommand_RefusesWithOfflineChanges(t *testing.T) {
+	cmd := &commands.LogoutCmd{}
+	cfg := &config.Config{Dir: t.TempDir(), Profile: "work"}
+	tokenPath := filepath.Join(cfg.Dir, "token.json")
+	if err := os.WriteFile(tokenPath, []byte(`{"access_token":"test","refresh_token":"test"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	box := outbox.Open(cfg.OutboxPath())
+	if _, err := box.Append(outbox.Op{Kind: outbox.CreateTask, ListID: "@default", Title: "Milk"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var outBuf, errBuf bytes.Buffer
+	code := cmd.Run(context.Background(), cfg, nil, nil, &outBuf, &errBuf)
+	if code != exitcode.UserError {
+		t.Errorf("expected exit code %d, got %d", exitcode.UserError, code)
+	}
+	want := "error: 1 offline change(s) not synced yet (run: gtask sync --profile work, or remove " + cfg.OutboxPath() + " to discard them)\n"
+	if errBuf.String() != want {
+		t.Errorf("expected %q, got %q", want, errBuf.String())
+	}
+	if _, err := os.Stat(tokenPath); err != nil {
+		t.Errorf("expected token.json kept: %v", err)
+	}
+
+	// Once synced, logout goes ahead
+	box.Remove(1)
+	errBuf.Reset()
+	if code := cmd.Run(context.Background(), cfg, nil, nil, &outBuf, &errBuf); code != exitcode.Success {
+		t.Errorf("expected exit code %d, got %d: %s", exitcode.Success, code, errBuf.String())
+	}
+}
+
 func TestLogoutCommand_NotLoggedIn(t *testing.T) {
 	cmd := &commands.LogoutCmd{}
 
@@ -212,3 +260,688 @@ func TestLogoutCommand_NotLoggedInQuiet(t *testing.T) {
 		t.Errorf("expected no stdout in quiet mode, got %q", outBuf.String())
 	}
 }
+
+// TestAuthMigrate_EncryptsToken verifies auth migrate replaces token.json
+// with token.enc when token_store is "encrypted", and logout removes it.
+func TestAuthMigrate_EncryptsToken(t *testing.T) {
+	tmpDir := t.TempDir()
+	tokenPath := filepath.Join(tmpDir, "token.json")
+	err := os.WriteFile(tokenPath, []byte(`{"access_token":"test","refresh_token":"secret-refresh"}`), 0600)
+	if err != nil {
+		t.Fatalf("failed to write token.json: %v", err)
+	}
+	t.Setenv("GTASK_TOKEN_PASSPHRASE", "passphrase")
+
+	cfg := &config.Config{Dir: tmpDir}
+	cfg.Settings.TokenStore = config.TokenStoreEncrypted
+
+	var outBuf, errBuf bytes.Buffer
+	code := (&commands.AuthCmd{}).Run(context.Background(), cfg, nil, []string{"migrate"}, &outBuf, &errBuf)
+	if code != exitcode.Success {
+		t.Fatalf("expected exit code %d, got %d (stderr: %s)", exitcode.Success, code, errBuf.String())
+	}
+	if outBuf.String() != "ok\n" {
+		t.Errorf("expected 'ok\\n', got %q", outBuf.String())
+	}
+	if _, err := os.Stat(tokenPath); !os.IsNotExist(err) {
+		t.Error("token.json should have been deleted")
+	}
+	data, err := os.ReadFile(filepath.Join(tmpDir, "token.enc"))
+	if err != nil {
+		t.Fatalf("token.enc not written: %v", err)
+	}
+	if bytes.Contains(data, []byte("secret-refresh")) {
+		t.Error("token.enc contains the plaintext refresh token")
+	}
+	if !cfg.HasToken() {
+		t.Error("expected HasToken with the encrypted store")
+	}
+
+	// Nothing left to migrate
+	outBuf.Reset()
+	code = (&commands.AuthCmd{}).Run(context.Background(), cfg, nil, []string{"migrate"}, &outBuf, &errBuf)
+	if code != exitcode.Success || outBuf.String() != "nothing to migrate\n" {
+		t.Errorf("expected 'nothing to migrate', got %d %q", code, outBuf.String())
+	}
+
+	outBuf.Reset()
+	code = (&commands.LogoutCmd{}).Run(context.Background(), cfg, nil, nil, &outBuf, &errBuf)
+	if code != exitcode.Success || outBuf.String() != "ok\n" {
+		t.Errorf("expected logout ok, got %d %q", code, outBuf.String())
+	}
+	if cfg.HasToken() {
+		t.Error("token.enc should have been deleted by logout")
+	}
+}
+
+// TestAuthMigrate_NoPassphrase verifies migrate fails and keeps token.json
+// when no passphrase is configured.
+func TestAuthMigrate_NoPassphrase(t *testing.T) {
+	tmpDir := t.TempDir()
+	tokenPath := filepath.Join(tmpDir, "token.json")
+	if err := os.WriteFile(tokenPath, []byte(`{"refresh_token":"r"}`), 0600); err != nil {
+		t.Fatalf("failed to write token.json: %v", err)
+	}
+	t.Setenv("GTASK_TOKEN_PASSPHRASE", "")
+
+	cfg := &config.Config{Dir: tmpDir}
+	cfg.Settings.TokenStore = config.TokenStoreEncrypted
+
+	var outBuf, errBuf bytes.Buffer
+	code := (&commands.AuthCmd{}).Run(context.Background(), cfg, nil, []string{"migrate"}, &outBuf, &errBuf)
+	if code != exitcode.AuthError {
+		t.Errorf("expected exit code %d, got %d", exitcode.AuthError, code)
+	}
+	if !bytes.Contains(errBuf.Bytes(), []byte("no token passphrase configured")) {
+		t.Errorf("unexpected stderr: %q", errBuf.String())
+	}
+	if _, err := os.Stat(tokenPath); err != nil {
+		t.Error("token.json must be kept when migration fails")
+	}
+}
+
+// newTokenServer starts a fake OAuth token endpoint and returns it with the
+// form of the last exchange request.
+func newTokenServer(t *testing.T) (*httptest.Server, *url.Values) {
+	return newScopedTokenServer(t, "")
+}
+
+// newScopedTokenServer is newTokenServer reporting scope as granted.
+func newScopedTokenServer(t *testing.T, scope string) (*httptest.Server, *url.Values) {
+	t.Helper()
+	var form url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"new-access","refresh_token":"new-refresh","token_type":"Bearer","expires_in":3600,"scope":%q}`, scope)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &form
+}
+
+// writeOAuthClient writes an oauth_client.json whose token endpoint is
+// tokenURL.
+func writeOAuthClient(t *testing.T, dir, tokenURL string) {
+	t.Helper()
+	client := fmt.Sprintf(`{"installed":{"client_id":"test","client_secret":"test","auth_uri":"https://accounts.example/auth","token_uri":%q,"redirect_uris":["http://localhost"]}}`, tokenURL)
+	if err := os.WriteFile(filepath.Join(dir, "oauth_client.json"), []byte(client), 0600); err != nil {
+		t.Fatalf("failed to write oauth_client.json: %v", err)
+	}
+}
+
+// urlWriter collects output and passes on the first auth URL written.
+type urlWriter struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	sent bool
+	urls chan string
+}
+
+func newURLWriter() *urlWriter {
+	return &urlWriter{urls: make(chan string, 1)}
+}
+
+func (w *urlWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	if !w.sent {
+		for _, line := range strings.Split(w.buf.String(), "\n") {
+			if strings.HasPrefix(line, "https://accounts.example/auth?") {
+				w.urls <- line
+				w.sent = true
+				break
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (w *urlWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+// withState replaces STATE in s by the state parameter of authURL.
+func withState(s, authURL string) string {
+	u, _ := url.Parse(authURL)
+	return strings.ReplaceAll(s, "STATE", u.Query().Get("state"))
+}
+
+// runManualLogin runs login --manual, answering the prompt with input
+// (STATE is replaced by the state of the printed auth URL).
+func runManualLogin(t *testing.T, cfg *config.Config, input string) (int, string, string) {
+	t.Helper()
+	cmd := &commands.LoginCmd{}
+	cmd.SetManual(true)
+	pr, pw := io.Pipe()
+	cmd.SetInput(pr)
+
+	errOut := newURLWriter()
+	go func() {
+		authURL := <-errOut.urls
+		pw.Write([]byte(withState(input, authURL)))
+		pw.Close()
+	}()
+
+	var outBuf bytes.Buffer
+	code := cmd.Run(context.Background(), cfg, nil, nil, &outBuf, errOut)
+	pr.Close()
+	return code, outBuf.String(), errOut.String()
+}
+
+// TestLoginCommand_Manual verifies --manual accepts a pasted redirect URL or
+// bare code and exchanges it with the PKCE verifier.
+func TestLoginCommand_Manual(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"redirect URL", "http://localhost:8085/callback?state=STATE&code=4/abc&scope=x\n"},
+		{"bare code", "  4/abc  \n"},
+		{"no newline", "4/abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			srv, form := newTokenServer(t)
+			writeOAuthClient(t, tmpDir, srv.URL)
+
+			cfg := &config.Config{Dir: tmpDir}
+			code, stdout, stderr := runManualLogin(t, cfg, tt.input)
+
+			if code != exitcode.Success {
+				t.Fatalf("expected exit code %d, got %d (stderr: %s)", exitcode.Success, code, stderr)
+			}
+			if stdout != "ok\n" {
+				t.Errorf("expected 'ok\\n', got %q", stdout)
+			}
+			if form.Get("code") != "4/abc" {
+				t.Errorf("expected code 4/abc, got %q", form.Get("code"))
+			}
+			if form.Get("code_verifier") == "" {
+				t.Error("expected PKCE code_verifier in exchange")
+			}
+			if form.Get("redirect_uri") != "http://localhost:8085/callback" {
+				t.Errorf("unexpected redirect_uri: %q", form.Get("redirect_uri"))
+			}
+			if !cfg.HasToken() {
+				t.Error("expected token.json to be written")
+			}
+		})
+	}
+}
+
+// TestLoginCommand_ManualErrors verifies bad pasted input fails without
+// saving a token.
+func TestLoginCommand_ManualErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"empty", "\n", "error: no code entered\n"},
+		{"eof", "", "error: no code entered\n"},
+		{"denied", "http://localhost:8085/callback?error=access_denied&state=STATE\n", "error: authorization failed: access_denied\n"},
+		{"described", "http://localhost:8085/callback?error=access_denied&error_description=User+declined&state=STATE\n",
+			"error: authorization failed: access_denied (User declined)\n"},
+		{"no code", "http://localhost:8085/callback?state=STATE\n", "error: no code in redirect URL\n"},
+		{"wrong state", "http://localhost:8085/callback?state=forged&code=x\n", "error: invalid state in redirect URL\n"},
+		{"no state", "http://localhost:8085/callback?code=x\n", "error: invalid state in redirect URL\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			srv, _ := newTokenServer(t)
+			writeOAuthClient(t, tmpDir, srv.URL)
+
+			cfg := &config.Config{Dir: tmpDir}
+			code, _, stderr := runManualLogin(t, cfg, tt.input)
+
+			if code != exitcode.AuthError {
+				t.Errorf("expected exit code %d, got %d", exitcode.AuthError, code)
+			}
+			if !strings.HasSuffix(stderr, tt.wantErr) {
+				t.Errorf("expected stderr ending in %q, got %q", tt.wantErr, stderr)
+			}
+			if cfg.HasToken() {
+				t.Error("no token should be saved")
+			}
+		})
+	}
+}
+
+// freePort returns a TCP port that is free at the time of the call.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startCallbackLogin runs login with the callback server on 127.0.0.1:port
+// and returns the auth URL passed to the browser and the exit code channel.
+func startCallbackLogin(t *testing.T, cfg *config.Config, port int) (string, <-chan int, *urlWriter) {
+	t.Helper()
+	cmd := &commands.LoginCmd{}
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	cmd.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--listen", "127.0.0.1", "--port", strconv.Itoa(port)}); err != nil {
+		t.Fatal(err)
+	}
+	opened := make(chan string, 1)
+	cmd.SetOpenBrowser(func(u string) error {
+		opened <- u
+		return nil
+	})
+
+	errOut := newURLWriter()
+	done := make(chan int, 1)
+	go func() {
+		done <- cmd.Run(context.Background(), cfg, nil, nil, io.Discard, errOut)
+	}()
+
+	select {
+	case authURL := <-opened:
+		return authURL, done, errOut
+	case <-time.After(5 * time.Second):
+		t.Fatal("browser was not opened")
+	}
+	return "", nil, nil
+}
+
+// getCallback requests the callback page and returns its status and body.
+func getCallback(t *testing.T, port int, query string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/callback?%s", port, query))
+	if err != nil {
+		t.Fatalf("callback request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+// TestLoginCommand_Callback verifies --listen and --port choose the callback
+// address, the browser gets the auth URL, and requests with a wrong state
+// are rejected without ending the login.
+func TestLoginCommand_Callback(t *testing.T) {
+	port := freePort(t)
+	tmpDir := t.TempDir()
+	srv, form := newTokenServer(t)
+	writeOAuthClient(t, tmpDir, srv.URL)
+
+	authURL, done, errOut := startCallbackLogin(t, &config.Config{Dir: tmpDir}, port)
+	state := withState("STATE", authURL)
+	if len(state) < 16 || state == "state" {
+		t.Errorf("expected a random state, got %q", state)
+	}
+
+	status, body := getCallback(t, port, "state=forged&code=evil")
+	if status != http.StatusBadRequest || !strings.Contains(body, "Invalid state") {
+		t.Errorf("expected rejected stray request, got %d %q", status, body)
+	}
+
+	status, body = getCallback(t, port, "state="+url.QueryEscape(state)+"&code=xyz")
+	if status != http.StatusOK || !strings.Contains(body, "Authentication successful") {
+		t.Errorf("expected success page, got %d %q", status, body)
+	}
+
+	if code := <-done; code != exitcode.Success {
+		t.Fatalf("expected exit code %d, got %d (stderr: %s)", exitcode.Success, code, errOut.String())
+	}
+	if form.Get("code") != "xyz" {
+		t.Errorf("expected code xyz, got %q", form.Get("code"))
+	}
+	if want := fmt.Sprintf("http://localhost:%d/callback", port); form.Get("redirect_uri") != want {
+		t.Errorf("expected redirect_uri %q, got %q", want, form.Get("redirect_uri"))
+	}
+}
+
+// TestLoginCommand_CallbackError verifies an error redirect ends the login
+// with Google's error and serves an escaped failure page.
+func TestLoginCommand_CallbackError(t *testing.T) {
+	port := freePort(t)
+	tmpDir := t.TempDir()
+	writeOAuthClient(t, tmpDir, "http://127.0.0.1:1/token")
+
+	cfg := &config.Config{Dir: tmpDir}
+	authURL, done, errOut := startCallbackLogin(t, cfg, port)
+
+	query := withState("state=STATE&error=access_denied&error_description=%3Cb%3Edeclined%3C%2Fb%3E", authURL)
+	status, body := getCallback(t, port, query)
+	if status != http.StatusBadRequest || !strings.Contains(body, "Authentication failed") {
+		t.Errorf("expected failure page, got %d %q", status, body)
+	}
+	if strings.Contains(body, "<b>") {
+		t.Errorf("failure page must escape the description: %q", body)
+	}
+
+	if code := <-done; code != exitcode.AuthError {
+		t.Errorf("expected exit code %d, got %d", exitcode.AuthError, code)
+	}
+	if !strings.HasSuffix(errOut.String(), "error: authorization failed: access_denied (<b>declined</b>)\n") {
+		t.Errorf("unexpected stderr: %q", errOut.String())
+	}
+	if cfg.HasToken() {
+		t.Error("no token should be saved")
+	}
+}
+
+// TestLoginCommand_RepeatedCallbacks verifies concurrent redirects never
+// block the callback handler.
+func TestLoginCommand_RepeatedCallbacks(t *testing.T) {
+	port := freePort(t)
+	tmpDir := t.TempDir()
+	srv, _ := newTokenServer(t)
+	writeOAuthClient(t, tmpDir, srv.URL)
+
+	authURL, done, _ := startCallbackLogin(t, &config.Config{Dir: tmpDir}, port)
+	callback := fmt.Sprintf("http://127.0.0.1:%d/callback?%s", port, withState("state=STATE&code=xyz", authURL))
+
+	client := &http.Client{Timeout: 3 * time.Second}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(callback)
+			if err != nil {
+				// The server may already be shutting down, but must not hang
+				if uerr, ok := err.(*url.Error); ok && uerr.Timeout() {
+					t.Errorf("callback request hung: %v", err)
+				}
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+				t.Errorf("unexpected status %d", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if code := <-done; code != exitcode.Success {
+		t.Errorf("expected exit code %d, got %d", exitcode.Success, code)
+	}
+}
+
+// TestLoginCommand_NoBrowser verifies --no-browser skips the browser.
+func TestLoginCommand_NoBrowser(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeOAuthClient(t, tmpDir, "http://127.0.0.1:1/token")
+
+	cmd := &commands.LoginCmd{}
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	cmd.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--no-browser", "--listen", "127.0.0.1", "--port", strconv.Itoa(freePort(t))}); err != nil {
+		t.Fatal(err)
+	}
+	opened := false
+	cmd.SetOpenBrowser(func(string) error {
+		opened = true
+		return nil
+	})
+
+	// Cancelled, so that login returns after printing the URL
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var outBuf, errBuf bytes.Buffer
+	code := cmd.Run(ctx, &config.Config{Dir: tmpDir}, nil, nil, &outBuf, &errBuf)
+	if code != exitcode.AuthError {
+		t.Errorf("expected exit code %d, got %d", exitcode.AuthError, code)
+	}
+	if opened {
+		t.Error("browser should not be opened with --no-browser")
+	}
+	if !strings.Contains(errBuf.String(), "Open this URL in your browser:") {
+		t.Errorf("expected the URL to be printed, got %q", errBuf.String())
+	}
+}
+
+// TestLoginCommand_InvalidAddress verifies conflicting or invalid callback
+// options are user errors.
+func TestLoginCommand_InvalidAddress(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"--port", "70000"}, "error: invalid port: 70000\n"},
+		{[]string{"--listen", "localhost:x"}, "error: invalid listen address: localhost:x\n"},
+		{[]string{"--listen", "localhost:9000", "--port", "9001"}, "error: --port 9001 conflicts with --listen localhost:9000\n"},
+		{[]string{"--manual", "--listen", "0.0.0.0"}, "error: --listen cannot be used with --manual\n"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			cmd := &commands.LoginCmd{}
+			fs := flag.NewFlagSet("login", flag.ContinueOnError)
+			cmd.RegisterFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			var outBuf, errBuf bytes.Buffer
+			code := cmd.Run(context.Background(), &config.Config{Dir: t.TempDir()}, nil, nil, &outBuf, &errBuf)
+			if code != exitcode.UserError {
+				t.Errorf("expected exit code %d, got %d", exitcode.UserError, code)
+			}
+			if errBuf.String() != tt.wantErr {
+				t.Errorf("expected %q, got %q", tt.wantErr, errBuf.String())
+			}
+		})
+	}
+}
+
+// TestLoginCommand_ReadOnly verifies --readonly requests the read-only scope
+// and records the granted scopes.
+func TestLoginCommand_ReadOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	srv, _ := newScopedTokenServer(t, auth.TasksReadOnlyScope)
+	writeOAuthClient(t, tmpDir, srv.URL)
+
+	cmd := &commands.LoginCmd{}
+	cmd.SetManual(true)
+	cmd.SetReadOnly(true)
+	pr, pw := io.Pipe()
+	cmd.SetInput(pr)
+	errOut := newURLWriter()
+	go func() {
+		authURL := <-errOut.urls
+		u, _ := url.Parse(authURL)
+		if got := u.Query().Get("scope"); got != auth.TasksReadOnlyScope {
+			t.Errorf("expected read-only scope in auth URL, got %q", got)
+		}
+		pw.Write([]byte("4/abc\n"))
+		pw.Close()
+	}()
+
+	cfg := &config.Config{Dir: tmpDir}
+	var outBuf bytes.Buffer
+	if code := cmd.Run(context.Background(), cfg, nil, nil, &outBuf, errOut); code != exitcode.Success {
+		t.Fatalf("expected exit code %d, got %d (stderr: %s)", exitcode.Success, code, errOut.String())
+	}
+
+	scopes, err := cfg.SavedScopes()
+	if err != nil || len(scopes) != 1 || scopes[0] != auth.TasksReadOnlyScope {
+		t.Errorf("expected recorded read-only scope, got %v, %v", scopes, err)
+	}
+	if !auth.ReadOnly(cfg) {
+		t.Error("expected a read-only login")
+	}
+
+	// Logout forgets the scopes
+	if code := (&commands.LogoutCmd{}).Run(context.Background(), cfg, nil, nil, io.Discard, io.Discard); code != exitcode.Success {
+		t.Fatalf("logout failed: %d", code)
+	}
+	if auth.ReadOnly(cfg) {
+		t.Error("expected scopes to be removed by logout")
+	}
+}
+
+// TestLoginCommand_ScopeNotGranted verifies login fails if the user did not
+// grant access to tasks.
+func TestLoginCommand_ScopeNotGranted(t *testing.T) {
+	tmpDir := t.TempDir()
+	srv, _ := newScopedTokenServer(t, "openid email")
+	writeOAuthClient(t, tmpDir, srv.URL)
+
+	cfg := &config.Config{Dir: tmpDir}
+	code, _, stderr := runManualLogin(t, cfg, "4/abc\n")
+	if code != exitcode.AuthError {
+		t.Errorf("expected exit code %d, got %d", exitcode.AuthError, code)
+	}
+	if !strings.HasSuffix(stderr, "error: access to Google Tasks was not granted\n") {
+		t.Errorf("unexpected stderr: %q", stderr)
+	}
+	if cfg.HasToken() {
+		t.Error("no token should be saved")
+	}
+}
+
+// TestAuthStatus verifies auth status refreshes the token and reports it
+// without printing token values.
+func TestAuthStatus(t *testing.T) {
+	tmpDir := t.TempDir()
+	srv, form := newTokenServer(t)
+	writeOAuthClient(t, tmpDir, srv.URL)
+	token := `{"access_token":"old-access","refresh_token":"secret-refresh","expiry":"2020-01-01T00:00:00Z"}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "token.json"), []byte(token), 0600); err != nil {
+		t.Fatalf("failed to write token.json: %v", err)
+	}
+
+	cfg := &config.Config{Dir: tmpDir, Profile: config.DefaultProfile, Backend: config.BackendGoogle}
+	var outBuf, errBuf bytes.Buffer
+	code := (&commands.AuthCmd{}).Run(context.Background(), cfg, nil, []string{"status"}, &outBuf, &errBuf)
+	if code != exitcode.Success {
+		t.Fatalf("expected exit code %d, got %d (stderr: %s)", exitcode.Success, code, errBuf.String())
+	}
+	if form.Get("grant_type") != "refresh_token" {
+		t.Errorf("expected a refresh request, got %v", *form)
+	}
+
+	got := outBuf.String()
+	for _, want := range []string{
+		"profile: default (" + tmpDir + ")",
+		"token store: file (" + filepath.Join(tmpDir, "token.json") + ")",
+		"scopes: " + auth.TasksScope + "\n",
+		"refresh token: present",
+		"access token: expired 20",
+		"refresh: ok (new access token expires ",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	for _, secret := range []string{"old-access", "secret-refresh", "new-access", "new-refresh"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("output contains token value %q", secret)
+		}
+	}
+}
+
+// TestAuthStatus_NotLoggedIn verifies auth status fails with a login hint.
+func TestAuthStatus_NotLoggedIn(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeOAuthClient(t, tmpDir, "http://127.0.0.1:1/token")
+
+	cfg := &config.Config{Dir: tmpDir, Profile: "work", Backend: config.BackendGoogle}
+	var outBuf, errBuf bytes.Buffer
+	code := (&commands.AuthCmd{}).Run(context.Background(), cfg, nil, []string{"status"}, &outBuf, &errBuf)
+	if code != exitcode.AuthError {
+		t.Errorf("expected exit code %d, got %d", exitcode.AuthError, code)
+	}
+	if errBuf.String() != "error: not logged in (run: gtask login --profile work)\n" {
+		t.Errorf("unexpected stderr: %q", errBuf.String())
+	}
+}
+
+// newAPIServer starts a fake Tasks API endpoint that answers with the
+// given Date header.
+func newAPIServer(t *testing.T, date time.Time) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", date.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestDoctor_AllPass verifies doctor passes with a valid setup.
+func TestDoctor_AllPass(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Chmod(tmpDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	tokenSrv, _ := newTokenServer(t)
+	writeOAuthClient(t, tmpDir, tokenSrv.URL)
+	token := `{"access_token":"a","refresh_token":"r","expiry":"2020-01-01T00:00:00Z"}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "token.json"), []byte(token), 0600); err != nil {
+		t.Fatalf("failed to write token.json: %v", err)
+	}
+
+	cmd := &commands.DoctorCmd{}
+	cmd.SetAPIURL(newAPIServer(t, time.Now()).URL)
+	cfg := &config.Config{Dir: tmpDir, Profile: config.DefaultProfile, Backend: config.BackendGoogle}
+	var outBuf, errBuf bytes.Buffer
+	code := cmd.Run(context.Background(), cfg, nil, nil, &outBuf, &errBuf)
+	if code != exitcode.Success {
+		t.Fatalf("expected exit code %d, got %d:\n%s%s", exitcode.Success, code, outBuf.String(), errBuf.String())
+	}
+	for _, want := range []string{
+		"ok    config dir: ",
+		"ok    backend: google",
+		"ok    oauth client: ",
+		"ok    token: valid",
+		"ok    scopes: read and write",
+		"ok    api: ",
+		"ok    clock: in sync",
+		"all checks passed",
+	} {
+		if !strings.Contains(outBuf.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, outBuf.String())
+		}
+	}
+}
+
+// TestDoctor_Problems verifies doctor reports a web client, a missing
+// token, loose permissions and clock skew.
+func TestDoctor_Problems(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	client := `{"web":{"client_id":"test","client_secret":"test","auth_uri":"https://accounts.example/auth","token_uri":"https://accounts.example/token"}}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "oauth_client.json"), []byte(client), 0600); err != nil {
+		t.Fatalf("failed to write oauth_client.json: %v", err)
+	}
+
+	cmd := &commands.DoctorCmd{}
+	cmd.SetAPIURL(newAPIServer(t, time.Now().Add(-time.Hour)).URL)
+	cfg := &config.Config{Dir: tmpDir, Profile: config.DefaultProfile, Backend: config.BackendGoogle}
+	var outBuf, errBuf bytes.Buffer
+	code := cmd.Run(context.Background(), cfg, nil, nil, &outBuf, &errBuf)
+	if code != exitcode.UserError {
+		t.Errorf("expected exit code %d, got %d", exitcode.UserError, code)
+	}
+	for _, want := range []string{
+		"FAIL  config dir: " + tmpDir + " has mode 0755, want 0700",
+		"FAIL  oauth client: " + filepath.Join(tmpDir, "oauth_client.json") + " is a web client",
+		"FAIL  token: not logged in (run: gtask login)",
+		"ok    api: ",
+		"FAIL  clock: local clock is off by 1h0m",
+		"4 problem(s) found",
+	} {
+		if !strings.Contains(outBuf.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, outBuf.String())
+		}
+	}
+}
@@ -6,8 +6,12 @@ import (
 	"fmt"
 	"io"
 
+	"gtask/internal/auth"
+	"gtask/internal/backend"
+	"gtask/internal/cache"
 	"gtask/internal/config"
 	"gtask/internal/exitcode"
+	"gtask/internal/outbox"
 	"gtask/internal/service"
 )
 
@@ -23,23 +27,50 @@ func (c *LogoutCmd) Aliases() []string { return nil }
 func (c *LogoutCmd) Synopsis() string  { return "Remove stored session token" }
 func (c *LogoutCmd) Usage() string     { return "gtask logout [common flags]" }
 func (c *LogoutCmd) NeedsAuth() bool   { return false }
+func (c *LogoutCmd) Mutates() bool     { return false }
 
 func (c *LogoutCmd) RegisterFlags(fs *flag.FlagSet) {}
 
 func (c *LogoutCmd) Run(ctx context.Context, cfg *config.Config, svc service.Service, args []string, out, errOut io.Writer) int {
-	// Check if token.json exists
-	if !cfg.HasToken() {
+	// Only OAuth backends use login
+	if b, ok := backend.DefaultRegistry.Find(cfg.Backend); ok && !b.NeedsOAuth {
 		if !cfg.Quiet {
-			fmt.Fprintln(out, "not logged in")
+			fmt.Fprintln(out, noLoginMessage(b))
 		}
 		return exitcode.Success
 	}
 
-	// Delete token.json only (not oauth_client.json)
-	if err := cfg.RemoveToken(); err != nil {
+	// Offline changes would be synced into the next account's lists
+	ops, err := outbox.Open(cfg.OutboxPath()).Ops()
+	if err != nil {
+		fmt.Fprintf(errOut, "error: %v\n", err)
+		return exitcode.UserError
+	}
+	if len(ops) > 0 {
+		fmt.Fprintf(errOut, "error: %d offline change(s) not synced yet (run: %s, or remove %s to discard them)\n", len(ops), cfg.ProfileCommand("sync"), cfg.OutboxPath())
+		return exitcode.UserError
+	}
+
+	// Delete tokens only (not oauth_client.json), from both token stores
+	found, err := auth.DeleteAll(cfg)
+	if err != nil {
 		fmt.Fprintf(errOut, "error: failed to remove token: %v\n", err)
 		return exitcode.AuthError
 	}
+	if !found {
+		if !cfg.Quiet {
+			fmt.Fprintln(out, "not logged in")
+		}
+		return exitcode.Success
+	}
+
+	// Drop cached data so the next account never sees it
+	if cfg.CacheDir != "" {
+		if err := cache.Remove(cfg); err != nil {
+			fmt.Fprintf(errOut, "error: failed to remove cache: %v\n", err)
+			return exitcode.AuthError
+		}
+	}
 
 	if !cfg.Quiet {
 		fmt.Fprintln(out, "ok")
@@ -0,0 +1,241 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gtask/internal/auth"
+	"gtask/internal/backend"
+	"gtask/internal/cache"
+	"gtask/internal/config"
+	"gtask/internal/exitcode"
+	"gtask/internal/outbox"
+	"gtask/internal/service"
+)
+
+func init() {
+	Register(&ProfilesCmd{})
+}
+
+// ProfilesCmd implements the profiles command.
+type ProfilesCmd struct{}
+
+func (c *ProfilesCmd) Name() string      { return "profiles" }
+func (c *ProfilesCmd) Aliases() []string { return []string{"profile"} }
+func (c *ProfilesCmd) Synopsis() string  { return "List and manage named profiles" }
+func (c *ProfilesCmd) Usage() string {
+	return "gtask profiles [common flags] [add <name> | rm <name> | default <name>]"
+}
+func (c *ProfilesCmd) NeedsAuth() bool { return false }
+func (c *ProfilesCmd) Mutates() bool   { return false }
+
+func (c *ProfilesCmd) RegisterFlags(fs *flag.FlagSet) {}
+
+func (c *ProfilesCmd) Run(ctx context.Context, cfg *config.Config, svc service.Service, args []string, out, errOut io.Writer) int {
+	if len(args) == 0 {
+		return c.list(cfg, out, errOut)
+	}
+	if len(args) != 2 {
+		fmt.Fprintf(errOut, "error: usage: %s\n", c.Usage())
+		return exitcode.UserError
+	}
+
+	name := args[1]
+	if err := config.ValidateProfileName(name); err != nil {
+		fmt.Fprintf(errOut, "error: %s\n", err)
+		return exitcode.UserError
+	}
+
+	switch args[0] {
+	case "add":
+		return c.add(cfg, name, out, errOut)
+	case "rm":
+		return c.remove(cfg, name, out, errOut)
+	case "default":
+		return c.setDefault(cfg, name, out, errOut)
+	}
+	fmt.Fprintf(errOut, "error: unknown profiles command: %s\n", args[0])
+	return exitcode.UserError
+}
+
+// list prints every profile, marking the active one, with its backend and
+// login state.
+func (c *ProfilesCmd) list(cfg *config.Config, out, errOut io.Writer) int {
+	names, err := cfg.Profiles()
+	if err != nil {
+		fmt.Fprintf(errOut, "error: failed to read profiles: %v\n", err)
+		return exitcode.UserError
+	}
+
+	active := cfg.Profile
+	if active == "" {
+		active = config.DefaultProfile
+	}
+	for _, name := range names {
+		marker := " "
+		if name == active {
+			marker = "*"
+		}
+		p := *cfg
+		if err := p.UseProfile(name); err != nil {
+			fmt.Fprintf(out, "%s %-10s error: %v\n", marker, name, err)
+			continue
+		}
+		fmt.Fprintf(out, "%s %-10s %s\n", marker, name, profileStatus(&p))
+	}
+	return exitcode.Success
+}
+
+func (c *ProfilesCmd) add(cfg *config.Config, name string, out, errOut io.Writer) int {
+	if profileExists(cfg, name) {
+		fmt.Fprintf(errOut, "error: profile already exists: %s\n", name)
+		return exitcode.UserError
+	}
+	if err := os.MkdirAll(cfg.ProfileDir(name), 0700); err != nil {
+		fmt.Fprintf(errOut, "error: failed to create profile: %v\n", err)
+		return exitcode.UserError
+	}
+	if !cfg.Quiet {
+		fmt.Fprintf(out, "ok (run: gtask login --profile %s)\n", name)
+	}
+	return exitcode.Success
+}
+
+// remove deletes a named profile with its token, settings and cached data.
+// It refuses while the profile or one of its mounts has offline changes
+// that were not synced, as logout does.
+func (c *ProfilesCmd) remove(cfg *config.Config, name string, out, errOut io.Writer) int {
+	if name == config.DefaultProfile {
+		fmt.Fprintln(errOut, "error: cannot remove default profile")
+		return exitcode.UserError
+	}
+	if !profileExists(cfg, name) {
+		fmt.Fprintf(errOut, "error: profile not found: %s\n", name)
+		return exitcode.UserError
+	}
+
+	p := *cfg
+	if err := p.UseProfile(name); err != nil {
+		fmt.Fprintf(errOut, "error: %s\n", err)
+		return exitcode.UserError
+	}
+	accounts, err := profileAccounts(&p)
+	if err != nil {
+		fmt.Fprintf(errOut, "error: failed to read profile: %v\n", err)
+		return exitcode.UserError
+	}
+
+	// Offline changes of the profile or its mounts would be lost
+	queued := 0
+	var outboxes []string
+	for _, account := range accounts {
+		ops, err := outbox.Open(account.OutboxPath()).Ops()
+		if err != nil {
+			fmt.Fprintf(errOut, "error: %v\n", err)
+			return exitcode.UserError
+		}
+		if len(ops) > 0 {
+			queued += len(ops)
+			outboxes = append(outboxes, account.OutboxPath())
+		}
+	}
+	if queued > 0 {
+		fmt.Fprintf(errOut, "error: %d offline change(s) not synced yet (run: %s, or remove %s to discard them)\n", queued, p.ProfileCommand("sync"), strings.Join(outboxes, ", "))
+		return exitcode.UserError
+	}
+
+	if p.CacheDir != "" {
+		for _, account := range accounts {
+			if err := cache.Remove(&account); err != nil {
+				fmt.Fprintf(errOut, "error: failed to remove cache: %v\n", err)
+				return exitcode.UserError
+			}
+		}
+	}
+	if err := os.RemoveAll(p.Dir); err != nil {
+		fmt.Fprintf(errOut, "error: failed to remove profile: %v\n", err)
+		return exitcode.UserError
+	}
+
+	// Fall back to the default profile if the removed one was the default
+	if saved, _ := cfg.SavedDefaultProfile(); saved == name {
+		if err := cfg.SaveDefaultProfile(config.DefaultProfile); err != nil {
+			fmt.Fprintf(errOut, "error: failed to reset default profile: %v\n", err)
+			return exitcode.UserError
+		}
+	}
+
+	if !cfg.Quiet {
+		fmt.Fprintln(out, "ok")
+	}
+	return exitcode.Success
+}
+
+// profileAccounts returns a config for every account that may be stored
+// in the profile directory p.Dir: the profile and its mounts
+// (subdirectories), each with every remote backend, as the profile may
+// have switched backends since. Their caches and outboxes go with the
+// profile.
+func profileAccounts(p *config.Config) ([]config.Config, error) {
+	var accounts []config.Config
+	err := filepath.WalkDir(p.Dir, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		for _, b := range backend.DefaultRegistry.All() {
+			if b.Remote {
+				account := *p
+				account.Dir, account.Backend = dir, b.Name
+				accounts = append(accounts, account)
+			}
+		}
+		return nil
+	})
+	return accounts, err
+}
+
+func (c *ProfilesCmd) setDefault(cfg *config.Config, name string, out, errOut io.Writer) int {
+	if !profileExists(cfg, name) {
+		fmt.Fprintf(errOut, "error: profile not found: %s\n", name)
+		return exitcode.UserError
+	}
+	if err := cfg.SaveDefaultProfile(name); err != nil {
+		fmt.Fprintf(errOut, "error: failed to save default profile: %v\n", err)
+		return exitcode.UserError
+	}
+	if !cfg.Quiet {
+		fmt.Fprintln(out, "ok")
+	}
+	return exitcode.Success
+}
+
+// profileExists reports whether a profile is usable. The default profile
+// always exists.
+func profileExists(cfg *config.Config, name string) bool {
+	if name == config.DefaultProfile {
+		return true
+	}
+	info, err := os.Stat(cfg.ProfileDir(name))
+	return err == nil && info.IsDir()
+}
+
+// profileStatus describes the backend and login state of a profile.
+func profileStatus(cfg *config.Config) string {
+	b, ok := backend.DefaultRegistry.Find(cfg.Backend)
+	if !ok || !b.NeedsOAuth {
+		return cfg.Backend
+	}
+	if cfg.HasToken() && auth.ReadOnly(cfg) {
+		return cfg.Backend + ", logged in (read-only)"
+	}
+	if cfg.HasToken() {
+		return cfg.Backend + ", logged in"
+	}
+	return cfg.Backend + ", not logged in"
+}
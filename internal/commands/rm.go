@@ -26,6 +26,7 @@ func (c *RmCmd) Aliases() []string { return nil }
 func (c *RmCmd) Synopsis() string  { return "Delete a task" }
 func (c *RmCmd) Usage() string     { return "gtask rm [--list <list-name>] <ref>" }
 func (c *RmCmd) NeedsAuth() bool   { return true }
+func (c *RmCmd) Mutates() bool     { return true }
 
 func (c *RmCmd) RegisterFlags(fs *flag.FlagSet) {
 	fs.StringVar(&c.listName, "list", "", "")
@@ -60,7 +61,7 @@ func (c *RmCmd) Run(ctx context.Context, cfg *config.Config, svc service.Service
 	var list service.TaskList
 	if c.listName != "" {
 		// --list flag provided
-		list, err = svc.ResolveList(ctx, c.listName)
+		list, err = resolveList(ctx, cfg, svc, c.listName)
 		if err != nil {
 			if strings.Contains(err.Error(), "not found") {
 				fmt.Fprintf(errOut, "error: list not found: %s\n", c.listName)
@@ -75,7 +76,7 @@ func (c *RmCmd) Run(ctx context.Context, cfg *config.Config, svc service.Service
 		}
 	} else if ref.HasLetter {
 		// List letter provided (e.g., a1, b 3)
-		list, err = ResolveListByLetter(ctx, svc, ref.Letter)
+		list, err = resolveListByLetter(ctx, cfg, svc, ref.Letter)
 		if err != nil {
 			if strings.Contains(err.Error(), "list letter not found") {
 				fmt.Fprintf(errOut, "error: list letter not found: %c\n", ref.Letter)
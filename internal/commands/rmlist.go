@@ -31,6 +31,7 @@ func (c *RmListCmd) Aliases() []string { return nil }
 func (c *RmListCmd) Synopsis() string  { return "Delete a list" }
 func (c *RmListCmd) Usage() string     { return "gtask rmlist [--force] <list-name>" }
 func (c *RmListCmd) NeedsAuth() bool   { return true }
+func (c *RmListCmd) Mutates() bool     { return true }
 
 func (c *RmListCmd) RegisterFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&c.force, "force", false, "")
@@ -52,7 +53,7 @@ func (c *RmListCmd) Run(ctx context.Context, cfg *config.Config, svc service.Ser
 	}
 
 	// Resolve list
-	list, err := svc.ResolveList(ctx, name)
+	list, err := resolveList(ctx, cfg, svc, name)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			fmt.Fprintf(errOut, "error: list not found: %s\n", name)
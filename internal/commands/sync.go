@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"gtask/internal/config"
+	"gtask/internal/exitcode"
+	"gtask/internal/outbox"
+	"gtask/internal/service"
+)
+
+func init() {
+	Register(&SyncCmd{})
+}
+
+// syncer is implemented by services that carry their own outbox
+// (outbox.Service).
+type syncer interface {
+	Sync(ctx context.Context) ([]outbox.Result, error)
+}
+
+// SyncCmd implements the sync command.
+type SyncCmd struct{}
+
+func (c *SyncCmd) Name() string      { return "sync" }
+func (c *SyncCmd) Aliases() []string { return nil }
+func (c *SyncCmd) Synopsis() string  { return "Apply changes queued while offline" }
+func (c *SyncCmd) Usage() string     { return "gtask sync [common flags]" }
+func (c *SyncCmd) NeedsAuth() bool   { return true }
+func (c *SyncCmd) Mutates() bool     { return true }
+
+func (c *SyncCmd) RegisterFlags(fs *flag.FlagSet) {}
+
+func (c *SyncCmd) Run(ctx context.Context, cfg *config.Config, svc service.Service, args []string, out, errOut io.Writer) int {
+	if cfg.Offline {
+		fmt.Fprintln(errOut, "error: cannot sync in offline mode")
+		return exitcode.UserError
+	}
+
+	var results []outbox.Result
+	var err error
+	if s, ok := svc.(syncer); ok {
+		results, err = s.Sync(ctx)
+	} else {
+		results, err = outbox.Replay(ctx, outbox.Open(cfg.OutboxPath()), svc)
+	}
+
+	// Report conflicts first; they were dropped from the outbox. Other
+	// failures stay queued for the next sync.
+	conflicts, failed := 0, 0
+	for _, r := range results {
+		switch {
+		case r.Conflict:
+			fmt.Fprintf(errOut, "error: conflict: %s: %v\n", r.Op.Describe(), r.Err)
+			conflicts++
+		case r.Err != nil:
+			fmt.Fprintf(errOut, "error: backend error: %s: %v (kept for the next sync)\n", r.Op.Describe(), r.Err)
+			failed++
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(errOut, "error: backend error: %v\n", err)
+		return exitcode.BackendError
+	}
+	if failed > 0 {
+		return exitcode.BackendError
+	}
+	if conflicts > 0 {
+		return exitcode.UserError
+	}
+
+	if !cfg.Quiet {
+		if len(results) == 0 {
+			fmt.Fprintln(out, "nothing to sync")
+		} else {
+			fmt.Fprintln(out, "ok")
+		}
+	}
+	return exitcode.Success
+}
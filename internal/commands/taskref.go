@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"unicode"
 
+	"gtask/internal/config"
 	"gtask/internal/service"
 )
 
@@ -99,10 +100,36 @@ func isLetter(r rune) bool {
 	return r >= 'a' && r <= 'z'
 }
 
+// resolveList resolves a list name with svc.ResolveList and logs the
+// result (--debug).
+func resolveList(ctx context.Context, cfg *config.Config, svc service.Service, name string) (service.TaskList, error) {
+	list, err := svc.ResolveList(ctx, name)
+	logResolved(cfg, "name", name, list, err)
+	return list, err
+}
+
+// resolveListByLetter resolves a list letter with ResolveListByLetter,
+// hiding the lists hidden by the settings, and logs the result (--debug).
+func resolveListByLetter(ctx context.Context, cfg *config.Config, svc service.Service, letter rune) (service.TaskList, error) {
+	list, err := ResolveListByLetter(ctx, svc, letter, cfg.Settings.IsHidden)
+	logResolved(cfg, "letter", string(letter), list, err)
+	return list, err
+}
+
+func logResolved(cfg *config.Config, key, ref string, list service.TaskList, err error) {
+	if err != nil {
+		cfg.Logger().Debug("resolve list", key, ref, "error", err)
+		return
+	}
+	cfg.Logger().Debug("resolve list", key, ref, "id", list.ID, "title", list.Title)
+}
+
 // ResolveListByLetter resolves a list letter to a TaskList.
 // Fetches all lists, assigns letters to named lists with open tasks, returns matching list.
+// Lists for which hidden returns true get no letter, as in the all-lists view;
+// hidden may be nil.
 // Returns error if letter is not found.
-func ResolveListByLetter(ctx context.Context, svc service.Service, letter rune) (service.TaskList, error) {
+func ResolveListByLetter(ctx context.Context, svc service.Service, letter rune, hidden func(title string) bool) (service.TaskList, error) {
 	lists, err := svc.ListLists(ctx)
 	if err != nil {
 		return service.TaskList{}, err
@@ -110,7 +137,7 @@ func ResolveListByLetter(ctx context.Context, svc service.Service, letter rune)
 
 	currentLetter := 'a'
 	for _, list := range lists {
-		if list.IsDefault {
+		if list.IsDefault || (hidden != nil && hidden(list.Title)) {
 			continue
 		}
 
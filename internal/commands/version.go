@@ -26,6 +26,7 @@ func (c *VersionCmd) Aliases() []string { return nil }
 func (c *VersionCmd) Synopsis() string  { return "Print version" }
 func (c *VersionCmd) Usage() string     { return "gtask version" }
 func (c *VersionCmd) NeedsAuth() bool   { return false }
+func (c *VersionCmd) Mutates() bool     { return false }
 
 func (c *VersionCmd) RegisterFlags(fs *flag.FlagSet) {}
 
@@ -2,8 +2,13 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 const (
@@ -15,28 +20,230 @@ const (
 
 	// TokenFile is the stored OAuth token filename.
 	TokenFile = "token.json"
+
+	// EncryptedTokenFile is the stored OAuth token filename when
+	// token_store is "encrypted".
+	EncryptedTokenFile = "token.enc"
+
+	// ScopesFile records the OAuth scopes granted at login, one per line.
+	ScopesFile = "scopes"
+
+	// OutboxFile holds changes queued while offline.
+	OutboxFile = "outbox.json"
+
+	// BackendFile holds the name of the selected backend.
+	BackendFile = "backend"
+
+	// BackendGoogle is the default backend (Google Tasks).
+	BackendGoogle = "google"
+
+	// ProfilesDir holds the config directories of named profiles.
+	ProfilesDir = "profiles"
+
+	// ProfileFile holds the name of the default profile.
+	ProfileFile = "profile"
+
+	// DefaultProfile is the profile stored directly in the base config
+	// directory.
+	DefaultProfile = "default"
+
+	// ProfileEnv selects the profile when --profile is not given.
+	ProfileEnv = "GTASK_PROFILE"
+
+	// ConfigDirEnv overrides the config directory when --config is not
+	// given.
+	ConfigDirEnv = "GTASK_CONFIG_DIR"
 )
 
 // Config holds configuration paths and settings.
 type Config struct {
-	// Dir is the configuration directory path.
+	// Dir is the configuration directory path of the active profile.
 	Dir string
 
+	// BaseDir is the top-level configuration directory. It equals Dir for
+	// the default profile; named profiles live in BaseDir/profiles/<name>.
+	BaseDir string
+
+	// Profile is the name of the active profile.
+	Profile string
+
 	// Debug enables debug logging.
 	Debug bool
 
+	// Log receives debug logs when Debug is set; see Logger.
+	Log *slog.Logger
+
 	// Quiet suppresses informational output.
 	Quiet bool
+
+	// CacheDir is the directory for cached backend data.
+	CacheDir string
+
+	// NoCache bypasses cached reads; fresh results are still written back.
+	NoCache bool
+
+	// MaxAge is how long cached data is served without revalidation.
+	MaxAge time.Duration
+
+	// Offline serves reads from cache and queues changes without
+	// contacting the backend.
+	Offline bool
+
+	// Backend names the task storage backend (see package backend).
+	Backend string
+
+	// Record is a cassette file that Google API exchanges are recorded
+	// to (--record).
+	Record string
+
+	// Replay is a cassette file that Google API responses are replayed
+	// from instead of the network (--replay).
+	Replay string
+
+	// TimeoutFlag is the --timeout flag (0 if not given). It is already
+	// applied to Settings.Timeout; configs derived from this one with their
+	// own settings, like the mounts of the multi backend, apply it again.
+	TimeoutFlag time.Duration
+
+	// Settings are the user defaults from config.toml (see LoadSettings).
+	Settings Settings
 }
 
 // New creates a new Config with the default or specified config directory.
-// If configDir is empty, uses XDG_CONFIG_HOME/gtask or $HOME/.config/gtask.
-func New(configDir string) (*Config, error) {
+// If configDir is empty, uses $GTASK_CONFIG_DIR, then XDG_CONFIG_HOME/gtask
+// or $HOME/.config/gtask.
+//
+// profile selects a named profile. If empty, $GTASK_PROFILE is used, then
+// the profile saved with SaveDefaultProfile, then the default profile.
+func New(configDir, profile string) (*Config, error) {
 	dir := configDir
+	if dir == "" {
+		dir = os.Getenv(ConfigDirEnv)
+	}
 	if dir == "" {
 		dir = DefaultConfigDir()
 	}
-	return &Config{Dir: dir}, nil
+	cfg := &Config{BaseDir: dir, CacheDir: DefaultCacheDir()}
+
+	if profile == "" {
+		profile = os.Getenv(ProfileEnv)
+	}
+	if profile == "" {
+		saved, err := cfg.SavedDefaultProfile()
+		if err != nil {
+			return nil, err
+		}
+		profile = saved
+	}
+	if err := cfg.UseProfile(profile); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Logger returns Log, or a logger that discards everything if Log is nil.
+func (c *Config) Logger() *slog.Logger {
+	if c.Log != nil {
+		return c.Log
+	}
+	return discardLogger
+}
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// UseProfile switches cfg to the named profile ("" means the default
+// profile) and loads the profile's saved backend.
+func (c *Config) UseProfile(name string) error {
+	if name == "" {
+		name = DefaultProfile
+	}
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+	c.Profile = name
+	c.Dir = c.ProfileDir(name)
+	c.Backend = BackendGoogle
+	saved, err := c.SavedBackend()
+	if err != nil {
+		return err
+	}
+	if saved != "" {
+		c.Backend = saved
+	}
+	return nil
+}
+
+// ValidateProfileName checks that name is usable as a directory name.
+func ValidateProfileName(name string) error {
+	if name == "" {
+		return errors.New("empty profile name")
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case (r == '-' || r == '_' || r == '.') && i > 0:
+		default:
+			return fmt.Errorf("invalid profile name: %s", name)
+		}
+	}
+	return nil
+}
+
+// ProfileDir returns the config directory of the named profile.
+func (c *Config) ProfileDir(name string) string {
+	if name == DefaultProfile {
+		return c.BaseDir
+	}
+	return filepath.Join(c.BaseDir, ProfilesDir, name)
+}
+
+// Profiles returns the default profile followed by the named profiles
+// found in the profiles directory, sorted.
+func (c *Config) Profiles() ([]string, error) {
+	profiles := []string{DefaultProfile}
+	entries, err := os.ReadDir(filepath.Join(c.BaseDir, ProfilesDir))
+	if os.IsNotExist(err) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() && e.Name() != DefaultProfile && ValidateProfileName(e.Name()) == nil {
+			profiles = append(profiles, e.Name())
+		}
+	}
+	return profiles, nil
+}
+
+// SavedDefaultProfile returns the profile name saved with
+// SaveDefaultProfile, or "" if none was saved.
+func (c *Config) SavedDefaultProfile() (string, error) {
+	data, err := os.ReadFile(filepath.Join(c.BaseDir, ProfileFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SaveDefaultProfile makes name the profile used when neither --profile
+// nor $GTASK_PROFILE is given.
+func (c *Config) SaveDefaultProfile(name string) error {
+	if err := os.MkdirAll(c.BaseDir, 0700); err != nil {
+		return err
+	}
+	path := filepath.Join(c.BaseDir, ProfileFile)
+	if name == DefaultProfile {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return os.WriteFile(path, []byte(name+"\n"), 0600)
 }
 
 // DefaultConfigDir returns the default configuration directory.
@@ -53,9 +260,34 @@ func DefaultConfigDir() string {
 	return filepath.Join(home, ".config", AppName)
 }
 
+// DefaultCacheDir returns the default cache directory.
+// Uses XDG_CACHE_HOME if set, otherwise $HOME/.cache.
+func DefaultCacheDir() string {
+	if xdg := os.Getenv("XDG_CACHE_HOME"); xdg != "" {
+		return filepath.Join(xdg, AppName)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), AppName)
+	}
+	return filepath.Join(home, ".cache", AppName)
+}
+
 // OAuthClientPath returns the path to the OAuth client credentials file.
+// Named profiles without their own file share the one in BaseDir, so one
+// OAuth client serves several accounts.
 func (c *Config) OAuthClientPath() string {
-	return filepath.Join(c.Dir, OAuthClientFile)
+	path := filepath.Join(c.Dir, OAuthClientFile)
+	if c.BaseDir == "" || c.BaseDir == c.Dir {
+		return path
+	}
+	if fileExists(path) {
+		return path
+	}
+	if shared := filepath.Join(c.BaseDir, OAuthClientFile); fileExists(shared) {
+		return shared
+	}
+	return path
 }
 
 // TokenPath returns the path to the stored OAuth token file.
@@ -63,6 +295,86 @@ func (c *Config) TokenPath() string {
 	return filepath.Join(c.Dir, TokenFile)
 }
 
+// EncryptedTokenPath returns the path to the encrypted OAuth token file.
+func (c *Config) EncryptedTokenPath() string {
+	return filepath.Join(c.Dir, EncryptedTokenFile)
+}
+
+// ProfileCommand returns the gtask command line running name on the
+// active profile, e.g. "gtask login --profile work", for error hints. A
+// config directory without a profile (a mount of the multi backend) is
+// named with --config.
+func (c *Config) ProfileCommand(name string) string {
+	if c.Profile == "" && c.BaseDir != "" {
+		return "gtask " + name + " --config " + c.Dir
+	}
+	if c.Profile != "" && c.Profile != DefaultProfile {
+		return "gtask " + name + " --profile " + c.Profile
+	}
+	return "gtask " + name
+}
+
+// ScopesPath returns the path to the granted scopes file.
+func (c *Config) ScopesPath() string {
+	return filepath.Join(c.Dir, ScopesFile)
+}
+
+// SavedScopes returns the scopes saved with SaveScopes, or nil if none
+// were saved.
+func (c *Config) SavedScopes() ([]string, error) {
+	data, err := os.ReadFile(c.ScopesPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// SaveScopes records the scopes granted at login.
+func (c *Config) SaveScopes(scopes []string) error {
+	if err := c.EnsureDir(); err != nil {
+		return err
+	}
+	return os.WriteFile(c.ScopesPath(), []byte(strings.Join(scopes, "\n")+"\n"), 0600)
+}
+
+// OutboxPath returns the path to the offline change queue.
+// Backends other than Google get their own queue.
+func (c *Config) OutboxPath() string {
+	if c.Backend != "" && c.Backend != BackendGoogle {
+		return filepath.Join(c.Dir, "outbox-"+c.Backend+".json")
+	}
+	return filepath.Join(c.Dir, OutboxFile)
+}
+
+// BackendPath returns the path to the backend selection file.
+func (c *Config) BackendPath() string {
+	return filepath.Join(c.Dir, BackendFile)
+}
+
+// SavedBackend returns the backend name saved with SaveBackend, or "" if
+// none was saved.
+func (c *Config) SavedBackend() (string, error) {
+	data, err := os.ReadFile(c.BackendPath())
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SaveBackend makes name the backend for this config directory.
+func (c *Config) SaveBackend(name string) error {
+	if err := c.EnsureDir(); err != nil {
+		return err
+	}
+	return os.WriteFile(c.BackendPath(), []byte(name+"\n"), 0600)
+}
+
 // EnsureDir creates the config directory if it doesn't exist.
 // Directory is created with mode 0700.
 func (c *Config) EnsureDir() error {
@@ -75,13 +387,16 @@ func (c *Config) HasOAuthClient() bool {
 	return err == nil
 }
 
-// HasToken checks if the token file exists.
+// HasToken checks if the token file of the configured token store
+// exists.
 func (c *Config) HasToken() bool {
-	_, err := os.Stat(c.TokenPath())
-	return err == nil
+	if c.Settings.TokenStore == TokenStoreEncrypted {
+		return fileExists(c.EncryptedTokenPath())
+	}
+	return fileExists(c.TokenPath())
 }
 
-// RemoveToken deletes the token file.
-func (c *Config) RemoveToken() error {
-	return os.Remove(c.TokenPath())
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
@@ -0,0 +1,631 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gtask/internal/fsutil"
+)
+
+// SettingsFile holds user defaults (a small subset of TOML).
+const SettingsFile = "config.toml"
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Color modes.
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+// Token stores.
+const (
+	TokenStoreFile      = "file"
+	TokenStoreEncrypted = "encrypted"
+)
+
+// flagsSection is the table of per-command default flags.
+const flagsSection = "flags"
+
+// EnvFlagsPrefix starts the environment variables holding default flags
+// per command, e.g. GTASK_FLAGS_LIST="--all".
+const EnvFlagsPrefix = "GTASK_FLAGS_"
+
+// Settings are user defaults read from config.toml. Zero values mean
+// "not set"; the built-in default then applies. Command-line flags take
+// precedence over settings, and settings over built-in defaults.
+type Settings struct {
+	// DefaultList is the list used by add when --list is omitted.
+	DefaultList string
+
+	// Format is the output format (FormatText or FormatJSON).
+	Format string
+
+	// PageSize is the number of tasks shown per list.
+	PageSize int
+
+	// Timeout limits each backend API request.
+	Timeout time.Duration
+
+	// Deadline limits the whole command, across all its requests.
+	Deadline time.Duration
+
+	// Retries is how often failed read requests are retried.
+	Retries int
+
+	// RateLimit is the number of API requests per second the Google
+	// backend sends at most, on average.
+	RateLimit int
+
+	// HiddenLists are left out of the all-lists view (matched by title,
+	// case-insensitively). They get no list letter but can still be used
+	// by name.
+	HiddenLists []string
+
+	// Color selects colored output (ColorAuto, ColorAlways, ColorNever).
+	Color string
+
+	// TokenStore selects where the OAuth token is kept (TokenStoreFile or
+	// TokenStoreEncrypted).
+	TokenStore string
+
+	// PassphraseFile and PassphraseCommand supply the passphrase of the
+	// encrypted token store when GTASK_TOKEN_PASSPHRASE is not set.
+	PassphraseFile    string
+	PassphraseCommand string
+
+	// Flags holds default flags per command name, inserted before the
+	// flags given on the command line.
+	Flags map[string][]string
+
+	// fromEnv records the keys set by ApplyEnv.
+	fromEnv map[string]bool
+}
+
+// IsHidden reports whether a list title is in HiddenLists.
+func (s *Settings) IsHidden(title string) bool {
+	title = strings.TrimSpace(title)
+	for _, h := range s.HiddenLists {
+		if strings.EqualFold(strings.TrimSpace(h), title) {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandFlags returns the default flags for a command, lowest precedence
+// first: flags implied by top-level settings from config.toml, the
+// command's [flags] entry, then the same two from the environment. The
+// command line comes after them and wins.
+func (s *Settings) CommandFlags(cmd string) []string {
+	flagsFromEnv := s.fromEnv[flagsSection+"."+cmd]
+	args := s.impliedFlags(cmd, false)
+	if !flagsFromEnv {
+		args = append(args, s.Flags[cmd]...)
+	}
+	args = append(args, s.impliedFlags(cmd, true)...)
+	if flagsFromEnv {
+		args = append(args, s.Flags[cmd]...)
+	}
+	return args
+}
+
+// FlagsOrigin names where the [flags] entry of cmd came from, for error
+// messages: config.toml or its environment variable.
+func (s *Settings) FlagsOrigin(cmd string) string {
+	if s.fromEnv[flagsSection+"."+cmd] {
+		return EnvFlagsPrefix + strings.ToUpper(cmd)
+	}
+	return SettingsFile
+}
+
+// impliedFlags returns the command flags implied by top-level settings
+// that did (env) or did not come from the environment.
+func (s *Settings) impliedFlags(cmd string, env bool) []string {
+	var args []string
+	switch cmd {
+	case "add", "create":
+		if s.DefaultList != "" && s.fromEnv["default_list"] == env {
+			args = append(args, "--list", s.DefaultList)
+		}
+	case "list":
+		if s.PageSize != 0 && s.fromEnv["page_size"] == env {
+			args = append(args, "--page-size", strconv.Itoa(s.PageSize))
+		}
+	}
+	return args
+}
+
+// settingKind is the value type of a settings key.
+type settingKind int
+
+const (
+	kindString settingKind = iota
+	kindInt
+	kindDuration
+	kindList
+)
+
+// settingKey describes a top-level key of config.toml.
+type settingKey struct {
+	name string
+	env  string // environment variable overriding the key
+	kind settingKind
+	set  func(s *Settings, v value) error
+	get  func(s *Settings) value
+}
+
+var settingKeys = []settingKey{
+	{
+		name: "default_list",
+		env:  "GTASK_LIST",
+		kind: kindString,
+		set:  func(s *Settings, v value) error { s.DefaultList = v.str; return nil },
+		get:  func(s *Settings) value { return value{kind: kindString, str: s.DefaultList, set: s.DefaultList != ""} },
+	},
+	{
+		name: "format",
+		env:  "GTASK_FORMAT",
+		kind: kindString,
+		set: func(s *Settings, v value) error {
+			if v.str != FormatText && v.str != FormatJSON {
+				return fmt.Errorf("invalid format: %s (want %s or %s)", v.str, FormatText, FormatJSON)
+			}
+			s.Format = v.str
+			return nil
+		},
+		get: func(s *Settings) value { return value{kind: kindString, str: s.Format, set: s.Format != ""} },
+	},
+	{
+		name: "page_size",
+		env:  "GTASK_PAGE_SIZE",
+		kind: kindInt,
+		set: func(s *Settings, v value) error {
+			if v.num < 1 {
+				return fmt.Errorf("invalid page_size: %d", v.num)
+			}
+			s.PageSize = v.num
+			return nil
+		},
+		get: func(s *Settings) value { return value{kind: kindInt, num: s.PageSize, set: s.PageSize != 0} },
+	},
+	{
+		name: "timeout",
+		env:  "GTASK_TIMEOUT",
+		kind: kindDuration,
+		set: func(s *Settings, v value) error {
+			d, err := time.ParseDuration(v.str)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid timeout: %s", v.str)
+			}
+			s.Timeout = d
+			return nil
+		},
+		get: func(s *Settings) value {
+			return value{kind: kindDuration, str: s.Timeout.String(), set: s.Timeout != 0}
+		},
+	},
+	{
+		name: "deadline",
+		env:  "GTASK_DEADLINE",
+		kind: kindDuration,
+		set: func(s *Settings, v value) error {
+			d, err := time.ParseDuration(v.str)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid deadline: %s", v.str)
+			}
+			s.Deadline = d
+			return nil
+		},
+		get: func(s *Settings) value {
+			return value{kind: kindDuration, str: s.Deadline.String(), set: s.Deadline != 0}
+		},
+	},
+	{
+		name: "retries",
+		env:  "GTASK_RETRIES",
+		kind: kindInt,
+		set: func(s *Settings, v value) error {
+			if v.num < 0 {
+				return fmt.Errorf("invalid retries: %d", v.num)
+			}
+			s.Retries = v.num
+			return nil
+		},
+		get: func(s *Settings) value { return value{kind: kindInt, num: s.Retries, set: s.Retries != 0} },
+	},
+	{
+		name: "rate_limit",
+		env:  "GTASK_RATE_LIMIT",
+		kind: kindInt,
+		set: func(s *Settings, v value) error {
+			if v.num < 1 {
+				return fmt.Errorf("invalid rate_limit: %d", v.num)
+			}
+			s.RateLimit = v.num
+			return nil
+		},
+		get: func(s *Settings) value { return value{kind: kindInt, num: s.RateLimit, set: s.RateLimit != 0} },
+	},
+	{
+		name: "hidden_lists",
+		env:  "GTASK_HIDDEN_LISTS",
+		kind: kindList,
+		set:  func(s *Settings, v value) error { s.HiddenLists = v.list; return nil },
+		get: func(s *Settings) value {
+			return value{kind: kindList, list: s.HiddenLists, set: len(s.HiddenLists) > 0}
+		},
+	},
+	{
+		name: "color",
+		env:  "GTASK_COLOR",
+		kind: kindString,
+		set: func(s *Settings, v value) error {
+			switch v.str {
+			case ColorAuto, ColorAlways, ColorNever:
+				s.Color = v.str
+				return nil
+			}
+			return fmt.Errorf("invalid color: %s (want %s, %s or %s)", v.str, ColorAuto, ColorAlways, ColorNever)
+		},
+		get: func(s *Settings) value { return value{kind: kindString, str: s.Color, set: s.Color != ""} },
+	},
+	{
+		name: "token_store",
+		env:  "GTASK_TOKEN_STORE",
+		kind: kindString,
+		set: func(s *Settings, v value) error {
+			if v.str != TokenStoreFile && v.str != TokenStoreEncrypted {
+				return fmt.Errorf("invalid token_store: %s (want %s or %s)", v.str, TokenStoreFile, TokenStoreEncrypted)
+			}
+			s.TokenStore = v.str
+			return nil
+		},
+		get: func(s *Settings) value {
+			return value{kind: kindString, str: s.TokenStore, set: s.TokenStore != ""}
+		},
+	},
+	{
+		name: "passphrase_file",
+		env:  "GTASK_PASSPHRASE_FILE",
+		kind: kindString,
+		set:  func(s *Settings, v value) error { s.PassphraseFile = v.str; return nil },
+		get: func(s *Settings) value {
+			return value{kind: kindString, str: s.PassphraseFile, set: s.PassphraseFile != ""}
+		},
+	},
+	{
+		name: "passphrase_command",
+		env:  "GTASK_PASSPHRASE_COMMAND",
+		kind: kindString,
+		set:  func(s *Settings, v value) error { s.PassphraseCommand = v.str; return nil },
+		get: func(s *Settings) value {
+			return value{kind: kindString, str: s.PassphraseCommand, set: s.PassphraseCommand != ""}
+		},
+	},
+}
+
+// findKey looks up a settings key. Keys of the form flags.<command> are
+// per-command default flags.
+func findKey(name string) (settingKey, error) {
+	if cmd, ok := strings.CutPrefix(name, flagsSection+"."); ok {
+		if cmd == "" {
+			return settingKey{}, fmt.Errorf("unknown key: %s", name)
+		}
+		return settingKey{
+			name: cmd,
+			kind: kindList,
+			set: func(s *Settings, v value) error {
+				if s.Flags == nil {
+					s.Flags = make(map[string][]string)
+				}
+				s.Flags[cmd] = v.list
+				return nil
+			},
+			get: func(s *Settings) value {
+				return value{kind: kindList, list: s.Flags[cmd], set: len(s.Flags[cmd]) > 0}
+			},
+		}, nil
+	}
+	for _, k := range settingKeys {
+		if k.name == name {
+			return k, nil
+		}
+	}
+	return settingKey{}, fmt.Errorf("unknown key: %s", name)
+}
+
+// SettingsPath returns the path to config.toml.
+func (c *Config) SettingsPath() string {
+	return filepath.Join(c.Dir, SettingsFile)
+}
+
+// LoadSettings reads config.toml into c.Settings and applies the GTASK_*
+// environment variables on top. A missing file leaves only the
+// environment.
+func (c *Config) LoadSettings() error {
+	s, err := ReadSettings(c.SettingsPath())
+	if err != nil {
+		return err
+	}
+	if err := s.ApplyEnv(os.Environ()); err != nil {
+		return err
+	}
+	c.Settings = *s
+	return nil
+}
+
+// ApplyEnv overrides settings with environment variables from environ
+// ("KEY=value" pairs, as returned by os.Environ). Every top-level key has a
+// variable (GTASK_LIST for default_list, otherwise GTASK_<KEY>);
+// GTASK_FLAGS_<COMMAND> replaces the [flags] entry of a command. Empty
+// variables are ignored.
+func (s *Settings) ApplyEnv(environ []string) error {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && v != "" {
+			env[k] = v
+		}
+	}
+
+	apply := func(key, name, raw string) error {
+		k, err := findKey(key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		v, err := parseRaw(k, key, raw)
+		if err == nil {
+			err = k.set(s, v)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if s.fromEnv == nil {
+			s.fromEnv = make(map[string]bool)
+		}
+		s.fromEnv[key] = true
+		return nil
+	}
+
+	for _, k := range settingKeys {
+		if raw, ok := env[k.env]; ok {
+			if err := apply(k.name, k.env, raw); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Sorted, so that errors are reported deterministically
+	var names []string
+	for name := range env {
+		if strings.HasPrefix(name, EnvFlagsPrefix) && len(name) > len(EnvFlagsPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := strings.ToLower(strings.TrimPrefix(name, EnvFlagsPrefix))
+		if err := apply(flagsSection+"."+cmd, name, env[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSettings parses a settings file. A missing file yields empty
+// settings. Errors name the file and line.
+func ReadSettings(path string) (*Settings, error) {
+	var s Settings
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", SettingsFile, err)
+	}
+
+	doc, err := parseTOML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	for _, e := range doc.entries {
+		name := e.key
+		if e.section != "" {
+			name = e.section + "." + e.key
+		}
+		if err := applySetting(&s, name, e.value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, e.line, err)
+		}
+	}
+	return &s, nil
+}
+
+// applySetting assigns one parsed value, checking its type.
+func applySetting(s *Settings, name string, v value) error {
+	if section, _, ok := strings.Cut(name, "."); ok && section != flagsSection {
+		return fmt.Errorf("unknown section: %s", section)
+	}
+	k, err := findKey(name)
+	if err != nil {
+		return err
+	}
+	// Durations are written as strings; a flags entry may be one string
+	switch {
+	case k.kind == kindDuration && v.kind == kindString:
+		v.kind = kindDuration
+	case k.kind == kindList && v.kind == kindString && strings.Contains(name, "."):
+		v = value{kind: kindList, list: strings.Fields(v.str)}
+	}
+	if v.kind != k.kind {
+		return fmt.Errorf("%s: expected %s", name, k.kind)
+	}
+	return k.set(s, v)
+}
+
+// GetSetting returns the value of key in s formatted for the command
+// line, and whether it is set.
+func GetSetting(s *Settings, key string) (string, bool, error) {
+	k, err := findKey(key)
+	if err != nil {
+		return "", false, err
+	}
+	v := k.get(s)
+	if !v.set {
+		return "", false, nil
+	}
+	switch v.kind {
+	case kindInt:
+		return strconv.Itoa(v.num), true, nil
+	case kindList:
+		if strings.HasPrefix(key, flagsSection+".") {
+			return strings.Join(v.list, " "), true, nil
+		}
+		return strings.Join(v.list, ","), true, nil
+	}
+	return v.str, true, nil
+}
+
+// SettingKeys returns the keys set in s, top-level keys first in
+// documentation order, then flags.<command> sorted.
+func SettingKeys(s *Settings) []string {
+	var keys []string
+	for _, k := range settingKeys {
+		if k.get(s).set {
+			keys = append(keys, k.name)
+		}
+	}
+	var cmds []string
+	for cmd, flags := range s.Flags {
+		if len(flags) > 0 {
+			cmds = append(cmds, flagsSection+"."+cmd)
+		}
+	}
+	sort.Strings(cmds)
+	return append(keys, cmds...)
+}
+
+// SetSetting validates raw as the value of key and writes it to the
+// settings file at path, keeping comments and the other lines. See
+// parseRaw for the format of raw.
+func SetSetting(path, key, raw string) error {
+	k, err := findKey(key)
+	if err != nil {
+		return err
+	}
+	v, err := parseRaw(k, key, raw)
+	if err != nil {
+		return err
+	}
+
+	// Validate against the current file so the result stays loadable
+	s, err := ReadSettings(path)
+	if err != nil {
+		return err
+	}
+	if err := k.set(s, v); err != nil {
+		return err
+	}
+
+	section, name := splitKey(key)
+	return editSettings(path, func(doc *tomlDoc) {
+		doc.set(section, name, v.toml())
+	})
+}
+
+// parseRaw converts a value given on the command line or in the
+// environment. Lists are comma-separated; flags.<command> takes flags
+// separated by spaces.
+func parseRaw(k settingKey, key, raw string) (value, error) {
+	switch k.kind {
+	case kindInt:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return value{}, fmt.Errorf("%s: expected %s", key, k.kind)
+		}
+		return value{kind: kindInt, num: n}, nil
+	case kindList:
+		if strings.HasPrefix(key, flagsSection+".") {
+			return value{kind: kindList, list: strings.Fields(raw)}, nil
+		}
+		return value{kind: kindList, list: splitList(raw)}, nil
+	}
+	return value{kind: k.kind, str: strings.TrimSpace(raw)}, nil
+}
+
+// UnsetSetting removes key from the settings file at path.
+func UnsetSetting(path, key string) error {
+	if _, err := findKey(key); err != nil {
+		return err
+	}
+	if _, err := ReadSettings(path); err != nil {
+		return err
+	}
+	section, name := splitKey(key)
+	return editSettings(path, func(doc *tomlDoc) {
+		doc.unset(section, name)
+	})
+}
+
+// editSettings rewrites the settings file through fn under a lock.
+func editSettings(path string, fn func(*tomlDoc)) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	unlock, err := fsutil.Lock(path)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", SettingsFile, err)
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", SettingsFile, err)
+	}
+	doc, err := parseTOML(string(data))
+	if err != nil {
+		return fmt.Errorf("%s:%w", path, err)
+	}
+	fn(doc)
+	return fsutil.WriteFileAtomic(path, []byte(doc.String()), 0600)
+}
+
+func splitKey(key string) (section, name string) {
+	if cmd, ok := strings.CutPrefix(key, flagsSection+"."); ok {
+		return flagsSection, cmd
+	}
+	return "", key
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(raw string) []string {
+	var list []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (k settingKind) String() string {
+	switch k {
+	case kindInt:
+		return "an integer"
+	case kindDuration:
+		return "a duration string (e.g. \"10s\")"
+	case kindList:
+		return "a list of strings"
+	}
+	return "a string"
+}
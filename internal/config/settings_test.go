@@ -0,0 +1,248 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeSettings(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), SettingsFile)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadSettings(t *testing.T) {
+	path := writeSettings(t, `# gtask settings
+default_list = "Work"   # used by add
+format = 'json'
+page_size = 20
+timeout = "10s"
+retries = 3
+hidden_lists = ["Archive", "Some \"day\"",]
+color = "never"
+
+[flags]
+list = ["--all"]
+rm = "--list Work"
+`)
+
+	s, err := ReadSettings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Settings{
+		DefaultList: "Work",
+		Format:      FormatJSON,
+		PageSize:    20,
+		Timeout:     10 * time.Second,
+		Retries:     3,
+		HiddenLists: []string{"Archive", `Some "day"`},
+		Color:       ColorNever,
+		Flags:       map[string][]string{"list": {"--all"}, "rm": {"--list", "Work"}},
+	}
+	if !reflect.DeepEqual(*s, want) {
+		t.Errorf("unexpected settings:\n got %+v\nwant %+v", *s, want)
+	}
+}
+
+func TestReadSettings_MissingFile(t *testing.T) {
+	s, err := ReadSettings(filepath.Join(t.TempDir(), SettingsFile))
+	if err != nil || !reflect.DeepEqual(*s, Settings{}) {
+		t.Errorf("expected empty settings, got %+v, %v", s, err)
+	}
+}
+
+func TestReadSettings_Errors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"page_size = 20\nfont = \"x\"\n", ":2: unknown key: font"},
+		{"page_size = \"20\"\n", ":1: page_size: expected an integer"},
+		{"page_size = 0\n", ":1: invalid page_size: 0"},
+		{"format = \"yaml\"\n", ":1: invalid format: yaml (want text or json)"},
+		{"timeout = \"soon\"\n", ":1: invalid timeout: soon"},
+		{"deadline = \"0s\"\n", ":1: invalid deadline: 0s"},
+		{"rate_limit = 0\n", ":1: invalid rate_limit: 0"},
+		{"color = \"blue\"\n", ":1: invalid color: blue"},
+		{"hidden_lists = [\"a\"\n", ":1: hidden_lists: expected , or ] in array"},
+		{"default_list = \"Work\n", ":1: default_list: unterminated string"},
+		{"default_list\n", ":1: expected key = value"},
+		{"[ui]\ncolor = \"auto\"\n", ":2: unknown section: ui"},
+		{"retries = 1\nretries = 2\n", ":2: duplicate key: retries"},
+		{"retries = 1 2\n", ":1: retries: unexpected text after value"},
+		{"retries = true\n", ":1: retries: unsupported value: true"},
+	}
+	for _, tt := range tests {
+		path := writeSettings(t, tt.content)
+		_, err := ReadSettings(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected error containing %q, got %v", tt.content, tt.want, err)
+		}
+	}
+}
+
+func TestSettings_CommandFlags(t *testing.T) {
+	s := Settings{
+		DefaultList: "Work",
+		PageSize:    20,
+		Flags:       map[string][]string{"add": {"--list", "Home"}, "list": {"--all"}},
+	}
+
+	// Entries in [flags] come after the top-level settings, so they win
+	if got := s.CommandFlags("add"); !reflect.DeepEqual(got, []string{"--list", "Work", "--list", "Home"}) {
+		t.Errorf("unexpected add flags: %q", got)
+	}
+	if got := s.CommandFlags("create"); !reflect.DeepEqual(got, []string{"--list", "Work"}) {
+		t.Errorf("unexpected create flags: %q", got)
+	}
+	if got := s.CommandFlags("list"); !reflect.DeepEqual(got, []string{"--page-size", "20", "--all"}) {
+		t.Errorf("unexpected list flags: %q", got)
+	}
+	if got := s.CommandFlags("done"); len(got) != 0 {
+		t.Errorf("expected no done flags, got %q", got)
+	}
+}
+
+func TestSetSetting_KeepsCommentsAndLayout(t *testing.T) {
+	path := writeSettings(t, `# my settings
+format = "json" # for scripts
+
+[flags]
+# always everything
+list = ["--all"]
+`)
+
+	steps := []struct{ key, value string }{
+		{"format", "text"},
+		{"page_size", "50"},
+		{"hidden_lists", "Archive, Someday"},
+		{"flags.add", "--list Work"},
+	}
+	for _, step := range steps {
+		if err := SetSetting(path, step.key, step.value); err != nil {
+			t.Fatalf("set %s: %v", step.key, err)
+		}
+	}
+	if err := UnsetSetting(path, "flags.list"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	want := `# my settings
+format = "text"
+page_size = 50
+hidden_lists = ["Archive", "Someday"]
+
+[flags]
+# always everything
+add = ["--list", "Work"]
+`
+	if string(data) != want {
+		t.Errorf("unexpected file:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestSetSetting_NewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile", SettingsFile)
+
+	if err := SetSetting(path, "flags.list", "--all"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSetting(path, "default_list", `Work "A"`); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	want := "default_list = \"Work \\\"A\\\"\"\n\n[flags]\nlist = [\"--all\"]\n"
+	if string(data) != want {
+		t.Errorf("unexpected file:\n%q\nwant:\n%q", data, want)
+	}
+	s, err := ReadSettings(path)
+	if err != nil || s.DefaultList != `Work "A"` {
+		t.Errorf("expected the file to read back, got %+v, %v", s, err)
+	}
+}
+
+func TestSetSetting_Rejects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SettingsFile)
+
+	for _, tt := range []struct{ key, value, want string }{
+		{"font", "x", "unknown key: font"},
+		{"retries", "many", "retries: expected an integer"},
+		{"color", "blue", "invalid color: blue"},
+	} {
+		if err := SetSetting(path, tt.key, tt.value); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("set %s=%s: expected %q, got %v", tt.key, tt.value, tt.want, err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no file after rejected changes, got %v", err)
+	}
+}
+
+func TestSettings_ApplyEnv(t *testing.T) {
+	s := Settings{DefaultList: "Work", PageSize: 20, Format: FormatJSON}
+	err := s.ApplyEnv([]string{
+		"HOME=/home/me",
+		"GTASK_LIST=Home",
+		"GTASK_TIMEOUT=30s",
+		"GTASK_HIDDEN_LISTS=Archive, Someday",
+		"GTASK_FORMAT=",
+		"GTASK_FLAGS_LIST=--all --page-size 5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.DefaultList != "Home" || s.Timeout != 30*time.Second || s.PageSize != 20 || s.Format != FormatJSON {
+		t.Errorf("unexpected settings: %+v", s)
+	}
+	if !reflect.DeepEqual(s.HiddenLists, []string{"Archive", "Someday"}) {
+		t.Errorf("unexpected hidden lists: %q", s.HiddenLists)
+	}
+
+	// The environment comes after config.toml: page_size from the file,
+	// then GTASK_FLAGS_LIST
+	if got := s.CommandFlags("list"); !reflect.DeepEqual(got, []string{"--page-size", "20", "--all", "--page-size", "5"}) {
+		t.Errorf("unexpected list flags: %q", got)
+	}
+	if s.FlagsOrigin("list") != "GTASK_FLAGS_LIST" || s.FlagsOrigin("add") != SettingsFile {
+		t.Errorf("unexpected flags origins: %s, %s", s.FlagsOrigin("list"), s.FlagsOrigin("add"))
+	}
+}
+
+func TestSettings_EnvListOverridesFileFlags(t *testing.T) {
+	s := Settings{Flags: map[string][]string{"add": {"-l", "Work"}}}
+	if err := s.ApplyEnv([]string{"GTASK_LIST=Home"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.CommandFlags("add"); !reflect.DeepEqual(got, []string{"-l", "Work", "--list", "Home"}) {
+		t.Errorf("unexpected add flags: %q", got)
+	}
+}
+
+func TestSettings_ApplyEnvErrors(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{"GTASK_PAGE_SIZE=lots", "GTASK_PAGE_SIZE: page_size: expected an integer"},
+		{"GTASK_TIMEOUT=-1s", "GTASK_TIMEOUT: invalid timeout: -1s"},
+		{"GTASK_COLOR=blue", "GTASK_COLOR: invalid color: blue"},
+	}
+	for _, tt := range tests {
+		var s Settings
+		if err := s.ApplyEnv([]string{tt.env}); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q, got %v", tt.env, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file implements the subset of TOML used by config.toml: comments,
+// [section] headers, and key = value lines whose value is a string, an
+// integer or a one-line array of strings. Documents keep their original
+// lines so that edits preserve comments and layout.
+
+// value is a parsed TOML value.
+type value struct {
+	kind settingKind
+	str  string
+	num  int
+	list []string
+
+	// set reports whether a setting has a value (see settingKey.get).
+	set bool
+}
+
+// toml renders v as a TOML value.
+func (v value) toml() string {
+	switch v.kind {
+	case kindInt:
+		return strconv.Itoa(v.num)
+	case kindList:
+		quoted := make([]string, len(v.list))
+		for i, s := range v.list {
+			quoted[i] = quoteTOML(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	return quoteTOML(v.str)
+}
+
+// tomlLine is one line of a document.
+type tomlLine struct {
+	text    string
+	section string // section the line belongs to
+	key     string // set for key = value lines
+	header  bool   // set for [section] lines
+}
+
+// tomlEntry is a parsed key = value line.
+type tomlEntry struct {
+	section string
+	key     string
+	value   value
+	line    int
+}
+
+// tomlDoc is a parsed document.
+type tomlDoc struct {
+	lines   []tomlLine
+	entries []tomlEntry
+}
+
+// parseTOML parses a document. Errors start with the line number.
+func parseTOML(data string) (*tomlDoc, error) {
+	doc := &tomlDoc{}
+	if data == "" {
+		return doc, nil
+	}
+
+	section := ""
+	seen := make(map[string]bool)
+	for i, text := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		n := i + 1
+		text = strings.TrimSuffix(text, "\r")
+		line := strings.TrimSpace(text)
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			doc.lines = append(doc.lines, tomlLine{text: text, section: section})
+
+		case strings.HasPrefix(line, "["):
+			end := strings.Index(line, "]")
+			if strings.HasPrefix(line, "[[") || end < 0 || !isComment(line[end+1:]) {
+				return nil, fmt.Errorf("%d: invalid section header", n)
+			}
+			name := strings.TrimSpace(line[1:end])
+			if !isBareKey(name) {
+				return nil, fmt.Errorf("%d: invalid section name: %s", n, name)
+			}
+			if seen["["+name] {
+				return nil, fmt.Errorf("%d: duplicate section: %s", n, name)
+			}
+			seen["["+name] = true
+			section = name
+			doc.lines = append(doc.lines, tomlLine{text: text, section: section, header: true})
+
+		default:
+			key, rest, ok := strings.Cut(line, "=")
+			key = strings.TrimSpace(key)
+			if !ok || !isBareKey(key) {
+				return nil, fmt.Errorf("%d: expected key = value", n)
+			}
+			v, rest, err := parseValue(strings.TrimSpace(rest))
+			if err != nil {
+				return nil, fmt.Errorf("%d: %s: %w", n, key, err)
+			}
+			if !isComment(rest) {
+				return nil, fmt.Errorf("%d: %s: unexpected text after value", n, key)
+			}
+			if seen[section+"."+key] {
+				return nil, fmt.Errorf("%d: duplicate key: %s", n, key)
+			}
+			seen[section+"."+key] = true
+			doc.lines = append(doc.lines, tomlLine{text: text, section: section, key: key})
+			doc.entries = append(doc.entries, tomlEntry{section: section, key: key, value: v, line: n})
+		}
+	}
+	return doc, nil
+}
+
+// parseValue parses the value at the start of s and returns the rest.
+func parseValue(s string) (value, string, error) {
+	switch {
+	case s == "":
+		return value{}, "", fmt.Errorf("missing value")
+	case s[0] == '"' || s[0] == '\'':
+		str, rest, err := parseString(s)
+		return value{kind: kindString, str: str}, rest, err
+	case s[0] == '[':
+		return parseArray(s[1:])
+	}
+
+	end := strings.IndexAny(s, " \t#")
+	if end < 0 {
+		end = len(s)
+	}
+	n, err := strconv.Atoi(strings.ReplaceAll(s[:end], "_", ""))
+	if err != nil {
+		return value{}, "", fmt.Errorf("unsupported value: %s", s[:end])
+	}
+	return value{kind: kindInt, num: n}, s[end:], nil
+}
+
+// parseString parses a basic ("...") or literal ('...') string.
+func parseString(s string) (string, string, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), s[i+1:], nil
+		case c == '\\' && quote == '"':
+			i++
+			if i == len(s) {
+				return "", "", fmt.Errorf("unterminated string")
+			}
+			switch s[i] {
+			case '"', '\\':
+				b.WriteByte(s[i])
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				return "", "", fmt.Errorf("unsupported escape: \\%c", s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// parseArray parses a one-line array of strings after its "[".
+func parseArray(s string) (value, string, error) {
+	var list []string
+	for {
+		s = strings.TrimSpace(s)
+		if strings.HasPrefix(s, "]") {
+			return value{kind: kindList, list: list}, s[1:], nil
+		}
+		if s == "" || (s[0] != '"' && s[0] != '\'') {
+			return value{}, "", fmt.Errorf("expected a one-line array of strings")
+		}
+		str, rest, err := parseString(s)
+		if err != nil {
+			return value{}, "", err
+		}
+		list = append(list, str)
+
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, ",") {
+			rest = rest[1:]
+		} else if !strings.HasPrefix(rest, "]") {
+			return value{}, "", fmt.Errorf("expected , or ] in array")
+		}
+		s = rest
+	}
+}
+
+// set replaces the value of key in section, or adds it at the end of the
+// section (creating the section if needed).
+func (d *tomlDoc) set(section, key, val string) {
+	text := key + " = " + val
+	for i, l := range d.lines {
+		if l.section == section && l.key == key {
+			d.lines[i].text = text
+			return
+		}
+	}
+
+	line := tomlLine{text: text, section: section, key: key}
+	last := -1
+	for i, l := range d.lines {
+		if l.section == section && (l.key != "" || l.header) {
+			last = i
+		}
+	}
+	if last < 0 {
+		if section == "" {
+			// Top-level keys must precede the first section
+			for i, l := range d.lines {
+				if l.header {
+					d.lines = append(d.lines[:i], append([]tomlLine{line, {}}, d.lines[i:]...)...)
+					return
+				}
+			}
+			d.lines = append(d.lines, line)
+			return
+		}
+		if len(d.lines) > 0 {
+			d.lines = append(d.lines, tomlLine{})
+		}
+		d.lines = append(d.lines, tomlLine{text: "[" + section + "]", section: section, header: true})
+		d.lines = append(d.lines, line)
+		return
+	}
+	d.lines = append(d.lines[:last+1], append([]tomlLine{line}, d.lines[last+1:]...)...)
+}
+
+// unset removes key from section.
+func (d *tomlDoc) unset(section, key string) {
+	for i, l := range d.lines {
+		if l.section == section && l.key == key {
+			d.lines = append(d.lines[:i], d.lines[i+1:]...)
+			return
+		}
+	}
+}
+
+// String renders the document.
+func (d *tomlDoc) String() string {
+	var b strings.Builder
+	for _, l := range d.lines {
+		b.WriteString(l.text)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// quoteTOML renders s as a TOML basic string.
+func quoteTOML(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// isComment reports whether s is empty or a comment.
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "#")
+}
+
+// isBareKey reports whether s is a valid bare TOML key.
+func isBareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,206 @@
+// Package outbox queues task mutations made while the backend is unreachable
+// and replays them later with `gtask sync`.
+//
+// The queue is a JSON file in the config directory. It is written atomically
+// under a file lock, so concurrent gtask processes can append safely.
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gtask/internal/fsutil"
+)
+
+// Kind identifies a queued mutation.
+type Kind string
+
+const (
+	// CreateTask creates a task with Title in ListID.
+	CreateTask Kind = "create_task"
+
+	// CompleteTask marks TaskID in ListID completed.
+	CompleteTask Kind = "complete_task"
+
+	// DeleteTask deletes TaskID from ListID.
+	DeleteTask Kind = "delete_task"
+)
+
+// LocalIDPrefix marks task IDs of tasks created offline that do not exist
+// on the backend yet.
+const LocalIDPrefix = "local:"
+
+// Op is a single queued mutation.
+type Op struct {
+	Seq      int       `json:"seq"`
+	Kind     Kind      `json:"kind"`
+	ListID   string    `json:"list_id"`
+	TaskID   string    `json:"task_id,omitempty"`
+	Title    string    `json:"title"`
+	QueuedAt time.Time `json:"queued_at"`
+
+	// Completed marks a CreateTask op whose task was completed before it
+	// was synced: replaying creates the task and then completes it.
+	Completed bool `json:"completed,omitempty"`
+
+	// Sent marks a CreateTask op whose request was sent but not answered
+	// (the backend went offline or the request timed out), so the task may
+	// exist. Before holds the IDs of the list's open tasks at that time:
+	// the next sync creates the task only if no new task with the title
+	// has appeared since.
+	Sent   bool     `json:"sent,omitempty"`
+	Before []string `json:"before,omitempty"`
+}
+
+// LocalTaskID returns the placeholder ID of the task created by a CreateTask op.
+func (op Op) LocalTaskID() string {
+	return fmt.Sprintf("%s%d", LocalIDPrefix, op.Seq)
+}
+
+// Describe returns a short human-readable description for sync reports.
+func (op Op) Describe() string {
+	switch op.Kind {
+	case CreateTask:
+		if op.Completed {
+			return fmt.Sprintf("add %q (done)", op.Title)
+		}
+		return fmt.Sprintf("add %q", op.Title)
+	case CompleteTask:
+		return fmt.Sprintf("done %q", op.Title)
+	case DeleteTask:
+		return fmt.Sprintf("rm %q", op.Title)
+	}
+	return string(op.Kind)
+}
+
+// IsLocalID reports whether taskID refers to a task created offline.
+func IsLocalID(taskID string) bool {
+	return strings.HasPrefix(taskID, LocalIDPrefix)
+}
+
+// file is the on-disk layout.
+type file struct {
+	NextSeq int  `json:"next_seq"`
+	Ops     []Op `json:"ops"`
+}
+
+// Box is a durable queue of mutations stored at a path.
+type Box struct {
+	path string
+}
+
+// Open returns the outbox stored at path. The file is created on first write.
+func Open(path string) *Box {
+	return &Box{path: path}
+}
+
+// Path returns the outbox file path.
+func (b *Box) Path() string {
+	return b.path
+}
+
+// Ops returns the queued operations in order.
+func (b *Box) Ops() ([]Op, error) {
+	f, err := b.read()
+	if err != nil {
+		return nil, err
+	}
+	return f.Ops, nil
+}
+
+// Append queues op, assigning its sequence number and timestamp.
+// Returns the stored op.
+func (b *Box) Append(op Op) (Op, error) {
+	err := b.modify(func(f *file) {
+		f.NextSeq++
+		op.Seq = f.NextSeq
+		if op.QueuedAt.IsZero() {
+			op.QueuedAt = time.Now().UTC()
+		}
+		f.Ops = append(f.Ops, op)
+	})
+	return op, err
+}
+
+// Remove deletes the ops with the given sequence numbers.
+func (b *Box) Remove(seqs ...int) error {
+	drop := make(map[int]bool, len(seqs))
+	for _, seq := range seqs {
+		drop[seq] = true
+	}
+	return b.modify(func(f *file) {
+		kept := f.Ops[:0]
+		for _, op := range f.Ops {
+			if !drop[op.Seq] {
+				kept = append(kept, op)
+			}
+		}
+		f.Ops = kept
+	})
+}
+
+// Update applies fn to the queued op with sequence number seq. It reports
+// whether the op was still queued.
+func (b *Box) Update(seq int, fn func(*Op)) (bool, error) {
+	found := false
+	err := b.modify(func(f *file) {
+		for i := range f.Ops {
+			if f.Ops[i].Seq == seq {
+				fn(&f.Ops[i])
+				found = true
+			}
+		}
+	})
+	return found, err
+}
+
+// read loads the outbox file. A missing file is an empty outbox.
+func (b *Box) read() (*file, error) {
+	data, err := os.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return &file{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid outbox %s: %w", b.path, err)
+	}
+	return &f, nil
+}
+
+// modify applies fn to the outbox under an exclusive lock.
+// The file is removed once the last op is gone.
+func (b *Box) modify(fn func(*file)) error {
+	if err := os.MkdirAll(filepath.Dir(b.path), 0700); err != nil {
+		return err
+	}
+	unlock, err := fsutil.Lock(b.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := b.read()
+	if err != nil {
+		return err
+	}
+	fn(f)
+
+	if len(f.Ops) == 0 {
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(b.path, data, 0600)
+}
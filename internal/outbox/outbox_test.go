@@ -0,0 +1,485 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gtask/internal/cache"
+	"gtask/internal/config"
+	"gtask/internal/service"
+	"gtask/internal/service/servicetest"
+	"gtask/internal/testutil"
+)
+
+func newTestService(t *testing.T, fake *testutil.FakeService, offline bool) *Service {
+	t.Helper()
+	cfg := &config.Config{Dir: t.TempDir(), Offline: offline}
+	return New(fake, cfg)
+}
+
+func titles(tasks []service.Task) []string {
+	var result []string
+	for _, task := range tasks {
+		result = append(result, task.Title)
+	}
+	return result
+}
+
+func TestService_QueuesWhenUnavailable(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.AddTask("@default", "t1", "Existing")
+	fake.CreateTaskErr = service.Unavailable(errors.New("network is unreachable"))
+	svc := newTestService(t, fake, false)
+	ctx := context.Background()
+
+	if err := svc.CreateTask(ctx, "@default", "Written on a train"); err != nil {
+		t.Fatalf("expected queued create to succeed, got %v", err)
+	}
+	if svc.Queued() != 1 {
+		t.Errorf("expected 1 queued change, got %d", svc.Queued())
+	}
+
+	tasks, err := svc.ListOpenTasks(ctx, "@default", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := titles(tasks)
+	if len(got) != 2 || got[0] != "Existing" || got[1] != "Written on a train" {
+		t.Errorf("expected optimistic view, got %v", got)
+	}
+}
+
+func TestService_NonNetworkErrorsAreNotQueued(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.CreateTaskErr = errors.New("token expired or revoked")
+	svc := newTestService(t, fake, false)
+
+	if err := svc.CreateTask(context.Background(), "@default", "Task"); err == nil {
+		t.Fatal("expected error to be returned")
+	}
+	if svc.Queued() != 0 {
+		t.Errorf("expected nothing queued, got %d", svc.Queued())
+	}
+}
+
+func TestService_OfflineCompleteHidesTask(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.AddTask("@default", "t1", "First")
+	fake.AddTask("@default", "t2", "Second")
+	svc := newTestService(t, fake, true)
+	ctx := context.Background()
+
+	if err := svc.CompleteTask(ctx, "@default", "t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Backend untouched, but the view reflects the change
+	backendTasks, _ := fake.ListOpenTasks(ctx, "@default", 1)
+	if len(backendTasks) != 2 {
+		t.Errorf("expected backend unchanged in offline mode, got %d tasks", len(backendTasks))
+	}
+	tasks, _ := svc.ListOpenTasks(ctx, "@default", 1)
+	if got := titles(tasks); len(got) != 1 || got[0] != "Second" {
+		t.Errorf("expected only 'Second' visible, got %v", got)
+	}
+
+	ops, _ := svc.box.Ops()
+	if len(ops) != 1 || ops[0].Title != "First" {
+		t.Errorf("expected queued op to record the title, got %+v", ops)
+	}
+}
+
+func TestService_RemovingLocalTaskDropsCreate(t *testing.T) {
+	fake := testutil.NewFakeService()
+	svc := newTestService(t, fake, true)
+	ctx := context.Background()
+
+	svc.CreateTask(ctx, "@default", "Oops")
+	tasks, _ := svc.ListOpenTasks(ctx, "@default", 1)
+	if len(tasks) != 1 || !IsLocalID(tasks[0].ID) {
+		t.Fatalf("expected one local task, got %+v", tasks)
+	}
+
+	if err := svc.DeleteTask(ctx, "@default", tasks[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	ops, _ := svc.box.Ops()
+	if len(ops) != 0 {
+		t.Errorf("expected empty outbox, got %+v", ops)
+	}
+
+	// The task is gone now, as a deleted task is on any backend
+	for _, err := range []error{
+		svc.DeleteTask(ctx, "@default", tasks[0].ID),
+		svc.CompleteTask(ctx, "@default", tasks[0].ID),
+	} {
+		if !errors.Is(err, service.ErrConflict) {
+			t.Errorf("expected a not found conflict, got %v", err)
+		}
+	}
+}
+
+func TestService_CompletingLocalTaskKeepsCreate(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.AddTask("@default", "m0", "Milk")
+	svc := newTestService(t, fake, true)
+	ctx := context.Background()
+
+	svc.CreateTask(ctx, "@default", "Milk")
+	tasks, _ := svc.ListOpenTasks(ctx, "@default", 1)
+	if len(tasks) != 2 || !IsLocalID(tasks[1].ID) {
+		t.Fatalf("expected the local task after the existing one, got %+v", tasks)
+	}
+	if err := svc.CompleteTask(ctx, "@default", tasks[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, _ := svc.ListOpenTasks(ctx, "@default", 1); len(tasks) != 1 || tasks[0].ID != "m0" {
+		t.Errorf("expected the completed local task hidden, got %+v", tasks)
+	}
+	ops, _ := svc.box.Ops()
+	if len(ops) != 1 || !ops[0].Completed || ops[0].Describe() != `add "Milk" (done)` {
+		t.Fatalf("expected the creation queued as completed, got %+v", ops)
+	}
+
+	// Completing fails after the create: the retry must not create it again
+	fake.CompleteTaskErr = service.Unavailable(errors.New("no route to host"))
+	if _, err := Replay(ctx, svc.box, fake); !errors.Is(err, service.ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+	ops, _ = svc.box.Ops()
+	if len(ops) != 1 || ops[0].Kind != CompleteTask || ops[0].TaskID != "milk" {
+		t.Fatalf("expected a queued completion of the created task, got %+v", ops)
+	}
+
+	fake.CompleteTaskErr = nil
+	if results, err := Replay(ctx, svc.box, fake); err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected replay results %+v, %v", results, err)
+	}
+	tasks, _ = fake.ListOpenTasks(ctx, "@default", 1)
+	if len(tasks) != 1 || tasks[0].ID != "m0" {
+		t.Errorf("expected only the existing task open, got %+v", tasks)
+	}
+}
+
+// listsFailingAfter fails every ListOpenTasks call after the first n.
+type listsFailingAfter struct {
+	service.Service
+	n   int
+	err error
+}
+
+func (l *listsFailingAfter) ListOpenTasks(ctx context.Context, listID string, page int) ([]service.Task, error) {
+	if l.n == 0 {
+		return nil, l.err
+	}
+	l.n--
+	return l.Service.ListOpenTasks(ctx, listID, page)
+}
+
+func TestReplay_CreatedTaskIsNotCreatedAgain(t *testing.T) {
+	fake := testutil.NewFakeService()
+	box := Open(filepath.Join(t.TempDir(), "outbox.json"))
+	ctx := context.Background()
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "Milk", Completed: true})
+
+	// The backend goes offline between the create and the listing after it
+	backend := &listsFailingAfter{Service: fake, n: 1, err: service.Unavailable(errors.New("no route to host"))}
+	results, err := Replay(ctx, box, backend)
+	if err != nil || len(results) != 1 || !results[0].Conflict {
+		t.Fatalf("expected the op reported as a conflict, got %+v, %v", results, err)
+	}
+	if _, err := Replay(ctx, box, fake); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, _ := fake.ListOpenTasks(ctx, "@default", 1); len(tasks) != 1 || tasks[0].Title != "Milk" {
+		t.Errorf("expected the task created once, got %+v", tasks)
+	}
+}
+
+// createsThenTimesOut applies every CreateTask but reports a timeout.
+type createsThenTimesOut struct {
+	service.Service
+}
+
+func (c createsThenTimesOut) CreateTask(ctx context.Context, listID, title string) error {
+	if err := c.Service.CreateTask(ctx, listID, title); err != nil {
+		return err
+	}
+	return service.Unavailable(errors.New("request timed out"))
+}
+
+func TestReplay_UnansweredCreateIsNotSentAgain(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.AddTask("@default", "t1", "Milk")
+	box := Open(filepath.Join(t.TempDir(), "outbox.json"))
+	ctx := context.Background()
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "Milk"})
+
+	_, err := Replay(ctx, box, createsThenTimesOut{fake})
+	if !errors.Is(err, service.ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+	if ops, _ := box.Ops(); len(ops) != 1 || !ops[0].Sent {
+		t.Fatalf("expected the create queued as sent, got %+v", ops)
+	}
+
+	results, err := Replay(ctx, box, fake)
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected replay results %+v, %v", results, err)
+	}
+	tasks, _ := fake.ListOpenTasks(ctx, "@default", 1)
+	if got := titles(tasks); len(got) != 2 {
+		t.Errorf("expected the existing task and one new one, got %v", got)
+	}
+	if ops, _ := box.Ops(); len(ops) != 0 {
+		t.Errorf("expected outbox to be drained, got %+v", ops)
+	}
+}
+
+func TestService_UnansweredCreateIsSyncedOnce(t *testing.T) {
+	fake := testutil.NewFakeService()
+	svc := New(createsThenTimesOut{fake}, &config.Config{Dir: t.TempDir()})
+	ctx := context.Background()
+
+	if err := svc.CreateTask(ctx, "@default", "Milk"); err != nil {
+		t.Fatal(err)
+	}
+	if ops, _ := svc.box.Ops(); len(ops) != 1 || !ops[0].Sent {
+		t.Fatalf("expected the create queued as sent, got %+v", ops)
+	}
+
+	if _, err := Replay(ctx, svc.box, fake); err != nil {
+		t.Fatal(err)
+	}
+	tasks, _ := fake.ListOpenTasks(ctx, "@default", 1)
+	if got := titles(tasks); len(got) != 1 {
+		t.Errorf("expected exactly one task, got %v", got)
+	}
+}
+
+// countingLists counts ListOpenTasks calls.
+type countingLists struct {
+	service.Service
+	lists int
+}
+
+func (c *countingLists) ListOpenTasks(ctx context.Context, listID string, page int) ([]service.Task, error) {
+	c.lists++
+	return c.Service.ListOpenTasks(ctx, listID, page)
+}
+
+func TestReplay_ListsOncePerRunOfCreates(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.AddTask("@default", "t1", "Milk")
+	box := Open(filepath.Join(t.TempDir(), "outbox.json"))
+	ctx := context.Background()
+
+	// Two sent creates of the same title, one of which went through
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "Bread", Sent: true, Before: []string{"t1"}})
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "Bread", Sent: true, Before: []string{"t1"}})
+	fake.CreateTask(ctx, "@default", "Bread")
+	backend := &countingLists{Service: fake}
+	if _, err := Replay(ctx, box, backend); err != nil {
+		t.Fatal(err)
+	}
+	tasks, _ := fake.ListOpenTasks(ctx, "@default", 1)
+	if got := titles(tasks); len(got) != 3 {
+		t.Errorf("expected the second bread created, got %v", got)
+	}
+
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "Eggs"})
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "Butter"})
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "Jam"})
+	backend.lists = 0
+	if _, err := Replay(ctx, box, backend); err != nil {
+		t.Fatal(err)
+	}
+	if backend.lists != 1 {
+		t.Errorf("expected one listing for three creates, got %d", backend.lists)
+	}
+}
+
+func TestReplay_AppliesAndReportsConflicts(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.AddTask("@default", "t1", "Still there")
+	box := Open(filepath.Join(t.TempDir(), "outbox.json"))
+	ctx := context.Background()
+
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "New"})
+	box.Append(Op{Kind: CompleteTask, ListID: "@default", TaskID: "t1", Title: "Still there"})
+	box.Append(Op{Kind: DeleteTask, ListID: "@default", TaskID: "gone", Title: "Deleted elsewhere"})
+
+	results, err := Replay(ctx, box, fake)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0].Conflict || results[1].Conflict || !results[2].Conflict {
+		t.Errorf("expected only the last op to conflict, got %+v", results)
+	}
+
+	tasks, _ := fake.ListOpenTasks(ctx, "@default", 1)
+	if got := titles(tasks); len(got) != 1 || got[0] != "New" {
+		t.Errorf("expected backend to contain only 'New', got %v", got)
+	}
+	ops, _ := box.Ops()
+	if len(ops) != 0 {
+		t.Errorf("expected outbox to be drained, got %+v", ops)
+	}
+}
+
+func TestReplay_KeepsFailedOpsWithoutBlocking(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.AddTask("@default", "t1", "Edited elsewhere")
+	fake.CompleteTaskErr = service.Conflict(errors.New("task was modified on the server"))
+	fake.CreateTaskErr = errors.New("400 Bad Request")
+	box := Open(filepath.Join(t.TempDir(), "outbox.json"))
+	ctx := context.Background()
+
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "Rejected"})
+	box.Append(Op{Kind: "rename_task", ListID: "@default", TaskID: "t1", Title: "Hand-edited"})
+	box.Append(Op{Kind: CompleteTask, ListID: "@default", TaskID: "t1", Title: "Edited elsewhere"})
+	box.Append(Op{Kind: DeleteTask, ListID: "@default", TaskID: "t1", Title: "Edited elsewhere"})
+
+	results, err := Replay(ctx, box, fake)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected every op to be tried, got %+v", results)
+	}
+	if results[0].Err == nil || results[0].Conflict || results[1].Err == nil || results[1].Conflict {
+		t.Errorf("expected the first two ops to fail without conflict, got %+v", results[:2])
+	}
+	if !results[2].Conflict || results[3].Err != nil {
+		t.Errorf("expected a conflict, then the delete applied, got %+v", results[2:])
+	}
+
+	// Only the failed ops stay queued, in order
+	ops, _ := box.Ops()
+	if len(ops) != 2 || ops[0].Title != "Rejected" || ops[1].Title != "Hand-edited" {
+		t.Errorf("expected the failed ops to stay queued, got %+v", ops)
+	}
+}
+
+func TestReplay_StopsAtTheDeadline(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.CreateTaskErr = service.ErrDeadline
+	box := Open(filepath.Join(t.TempDir(), "outbox.json"))
+
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "A"})
+	box.Append(Op{Kind: DeleteTask, ListID: "@default", TaskID: "gone", Title: "B"})
+
+	results, err := Replay(context.Background(), box, fake)
+	if !errors.Is(err, service.ErrDeadline) || len(results) != 0 {
+		t.Fatalf("expected to stop at the deadline, got %+v, %v", results, err)
+	}
+	if ops, _ := box.Ops(); len(ops) != 2 {
+		t.Errorf("expected both ops to stay queued, got %d", len(ops))
+	}
+}
+
+func TestReplay_StopsWhileStillOffline(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.CreateTaskErr = service.Unavailable(errors.New("no route to host"))
+	box := Open(filepath.Join(t.TempDir(), "outbox.json"))
+
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "A"})
+	box.Append(Op{Kind: CreateTask, ListID: "@default", Title: "B"})
+
+	_, err := Replay(context.Background(), box, fake)
+	if !errors.Is(err, service.ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+	ops, _ := box.Ops()
+	if len(ops) != 2 {
+		t.Errorf("expected both ops to stay queued, got %d", len(ops))
+	}
+}
+
+func TestReplay_StopsAtFirstUnreachableWithoutBatching(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.AddTask("@default", "t1", "First")
+	fake.AddTask("@default", "t2", "Second")
+	fake.DeleteTaskErr = service.Unavailable(errors.New("request timed out"))
+	box := Open(filepath.Join(t.TempDir(), "outbox.json"))
+
+	box.Append(Op{Kind: DeleteTask, ListID: "@default", TaskID: "t1", Title: "First"})
+	box.Append(Op{Kind: DeleteTask, ListID: "@default", TaskID: "t2", Title: "Second"})
+
+	// The cache passes batches on to a backend that cannot batch
+	backend := &countingDeletes{Service: fake}
+	cached := cache.New(backend, &config.Config{Dir: t.TempDir(), CacheDir: t.TempDir()})
+	_, err := Replay(context.Background(), box, cached)
+	if !errors.Is(err, service.ErrUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+	if backend.deletes != 1 {
+		t.Errorf("expected 1 delete request, got %d", backend.deletes)
+	}
+	if ops, _ := box.Ops(); len(ops) != 2 {
+		t.Errorf("expected both ops to stay queued, got %d", len(ops))
+	}
+}
+
+// countingDeletes counts DeleteTask calls.
+type countingDeletes struct {
+	service.Service
+	deletes int
+}
+
+func (c *countingDeletes) DeleteTask(ctx context.Context, listID, taskID string) error {
+	c.deletes++
+	return c.Service.DeleteTask(ctx, listID, taskID)
+}
+
+func TestService_BatchQueuesWhenUnavailable(t *testing.T) {
+	fake := testutil.NewFakeService()
+	fake.AddTask("@default", "t1", "First")
+	fake.AddTask("@default", "t2", "Second")
+	fake.DeleteTaskErr = service.Unavailable(errors.New("network is unreachable"))
+	backend := &countingDeletes{Service: fake}
+	svc := New(backend, &config.Config{Dir: t.TempDir()})
+	ctx := context.Background()
+
+	errs, err := svc.Batch(ctx, []service.Op{
+		{Kind: service.OpComplete, ListID: "@default", TaskID: "t1"},
+		{Kind: service.OpComplete, ListID: "@default", TaskID: "nope"},
+		{Kind: service.OpDelete, ListID: "@default", TaskID: "t2"},
+		{Kind: service.OpDelete, ListID: "@default", TaskID: "t3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] != nil || errs[2] != nil || errs[3] != nil {
+		t.Errorf("expected complete applied and deletes queued, got %v", errs)
+	}
+	if errs[1] == nil {
+		t.Error("expected error for unknown task")
+	}
+	// The fallback stops at the unreachable delete: t3 is queued untried
+	if backend.deletes != 1 {
+		t.Errorf("expected 1 delete request, got %d", backend.deletes)
+	}
+	if svc.Queued() != 2 {
+		t.Errorf("expected 2 queued changes, got %d", svc.Queued())
+	}
+
+	tasks, err := svc.ListOpenTasks(ctx, "@default", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(tasks); len(got) != 0 {
+		t.Errorf("expected both tasks hidden, got %v", got)
+	}
+}
+
+func TestService_Conformance(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) service.Service {
+		return newTestService(t, testutil.NewFakeService(), false)
+	})
+}
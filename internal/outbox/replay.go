@@ -0,0 +1,285 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gtask/internal/service"
+)
+
+// Result is the outcome of replaying one queued op.
+type Result struct {
+	Op Op
+
+	// Err is nil if the op was applied.
+	Err error
+
+	// Conflict is true if the op can never be applied (its task or list no
+	// longer exists on the backend, see service.ErrConflict). Conflicting
+	// ops are dropped; ops failing otherwise stay queued.
+	Conflict bool
+}
+
+// Replay applies the queued ops to backend in order. Applied and conflicting
+// ops are removed from the outbox as soon as the backend has answered, so
+// an interrupted sync does not leave applied ops queued. An op failing with
+// another error (a rejected request, an unknown kind in a hand-edited
+// outbox) is reported and stays queued for the next sync, without holding
+// back the ops after it.
+//
+// Consecutive completions and deletions of distinct tasks do not depend on
+// each other, so if backend batches them in one round trip
+// (service.CanBatch), they are sent together with service.ApplyBatch, up to
+// maxBatchRun at a time. Otherwise every op is sent on its own.
+//
+// Replay stops when the backend cannot be reached (service.ErrUnavailable)
+// or the command runs out of time, leaving that op and all later ones
+// queued, and returns the error.
+func Replay(ctx context.Context, box *Box, backend service.Service) ([]Result, error) {
+	ops, err := box.Ops()
+	if err != nil {
+		return nil, err
+	}
+	batch := service.CanBatch(backend)
+	snaps := newSnapshots()
+
+	var results []Result
+	for len(ops) > 0 {
+		run := ops[:1]
+		if batch {
+			run = batchRun(ops)
+		}
+		ops = ops[len(run):]
+
+		var errs []error
+		if len(run) == 1 {
+			errs = []error{apply(ctx, box, backend, snaps, run[0])}
+		} else {
+			errs, err = service.ApplyBatch(ctx, backend, batchOps(run))
+			if err != nil {
+				errs = make([]error, len(run))
+				for i := range errs {
+					errs[i] = err
+				}
+			}
+		}
+
+		// Record the whole run before stopping: ops of a batch after the
+		// one that stops may have been applied
+		var stop error
+		var remove []int
+		for i, op := range run {
+			err := errs[i]
+			if service.IsUnreachable(ctx, err) {
+				if stop == nil {
+					stop = fmt.Errorf("%s: %w", op.Describe(), err)
+				}
+				continue
+			}
+			conflict := errors.Is(err, service.ErrConflict)
+			results = append(results, Result{Op: op, Err: err, Conflict: conflict})
+			if err == nil || conflict {
+				remove = append(remove, op.Seq)
+			}
+		}
+		if len(remove) > 0 {
+			if err := box.Remove(remove...); err != nil {
+				return results, err
+			}
+		}
+		if stop != nil {
+			return results, stop
+		}
+	}
+	return results, nil
+}
+
+// maxBatchRun is the largest number of ops Replay sends as one batch. It
+// matches googletasks.MaxBatchSize, so a run takes one batch request and
+// is removed from the outbox before the next one is sent.
+const maxBatchRun = 50
+
+// batchRun returns the leading ops that can be sent as one batch: a run of
+// up to maxBatchRun completions and deletions, each of a different task.
+// Any other op is a run of its own.
+func batchRun(ops []Op) []Op {
+	seen := make(map[[2]string]bool)
+	for i, op := range ops {
+		key := [2]string{op.ListID, op.TaskID}
+		if i == maxBatchRun || (op.Kind != CompleteTask && op.Kind != DeleteTask) || seen[key] {
+			return ops[:max(i, 1)]
+		}
+		seen[key] = true
+	}
+	return ops
+}
+
+// batchOps converts a run from batchRun to service ops.
+func batchOps(run []Op) []service.Op {
+	ops := make([]service.Op, len(run))
+	for i, op := range run {
+		kind := service.OpComplete
+		if op.Kind == DeleteTask {
+			kind = service.OpDelete
+		}
+		ops[i] = service.Op{Kind: kind, ListID: op.ListID, TaskID: op.TaskID}
+	}
+	return ops
+}
+
+// apply performs a single op against backend.
+func apply(ctx context.Context, box *Box, backend service.Service, snaps *snapshots, op Op) error {
+	switch op.Kind {
+	case CreateTask:
+		if op.Completed {
+			return createCompleted(ctx, box, backend, snaps, op)
+		}
+		_, _, err := create(ctx, box, backend, snaps, op)
+		return err
+	case CompleteTask:
+		return backend.CompleteTask(ctx, op.ListID, op.TaskID)
+	case DeleteTask:
+		return backend.DeleteTask(ctx, op.ListID, op.TaskID)
+	}
+	return fmt.Errorf("unknown operation: %s", op.Kind)
+}
+
+// snapshot holds the IDs of a list's open tasks, to tell the task of a
+// create apart from the tasks that were there before (see create).
+type snapshot struct {
+	ids []string
+
+	// created holds the titles created since the snapshot was taken.
+	// Their tasks are not in ids, so a create with one of these titles
+	// needs a new snapshot.
+	created map[string]bool
+}
+
+// snapshots holds one snapshot per list ID, so that a run of creates in a
+// list lists its tasks once, not once per create.
+type snapshots struct {
+	lists map[string]*snapshot
+
+	// claimed holds the IDs of tasks found for Sent ops, so that two
+	// queued creates with the same title do not both take one task.
+	claimed map[string]bool
+}
+
+func newSnapshots() *snapshots {
+	return &snapshots{lists: make(map[string]*snapshot), claimed: make(map[string]bool)}
+}
+
+// before returns the snapshot IDs of listID for a create of title, taking
+// a new snapshot if there is none that can tell that task apart.
+func (s *snapshots) before(ctx context.Context, backend service.Service, listID, title string) ([]string, error) {
+	if snap := s.lists[listID]; snap != nil && !snap.created[title] {
+		return snap.ids, nil
+	}
+	tasks, err := service.AllOpenTasks(ctx, backend, listID)
+	if err != nil {
+		return nil, err
+	}
+	return s.take(listID, tasks), nil
+}
+
+// take stores tasks as the snapshot of listID and returns its IDs.
+func (s *snapshots) take(listID string, tasks []service.Task) []string {
+	snap := &snapshot{ids: taskIDs(tasks), created: make(map[string]bool)}
+	s.lists[listID] = snap
+	return snap.ids
+}
+
+// newTask returns the ID of the first task with title whose ID is neither
+// in before nor claimed, and claims it. It returns "" if there is none.
+func (s *snapshots) newTask(tasks []service.Task, before []string, title string) string {
+	existed := make(map[string]bool, len(before))
+	for _, id := range before {
+		existed[id] = true
+	}
+	for _, task := range tasks {
+		if task.Title == title && !existed[task.ID] && !s.claimed[task.ID] {
+			s.claimed[task.ID] = true
+			return task.ID
+		}
+	}
+	return ""
+}
+
+// taskIDs returns the IDs of tasks.
+func taskIDs(tasks []service.Task) []string {
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
+
+// create sends the CreateTask op and returns the IDs of the list's open
+// tasks before it, so that the new task can be told apart. CreateTask does
+// not return the new ID: the task is the open task with the op's title
+// that was not there before. If the create request is not answered, the
+// op is marked Sent with those IDs, and the next sync first looks for the
+// task, so that it is not created twice; found is its ID if it is there.
+func create(ctx context.Context, box *Box, backend service.Service, snaps *snapshots, op Op) (found string, before []string, err error) {
+	if op.Sent {
+		tasks, err := service.AllOpenTasks(ctx, backend, op.ListID)
+		if err != nil {
+			return "", nil, err
+		}
+		before = snaps.take(op.ListID, tasks)
+		if id := snaps.newTask(tasks, op.Before, op.Title); id != "" {
+			return id, op.Before, nil
+		}
+	} else {
+		before, err = snaps.before(ctx, backend, op.ListID, op.Title)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	if err := backend.CreateTask(ctx, op.ListID, op.Title); err != nil {
+		if service.IsUnreachable(ctx, err) {
+			if _, uerr := box.Update(op.Seq, func(op *Op) {
+				op.Sent, op.Before = true, before
+			}); uerr != nil {
+				return "", nil, uerr
+			}
+		}
+		return "", nil, err
+	}
+	snaps.lists[op.ListID].created[op.Title] = true
+	return "", before, nil
+}
+
+// createCompleted creates the task of a Completed CreateTask op (see
+// create) and completes it. If completing fails, the op becomes a
+// CompleteTask of the new task, so that the next sync does not create it
+// again. If the new task cannot be found, the error is a conflict, so the
+// op is dropped even if the backend went offline after the create.
+func createCompleted(ctx context.Context, box *Box, backend service.Service, snaps *snapshots, op Op) error {
+	id, before, err := create(ctx, box, backend, snaps, op)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		after, err := service.AllOpenTasks(ctx, backend, op.ListID)
+		if err != nil {
+			return service.Conflict(fmt.Errorf("created but not completed: %w", err))
+		}
+		id = snaps.newTask(after, before, op.Title)
+	}
+	if id == "" {
+		return service.Conflict(errors.New("created but not completed: task not found"))
+	}
+	err = backend.CompleteTask(ctx, op.ListID, id)
+	if err != nil && !errors.Is(err, service.ErrConflict) {
+		if _, uerr := box.Update(op.Seq, func(op *Op) {
+			op.Kind, op.TaskID, op.Completed = CompleteTask, id, false
+			op.Sent, op.Before = false, nil
+		}); uerr != nil {
+			return uerr
+		}
+	}
+	return err
+}
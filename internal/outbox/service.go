@@ -0,0 +1,351 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+
+	"gtask/internal/config"
+	"gtask/internal/service"
+)
+
+// errNotFound is returned for a task created offline whose queued
+// creation is gone, as backends report a missing task.
+var errNotFound = service.Conflict(errors.New("not found"))
+
+// Service is a service.Service decorator that queues task mutations in a Box
+// when the wrapped service is unreachable (or in offline mode), and overlays
+// queued changes on reads so task numbering stays consistent until sync.
+//
+// It is meant to wrap the cache, which keeps serving reads while offline.
+type Service struct {
+	inner   service.Service
+	box     *Box
+	offline bool
+	queued  int
+}
+
+// New wraps inner with the outbox at cfg.OutboxPath().
+// With cfg.Offline set, mutations are queued without trying inner first.
+func New(inner service.Service, cfg *config.Config) *Service {
+	return &Service{
+		inner:   inner,
+		box:     Open(cfg.OutboxPath()),
+		offline: cfg.Offline,
+	}
+}
+
+// Queued returns the number of mutations queued by this Service.
+func (s *Service) Queued() int {
+	return s.queued
+}
+
+// Sync replays the outbox against the wrapped service. See Replay.
+func (s *Service) Sync(ctx context.Context) ([]Result, error) {
+	return Replay(ctx, s.box, s.inner)
+}
+
+// DefaultList implements service.Service.
+func (s *Service) DefaultList(ctx context.Context) (service.TaskList, error) {
+	return s.inner.DefaultList(ctx)
+}
+
+// ListLists implements service.Service.
+func (s *Service) ListLists(ctx context.Context) ([]service.TaskList, error) {
+	return s.inner.ListLists(ctx)
+}
+
+// ResolveList implements service.Service.
+func (s *Service) ResolveList(ctx context.Context, name string) (service.TaskList, error) {
+	return s.inner.ResolveList(ctx, name)
+}
+
+// CreateList implements service.Service. List changes are never queued.
+func (s *Service) CreateList(ctx context.Context, name string) error {
+	return s.inner.CreateList(ctx, name)
+}
+
+// DeleteList implements service.Service. List changes are never queued.
+func (s *Service) DeleteList(ctx context.Context, listID string) error {
+	return s.inner.DeleteList(ctx, listID)
+}
+
+// ListOpenTasks implements service.Service.
+// Queued changes for the list are applied on top of the wrapped results.
+func (s *Service) ListOpenTasks(ctx context.Context, listID string, page int) ([]service.Task, error) {
+	ops, err := s.pending(listID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 {
+		return s.inner.ListOpenTasks(ctx, listID, page)
+	}
+
+	tasks, err := s.overlay(ctx, listID, ops)
+	if err != nil {
+		return nil, err
+	}
+	return service.Page(tasks, page), nil
+}
+
+// HasOpenTasks implements service.Service.
+func (s *Service) HasOpenTasks(ctx context.Context, listID string) (bool, error) {
+	ops, err := s.pending(listID)
+	if err != nil {
+		return false, err
+	}
+	if len(ops) == 0 {
+		return s.inner.HasOpenTasks(ctx, listID)
+	}
+
+	tasks, err := s.overlay(ctx, listID, ops)
+	if err != nil {
+		return false, err
+	}
+	return len(tasks) > 0, nil
+}
+
+// CreateTask implements service.Service.
+// The list's open tasks are read first (usually from the cache). If the
+// create is then not answered, the task may exist: it is queued Sent with
+// those tasks, so that sync does not create it twice.
+func (s *Service) CreateTask(ctx context.Context, listID, title string) error {
+	op := Op{Kind: CreateTask, ListID: listID, Title: title}
+	if s.offline {
+		return s.enqueue(op)
+	}
+	before, err := service.AllOpenTasks(ctx, s.inner, listID)
+	if errors.Is(err, service.ErrUnavailable) {
+		return s.enqueue(op)
+	}
+	if err != nil {
+		return err
+	}
+	err = s.inner.CreateTask(ctx, listID, title)
+	if !errors.Is(err, service.ErrUnavailable) {
+		return err
+	}
+	op.Sent, op.Before = true, taskIDs(before)
+	return s.enqueue(op)
+}
+
+// CompleteTask implements service.Service.
+func (s *Service) CompleteTask(ctx context.Context, listID, taskID string) error {
+	return s.mutate(ctx, CompleteTask, listID, taskID, s.inner.CompleteTask)
+}
+
+// DeleteTask implements service.Service.
+func (s *Service) DeleteTask(ctx context.Context, listID, taskID string) error {
+	return s.mutate(ctx, DeleteTask, listID, taskID, s.inner.DeleteTask)
+}
+
+// Batch implements service.Batcher. Ops are sent with the wrapped
+// service's Batch method if it has one; ops the backend could not be
+// reached for are queued, as by the single mutations.
+func (s *Service) Batch(ctx context.Context, ops []service.Op) ([]error, error) {
+	errs := make([]error, len(ops))
+	var send []service.Op
+	var index []int
+	for i, op := range ops {
+		switch {
+		case op.Kind != service.OpCreate && op.Kind != service.OpComplete && op.Kind != service.OpDelete:
+			errs[i] = &service.UnknownOpError{Kind: op.Kind}
+			continue
+		case op.Kind == service.OpComplete && IsLocalID(op.TaskID):
+			errs[i] = s.completeLocal(op.TaskID)
+			continue
+		case op.Kind == service.OpDelete && IsLocalID(op.TaskID):
+			errs[i] = s.dropLocal(op.TaskID)
+			continue
+		}
+		send = append(send, op)
+		index = append(index, i)
+	}
+
+	// Creates are queued Sent with the open tasks from before, as by
+	// CreateTask
+	before := make(map[string][]string)
+	sent := make([]error, len(send))
+	if s.offline {
+		for j := range sent {
+			sent[j] = service.ErrUnavailable
+		}
+	} else if len(send) > 0 {
+		var err error
+		for _, op := range send {
+			if _, ok := before[op.ListID]; ok || op.Kind != service.OpCreate {
+				continue
+			}
+			var tasks []service.Task
+			if tasks, err = service.AllOpenTasks(ctx, s.inner, op.ListID); err != nil {
+				break
+			}
+			before[op.ListID] = taskIDs(tasks)
+		}
+		if err == nil {
+			sent, err = service.ApplyBatch(ctx, s.inner, send)
+		}
+		if err != nil && !errors.Is(err, service.ErrUnavailable) {
+			return nil, err
+		}
+		if err != nil {
+			sent = make([]error, len(send))
+			for j := range sent {
+				sent[j] = err
+			}
+		}
+	}
+
+	for j, op := range send {
+		i := index[j]
+		if !errors.Is(sent[j], service.ErrUnavailable) {
+			errs[i] = sent[j]
+			continue
+		}
+		queued := s.outboxOp(ctx, op)
+		if ids, ok := before[op.ListID]; ok && queued.Kind == CreateTask {
+			queued.Sent, queued.Before = true, ids
+		}
+		errs[i] = s.enqueue(queued)
+	}
+	return errs, nil
+}
+
+// outboxOp returns the outbox entry queueing op.
+func (s *Service) outboxOp(ctx context.Context, op service.Op) Op {
+	switch op.Kind {
+	case service.OpComplete:
+		return Op{Kind: CompleteTask, ListID: op.ListID, TaskID: op.TaskID, Title: s.lookupTitle(ctx, op.ListID, op.TaskID)}
+	case service.OpDelete:
+		return Op{Kind: DeleteTask, ListID: op.ListID, TaskID: op.TaskID, Title: s.lookupTitle(ctx, op.ListID, op.TaskID)}
+	}
+	return Op{Kind: CreateTask, ListID: op.ListID, Title: op.Title}
+}
+
+// mutate completes or deletes a task, queueing the change if needed.
+// A task created offline never reached the backend: deleting it drops its
+// queued creation, and completing it marks the creation completed.
+func (s *Service) mutate(ctx context.Context, kind Kind, listID, taskID string, apply func(context.Context, string, string) error) error {
+	if IsLocalID(taskID) {
+		if kind == CompleteTask {
+			return s.completeLocal(taskID)
+		}
+		return s.dropLocal(taskID)
+	}
+
+	if !s.offline {
+		err := apply(ctx, listID, taskID)
+		if !errors.Is(err, service.ErrUnavailable) {
+			return err
+		}
+	}
+	title := s.lookupTitle(ctx, listID, taskID)
+	return s.enqueue(Op{Kind: kind, ListID: listID, TaskID: taskID, Title: title})
+}
+
+// enqueue appends op to the outbox.
+func (s *Service) enqueue(op Op) error {
+	if _, err := s.box.Append(op); err != nil {
+		return err
+	}
+	s.queued++
+	return nil
+}
+
+// dropLocal removes the queued creation of a task created offline.
+func (s *Service) dropLocal(taskID string) error {
+	ops, err := s.box.Ops()
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if op.Kind == CreateTask && op.LocalTaskID() == taskID {
+			return s.box.Remove(op.Seq)
+		}
+	}
+	return errNotFound
+}
+
+// completeLocal marks the queued creation of a task created offline as
+// completed, so that sync creates the task and then completes it.
+func (s *Service) completeLocal(taskID string) error {
+	ops, err := s.box.Ops()
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if op.Kind == CreateTask && op.LocalTaskID() == taskID && !op.Completed {
+			found, err := s.box.Update(op.Seq, func(op *Op) { op.Completed = true })
+			if err != nil {
+				return err
+			}
+			if found {
+				s.queued++
+				return nil
+			}
+		}
+	}
+	return errNotFound
+}
+
+// pending returns the queued ops for a list.
+func (s *Service) pending(listID string) ([]Op, error) {
+	ops, err := s.box.Ops()
+	if err != nil {
+		return nil, err
+	}
+	var result []Op
+	for _, op := range ops {
+		if op.ListID == listID {
+			result = append(result, op)
+		}
+	}
+	return result, nil
+}
+
+// overlay returns all open tasks of a list with queued ops applied:
+// completed and deleted tasks are hidden, tasks created offline are appended.
+func (s *Service) overlay(ctx context.Context, listID string, ops []Op) ([]service.Task, error) {
+	tasks, err := service.AllOpenTasks(ctx, s.inner, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	gone := make(map[string]bool)
+	for _, op := range ops {
+		if op.Kind == CompleteTask || op.Kind == DeleteTask {
+			gone[op.TaskID] = true
+		}
+	}
+
+	result := make([]service.Task, 0, len(tasks))
+	for _, task := range tasks {
+		if !gone[task.ID] {
+			result = append(result, task)
+		}
+	}
+	for _, op := range ops {
+		if op.Kind == CreateTask && !op.Completed {
+			result = append(result, service.Task{
+				ID:     op.LocalTaskID(),
+				Title:  op.Title,
+				Status: "needsAction",
+			})
+		}
+	}
+	return result, nil
+}
+
+// lookupTitle finds a task's title for sync reports. Best effort: returns
+// the task ID if the title is not available.
+func (s *Service) lookupTitle(ctx context.Context, listID, taskID string) string {
+	tasks, err := service.AllOpenTasks(ctx, s.inner, listID)
+	if err != nil {
+		return taskID
+	}
+	for _, task := range tasks {
+		if task.ID == taskID {
+			return task.Title
+		}
+	}
+	return taskID
+}
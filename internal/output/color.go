@@ -0,0 +1,45 @@
+package output
+
+import (
+	"io"
+	"os"
+
+	"gtask/internal/config"
+)
+
+// ANSI escape sequences.
+const (
+	ansiBold  = "\033[1m"
+	ansiCyan  = "\033[36m"
+	ansiReset = "\033[0m"
+)
+
+// UseColor reports whether output written to w should be colored in the
+// given mode (config.ColorAuto, ColorAlways or ColorNever). In auto mode
+// (or if mode is empty) only terminals get color, and never when NO_COLOR
+// is set or TERM is dumb.
+func UseColor(w io.Writer, mode string) bool {
+	switch mode {
+	case config.ColorAlways:
+		return true
+	case config.ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// paint wraps s in an escape sequence if color is on.
+func paint(s, code string, color bool) string {
+	if !color {
+		return s
+	}
+	return code + s + ansiReset
+}
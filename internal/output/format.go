@@ -16,45 +16,53 @@ const (
 
 // FormatTask formats a task line for the default list.
 // Format: "{N:>4}  {TITLE}\n" (4-wide right-aligned number, two spaces, title)
-func FormatTask(w io.Writer, num int, task service.Task) {
+// With color, the number is highlighted.
+func FormatTask(w io.Writer, num int, task service.Task, color bool) {
 	title := normalizeTitle(task.Title)
-	fmt.Fprintf(w, "%4d  %s\n", num, title)
+	fmt.Fprintf(w, "%s  %s\n", paint(fmt.Sprintf("%4d", num), ansiCyan, color), title)
 }
 
 // FormatTaskIndented formats a task line for a named list section (without letter).
 // Format: "    {N:>4}  {TITLE}\n" (4 spaces indent + 4-wide number + 2 spaces + title)
 // Used by `gtask list <name>` command which does not show list letters.
-func FormatTaskIndented(w io.Writer, num int, task service.Task) {
+// With color, the number is highlighted.
+func FormatTaskIndented(w io.Writer, num int, task service.Task, color bool) {
 	title := normalizeTitle(task.Title)
-	fmt.Fprintf(w, "    %4d  %s\n", num, title)
+	fmt.Fprintf(w, "    %s  %s\n", paint(fmt.Sprintf("%4d", num), ansiCyan, color), title)
 }
 
 // FormatTaskWithLetter formats a task line for a named list section with a list letter.
 // Format: "    {LN:>4}  {TITLE}\n" (4 spaces indent + 4-wide right-aligned letter+number + 2 spaces + title)
 // Used by `gtask` (all-lists view) to show tasks like "a1", "b3", etc.
-func FormatTaskWithLetter(w io.Writer, letter rune, num int, task service.Task) {
+// With color, the reference is highlighted.
+func FormatTaskWithLetter(w io.Writer, letter rune, num int, task service.Task, color bool) {
 	title := normalizeTitle(task.Title)
-	ref := fmt.Sprintf("%c%d", letter, num)
-	fmt.Fprintf(w, "    %4s  %s\n", ref, title)
+	ref := fmt.Sprintf("%4s", fmt.Sprintf("%c%d", letter, num))
+	fmt.Fprintf(w, "    %s  %s\n", paint(ref, ansiCyan, color), title)
 }
 
-// FormatListHeader formats a list section header.
-func FormatListHeader(w io.Writer, title string, isDefault bool) {
+// FormatListHeader formats a list section header. With color, the title
+// is bold.
+func FormatListHeader(w io.Writer, title string, isDefault bool, color bool) {
 	displayTitle := normalizeListTitle(title)
 	if isDefault {
 		displayTitle += " [default]"
 	}
 	fmt.Fprintln(w, ListSeparator)
-	fmt.Fprintln(w, displayTitle)
+	fmt.Fprintln(w, paint(displayTitle, ansiBold, color))
 	fmt.Fprintln(w, ListSeparator)
 }
 
 // FormatListName formats a list name for the lists command.
-func FormatListName(w io.Writer, list service.TaskList) {
+// Hidden lists (see config.Settings.HiddenLists) are marked.
+func FormatListName(w io.Writer, list service.TaskList, hidden bool) {
 	title := normalizeListTitle(list.Title)
 	if list.IsDefault {
 		title += " [default]"
 	}
+	if hidden {
+		title += " [hidden]"
+	}
 	fmt.Fprintln(w, title)
 }
 
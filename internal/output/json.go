@@ -0,0 +1,62 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"gtask/internal/service"
+)
+
+// List is the JSON form of a task list.
+type List struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Default bool   `json:"default,omitempty"`
+	Hidden  bool   `json:"hidden,omitempty"`
+
+	// Letter is the list letter in the all-lists view, if any.
+	Letter string `json:"letter,omitempty"`
+}
+
+// ListTasks is the JSON form of a list section with its tasks.
+type ListTasks struct {
+	List
+	Tasks []Task `json:"tasks"`
+}
+
+// Task is the JSON form of a task.
+type Task struct {
+	// Ref is the reference accepted by done and rm, e.g. "3" or "a3".
+	Ref   string `json:"ref"`
+	ID    string `json:"id"`
+	Title string `json:"title"`
+
+	// Due is the due date (YYYY-MM-DD), if any.
+	Due string `json:"due,omitempty"`
+}
+
+// Tasks converts tasks numbered from start, prefixing references with
+// letter unless it is 0.
+func Tasks(tasks []service.Task, letter rune, start int) []Task {
+	result := make([]Task, 0, len(tasks))
+	for i, t := range tasks {
+		ref := strconv.Itoa(start + i)
+		if letter != 0 {
+			ref = string(letter) + ref
+		}
+		jt := Task{Ref: ref, ID: t.ID, Title: t.Title}
+		if !t.Due.IsZero() {
+			jt.Due = t.Due.Format("2006-01-02")
+		}
+		result = append(result, jt)
+	}
+	return result
+}
+
+// WriteJSON writes v as indented JSON followed by a newline.
+func WriteJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+// OpKind identifies a task mutation in a batch.
+type OpKind string
+
+const (
+	// OpCreate creates a task with Title in ListID.
+	OpCreate OpKind = "create"
+
+	// OpComplete marks TaskID in ListID completed.
+	OpComplete OpKind = "complete"
+
+	// OpDelete deletes TaskID from ListID.
+	OpDelete OpKind = "delete"
+)
+
+// Op is one task mutation of a batch.
+type Op struct {
+	Kind   OpKind
+	ListID string
+	TaskID string // OpComplete, OpDelete
+	Title  string // OpCreate
+}
+
+// Batcher is an optional interface for backends that can apply many task
+// mutations in few round trips. Commands type-assert for it, or use
+// ApplyBatch, which falls back to one call per op.
+type Batcher interface {
+	// Batch applies ops and returns one error per op, in the order of ops
+	// (nil if the op was applied). Ops are independent: a failed op does
+	// not stop the others, and they may be applied in any order. The
+	// second result is set only if no op could be tried; the per-op errors
+	// are then nil.
+	Batch(ctx context.Context, ops []Op) ([]error, error)
+}
+
+// ApplyBatch applies ops with svc's Batch method if it is a Batcher,
+// otherwise one call at a time in order. Results are as for
+// Batcher.Batch, except that the one-at-a-time fallback stops at the
+// first op the backend could not be reached for (ErrUnavailable) or that
+// ran out of time: that op and all later ones get its error without being
+// tried, so an unreachable backend costs one request timeout, not one per
+// op.
+func ApplyBatch(ctx context.Context, svc Service, ops []Op) ([]error, error) {
+	if b, ok := svc.(Batcher); ok {
+		return b.Batch(ctx, ops)
+	}
+	errs := make([]error, len(ops))
+	for i, op := range ops {
+		err := Apply(ctx, svc, op)
+		if IsUnreachable(ctx, err) {
+			for j := i; j < len(ops); j++ {
+				errs[j] = err
+			}
+			break
+		}
+		errs[i] = err
+	}
+	return errs, nil
+}
+
+// IsUnreachable reports whether err means the backend cannot be reached
+// now, so later calls would fail the same way: it is ErrUnavailable or
+// ErrDeadline, or ctx is done. A conflict never is.
+func IsUnreachable(ctx context.Context, err error) bool {
+	if err == nil || errors.Is(err, ErrConflict) {
+		return false
+	}
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrDeadline) || ctx.Err() != nil
+}
+
+// Wrapper is implemented by services that wrap another one and pass
+// batches on to it, such as the cache.
+type Wrapper interface {
+	Unwrap() Service
+}
+
+// CanBatch reports whether svc applies a batch in fewer round trips than
+// one call per op: svc and every service it wraps (see Wrapper) are
+// Batchers. Callers that must record each op as soon as it is applied use
+// single calls when it reports false.
+func CanBatch(svc Service) bool {
+	for {
+		if _, ok := svc.(Batcher); !ok {
+			return false
+		}
+		w, ok := svc.(Wrapper)
+		if !ok {
+			return true
+		}
+		svc = w.Unwrap()
+	}
+}
+
+// Apply performs a single op with the matching Service method.
+func Apply(ctx context.Context, svc Service, op Op) error {
+	switch op.Kind {
+	case OpCreate:
+		return svc.CreateTask(ctx, op.ListID, op.Title)
+	case OpComplete:
+		return svc.CompleteTask(ctx, op.ListID, op.TaskID)
+	case OpDelete:
+		return svc.DeleteTask(ctx, op.ListID, op.TaskID)
+	}
+	return &UnknownOpError{Kind: op.Kind}
+}
+
+// UnknownOpError is returned for ops of an unknown kind.
+type UnknownOpError struct {
+	Kind OpKind
+}
+
+func (e *UnknownOpError) Error() string { return "unknown operation: " + string(e.Kind) }
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrListNotFound is returned by ResolveList if no list has the name.
+	// Test with errors.Is.
+	ErrListNotFound = errors.New("list not found")
+
+	// ErrAmbiguousList is returned by ResolveList if several lists have
+	// the name. Test with errors.Is.
+	ErrAmbiguousList = errors.New("ambiguous list name")
+)
+
+// MatchList finds a list by name (case-insensitive, trimmed) among lists.
+// Backends use it to implement ResolveList with the semantics of Spec §6.3.
+// Returns ErrListNotFound or ErrAmbiguousList, followed by the name.
+func MatchList(lists []TaskList, name string) (TaskList, error) {
+	name = strings.TrimSpace(name)
+	nameLower := strings.ToLower(name)
+
+	var matches []TaskList
+	for _, list := range lists {
+		if strings.ToLower(strings.TrimSpace(list.Title)) == nameLower {
+			matches = append(matches, list)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return TaskList{}, fmt.Errorf("%w: %s", ErrListNotFound, name)
+	case 1:
+		return matches[0], nil
+	default:
+		return TaskList{}, fmt.Errorf("%w: %s", ErrAmbiguousList, name)
+	}
+}
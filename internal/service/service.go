@@ -1,7 +1,42 @@
 // Package service defines the backend-agnostic interface for task operations.
 package service
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// PageSize is the number of tasks returned per ListOpenTasks page.
+const PageSize = 100
+
+// Page returns the 1-based page of tasks with PageSize tasks per page, as
+// ListOpenTasks returns it: empty past the end or for a page below 1. The
+// result is a copy, so callers may keep it while tasks changes.
+func Page(tasks []Task, page int) []Task {
+	start := (page - 1) * PageSize
+	if page < 1 || start >= len(tasks) {
+		return nil
+	}
+	end := min(start+PageSize, len(tasks))
+	return append([]Task(nil), tasks[start:end]...)
+}
+
+// AllOpenTasks returns all open tasks of a list, fetching pages of svc
+// until a short page.
+func AllOpenTasks(ctx context.Context, svc Service, listID string) ([]Task, error) {
+	var tasks []Task
+	for page := 1; ; page++ {
+		pageTasks, err := svc.ListOpenTasks(ctx, listID, page)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, pageTasks...)
+		if len(pageTasks) < PageSize {
+			return tasks, nil
+		}
+	}
+}
 
 // Service defines the interface for task backend operations.
 // All Google Tasks API calls go through this interface.
@@ -24,7 +59,7 @@ type Service interface {
 	DeleteList(ctx context.Context, listID string) error
 
 	// ListOpenTasks returns open tasks for a list.
-	// page is 1-based; page size is 100.
+	// page is 1-based; page size is PageSize.
 	// Returns empty slice if page is out of range.
 	// Results are in API order (no client-side sorting).
 	ListOpenTasks(ctx context.Context, listID string, page int) ([]Task, error)
@@ -41,3 +76,68 @@ type Service interface {
 	// DeleteTask deletes a task.
 	DeleteTask(ctx context.Context, listID, taskID string) error
 }
+
+// ErrUnavailable marks errors caused by the backend being unreachable
+// (no network, DNS failure, timeout). Test with errors.Is.
+var ErrUnavailable = errors.New("backend unavailable")
+
+// Unavailable wraps err so that errors.Is(err, ErrUnavailable) reports true.
+// The error message is unchanged.
+func Unavailable(err error) error {
+	return unavailableError{err}
+}
+
+type unavailableError struct{ err error }
+
+func (e unavailableError) Error() string   { return e.err.Error() }
+func (e unavailableError) Unwrap() []error { return []error{e.err, ErrUnavailable} }
+
+// ErrConflict marks errors of changes that can never be applied as made:
+// their task or list is gone, or changed on the server since it was read
+// (HTTP 404 or 412). Test with errors.Is.
+var ErrConflict = errors.New("conflict")
+
+// Conflict wraps err so that errors.Is(err, ErrConflict) reports true.
+// The error message is unchanged.
+func Conflict(err error) error {
+	return conflictError{err}
+}
+
+type conflictError struct{ err error }
+
+func (e conflictError) Error() string   { return e.err.Error() }
+func (e conflictError) Unwrap() []error { return []error{e.err, ErrConflict} }
+
+// ErrDeadline is the cancellation cause of a command whose overall
+// deadline (setting: deadline) passed. Unlike a request timeout it is not
+// ErrUnavailable: nothing is served from cache or queued once the command
+// is out of time.
+var ErrDeadline = errors.New("command deadline exceeded")
+
+// TimeoutError returns the error for a request that ran out of time with
+// ctx: ErrDeadline if the command deadline passed, otherwise an
+// ErrUnavailable "request timed out".
+func TimeoutError(ctx context.Context) error {
+	if errors.Is(context.Cause(ctx), ErrDeadline) {
+		return ErrDeadline
+	}
+	return Unavailable(errors.New("request timed out"))
+}
+
+// ErrNotModified is returned by Revalidator methods when previously fetched
+// data is still current.
+var ErrNotModified = errors.New("not modified")
+
+// Revalidator is an optional interface for backends that can cheaply tell
+// whether previously fetched data is still current. Caching layers
+// type-assert for it and fall back to refetching when it is absent.
+type Revalidator interface {
+	// ListListsIfNoneMatch returns ErrNotModified if the lists are unchanged
+	// since etag was issued. Otherwise it returns the current lists and a new
+	// etag. An empty etag always fetches.
+	ListListsIfNoneMatch(ctx context.Context, etag string) ([]TaskList, string, error)
+
+	// TasksModifiedSince reports whether any task in the list was created,
+	// updated, completed or deleted after since.
+	TasksModifiedSince(ctx context.Context, listID string, since time.Time) (bool, error)
+}
@@ -0,0 +1,354 @@
+// Package servicetest provides a conformance suite for implementations of
+// service.Service, checking the behavior documented on the interface and
+// in Spec §6.
+package servicetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"gtask/internal/service"
+)
+
+// Factory returns a new service for one test. Its default list must be
+// empty; other lists may exist (such as the default lists of other mounts)
+// if they have no tasks and none of the names the suite creates.
+type Factory func(t *testing.T) service.Service
+
+// Run runs the conformance suite against services made by newService,
+// each check in its own subtest with its own service.
+func Run(t *testing.T, newService Factory) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, service.Service)
+	}{
+		{"DefaultList", testDefaultList},
+		{"ResolveList", testResolveList},
+		{"ResolveListErrors", testResolveListErrors},
+		{"CreateAndDeleteList", testCreateAndDeleteList},
+		{"TaskLifecycle", testTaskLifecycle},
+		{"ListsAreSeparate", testListsAreSeparate},
+		{"Paging", testPaging},
+		{"OrderIsStable", testOrderIsStable},
+		{"MissingTask", testMissingTask},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newService(t))
+		})
+	}
+}
+
+func testDefaultList(t *testing.T, svc service.Service) {
+	ctx := context.Background()
+	def, err := svc.DefaultList(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !def.IsDefault || def.ID == "" || def.Title == "" {
+		t.Errorf("DefaultList() = %+v, want a default list with ID and title", def)
+	}
+
+	lists := mustLists(t, svc)
+	var defaults []service.TaskList
+	for _, l := range lists {
+		if l.IsDefault {
+			defaults = append(defaults, l)
+		}
+	}
+	if len(defaults) != 1 || defaults[0] != def {
+		t.Errorf("ListLists() = %+v, want exactly one default list equal to %+v", lists, def)
+	}
+}
+
+func testResolveList(t *testing.T, svc service.Service) {
+	ctx := context.Background()
+	mustCreateList(t, svc, "Groceries")
+
+	// Services may decorate titles (the multi-backend mux prefixes the
+	// mount name), so the resolved list is checked against ListLists
+	// rather than the name.
+	want, err := svc.ResolveList(ctx, "Groceries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(mustLists(t, svc), want) || want.IsDefault {
+		t.Fatalf("ResolveList(%q) = %+v, not a non-default list of ListLists", "Groceries", want)
+	}
+	for _, name := range []string{"groceries", "  GROCERIES\t"} {
+		list, err := svc.ResolveList(ctx, name)
+		if err != nil {
+			t.Errorf("ResolveList(%q): %v", name, err)
+			continue
+		}
+		if list != want {
+			t.Errorf("ResolveList(%q) = %+v, want %+v", name, list, want)
+		}
+	}
+
+	// The default list resolves by its title, with its default ID
+	def, err := svc.DefaultList(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := svc.ResolveList(ctx, " "+def.Title+" ")
+	if err != nil || list.ID != def.ID || !list.IsDefault {
+		t.Errorf("ResolveList(%q) = %+v, %v, want the default list %+v", def.Title, list, err, def)
+	}
+}
+
+func testResolveListErrors(t *testing.T, svc service.Service) {
+	ctx := context.Background()
+	mustCreateList(t, svc, "Work")
+	mustCreateList(t, svc, "WORK")
+
+	_, err := svc.ResolveList(ctx, "Holidays")
+	if !errors.Is(err, service.ErrListNotFound) {
+		t.Errorf("ResolveList(unknown) error = %v, want ErrListNotFound", err)
+	}
+	_, err = svc.ResolveList(ctx, "work")
+	if !errors.Is(err, service.ErrAmbiguousList) {
+		t.Errorf("ResolveList(ambiguous) error = %v, want ErrAmbiguousList", err)
+	}
+}
+
+func testCreateAndDeleteList(t *testing.T, svc service.Service) {
+	ctx := context.Background()
+	before := len(mustLists(t, svc))
+	mustCreateList(t, svc, "Reading")
+
+	list, err := svc.ResolveList(ctx, "Reading")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(mustLists(t, svc)); got != before+1 {
+		t.Errorf("expected %d lists after CreateList, got %d", before+1, got)
+	}
+	if open, err := svc.HasOpenTasks(ctx, list.ID); err != nil || open {
+		t.Errorf("HasOpenTasks(new list) = %v, %v, want false", open, err)
+	}
+
+	if err := svc.DeleteList(ctx, list.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ResolveList(ctx, "Reading"); !errors.Is(err, service.ErrListNotFound) {
+		t.Errorf("ResolveList(deleted) error = %v, want ErrListNotFound", err)
+	}
+	if got := len(mustLists(t, svc)); got != before {
+		t.Errorf("expected %d lists after DeleteList, got %d", before, got)
+	}
+	if err := svc.DeleteList(ctx, list.ID); err == nil {
+		t.Error("DeleteList(deleted) succeeded, want an error")
+	}
+}
+
+func testTaskLifecycle(t *testing.T, svc service.Service) {
+	ctx := context.Background()
+	listID := defaultID(t, svc)
+
+	if open, err := svc.HasOpenTasks(ctx, listID); err != nil || open {
+		t.Fatalf("HasOpenTasks(empty) = %v, %v, want false", open, err)
+	}
+	mustCreateTask(t, svc, listID, "Milk")
+	mustCreateTask(t, svc, listID, "Bread")
+
+	tasks := openTasks(t, svc, listID)
+	if got := titles(tasks); !sameSet(got, []string{"Milk", "Bread"}) {
+		t.Fatalf("open tasks = %q, want Milk and Bread", got)
+	}
+	for _, task := range tasks {
+		if task.ID == "" || task.Status != "needsAction" {
+			t.Errorf("new task %+v, want an ID and status needsAction", task)
+		}
+	}
+	if open, err := svc.HasOpenTasks(ctx, listID); err != nil || !open {
+		t.Errorf("HasOpenTasks() = %v, %v, want true", open, err)
+	}
+
+	milk := find(t, tasks, "Milk")
+	if err := svc.CompleteTask(ctx, listID, milk.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(openTasks(t, svc, listID)); !sameSet(got, []string{"Bread"}) {
+		t.Errorf("open tasks after complete = %q, want Bread", got)
+	}
+
+	bread := find(t, tasks, "Bread")
+	if err := svc.DeleteTask(ctx, listID, bread.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := openTasks(t, svc, listID); len(got) != 0 {
+		t.Errorf("open tasks after delete = %q, want none", titles(got))
+	}
+	if open, err := svc.HasOpenTasks(ctx, listID); err != nil || open {
+		t.Errorf("HasOpenTasks() after delete = %v, %v, want false", open, err)
+	}
+}
+
+func testListsAreSeparate(t *testing.T, svc service.Service) {
+	ctx := context.Background()
+	mustCreateList(t, svc, "Errands")
+	errands, err := svc.ResolveList(ctx, "Errands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defID := defaultID(t, svc)
+	mustCreateTask(t, svc, errands.ID, "Post office")
+	mustCreateTask(t, svc, defID, "Call mom")
+
+	if got := titles(openTasks(t, svc, errands.ID)); !sameSet(got, []string{"Post office"}) {
+		t.Errorf("Errands tasks = %q, want Post office", got)
+	}
+	if got := titles(openTasks(t, svc, defID)); !sameSet(got, []string{"Call mom"}) {
+		t.Errorf("default list tasks = %q, want Call mom", got)
+	}
+}
+
+func testPaging(t *testing.T, svc service.Service) {
+	ctx := context.Background()
+	listID := defaultID(t, svc)
+	n := service.PageSize + service.PageSize/2
+	var want []string
+	for i := range n {
+		title := fmt.Sprintf("Task %03d", i+1)
+		mustCreateTask(t, svc, listID, title)
+		want = append(want, title)
+	}
+
+	page1, err := svc.ListOpenTasks(ctx, listID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page2, err := svc.ListOpenTasks(ctx, listID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page1) != service.PageSize || len(page2) != n-service.PageSize {
+		t.Errorf("page sizes = %d, %d, want %d, %d", len(page1), len(page2), service.PageSize, n-service.PageSize)
+	}
+	if got := titles(append(page1, page2...)); !sameSet(got, want) {
+		t.Errorf("pages 1 and 2 do not hold each task once: %q", got)
+	}
+
+	for _, page := range []int{3, 10} {
+		tasks, err := svc.ListOpenTasks(ctx, listID, page)
+		if err != nil || len(tasks) != 0 {
+			t.Errorf("ListOpenTasks(page %d) = %d tasks, %v, want none", page, len(tasks), err)
+		}
+	}
+}
+
+func testOrderIsStable(t *testing.T, svc service.Service) {
+	ctx := context.Background()
+	listID := defaultID(t, svc)
+	for _, title := range []string{"One", "Two", "Three", "Four"} {
+		mustCreateTask(t, svc, listID, title)
+	}
+
+	first := titles(openTasks(t, svc, listID))
+	if again := titles(openTasks(t, svc, listID)); !slices.Equal(first, again) {
+		t.Errorf("order changed between reads: %q, then %q", first, again)
+	}
+
+	// Completing a task leaves the others in order
+	tasks := openTasks(t, svc, listID)
+	if err := svc.CompleteTask(ctx, listID, find(t, tasks, "Two").ID); err != nil {
+		t.Fatal(err)
+	}
+	want := slices.DeleteFunc(slices.Clone(first), func(s string) bool { return s == "Two" })
+	if got := titles(openTasks(t, svc, listID)); !slices.Equal(got, want) {
+		t.Errorf("order after completing Two = %q, want %q", got, want)
+	}
+}
+
+func testMissingTask(t *testing.T, svc service.Service) {
+	ctx := context.Background()
+	listID := defaultID(t, svc)
+	mustCreateTask(t, svc, listID, "Milk")
+	milk := find(t, openTasks(t, svc, listID), "Milk")
+	if err := svc.DeleteTask(ctx, listID, milk.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.CompleteTask(ctx, listID, milk.ID); err == nil {
+		t.Error("CompleteTask(deleted task) succeeded, want an error")
+	}
+	if err := svc.DeleteTask(ctx, listID, milk.ID); err == nil {
+		t.Error("DeleteTask(deleted task) succeeded, want an error")
+	}
+}
+
+// Helpers
+
+func mustLists(t *testing.T, svc service.Service) []service.TaskList {
+	t.Helper()
+	lists, err := svc.ListLists(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lists
+}
+
+func mustCreateList(t *testing.T, svc service.Service, name string) {
+	t.Helper()
+	if err := svc.CreateList(context.Background(), name); err != nil {
+		t.Fatalf("CreateList(%q): %v", name, err)
+	}
+}
+
+func mustCreateTask(t *testing.T, svc service.Service, listID, title string) {
+	t.Helper()
+	if err := svc.CreateTask(context.Background(), listID, title); err != nil {
+		t.Fatalf("CreateTask(%q): %v", title, err)
+	}
+}
+
+func defaultID(t *testing.T, svc service.Service) string {
+	t.Helper()
+	def, err := svc.DefaultList(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return def.ID
+}
+
+// openTasks returns all open tasks of a list, reading every page.
+func openTasks(t *testing.T, svc service.Service, listID string) []service.Task {
+	t.Helper()
+	tasks, err := service.AllOpenTasks(context.Background(), svc, listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tasks
+}
+
+func find(t *testing.T, tasks []service.Task, title string) service.Task {
+	t.Helper()
+	for _, task := range tasks {
+		if task.Title == title {
+			return task
+		}
+	}
+	t.Fatalf("no task %q in %q", title, titles(tasks))
+	return service.Task{}
+}
+
+func titles(tasks []service.Task) []string {
+	result := []string{}
+	for _, task := range tasks {
+		result = append(result, task.Title)
+	}
+	return result
+}
+
+// sameSet reports whether got holds the strings of want, each once, in
+// any order. Services may order new tasks first or last.
+func sameSet(got, want []string) bool {
+	a, b := slices.Clone(got), slices.Clone(want)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
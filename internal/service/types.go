@@ -1,12 +1,15 @@
 // Package service defines the backend-agnostic interface for task operations.
 package service
 
+import "time"
+
 // Task represents a single task item.
 type Task struct {
 	ID       string
 	Title    string
 	Position string
-	Status   string // "needsAction" or "completed"
+	Status   string    // "needsAction" or "completed"
+	Due      time.Time // zero if the task has no due date
 }
 
 // TaskList represents a task list.
@@ -14,10 +14,7 @@ import (
 const DefaultListID = "@default"
 
 // ErrNotFound is returned when a resource is not found.
-var ErrNotFound = errors.New("not found")
-
-// ErrAmbiguous is returned when multiple matches are found.
-var ErrAmbiguous = errors.New("ambiguous")
+var ErrNotFound = service.Conflict(errors.New("not found"))
 
 // FakeService is an in-memory implementation of service.Service for testing.
 type FakeService struct {
@@ -36,6 +33,9 @@ type FakeService struct {
 	CreateTaskErr    error
 	CompleteTaskErr  error
 	DeleteTaskErr    error
+
+	// PagesFetched records the pages requested by ListOpenTasks, in order.
+	PagesFetched []int
 }
 
 // NewFakeService creates a new FakeService with a default list.
@@ -107,25 +107,7 @@ func (f *FakeService) ResolveList(ctx context.Context, name string) (service.Tas
 	}
 	f.mu.RLock()
 	defer f.mu.RUnlock()
-
-	name = strings.TrimSpace(name)
-	nameLower := strings.ToLower(name)
-
-	var matches []service.TaskList
-	for _, l := range f.lists {
-		if strings.ToLower(strings.TrimSpace(l.Title)) == nameLower {
-			matches = append(matches, l)
-		}
-	}
-
-	switch len(matches) {
-	case 0:
-		return service.TaskList{}, ErrNotFound
-	case 1:
-		return matches[0], nil
-	default:
-		return service.TaskList{}, ErrAmbiguous
-	}
+	return service.MatchList(f.lists, name)
 }
 
 // CreateList implements service.Service.
@@ -166,8 +148,9 @@ func (f *FakeService) ListOpenTasks(ctx context.Context, listID string, page int
 	if err, ok := f.ListOpenTasksErr[listID]; ok && err != nil {
 		return nil, err
 	}
-	f.mu.RLock()
-	defer f.mu.RUnlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.PagesFetched = append(f.PagesFetched, page)
 
 	tasks, ok := f.tasks[listID]
 	if !ok {
@@ -0,0 +1,15 @@
+package testutil_test
+
+import (
+	"testing"
+
+	"gtask/internal/service"
+	"gtask/internal/service/servicetest"
+	"gtask/internal/testutil"
+)
+
+func TestFakeService_Conformance(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) service.Service {
+		return testutil.NewFakeService()
+	})
+}
@@ -0,0 +1,71 @@
+package tasksapi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+)
+
+// serveBatch answers a multipart/mixed batch request. Each part is an
+// application/http request, answered in a part with the Content-ID
+// "response-" followed by the request's Content-ID.
+func (s *Server) serveBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		writeError(w, http.StatusBadRequest, "invalid", "Batch requests must be multipart/mixed.")
+		return
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid batch request.")
+			return
+		}
+		inner, err := http.ReadRequest(bufio.NewReader(part))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid batch part.")
+			return
+		}
+		inner = inner.WithContext(r.Context())
+
+		rec := httptest.NewRecorder()
+		s.serve(rec, inner)
+		resp := rec.Result()
+
+		out, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-Id":   {"<response-" + strings.Trim(part.Header.Get("Content-Id"), "<>") + ">"},
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "backendError", err.Error())
+			return
+		}
+		fmt.Fprintf(out, "HTTP/1.1 %s\r\n", resp.Status)
+		resp.Header.Write(out)
+		fmt.Fprintf(out, "Content-Length: %d\r\n\r\n", rec.Body.Len())
+		out.Write(rec.Body.Bytes())
+	}
+	mw.Close()
+
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
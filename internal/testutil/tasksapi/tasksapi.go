@@ -0,0 +1,819 @@
+// Package tasksapi is an in-process emulator of the Google Tasks v1 REST
+// API for hermetic tests of the Google backend.
+//
+// It serves task lists and tasks (CRUD, move, clear), paging tokens,
+// ETags on the task list collection, batch requests and injected faults.
+// Requests are not authenticated. Drive the real client with Client:
+//
+//	api := tasksapi.NewServer()
+//	defer api.Close()
+//	c, err := googletasks.NewWithHTTPClient(ctx, api.Client())
+package tasksapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tasks "google.golang.org/api/tasks/v1"
+)
+
+const (
+	// DefaultListTitle is the title of the default list of a new Server.
+	DefaultListTitle = "My Tasks"
+
+	// Page sizes: tasklists.list returns up to maxLists lists, by
+	// default all; tasks.list defaultTaskLimit tasks, up to maxTasks.
+	maxLists         = 1000
+	defaultTaskLimit = 20
+	maxTasks         = 100
+)
+
+// Server emulates the Tasks API. The first list is the default list,
+// addressed as @default; it cannot be deleted. All methods are safe for
+// concurrent use.
+type Server struct {
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	lists    []*list
+	nextID   int
+	etag     int // version of the task list collection
+	faults   []*Fault
+	requests []string
+
+	// now returns the time stamped on changes.
+	now func() time.Time
+}
+
+// list is a task list with its tasks in API order: each task is
+// followed by its subtasks. Deleted tasks are kept for showDeleted.
+type list struct {
+	*tasks.TaskList
+	tasks []*tasks.Task
+}
+
+// Fault makes matching requests fail.
+type Fault struct {
+	// Method matches the request method; empty matches any.
+	Method string
+
+	// Path matches requests whose path below /tasks/v1/ starts with it,
+	// e.g. "users/@me/lists" or "lists/L1/tasks"; empty matches any. The
+	// parts of a batch request are matched on their own, so a fault can
+	// fail single items of a batch.
+	Path string
+
+	// Status is the HTTP status of the error response. Zero, with a
+	// Delay, lets the request through after the delay.
+	Status int
+
+	// Delay holds the response back, e.g. to trigger client timeouts. A
+	// request whose client gives up is answered no further.
+	Delay time.Duration
+
+	// Times is the number of requests to fail; zero fails all.
+	Times int
+
+	// RetryAfter, if set, is sent as the Retry-After header.
+	RetryAfter string
+
+	// Reason is the error reason of the response; empty means "injected".
+	// Google reports exhausted quota as 403 with "rateLimitExceeded" or
+	// "userRateLimitExceeded".
+	Reason string
+}
+
+// NewServer starts an emulator with an empty default list. Close it when
+// done.
+func NewServer() *Server {
+	s := &Server{now: time.Now}
+	s.lists = []*list{{TaskList: s.newList(DefaultListTitle)}}
+	s.srv = httptest.NewServer(s)
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// URL returns the base URL of the server.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Client returns an HTTP client that sends requests for any host to the
+// emulator, so clients using the real API endpoint need no
+// configuration.
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.srv.URL)
+	return &http.Client{Transport: &redirect{target: target, base: s.srv.Client().Transport}}
+}
+
+// SetNow sets the clock used for update times.
+func (s *Server) SetNow(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// Inject adds a fault. Faults are matched in the order they were added.
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns the requests received so far as "METHOD path?query".
+// The parts of a batch are not listed.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// ResetRequests clears the list returned by Requests.
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// DefaultListID returns the real ID of the default list.
+func (s *Server) DefaultListID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lists[0].Id
+}
+
+// AddList creates a list and returns its ID.
+func (s *Server) AddList(title string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := &list{TaskList: s.newList(title)}
+	s.lists = append(s.lists, l)
+	s.etag++
+	return l.Id
+}
+
+// AddTask appends an open task to a list (@default allowed) and returns
+// its ID. It panics if the list does not exist.
+func (s *Server) AddTask(listID, title string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.findList(listID)
+	if l == nil {
+		panic("tasksapi: no list " + listID)
+	}
+	t := s.newTask(&tasks.Task{Title: title, Status: "needsAction"})
+	l.tasks = append(l.tasks, t)
+	renumber(l)
+	return t.Id
+}
+
+// Task returns a copy of a task, including deleted ones, or nil.
+func (s *Server) Task(listID, taskID string) *tasks.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.findList(listID)
+	if l == nil {
+		return nil
+	}
+	for _, t := range l.tasks {
+		if t.Id == taskID {
+			c := *t
+			return &c
+		}
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	s.mu.Unlock()
+
+	if r.URL.Path == "/batch/tasks/v1" || r.URL.Path == "/batch" {
+		if s.fault(w, r, "") {
+			return
+		}
+		s.serveBatch(w, r)
+		return
+	}
+	s.serve(w, r)
+}
+
+// serve answers a request to the REST API, which may be a part of a
+// batch.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutPrefix(r.URL.EscapedPath(), "/tasks/v1/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+		return
+	}
+	if s.fault(w, r, path) {
+		return
+	}
+	var parts []string
+	for _, p := range strings.Split(path, "/") {
+		p, err := url.PathUnescape(p)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid path")
+			return
+		}
+		parts = append(parts, p)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case match(parts, "users", "@me", "lists"):
+		switch r.Method {
+		case http.MethodGet:
+			s.listLists(w, r)
+		case http.MethodPost:
+			s.insertList(w, r)
+		default:
+			methodNotAllowed(w)
+		}
+	case match(parts, "users", "@me", "lists", "*"):
+		switch r.Method {
+		case http.MethodGet:
+			s.getList(w, parts[3])
+		case http.MethodPut, http.MethodPatch:
+			s.updateList(w, r, parts[3])
+		case http.MethodDelete:
+			s.deleteList(w, parts[3])
+		default:
+			methodNotAllowed(w)
+		}
+	case match(parts, "lists", "*", "tasks"):
+		switch r.Method {
+		case http.MethodGet:
+			s.listTasks(w, r, parts[1])
+		case http.MethodPost:
+			s.insertTask(w, r, parts[1])
+		default:
+			methodNotAllowed(w)
+		}
+	case match(parts, "lists", "*", "tasks", "*"):
+		switch r.Method {
+		case http.MethodGet:
+			s.getTask(w, parts[1], parts[3])
+		case http.MethodPut, http.MethodPatch:
+			s.updateTask(w, r, parts[1], parts[3])
+		case http.MethodDelete:
+			s.deleteTask(w, parts[1], parts[3])
+		default:
+			methodNotAllowed(w)
+		}
+	case match(parts, "lists", "*", "tasks", "*", "move") && r.Method == http.MethodPost:
+		s.moveTask(w, r, parts[1], parts[3])
+	case match(parts, "lists", "*", "clear") && r.Method == http.MethodPost:
+		s.clear(w, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+	}
+}
+
+// match reports whether path has the segments of pattern, where "*"
+// matches any segment.
+func match(path []string, pattern ...string) bool {
+	if len(path) != len(pattern) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && p != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fault applies the first matching fault. It reports whether the request
+// was answered. path is the request path below /tasks/v1/.
+func (s *Server) fault(w http.ResponseWriter, r *http.Request, path string) bool {
+	s.mu.Lock()
+	var f *Fault
+	for i, c := range s.faults {
+		if (c.Method == "" || c.Method == r.Method) && strings.HasPrefix(path, c.Path) {
+			f = c
+			if c.Times > 0 {
+				if c.Times--; c.Times == 0 {
+					s.faults = append(s.faults[:i], s.faults[i+1:]...)
+				}
+			}
+			break
+		}
+	}
+	s.mu.Unlock()
+	if f == nil {
+		return false
+	}
+
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+	if f.Status == 0 {
+		return false
+	}
+	if f.RetryAfter != "" {
+		w.Header().Set("Retry-After", f.RetryAfter)
+	}
+	reason := f.Reason
+	if reason == "" {
+		reason = "injected"
+	}
+	writeError(w, f.Status, reason, http.StatusText(f.Status))
+	return true
+}
+
+// Task lists
+
+func (s *Server) listLists(w http.ResponseWriter, r *http.Request) {
+	etag := strconv.Quote(fmt.Sprintf("lists-%d", s.etag))
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	start, limit, ok := page(w, r, maxLists, maxLists)
+	if !ok {
+		return
+	}
+	resp := &tasks.TaskLists{Kind: "tasks#taskLists", Etag: etag, Items: []*tasks.TaskList{}}
+	for _, l := range s.lists[min(start, len(s.lists)):min(start+limit, len(s.lists))] {
+		resp.Items = append(resp.Items, l.TaskList)
+	}
+	if start+limit < len(s.lists) {
+		resp.NextPageToken = strconv.Itoa(start + limit)
+	}
+	w.Header().Set("ETag", etag)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) getList(w http.ResponseWriter, id string) {
+	l := s.findList(id)
+	if l == nil {
+		writeError(w, http.StatusNotFound, "notFound", "Task list not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, l.TaskList)
+}
+
+func (s *Server) insertList(w http.ResponseWriter, r *http.Request) {
+	var in tasks.TaskList
+	if !decode(w, r, &in) {
+		return
+	}
+	if strings.TrimSpace(in.Title) == "" {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid task list title.")
+		return
+	}
+	l := &list{TaskList: s.newList(in.Title)}
+	s.lists = append(s.lists, l)
+	s.etag++
+	writeJSON(w, http.StatusOK, l.TaskList)
+}
+
+func (s *Server) updateList(w http.ResponseWriter, r *http.Request, id string) {
+	l := s.findList(id)
+	if l == nil {
+		writeError(w, http.StatusNotFound, "notFound", "Task list not found.")
+		return
+	}
+	var in tasks.TaskList
+	if !decode(w, r, &in) {
+		return
+	}
+	if in.Title != "" {
+		l.Title = in.Title
+	}
+	s.touchList(l)
+	s.etag++
+	writeJSON(w, http.StatusOK, l.TaskList)
+}
+
+func (s *Server) deleteList(w http.ResponseWriter, id string) {
+	for i, l := range s.lists {
+		if l.Id != id && (id != "@default" || i != 0) {
+			continue
+		}
+		if i == 0 {
+			writeError(w, http.StatusBadRequest, "invalid", "Cannot delete the default task list.")
+			return
+		}
+		s.lists = append(s.lists[:i], s.lists[i+1:]...)
+		s.etag++
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeError(w, http.StatusNotFound, "notFound", "Task list not found.")
+}
+
+// Tasks
+
+func (s *Server) listTasks(w http.ResponseWriter, r *http.Request, listID string) {
+	l := s.findList(listID)
+	if l == nil {
+		writeError(w, http.StatusNotFound, "notFound", "Task list not found.")
+		return
+	}
+	q := r.URL.Query()
+	showCompleted := q.Get("showCompleted") != "false"
+	showDeleted := q.Get("showDeleted") == "true"
+	showHidden := q.Get("showHidden") == "true"
+	var updatedMin time.Time
+	if v := q.Get("updatedMin"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid updatedMin.")
+			return
+		}
+		updatedMin = t
+	}
+	start, limit, ok := page(w, r, defaultTaskLimit, maxTasks)
+	if !ok {
+		return
+	}
+
+	var matched []*tasks.Task
+	for _, t := range l.tasks {
+		switch {
+		case t.Deleted && !showDeleted:
+		case t.Hidden && !showHidden:
+		case t.Status == "completed" && !showCompleted:
+		case !updatedMin.IsZero() && parseTime(t.Updated).Before(updatedMin):
+		default:
+			matched = append(matched, t)
+		}
+	}
+
+	resp := &tasks.Tasks{Kind: "tasks#tasks", Etag: strconv.Quote(fmt.Sprintf("tasks-%d", len(l.tasks))), Items: []*tasks.Task{}}
+	resp.Items = append(resp.Items, matched[min(start, len(matched)):min(start+limit, len(matched))]...)
+	if start+limit < len(matched) {
+		resp.NextPageToken = strconv.Itoa(start + limit)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) getTask(w http.ResponseWriter, listID, taskID string) {
+	_, t := s.find(w, listID, taskID)
+	if t == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) insertTask(w http.ResponseWriter, r *http.Request, listID string) {
+	l := s.findList(listID)
+	if l == nil {
+		writeError(w, http.StatusNotFound, "notFound", "Task list not found.")
+		return
+	}
+	var in tasks.Task
+	if !decode(w, r, &in) {
+		return
+	}
+	t := s.newTask(&tasks.Task{Title: in.Title, Notes: in.Notes, Due: in.Due, Status: "needsAction"})
+	if in.Status == "completed" {
+		setStatus(t, "completed", s.stamp())
+	}
+	q := r.URL.Query()
+	if !place(w, l, t, q.Get("parent"), q.Get("previous")) {
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) updateTask(w http.ResponseWriter, r *http.Request, listID, taskID string) {
+	l, t := s.find(w, listID, taskID)
+	if t == nil {
+		return
+	}
+	var in map[string]json.RawMessage
+	if !decode(w, r, &in) {
+		return
+	}
+	for key, raw := range in {
+		var v string
+		switch key {
+		case "title", "notes", "status", "due":
+			if err := json.Unmarshal(raw, &v); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid", "Invalid value for "+key+".")
+				return
+			}
+		default:
+			continue
+		}
+		switch key {
+		case "title":
+			t.Title = v
+		case "notes":
+			t.Notes = v
+		case "due":
+			t.Due = v
+		case "status":
+			if v != "needsAction" && v != "completed" {
+				writeError(w, http.StatusBadRequest, "invalid", "Invalid task status.")
+				return
+			}
+			setStatus(t, v, s.stamp())
+		}
+	}
+	s.touchTask(t)
+	s.touchList(l)
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) deleteTask(w http.ResponseWriter, listID, taskID string) {
+	l, t := s.find(w, listID, taskID)
+	if t == nil {
+		return
+	}
+	// Subtasks go with their parent
+	for _, c := range l.tasks {
+		if c == t || c.Parent == t.Id {
+			c.Deleted = true
+			s.touchTask(c)
+		}
+	}
+	s.touchList(l)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) moveTask(w http.ResponseWriter, r *http.Request, listID, taskID string) {
+	l, t := s.find(w, listID, taskID)
+	if t == nil {
+		return
+	}
+	q := r.URL.Query()
+	if !place(w, l, t, q.Get("parent"), q.Get("previous")) {
+		return
+	}
+	s.touchTask(t)
+	s.touchList(l)
+	writeJSON(w, http.StatusOK, t)
+}
+
+// clear hides the completed tasks of a list.
+func (s *Server) clear(w http.ResponseWriter, listID string) {
+	l := s.findList(listID)
+	if l == nil {
+		writeError(w, http.StatusNotFound, "notFound", "Task list not found.")
+		return
+	}
+	for _, t := range l.tasks {
+		if t.Status == "completed" && !t.Hidden && !t.Deleted {
+			t.Hidden = true
+			s.touchTask(t)
+		}
+	}
+	s.touchList(l)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Helpers; callers hold s.mu
+
+// findList returns the list with id, or the default list for @default.
+func (s *Server) findList(id string) *list {
+	if id == "@default" {
+		return s.lists[0]
+	}
+	for _, l := range s.lists {
+		if l.Id == id {
+			return l
+		}
+	}
+	return nil
+}
+
+// find returns a list and a task in it that is not deleted, or answers
+// with 404.
+func (s *Server) find(w http.ResponseWriter, listID, taskID string) (*list, *tasks.Task) {
+	l := s.findList(listID)
+	if l == nil {
+		writeError(w, http.StatusNotFound, "notFound", "Task list not found.")
+		return nil, nil
+	}
+	for _, t := range l.tasks {
+		if t.Id == taskID && !t.Deleted {
+			return l, t
+		}
+	}
+	writeError(w, http.StatusNotFound, "notFound", "Task not found.")
+	return nil, nil
+}
+
+func (s *Server) newList(title string) *tasks.TaskList {
+	s.nextID++
+	l := &tasks.TaskList{Kind: "tasks#taskList", Id: fmt.Sprintf("list-%d", s.nextID), Title: title}
+	s.touchList(&list{TaskList: l})
+	return l
+}
+
+func (s *Server) newTask(t *tasks.Task) *tasks.Task {
+	s.nextID++
+	t.Kind = "tasks#task"
+	t.Id = fmt.Sprintf("task-%d", s.nextID)
+	s.touchTask(t)
+	return t
+}
+
+func (s *Server) stamp() string {
+	return s.now().UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func (s *Server) touchList(l *list) {
+	s.nextID++
+	l.Updated = s.stamp()
+	l.Etag = strconv.Quote(fmt.Sprintf("v%d", s.nextID))
+}
+
+func (s *Server) touchTask(t *tasks.Task) {
+	s.nextID++
+	t.Updated = s.stamp()
+	t.Etag = strconv.Quote(fmt.Sprintf("v%d", s.nextID))
+}
+
+// setStatus sets the status of t, stamping or clearing its completion
+// time.
+func setStatus(t *tasks.Task, status, now string) {
+	t.Status = status
+	if status == "completed" {
+		if t.Completed == nil {
+			t.Completed = &now
+		}
+	} else {
+		t.Completed = nil
+	}
+}
+
+// place moves t (with its subtasks) to the first position below parent,
+// or right after the sibling previous. Either may be empty. It answers
+// with 400 for an unknown parent or previous.
+func place(w http.ResponseWriter, l *list, t *tasks.Task, parent, previous string) bool {
+	if parent == t.Id || previous == t.Id {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid task position.")
+		return false
+	}
+	indexOf := func(id string) int {
+		for i, c := range l.tasks {
+			if c.Id == id && !c.Deleted {
+				return i
+			}
+		}
+		return -1
+	}
+	if parent != "" && (indexOf(parent) < 0 || l.tasks[indexOf(parent)].Parent != "") {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid parent task.")
+		return false
+	}
+	if previous != "" && (indexOf(previous) < 0 || l.tasks[indexOf(previous)].Parent != parent) {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid previous task.")
+		return false
+	}
+
+	// Take t and its subtasks out
+	var block, rest []*tasks.Task
+	for _, c := range l.tasks {
+		if c == t || (c.Parent == t.Id && t.Id != "") {
+			block = append(block, c)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+	if parent != "" && len(block) > 1 {
+		writeError(w, http.StatusBadRequest, "invalid", "Tasks with subtasks cannot become subtasks.")
+		return false
+	}
+	if len(block) == 0 {
+		block = []*tasks.Task{t}
+	}
+	t.Parent = parent
+	l.tasks = rest
+
+	at := 0
+	switch {
+	case previous != "":
+		at = indexOf(previous) + 1
+		for at < len(l.tasks) && l.tasks[at].Parent == previous {
+			at++
+		}
+	case parent != "":
+		at = indexOf(parent) + 1
+	}
+	l.tasks = append(l.tasks[:at], append(block, l.tasks[at:]...)...)
+	renumber(l)
+	return true
+}
+
+// renumber sets the positions of the tasks of l from their order among
+// their siblings.
+func renumber(l *list) {
+	next := make(map[string]int)
+	for _, t := range l.tasks {
+		if t.Deleted {
+			continue
+		}
+		t.Position = fmt.Sprintf("%020d", next[t.Parent])
+		next[t.Parent]++
+	}
+}
+
+// page parses pageToken and maxResults.
+func page(w http.ResponseWriter, r *http.Request, def, max int) (start, limit int, ok bool) {
+	q := r.URL.Query()
+	limit = def
+	if v := q.Get("maxResults"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid maxResults.")
+			return 0, 0, false
+		}
+		limit = min(n, max)
+	}
+	if v := q.Get("pageToken"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid page token.")
+			return 0, 0, false
+		}
+		start = n
+	}
+	return start, limit, true
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.Body == nil || r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "parseError", "Parse Error")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with an error in the format of Google APIs.
+func writeError(w http.ResponseWriter, status int, reason, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"code":    status,
+			"message": message,
+			"errors": []map[string]string{
+				{"domain": "global", "reason": reason, "message": message},
+			},
+		},
+	})
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, "methodNotAllowed", "Method Not Allowed")
+}
+
+// redirect sends requests for any host to target.
+type redirect struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+	return t.base.RoundTrip(req)
+}
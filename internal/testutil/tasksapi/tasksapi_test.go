@@ -0,0 +1,97 @@
+package tasksapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	tasks "google.golang.org/api/tasks/v1"
+)
+
+func newService(t *testing.T) (*tasks.Service, *Server) {
+	t.Helper()
+	api := NewServer()
+	t.Cleanup(api.Close)
+	svc, err := tasks.NewService(context.Background(), option.WithHTTPClient(api.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc, api
+}
+
+func titles(t *testing.T, svc *tasks.Service, listID string, hidden bool) []string {
+	t.Helper()
+	resp, err := svc.Tasks.List(listID).ShowHidden(hidden).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, task := range resp.Items {
+		title := task.Title
+		if task.Parent != "" {
+			title = "  " + title
+		}
+		result = append(result, title)
+	}
+	return result
+}
+
+func TestServer_MoveAndClear(t *testing.T) {
+	svc, api := newService(t)
+	a := api.AddTask("@default", "A")
+	b := api.AddTask("@default", "B")
+	c := api.AddTask("@default", "C")
+
+	// C under A, then B first
+	if _, err := svc.Tasks.Move("@default", c).Parent(a).Do(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Tasks.Move("@default", b).Do(); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(t, svc, "@default", false); len(got) != 3 || got[0] != "B" || got[1] != "A" || got[2] != "  C" {
+		t.Errorf("unexpected order after move: %q", got)
+	}
+	// Moving a parent moves its subtasks with it
+	if _, err := svc.Tasks.Move("@default", a).Do(); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(t, svc, "@default", false); got[0] != "A" || got[1] != "  C" || got[2] != "B" {
+		t.Errorf("unexpected order after moving parent: %q", got)
+	}
+	if _, err := svc.Tasks.Move("@default", b).Parent(a).Previous("missing").Do(); err == nil {
+		t.Error("expected an error for an unknown previous task")
+	}
+
+	if _, err := svc.Tasks.Patch("@default", c, &tasks.Task{Status: "completed"}).Do(); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Tasks.Clear("@default").Do(); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(t, svc, "@default", false); len(got) != 2 {
+		t.Errorf("expected cleared task hidden, got %q", got)
+	}
+	if got := titles(t, svc, "@default", true); len(got) != 3 {
+		t.Errorf("expected cleared task with showHidden, got %q", got)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	svc, api := newService(t)
+	api.Inject(Fault{Method: http.MethodGet, Path: "users/@me/lists", Status: http.StatusTooManyRequests, Times: 1, RetryAfter: "3"})
+
+	_, err := svc.Tasklists.List().Do()
+	gerr, ok := err.(*googleapi.Error)
+	if !ok || gerr.Code != http.StatusTooManyRequests || gerr.Header.Get("Retry-After") != "3" {
+		t.Fatalf("expected injected 429, got %v", err)
+	}
+	if _, err := svc.Tasklists.List().Do(); err != nil {
+		t.Errorf("expected the fault to fire once, got %v", err)
+	}
+	if got := api.Requests(); len(got) != 2 {
+		t.Errorf("expected 2 requests, got %q", got)
+	}
+}
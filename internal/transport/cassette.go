@@ -0,0 +1,276 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"gtask/internal/fsutil"
+)
+
+// CassetteVersion is the format version written to cassettes.
+const CassetteVersion = 1
+
+// Cassette is a sanitized recording of HTTP exchanges, stored as JSON.
+// Credentials and email addresses are scrubbed (see Scrub); task titles and
+// other content are kept, so review a cassette before sharing it.
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the recorded part of a request. Only the headers in
+// recordedRequestHeaders are kept; Authorization never is.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the recorded part of a response. Only the headers
+// in recordedResponseHeaders are kept.
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+var (
+	recordedRequestHeaders  = []string{"Content-Type", "If-None-Match"}
+	recordedResponseHeaders = []string{"Content-Type", "Etag", "Retry-After"}
+)
+
+// ErrNotRecorded is returned by Replay for a request that has no unused
+// recorded interaction.
+var ErrNotRecorded = errors.New("replay: no recorded response")
+
+// scrubbedEmail replaces email addresses in cassettes.
+const scrubbedEmail = "user@example.com"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+
+	// credentialPattern matches credential values in JSON
+	// ("access_token": "...") and form bodies (access_token=...).
+	credentialPattern = regexp.MustCompile(`(?i)("(?:` + credentialNames() + `)"\s*:\s*")[^"]*(")|\b((?:` + credentialNames() + `)=)[^&\s"]*`)
+)
+
+// credentialNames returns the credential parameter names of RedactURL as
+// a regexp alternation.
+func credentialNames() string {
+	var names []string
+	for name := range redactedQuery {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	slices.Sort(names)
+	return strings.Join(names, "|")
+}
+
+// Scrub replaces credentials (the parameters redacted by RedactURL, as
+// JSON fields or form values) with Redacted and email addresses with
+// user@example.com.
+func Scrub(s string) string {
+	s = credentialPattern.ReplaceAllString(s, "${1}${3}"+Redacted+"${2}")
+	return emailPattern.ReplaceAllString(s, scrubbedEmail)
+}
+
+// recordedURL returns the sanitized URL of req, as stored in cassettes
+// and matched on replay.
+func recordedURL(req *http.Request) string {
+	return Scrub(RedactURL(req.URL))
+}
+
+// keepHeaders returns the names of h in keep, scrubbed.
+func keepHeaders(h http.Header, keep []string) http.Header {
+	var kept http.Header
+	for _, name := range keep {
+		if v := h.Values(name); len(v) > 0 {
+			if kept == nil {
+				kept = make(http.Header)
+			}
+			for _, value := range v {
+				kept.Add(name, Scrub(value))
+			}
+		}
+	}
+	return kept
+}
+
+// Record is a RoundTripper that records sanitized exchanges to a cassette
+// file. The file is rewritten after every exchange, so it is complete even
+// if the command fails. Place it above the OAuth transport so that
+// requests are recorded before the Authorization header is added and
+// token refreshes are not recorded.
+type Record struct {
+	// Base sends the requests. Nil means http.DefaultTransport.
+	Base http.RoundTripper
+
+	// Path is the cassette file, written with mode 0600.
+	Path string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecord wraps base to record to the cassette at path.
+func NewRecord(base http.RoundTripper, path string) *Record {
+	return &Record{Base: base, Path: path, cassette: Cassette{Version: CassetteVersion}}
+}
+
+// RoundTrip implements http.RoundTripper. Requests that fail without a
+// response are not recorded.
+func (t *Record) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// Read the body of a copy; RoundTrippers must not modify the request
+	req = req.Clone(req.Context())
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetBody != nil {
+		// Retries below re-read the body
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(reqBody)), nil }
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    recordedURL(req),
+			Header: keepHeaders(req.Header, recordedRequestHeaders),
+			Body:   Scrub(string(reqBody)),
+		},
+		Response: RecordedResponse{
+			Status: resp.StatusCode,
+			Header: keepHeaders(resp.Header, recordedResponseHeaders),
+			Body:   Scrub(string(respBody)),
+		},
+	})
+	data, err := json.MarshalIndent(&t.cassette, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := fsutil.WriteFileAtomic(t.Path, append(data, '\n'), 0600); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("recording to %s: %w", t.Path, err)
+	}
+	return resp, nil
+}
+
+// readBody reads *body and replaces it with a reader over the same bytes.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// Replay is a RoundTripper that answers requests from a cassette instead
+// of the network. A request gets the first unused interaction with the
+// same method and sanitized URL, so repeated requests are answered in
+// recorded order. Bodies are not compared: batch requests carry random
+// multipart boundaries.
+type Replay struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewReplay loads the cassette at path.
+func NewReplay(path string) (*Replay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	if c.Version != CassetteVersion {
+		return nil, fmt.Errorf("invalid cassette %s: unsupported version %d", path, c.Version)
+	}
+	return &Replay{interactions: c.Interactions, used: make([]bool, len(c.Interactions))}, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Replay) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	url := recordedURL(req)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, in := range t.interactions {
+		if t.used[i] || in.Request.Method != req.Method || in.Request.URL != url {
+			continue
+		}
+		t.used[i] = true
+		header := in.Response.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w for %s %s", ErrNotRecorded, req.Method, url)
+}
+
+// Unused returns the number of recorded interactions not replayed yet.
+func (t *Replay) Unused() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, used := range t.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestScrub(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{`{"access_token": "ya29.secret", "expires_in": 3599}`, `{"access_token": "REDACTED", "expires_in": 3599}`},
+		{`grant_type=refresh_token&refresh_token=1//secret&client_secret=shh`, `grant_type=refresh_token&refresh_token=REDACTED&client_secret=REDACTED`},
+		{`{"title": "Call jane.doe@mail.example.com"}`, `{"title": "Call user@example.com"}`},
+		{`{"nextPageToken": "Q0FF", "code": 404}`, `{"nextPageToken": "Q0FF", "code": 404}`},
+	}
+	for _, tt := range tests {
+		if got := Scrub(tt.in); got != tt.want {
+			t.Errorf("Scrub(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	calls := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		body, _ := io.ReadAll(req.Body)
+		resp := response(http.StatusOK)
+		resp.Header = http.Header{"Content-Type": {"application/json"}, "Set-Cookie": {"session=secret"}}
+		resp.Body = io.NopCloser(strings.NewReader(`{"n": ` + strconv.Itoa(calls) + `, "got": ` + string(body) + `, "email": "me@mail.example.com"}`))
+		return resp, nil
+	})
+	rt := NewRecord(base, path)
+
+	for _, body := range []string{`"a"`, `"b"`} {
+		req, _ := http.NewRequest(http.MethodPost, "https://tasks.example/lists?access_token=secret-access", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret-bearer")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The caller still gets the whole body
+		if got, _ := io.ReadAll(resp.Body); !strings.Contains(string(got), body) {
+			t.Errorf("response body %q lacks %s", got, body)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-access", "secret-bearer", "Authorization", "Set-Cookie", "me@mail.example.com"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, data)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected cassette with mode 0600, got %v, %v", info.Mode(), err)
+	}
+
+	replay, err := NewReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Repeated requests are answered in recorded order
+	for _, want := range []string{`"n": 1`, `"n": 2`} {
+		req, _ := http.NewRequest(http.MethodPost, "https://tasks.example/lists?access_token=other", strings.NewReader(`"x"`))
+		resp, err := replay.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" || !strings.Contains(string(got), want) {
+			t.Errorf("unexpected replayed response %d %v %s", resp.StatusCode, resp.Header, got)
+		}
+	}
+	if replay.Unused() != 0 {
+		t.Errorf("expected all interactions replayed, %d unused", replay.Unused())
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://tasks.example/lists", nil)
+	_, err = replay.RoundTrip(req)
+	if !errors.Is(err, ErrNotRecorded) || !strings.Contains(err.Error(), "POST https://tasks.example/lists") {
+		t.Errorf("expected not recorded error, got %v", err)
+	}
+}
+
+func TestNewReplay_RejectsInvalidCassettes(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"garbage.json": "not json",
+		"future.json":  `{"version": 99, "interactions": []}`,
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0600)
+		if _, err := NewReplay(path); err == nil || !strings.Contains(err.Error(), "invalid cassette") {
+			t.Errorf("%s: expected invalid cassette error, got %v", name, err)
+		}
+	}
+}
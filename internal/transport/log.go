@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redactedQuery names query parameters that carry credentials. Their
+// values are replaced when URLs are logged.
+var redactedQuery = map[string]bool{
+	"access_token":  true,
+	"refresh_token": true,
+	"id_token":      true,
+	"token":         true,
+	"key":           true,
+	"code":          true,
+	"client_secret": true,
+	"password":      true,
+}
+
+// Redacted replaces credential values in logged text.
+const Redacted = "REDACTED"
+
+// Log logs every request at debug level with method, URL, status, latency,
+// the number of retries made by a Retry below it and the time a RateLimit
+// below it held the request back. Headers and bodies are not logged, and
+// credentials in the URL are redacted (see RedactURL), so Authorization
+// headers and tokens never reach the log.
+type Log struct {
+	// Base sends the requests. Nil means http.DefaultTransport.
+	Base http.RoundTripper
+
+	// Logger receives the request logs.
+	Logger *slog.Logger
+
+	// Stats, if not nil, counts the requests for a summary.
+	Stats *Stats
+}
+
+// NewLog wraps base to log requests to logger and count them in stats
+// (may be nil).
+func NewLog(base http.RoundTripper, logger *slog.Logger, stats *Stats) *Log {
+	return &Log{Base: base, Logger: logger, Stats: stats}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Log) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// Retry and RateLimit report through the request context
+	info := &requestInfo{}
+	req = req.WithContext(context.WithValue(req.Context(), requestInfoKey{}, info))
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	t.Stats.add(status, err, info, elapsed)
+
+	attrs := []any{
+		"method", req.Method,
+		"url", RedactURL(req.URL),
+		"status", status,
+		"latency", elapsed.Round(time.Millisecond),
+		"retries", info.retries,
+	}
+	if info.throttled > 0 {
+		attrs = append(attrs, "throttled", info.throttled.Round(time.Millisecond))
+	}
+	if err != nil {
+		attrs = append(attrs, "error", redactError(err, req.URL))
+	}
+	t.Logger.Debug("http request", attrs...)
+	return resp, err
+}
+
+// requestInfo collects what the middleware below Log did with a request.
+// Retry attempts of one request run one after another, so no lock is
+// needed.
+type requestInfo struct {
+	retries   int
+	throttled time.Duration // time spent waiting in RateLimit
+}
+
+// requestInfoKey is the context key for the requestInfo of a request.
+type requestInfoKey struct{}
+
+// countRetry records that Retry is making its attempt-th retry of the
+// request with context ctx.
+func countRetry(ctx context.Context, attempt int) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.retries = attempt
+	}
+}
+
+// countThrottled records that RateLimit held an attempt of the request
+// with context ctx back for d.
+func countThrottled(ctx context.Context, d time.Duration) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.throttled += d
+	}
+}
+
+// RedactURL returns u as a string with the password and the values of
+// credential query parameters replaced by Redacted.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	c := *u
+	if c.User != nil {
+		if _, ok := c.User.Password(); ok {
+			c.User = url.UserPassword(c.User.Username(), Redacted)
+		}
+	}
+	if c.RawQuery != "" {
+		q := c.Query()
+		for name := range q {
+			if redactedQuery[strings.ToLower(name)] {
+				q.Set(name, Redacted)
+			}
+		}
+		c.RawQuery = q.Encode()
+	}
+	return c.String()
+}
+
+// redactError returns the message of err with the request URL redacted.
+func redactError(err error, u *url.URL) string {
+	msg := err.Error()
+	if u != nil {
+		msg = strings.ReplaceAll(msg, u.String(), RedactURL(u))
+	}
+	return msg
+}
+
+// Stats counts the requests seen by Log. The zero value is ready to use;
+// methods on a nil *Stats do nothing.
+type Stats struct {
+	mu        sync.Mutex
+	calls     int
+	failures  int
+	retries   int
+	throttled int
+	waited    time.Duration
+	elapsed   time.Duration
+}
+
+func (s *Stats) add(status int, err error, info *requestInfo, elapsed time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if err != nil || status >= 400 {
+		s.failures++
+	}
+	s.retries += info.retries
+	if info.throttled > 0 {
+		s.throttled++
+		s.waited += info.throttled
+	}
+	s.elapsed += elapsed
+}
+
+// Attrs returns the counts as slog key-value pairs: calls, failed,
+// retries, throttled (requests held back by RateLimit), the time they
+// waited, and the total time spent in requests.
+func (s *Stats) Attrs() []any {
+	if s == nil {
+		return []any{"calls", 0}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return []any{
+		"calls", s.calls,
+		"failed", s.failures,
+		"retries", s.retries,
+		"throttled", s.throttled,
+		"waited", s.waited.Round(time.Millisecond),
+		"time", s.elapsed.Round(time.Millisecond),
+	}
+}
+
+// statsKey is the context key for the Stats of a run.
+type statsKey struct{}
+
+// WithStats returns a context carrying stats, for backends that create
+// their HTTP clients from it (see StatsFrom).
+func WithStats(ctx context.Context, stats *Stats) context.Context {
+	return context.WithValue(ctx, statsKey{}, stats)
+}
+
+// StatsFrom returns the Stats stored by WithStats, or nil.
+func StatsFrom(ctx context.Context) *Stats {
+	s, _ := ctx.Value(statsKey{}).(*Stats)
+	return s
+}
@@ -0,0 +1,187 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultQuotaPause is how long a RateLimit stops sending after a quota
+// response without a usable Retry-After header.
+const DefaultQuotaPause = time.Second
+
+// maxErrorBody is how much of a 403 response body RateLimit reads to look
+// for a quota reason.
+const maxErrorBody = 64 << 10
+
+// Limiter is a token bucket: it holds up to burst tokens and gains rate
+// tokens per second; every request takes one. It is safe for concurrent
+// use, so one Limiter can pace all requests of a client.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	until  time.Time // no tokens are handed out before this (see Pause)
+}
+
+// NewLimiter returns a full bucket allowing rate requests per second on
+// average and bursts of up to burst requests.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{rate: rate, burst: float64(burst), tokens: float64(burst), now: time.Now}
+}
+
+// reserve takes a token and returns how long the caller must wait before
+// using it.
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if pause := l.until.Sub(now); pause > wait {
+		wait = pause
+	}
+	return wait
+}
+
+// release returns a token taken by reserve that was not used.
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+}
+
+// Pause stops handing out tokens for d, e.g. after the server reported
+// that the quota is used up.
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.now().Add(d); until.After(l.until) {
+		l.until = until
+	}
+}
+
+// RateLimit paces requests with a Limiter. A 429 Too Many Requests
+// response, or a 403 whose error reason is a quota (see IsQuotaReason),
+// pauses the limiter for the server's Retry-After time, so requests from
+// other goroutines back off too. Place it below Retry so that retries are
+// paced as well.
+type RateLimit struct {
+	// Base sends the requests. Nil means http.DefaultTransport.
+	Base http.RoundTripper
+
+	// Limiter paces the requests.
+	Limiter *Limiter
+}
+
+// NewRateLimit wraps base to send at most rate requests per second on
+// average, in bursts of up to burst.
+func NewRateLimit(base http.RoundTripper, rate float64, burst int) *RateLimit {
+	return &RateLimit{Base: base, Limiter: NewLimiter(rate, burst)}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RateLimit) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if wait := t.Limiter.reserve(); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			countThrottled(req.Context(), wait)
+		case <-req.Context().Done():
+			timer.Stop()
+			t.Limiter.release()
+			return nil, req.Context().Err()
+		}
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err == nil && quotaExceeded(resp) {
+		t.Limiter.Pause(retryAfter(resp.Header.Get("Retry-After")))
+	}
+	return resp, err
+}
+
+// IsQuotaReason reports whether reason, from the error of a Google API
+// response, means that a rate limit quota is used up. Google answers these
+// with 403, not 429.
+func IsQuotaReason(reason string) bool {
+	return reason == "rateLimitExceeded" || reason == "userRateLimitExceeded"
+}
+
+// quotaExceeded reports whether resp says that the quota is used up. The
+// start of a 403 body is read for the error reasons and put back.
+func quotaExceeded(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+	default:
+		return false
+	}
+	if resp.Body == nil {
+		return false
+	}
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	var body struct {
+		Error struct {
+			Errors []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(head, &body) != nil {
+		return false
+	}
+	for _, e := range body.Error.Errors {
+		if IsQuotaReason(e.Reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header (seconds or an HTTP date).
+func retryAfter(v string) time.Duration {
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return DefaultQuotaPause
+}
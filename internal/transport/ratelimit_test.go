@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter_TokenBucket(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	l := NewLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	// A full bucket allows a burst
+	for i := range 3 {
+		if wait := l.reserve(); wait != 0 {
+			t.Fatalf("request %d: expected no wait, got %s", i+1, wait)
+		}
+	}
+	// Then one token every half second
+	if wait := l.reserve(); wait != 500*time.Millisecond {
+		t.Errorf("expected 500ms wait, got %s", wait)
+	}
+	if wait := l.reserve(); wait != time.Second {
+		t.Errorf("expected 1s wait, got %s", wait)
+	}
+
+	// Tokens refill with time, up to the burst
+	now = now.Add(time.Minute)
+	if wait := l.reserve(); wait != 0 {
+		t.Errorf("expected no wait after refill, got %s", wait)
+	}
+
+	l.Pause(3 * time.Second)
+	if wait := l.reserve(); wait != 3*time.Second {
+		t.Errorf("expected 3s pause, got %s", wait)
+	}
+}
+
+func TestRateLimit_SharedAcrossGoroutines(t *testing.T) {
+	var mu sync.Mutex
+	var sent []time.Time
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		sent = append(sent, time.Now())
+		mu.Unlock()
+		return response(http.StatusOK), nil
+	})
+	rt := NewRateLimit(base, 100, 2)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Go(func() {
+			req, _ := http.NewRequest(http.MethodGet, "https://tasks.example/", nil)
+			if _, err := rt.RoundTrip(req); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	// 2 at once, then 4 more at 10ms intervals
+	if len(sent) != 6 {
+		t.Fatalf("expected 6 requests, got %d", len(sent))
+	}
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("expected the limiter to spread requests over 40ms, took %s", elapsed)
+	}
+}
+
+func TestRateLimit_PausesOnTooManyRequests(t *testing.T) {
+	calls := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls == 1 {
+			resp := response(http.StatusTooManyRequests)
+			resp.Header = http.Header{"Retry-After": {"1"}}
+			return resp, nil
+		}
+		return response(http.StatusOK), nil
+	})
+	var buf bytes.Buffer
+	stats := &Stats{}
+	rt := NewLog(NewRateLimit(base, 1000, 10), slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})), stats)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://tasks.example/", nil)
+	if resp, _ := rt.RoundTrip(req); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", resp.StatusCode)
+	}
+
+	// The next request waits out Retry-After, or fails at its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, "https://tasks.example/", nil)
+	if _, err := rt.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the request to wait for the quota, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected no request during the pause, got %d", calls)
+	}
+
+	start := time.Now()
+	req, _ = http.NewRequest(http.MethodGet, "https://tasks.example/", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 800*time.Millisecond {
+		t.Errorf("expected to wait about 1s, waited %s", waited)
+	}
+	if !strings.Contains(buf.String(), "throttled=") {
+		t.Errorf("expected throttled request in log: %s", buf.String())
+	}
+	attrs := stats.Attrs()
+	if attrs[1] != 3 || attrs[7] != 1 {
+		t.Errorf("expected 3 calls, 1 throttled, got %v", attrs)
+	}
+}
+
+func TestRateLimit_PausesOnQuota403(t *testing.T) {
+	tests := []struct {
+		body  string
+		pause bool
+	}{
+		{`{"error": {"code": 403, "errors": [{"reason": "rateLimitExceeded"}]}}`, true},
+		{`{"error": {"code": 403, "errors": [{"reason": "userRateLimitExceeded"}]}}`, true},
+		{`{"error": {"code": 403, "errors": [{"reason": "insufficientPermissions"}]}}`, false},
+		{`forbidden`, false},
+	}
+	for _, tt := range tests {
+		base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			resp := response(http.StatusForbidden)
+			resp.Header = http.Header{"Retry-After": {"5"}}
+			resp.Body = io.NopCloser(strings.NewReader(tt.body))
+			return resp, nil
+		})
+		rt := NewRateLimit(base, 1000, 10)
+		req, _ := http.NewRequest(http.MethodGet, "https://tasks.example/", nil)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The caller still gets the whole body
+		if got, _ := io.ReadAll(resp.Body); string(got) != tt.body {
+			t.Errorf("expected body %q, got %q", tt.body, got)
+		}
+		if paused := rt.Limiter.reserve() > time.Second; paused != tt.pause {
+			t.Errorf("%s: expected pause %v, got %v", tt.body, tt.pause, paused)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", DefaultQuotaPause},
+		{"5", 5 * time.Second},
+		{"soon", DefaultQuotaPause},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", DefaultQuotaPause}, // in the past
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.header); got != tt.want {
+			t.Errorf("retryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
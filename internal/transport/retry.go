@@ -0,0 +1,102 @@
+// Package transport provides http.RoundTripper middleware shared by the
+// HTTP backends.
+package transport
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultRetryDelay is the delay before the first retry. It doubles with
+// every further attempt.
+const DefaultRetryDelay = 250 * time.Millisecond
+
+// Retry retries read requests that failed with a network error or a
+// temporary server status (429, 500, 502, 503, 504, or a 403 whose error
+// reason is a quota, see IsQuotaReason). Changes are sent
+// once: a repeated create would duplicate the task, and a repeated delete
+// or conditional update would fail if the first attempt got through.
+type Retry struct {
+	// Base sends the requests. Nil means http.DefaultTransport.
+	Base http.RoundTripper
+
+	// Retries is the number of additional attempts.
+	Retries int
+
+	// Delay before the first retry (default DefaultRetryDelay).
+	Delay time.Duration
+}
+
+// NewRetry wraps base with up to retries additional attempts.
+func NewRetry(base http.RoundTripper, retries int) *Retry {
+	return &Retry{Base: base, Retries: retries}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Retry) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.Retries <= 0 || !retryable(req) {
+		return base.RoundTrip(req)
+	}
+
+	delay := t.Delay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 {
+			countRetry(req.Context(), attempt)
+		}
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		resp, err := base.RoundTrip(r)
+		if attempt == t.Retries || !temporary(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		delay *= 2
+	}
+}
+
+// retryable reports whether req may be sent again.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "REPORT":
+		return req.Body == nil || req.GetBody != nil
+	}
+	return false
+}
+
+// temporary reports whether a failed attempt is worth repeating.
+func temporary(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusForbidden:
+		return quotaExceeded(resp)
+	}
+	return false
+}
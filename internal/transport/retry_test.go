@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func response(status int) *http.Response {
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(""))}
+}
+
+func TestRetry_RetriesTemporaryFailures(t *testing.T) {
+	attempts := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		switch attempts {
+		case 1:
+			return nil, errors.New("connection reset by peer")
+		case 2:
+			return response(http.StatusServiceUnavailable), nil
+		}
+		return response(http.StatusOK), nil
+	})
+	rt := &Retry{Base: base, Retries: 2, Delay: 1}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected success after retries, got %v, %v", resp, err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetry_RetriesQuota403(t *testing.T) {
+	tests := []struct {
+		body     string
+		attempts int
+	}{
+		{`{"error": {"code": 403, "errors": [{"reason": "rateLimitExceeded"}]}}`, 2},
+		{`{"error": {"code": 403, "errors": [{"reason": "userRateLimitExceeded"}]}}`, 2},
+		{`{"error": {"code": 403, "errors": [{"reason": "insufficientPermissions"}]}}`, 1},
+	}
+	for _, tt := range tests {
+		attempts := 0
+		base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			if attempts == 1 {
+				resp := response(http.StatusForbidden)
+				resp.Body = io.NopCloser(strings.NewReader(tt.body))
+				return resp, nil
+			}
+			return response(http.StatusOK), nil
+		})
+		rt := &Retry{Base: base, Retries: 2, Delay: 1}
+
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		if attempts != tt.attempts {
+			t.Errorf("%s: expected %d attempts, got %d", tt.body, tt.attempts, attempts)
+		}
+	}
+}
+
+func TestRetry_GivesUpAfterRetries(t *testing.T) {
+	attempts := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return response(http.StatusBadGateway), nil
+	})
+	rt := &Retry{Base: base, Retries: 1, Delay: 1}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected the last response, got %v, %v", resp, err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestRetry_SendsChangesOnce(t *testing.T) {
+	for _, method := range []string{http.MethodPost, http.MethodPatch, http.MethodPut, http.MethodDelete} {
+		attempts := 0
+		base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			return response(http.StatusServiceUnavailable), nil
+		})
+		rt := &Retry{Base: base, Retries: 3, Delay: 1}
+
+		req, _ := http.NewRequest(method, "http://example.com/", strings.NewReader("{}"))
+		rt.RoundTrip(req)
+		if attempts != 1 {
+			t.Errorf("%s: expected 1 attempt, got %d", method, attempts)
+		}
+	}
+}
+
+func TestRetry_ResendsBody(t *testing.T) {
+	var bodies []string
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		data, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(data))
+		if len(bodies) == 1 {
+			return response(http.StatusTooManyRequests), nil
+		}
+		return response(http.StatusMultiStatus), nil
+	})
+	rt := &Retry{Base: base, Retries: 1, Delay: 1}
+
+	req, _ := http.NewRequest("REPORT", "http://example.com/", strings.NewReader("<query/>"))
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 || bodies[1] != "<query/>" {
+		t.Errorf("expected the body on both attempts, got %q", bodies)
+	}
+}